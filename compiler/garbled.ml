@@ -29,6 +29,8 @@ let rec bpr_go_value b is_gen (typ, value) =
       bprintf b "%sUint(vm, %d, %d)" pkg (State.bl_num bl) (State.get_bl_bits())
   | Int x ->
       bprintf b "%sInt(vm, %s, %d)" pkg (Big_int.string_of_big_int x) (State.bitwidth typ)
+  | Float x ->
+      bprintf b "%sUint(vm, %s, %d)" pkg (State.float_bits typ x) (State.bitwidth typ)
   | Zero ->
       bprintf b "%sUint(vm, 0, %d) /* CAUTION: zero */" pkg (State.bitwidth typ)
   | Null ->
@@ -41,6 +43,76 @@ let rec bpr_go_value b is_gen (typ, value) =
   | op ->
       bpr_value b op
 
+(* The runtime function for a bit-counting intrinsic of LLVM, such as llvm.ctpop.i32 *)
+let count_intrinsic f =
+  let has_prefix p = String.length f > String.length p && String.sub f 0 (String.length p) = p in
+  if has_prefix "llvm.ctpop." then Some "Popcount"
+  else if has_prefix "llvm.ctlz." then Some "Ctlz"
+  else if has_prefix "llvm.cttz." then Some "Cttz"
+  else None
+
+(* The runtime function for an extern fixed-point function of C; fixl_ is for long long *)
+let fixed_point_function = function
+  | "fix_mul" | "fixl_mul" -> Some "FixMul"
+  | "fix_mulr" | "fixl_mulr" -> Some "FixMulRound"
+  | "fix_div" | "fixl_div" -> Some "FixDiv"
+  | "fix_recip" | "fixl_recip" -> Some "FixRecip"
+  | "fix_sqrt" | "fixl_sqrt" -> Some "FixSqrt"
+  | "fix_exp" | "fixl_exp" -> Some "FixExp"
+  | "fix_log" | "fixl_log" -> Some "FixLog"
+  | "fix_sigmoid" | "fixl_sigmoid" -> Some "FixSigmoid"
+  | _ -> None
+
+(* The operands of a call of a fixed-point function, and its fractional width, which must be a constant *)
+let fixed_point_args f args =
+  match List.rev args with
+  | (_,_,Int frac)::rev_ops ->
+      (List.rev_map (fun (a,b,c) -> (a,c)) rev_ops, Big_int.int_of_big_int frac)
+  | _ -> failwith (sprintf "Error: the last argument of %s must be a constant fractional width" f)
+
+(* The runtime function for an extern oblivious array function of C, on unsigned ints *)
+let oblivious_function = function
+  | "oblivious_sort" -> Some "SortMemory"
+  | "oblivious_shuffle" -> Some "ShuffleMemory"
+  | _ -> None
+
+(* The array of a call of an oblivious array function, and its length, which must be a constant *)
+let oblivious_args f args =
+  if options.oram then
+    failwith (sprintf "Error: %s is not supported with -oram" f);
+  match args with
+  | [(typ,_,x);(_,_,Int n)] -> ((typ,x), Big_int.int_of_big_int n)
+  | _ -> failwith (sprintf "Error: the length argument of %s must be a constant" f)
+
+(* The runtime function for an extern cryptographic function of C, and which of its arguments must be constants;
+   the others are pointers to bytes in memory, but for the block counter of ChaCha20 *)
+let crypto_function = function
+  | "aes128_encrypt" -> Some ("AES128Memory", [false; false; false])
+  | "aes256_encrypt" -> Some ("AES256Memory", [false; false; false])
+  | "sha256_digest" -> Some ("SHA256Memory", [false; false; true])
+  | "sha1_digest" -> Some ("SHA1Memory", [false; false; true])
+  | "chacha20_block" -> Some ("ChaCha20Memory", [false; false; false; false])
+  | _ -> None
+
+(* The arguments of a call of a cryptographic function, each paired with whether it must be a constant *)
+let crypto_args f args =
+  if options.oram then
+    failwith (sprintf "Error: %s is not supported with -oram" f);
+  match crypto_function f with
+  | Some (_, consts) when List.length consts = List.length args ->
+      List.map2
+        (fun const (typ,_,x) ->
+          match const, x with
+          | true, Int _ | false, _ -> (const, (typ,x))
+          | true, _ -> failwith (sprintf "Error: the length argument of %s must be a constant" f))
+        consts args
+  | _ -> failwith (sprintf "Error: wrong number of arguments to %s" f)
+
+(* An argument of a call of a cryptographic function, printed by bpr_value unless it is a constant *)
+let bpr_crypto_arg bpr_value b = function
+  | true, (_, Int n) -> bprintf b "%s" (Big_int.string_of_big_int n)
+  | _, x -> bpr_value b x
+
 let bpr_go_instr b is_gen declared_vars (nopt,i) =
   let pkg = if is_gen then "gen." else "eval." in
   let bpr_go_value = (fun b -> bpr_go_value b is_gen) in
@@ -50,6 +122,8 @@ let bpr_go_instr b is_gen declared_vars (nopt,i) =
   let unused =
     (match i with
     | Call(_,_,_,_,Var(Name(true, ("printf" | "puts" | "putchar"))),_,_,_) -> true
+    | Call(_,_,_,_,Var(Name(true, f)),_,_,_) when oblivious_function f <> None -> true
+    | Call(_,_,_,_,Var(Name(true, f)),_,_,_) when crypto_function f <> None -> true
     | Store _ -> true
     | _ -> false) in
   (* Go does not permit re-declaration: in var := expr, var must be a new variable.
@@ -99,6 +173,28 @@ let bpr_go_instr b is_gen declared_vars (nopt,i) =
   | Call(_,_,_,_,Var(Name(true, "selectbit")),[(ty,_,Var v);(_,_,Int l)],_,_) ->
       let bitnum = Big_int.int_of_big_int l in
       bprintf b "%s[%d:%d]\n" (govar v) bitnum (bitnum+1)
+  | Call(_,_,_,_,Var(Name(true, f)),(typ,_,x)::_,_,_) when count_intrinsic f <> None ->
+      (* the flag of ctlz and cttz is ignored: they give the width for 0 either way *)
+      (match count_intrinsic f with
+      | Some g -> bprintf b "%s%s(vm, %a)\n" pkg g bpr_go_value (typ, x)
+      | None -> failwith "count_intrinsic")
+  | Call(_,_,_,_,Var(Name(true, f)),args,_,_) when fixed_point_function f <> None ->
+      let ops, frac = fixed_point_args f args in
+      (match fixed_point_function f with
+      | Some g -> bprintf b "%s%s(vm, %a, %d)\n" pkg g (between ", " bpr_go_value) ops frac
+      | None -> failwith "fixed_point_function")
+  | Call(_,_,_,_,Var(Name(true, "oblivious_shuffle")),_,_,_) ->
+      (* memory is the generator's, who would see the shuffled array, and so the permutation *)
+      failwith "Error: oblivious_shuffle needs shared memory, as in GMW, and is not supported in the garbled circuit back ends"
+  | Call(_,_,_,_,Var(Name(true, f)),args,_,_) when oblivious_function f <> None ->
+      let a, n = oblivious_args f args in
+      (match oblivious_function f with
+      | Some g -> bprintf b "%s%s(vm, mask, %a, %d)\n" pkg g bpr_go_value a n
+      | None -> failwith "oblivious_function")
+  | Call(_,_,_,_,Var(Name(true, f)),args,_,_) when crypto_function f <> None ->
+      (match crypto_function f with
+      | Some (g, _) -> bprintf b "%s%s(vm, mask, %a)\n" pkg g (between ", " (bpr_crypto_arg bpr_go_value)) (crypto_args f args)
+      | None -> failwith "crypto_function")
   | Call(_,_,_,_,Var(Name(true, "llvm.lifetime.start")),_,_,_) ->
       ()
   | Call(_,_,_,_,Var(Name(true, "llvm.lifetime.end")),_,_,_) ->
@@ -143,10 +239,24 @@ let bpr_go_instr b is_gen declared_vars (nopt,i) =
   | Shl(_,_,tv,Int y,_) ->
       let shift_bits = Big_int.int_of_big_int y in
       bprintf b "%sShl(vm, %a, %d)\n" pkg bpr_go_value tv shift_bits
+  | Lshr(_,(typ,x),y,_) ->
+      bprintf b "%sLshrV(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
+  | Ashr(_,(typ,x),y,_) ->
+      bprintf b "%sAshrV(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
+  | Shl(_,_,(typ,x),y,_) ->
+      bprintf b "%sShlV(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
   | Add(_,_,(typ,x),y,_) ->
       bprintf b "%sAdd(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
   | Sub(_,_,(typ,x),y,_) ->
       bprintf b "%sSub(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
+  | Udiv(_,(typ,x),y,_) ->
+      bprintf b "%sUdiv(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
+  | Sdiv(_,(typ,x),y,_) ->
+      bprintf b "%sSdiv(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
+  | Urem((typ,x),y,_) ->
+      bprintf b "%sUrem(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
+  | Srem((typ,x),y,_) ->
+      bprintf b "%sSrem(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
   | And((typ,x),y,_) ->
       bprintf b "%sAnd(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
   | Or((typ,x),y,_) ->
@@ -157,6 +267,30 @@ let bpr_go_instr b is_gen declared_vars (nopt,i) =
       bprintf b "%sIcmp_%a(vm, %a, %a)\n" pkg
         bpr_icmp pred
         bpr_go_value (typ,x) bpr_go_value (typ,y)
+  | Fadd(_,(typ,x),y,_) ->
+      bprintf b "%sFadd(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
+  | Fsub(_,(typ,x),y,_) ->
+      bprintf b "%sFsub(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
+  | Fmul(_,(typ,x),y,_) ->
+      bprintf b "%sFmul(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
+  | Fdiv(_,(typ,x),y,_) ->
+      bprintf b "%sFdiv(vm, %a, %a)\n" pkg bpr_go_value (typ,x) bpr_go_value (typ,y)
+  | Fcmp(pred,(typ,x),y,_) ->
+      bprintf b "%sFcmp_%a(vm, %a, %a)\n" pkg
+        bpr_fcmp pred
+        bpr_go_value (typ,x) bpr_go_value (typ,y)
+  | Sitofp(tv,t,_) ->
+      bprintf b "%sSitofp(vm, %a, %d)\n" pkg bpr_go_value tv (State.bitwidth t)
+  | Uitofp(tv,t,_) ->
+      bprintf b "%sUitofp(vm, %a, %d)\n" pkg bpr_go_value tv (State.bitwidth t)
+  | Fptosi(tv,t,_) ->
+      bprintf b "%sFptosi(vm, %a, %d)\n" pkg bpr_go_value tv (State.bitwidth t)
+  | Fptoui(tv,t,_) ->
+      bprintf b "%sFptoui(vm, %a, %d)\n" pkg bpr_go_value tv (State.bitwidth t)
+  | Fpext(tv,t,_) ->
+      bprintf b "%sFpext(vm, %a, %d)\n" pkg bpr_go_value tv (State.bitwidth t)
+  | Fptrunc(tv,t,_) ->
+      bprintf b "%sFptrunc(vm, %a, %d)\n" pkg bpr_go_value tv (State.bitwidth t)
 (*  | AssignInst(result_ty, [(ty,op)]) (* special instruction inserted by our compiler *) *)
   | Inttoptr((ty,op), result_ty,_) ->
       let bits_result = State.bitwidth result_ty in
@@ -233,12 +367,12 @@ let bpr_go_block b blocks_fv is_gen bl =
     bprintf b "\t%sPrintf(vm, mask, \"Block %d\\n\")\n" pkg (State.bl_num bl.bname);
   ignore(List.fold_left (bpr_go_instr b is_gen) (free_of_block bl) bl.binstrs);
   if not(VSet.is_empty outputs) then begin
-    if not(VSet.is_empty (VSet.diff outputs State.V.special)) then
-      bprintf b "\tch <- mask\n";
+    (* outputs are sent unmasked; the main loop muxes them by mask *)
+    bprintf b "\tch <- mask\n";
     VSet.iter
       (fun var ->
         let value = Var var in
-        bprintf b "\tch <- %sMask(vm, mask, %a)\n" pkg bpr_go_value (State.typ_of_var var, value))
+        bprintf b "\tch <- %a\n" bpr_go_value (State.typ_of_var var, value))
       outputs
   end;
   bprintf b "}\n"
@@ -248,14 +382,21 @@ let bpr_main b f is_gen =
   let blocks = f.fblocks in
   let blocks_fv = List.fold_left VSet.union VSet.empty
       (List.map free_of_block blocks) in
+  let loads = VSet.mem State.V.vMemRes blocks_fv in
+  let stores = VSet.mem State.V.vMemVal (outputs_of_blocks blocks) in
+  (* the memory is a variable of main, so that each run has its own *)
+  let mem = if options.oram && (loads || stores) then "mem := " else "" in
   bprintf b "func %s_main(vms []%sVM) {\n" (gen_or_eval is_gen) pkg;
   bprintf b "\n";
   if is_gen then
-    bprintf b "\tinitialize_ram(vms[0])\n\n";
+    bprintf b "\t%sinitialize_ram(vms[0])\n\n" mem
+  else if options.oram && (!State.loc <> 0 || mem <> "") then
+    bprintf b "\t%seval.InitMemory(vms[0], 0x%x)\n\n" mem !State.loc;
   bprintf b "\t/* create output channels */\n";
   List.iter
     (fun bl ->
-      let capacity = VSet.cardinal(outputs_of_block blocks_fv bl) in
+      (* room for the mask and every output, so that a block never waits on a main that has given up *)
+      let capacity = VSet.cardinal(outputs_of_block blocks_fv bl) + 1 in
       bprintf b "\tch%d := make(chan []%s, %d)\n" (State.bl_num bl.bname) (bit_type is_gen) capacity
       )
     blocks;
@@ -299,7 +440,7 @@ let bpr_main b f is_gen =
   List.iter
     (fun bl ->
       let outputs = outputs_of_block blocks_fv bl in
-      if not(VSet.is_empty (VSet.diff outputs State.V.special)) then
+      if not(VSet.is_empty outputs) then
         bprintf b "\t\tmask_%d := <-ch%d\n" (State.bl_num bl.bname) (State.bl_num bl.bname);
       VSet.iter
         (fun var ->
@@ -312,24 +453,31 @@ let bpr_main b f is_gen =
   VSet.iter
     (fun var ->
       let sources = List.filter (fun bl -> VSet.mem var (outputs_of_block blocks_fv bl)) blocks in
-      if VSet.mem var State.V.special then
-        (* specials are assigned 0 unless the active block assigned them *)
-        bprintf b "\t\t%s = %sTreeXor(vms[0], %s)\n"
-          (govar var)
-          pkg
-          (String.concat ", " (List.map (fun bl -> sprintf "%s_%d" (govar var) (State.bl_num bl.bname)) sources))
-      else
-        (* non-specials keep their value from before the blocks unless the active block assigned them *)
-        bprintf b "\t\t%s = %sSelect(vms[0], %sTreeXor(vms[0], %s), %sTreeXor(vms[0], %s), %s)\n"
-          (govar var)
-          pkg
-          pkg
-          (String.concat ", " (List.map (fun bl -> sprintf "mask_%d" (State.bl_num bl.bname)) sources))
-          pkg
-          (String.concat ", " (List.map (fun bl -> sprintf "%s_%d" (govar var) (State.bl_num bl.bname)) sources))
-          (govar var))
+      let dflt =
+        if VSet.mem var State.V.special then
+          (* specials are assigned 0 unless the active block assigned them *)
+          sprintf "%sUint(vms[0], 0, %d)" pkg (State.bitwidth (State.typ_of_var var))
+        else
+          (* non-specials keep their value from before the blocks unless the active block assigned them *)
+          govar var in
+      bprintf b "\t\t%s = %sMuxHot(vms[0], []%s{%s}, %s, %s)\n"
+        (govar var)
+        pkg
+        (bit_type is_gen)
+        (String.concat ", " (List.map (fun bl -> sprintf "mask_%d[0]" (State.bl_num bl.bname)) sources))
+        dflt
+        (String.concat ", " (List.map (fun bl -> sprintf "%s_%d" (govar var) (State.bl_num bl.bname)) sources)))
     (outputs_of_blocks blocks);
-  if VSet.mem State.V.vMemRes blocks_fv then begin
+  if options.oram && (loads || stores) then begin
+    (* One oblivious access per iteration, whether or not a block loads or stores *)
+    bprintf b "\n";
+    bprintf b "\t\t/* access memory */\n";
+    bprintf b "\t\t%s%sMemAccess(vms[0], mem, _vMemAct, _vMemLoc, _vMemSize, %s)\n"
+      (if loads then "_vMemRes = " else "")
+      pkg
+      (if stores then "_vMemVal" else sprintf "%sUint(vms[0], 0, 32)" pkg)
+  end;
+  if not options.oram && loads then begin
     (* We need to load from memory iff some block uses vMemRes *)
     bprintf b "\n";
     bprintf b "\t\t/* load from memory if necessary */\n";
@@ -337,7 +485,7 @@ let bpr_main b f is_gen =
     bprintf b "\t\t\t_vMemRes = %sLoad(vms[0], _vMemLoc, _vMemSize)\n" pkg;
     bprintf b "\t\t}\n";
   end;
-  if VSet.mem State.V.vMemVal (outputs_of_blocks blocks) then begin
+  if not options.oram && stores then begin
     (* We need to store to memory iff some block assigns vMemVal *)
     bprintf b "\n";
     bprintf b "\t\t/* store to memory if necessary */\n";
@@ -413,12 +561,17 @@ let bpr_globals b m is_gen =
               Hashtbl.add string_constants loc s
         | _ -> ()) in
   List.iter pr_global m.cglobals;
-  bprintf b "func initialize_ram(vm %sVM) {\n" pkg;
+  (* with -oram the memory is returned, to be kept by main *)
+  bprintf b "func initialize_ram(vm %sVM)%s {\n" pkg (if options.oram then " " ^ pkg ^ "ORam" else "");
   if !State.loc <> 0 then begin
     bprintf b "\tram := make([]byte, 0x%x)\n" !State.loc;
     Buffer.add_buffer b b1;
-    bprintf b "\t%sInitRam(ram)\n" pkg;
-  end;
+    if options.oram then
+      bprintf b "\treturn %sInitMemory(vm, ram)\n" pkg
+    else
+      bprintf b "\t%sInitRam(vm, ram)\n" pkg;
+  end else if options.oram then
+    bprintf b "\treturn nil\n";
   bprintf b "}\n";
   bprintf b "\n"
 
@@ -446,6 +599,9 @@ let print_function_circuit m f =
   bprintf b "\n";
   (* main function *)
   bprintf b "func main() {\n";
+  (match options.circuitlib with
+  | Some lib -> bprintf b "\truntime.CircuitLib = \"%s\"\n" lib
+  | None -> ());
   bprintf b "\truntime.Run(%d, gen_main, eval_main)\n" (List.length f.fblocks);
   bprintf b "}\n";
   pr_output_file ".go" (Buffer.contents b)
@@ -15,6 +15,13 @@ let roundup_bitwidth typ =
     w'
   end
 
+(* a literal as a public operand, not a share *)
+let bpr_public b (typ, x) =
+  if Big_int.sign_big_int x < 0 then
+    bprintf b "(1<<%d)%s" (roundup_bitwidth typ) (Big_int.string_of_big_int x)
+  else
+    bprintf b "%s" (Big_int.string_of_big_int x)
+
 let rec bpr_gmw_value b (typ, value) =
   match value with
   | Var v ->
@@ -36,6 +43,8 @@ let rec bpr_gmw_value b (typ, value) =
         bprintf b "Uint%d(io, (1<<%d)%s)" (roundup_bitwidth typ) (roundup_bitwidth typ) (Big_int.string_of_big_int x)
       else
         bprintf b "Uint%d(io, %s)" (roundup_bitwidth typ) (Big_int.string_of_big_int x)
+  | Float x ->
+      bprintf b "Uint%d(io, %s)" (roundup_bitwidth typ) (State.float_bits typ x)
   | Zero ->
       bprintf b "Uint%d(io, 0) /* CAUTION: zero */" (roundup_bitwidth typ)
   | Null ->
@@ -55,6 +64,8 @@ let bpr_gmw_instr b declared_vars (nopt,i) =
   let unused =
     (match i with
     | Call(_,_,_,_,Var(Name(true, ("printf" | "puts" | "putchar"))),_,_,_) -> true
+    | Call(_,_,_,_,Var(Name(true, f)),_,_,_) when Garbled.oblivious_function f <> None -> true
+    | Call(_,_,_,_,Var(Name(true, f)),_,_,_) when Garbled.crypto_function f <> None -> true
     | Store _ -> true
     | _ -> false) in
   (* Go does not permit re-declaration: in var := expr, var must be a new variable.
@@ -109,6 +120,25 @@ let bpr_gmw_instr b declared_vars (nopt,i) =
   | Call(_,_,_,_,Var(Name(true, "selectbit")),[(ty,_,Var v);(_,_,Int l)],_,_) ->
       let bitnum = Big_int.int_of_big_int l in
       bprintf b "((%s >> %d) & 1) > 0\n" (Garbled.govar v) bitnum
+  | Call(_,_,_,_,Var(Name(true, f)),(typ,_,x)::_,_,_) when Garbled.count_intrinsic f <> None ->
+      (match Garbled.count_intrinsic f with
+      | Some g -> bprintf b "%s%d(io, %a)\n" g (roundup_bitwidth typ) bpr_gmw_value (typ, x)
+      | None -> failwith "count_intrinsic")
+  | Call(_,_,_,_,Var(Name(true, f)),args,_,_) when Garbled.fixed_point_function f <> None ->
+      let ops, frac = Garbled.fixed_point_args f args in
+      (match Garbled.fixed_point_function f, ops with
+      | Some g, (typ,_)::_ ->
+          bprintf b "%s%d(io, %a, %d)\n" g (roundup_bitwidth typ) (between ", " bpr_gmw_value) ops frac
+      | _ -> failwith (sprintf "Error: %s needs an operand" f))
+  | Call(_,_,_,_,Var(Name(true, f)),args,_,_) when Garbled.oblivious_function f <> None ->
+      let a, n = Garbled.oblivious_args f args in
+      (match Garbled.oblivious_function f with
+      | Some g -> bprintf b "%s(io, mask, %a, %d)\n" g bpr_gmw_value a n
+      | None -> failwith "oblivious_function")
+  | Call(_,_,_,_,Var(Name(true, f)),args,_,_) when Garbled.crypto_function f <> None ->
+      (match Garbled.crypto_function f with
+      | Some (g, _) -> bprintf b "%s(io, mask, %a)\n" g (between ", " (Garbled.bpr_crypto_arg bpr_gmw_value)) (Garbled.crypto_args f args)
+      | None -> failwith "crypto_function")
   | Call(_,_,_,_,Var(Name(true, "llvm.lifetime.start")),_,_,_) ->
       ()
   | Call(_,_,_,_,Var(Name(true, "llvm.lifetime.end")),_,_,_) ->
@@ -135,7 +165,7 @@ let bpr_gmw_instr b declared_vars (nopt,i) =
       |  64 -> bprintf b "Shl%d(io, %a, %d)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) 6
       | 128 -> bprintf b "Shl%d(io, %a, %d)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) 7
       | 256 -> bprintf b "Shl%d(io, %a, %d)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) 8
-      | _   -> bprintf b "Mul%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,Int y))
+      | _   -> bprintf b "MulPublic%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_public (typ,y))
   | Mul(_,_,(typ,x),y,_) ->
       bprintf b "Mul%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
   | Lshr(_,(typ,x),Int y,_) ->
@@ -147,10 +177,29 @@ let bpr_gmw_instr b declared_vars (nopt,i) =
   | Shl(_,_,(typ,x),Int y,_) ->
       let shift_bits = Big_int.int_of_big_int y in
       bprintf b "Shl%d(io, %a, %d)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) shift_bits
+  | Lshr(_,(typ,x),y,_) ->
+      bprintf b "LshrV%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  | Ashr(_,(typ,x),y,_) ->
+      bprintf b "AshrV%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  | Shl(_,_,(typ,x),y,_) ->
+      bprintf b "ShlV%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
   | Add(_,_,(typ,x),y,_) ->
       bprintf b "Add%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
   | Sub(_,_,(typ,x),y,_) ->
       bprintf b "Sub%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  | Udiv(_,(typ,x),y,_) ->
+      bprintf b "Udiv%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  | Sdiv(_,(typ,x),y,_) ->
+      bprintf b "Sdiv%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  | Urem((typ,x),y,_) ->
+      bprintf b "Urem%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  | Srem((typ,x),y,_) ->
+      bprintf b "Srem%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  (* an AND or OR with a literal is computed locally, see runtime/gmw/public.go *)
+  | And((typ,x),(Int y),_) when roundup_bitwidth typ > 1 ->
+      bprintf b "AndPublic%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_public (typ,y)
+  | Or((typ,x),(Int y),_) when roundup_bitwidth typ > 1 ->
+      bprintf b "OrPublic%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_public (typ,y)
   | And((typ,x),y,_) ->
       bprintf b "And%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
   | Or((typ,x),y,_) ->
@@ -162,6 +211,31 @@ let bpr_gmw_instr b declared_vars (nopt,i) =
         bpr_icmp pred
         (roundup_bitwidth typ)
         bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  | Fadd(_,(typ,x),y,_) ->
+      bprintf b "Fadd%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  | Fsub(_,(typ,x),y,_) ->
+      bprintf b "Fsub%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  | Fmul(_,(typ,x),y,_) ->
+      bprintf b "Fmul%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  | Fdiv(_,(typ,x),y,_) ->
+      bprintf b "Fdiv%d(io, %a, %a)\n" (roundup_bitwidth typ) bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  | Fcmp(pred,(typ,x),y,_) ->
+      bprintf b "Fcmp_%a%d(io, %a, %a)\n"
+        bpr_fcmp pred
+        (roundup_bitwidth typ)
+        bpr_gmw_value (typ,x) bpr_gmw_value (typ,y)
+  | Sitofp((typ,x),t,_) ->
+      bprintf b "Sitofp%d_%d(io, %a)\n" (roundup_bitwidth typ) (roundup_bitwidth t) bpr_gmw_value (typ,x)
+  | Uitofp((typ,x),t,_) ->
+      bprintf b "Uitofp%d_%d(io, %a)\n" (roundup_bitwidth typ) (roundup_bitwidth t) bpr_gmw_value (typ,x)
+  | Fptosi((typ,x),t,_) ->
+      bprintf b "Fptosi%d_%d(io, %a)\n" (roundup_bitwidth typ) (roundup_bitwidth t) bpr_gmw_value (typ,x)
+  | Fptoui((typ,x),t,_) ->
+      bprintf b "Fptoui%d_%d(io, %a)\n" (roundup_bitwidth typ) (roundup_bitwidth t) bpr_gmw_value (typ,x)
+  | Fpext((typ,x),t,_) ->
+      bprintf b "Fpext%d_%d(io, %a)\n" (roundup_bitwidth typ) (roundup_bitwidth t) bpr_gmw_value (typ,x)
+  | Fptrunc((typ,x),t,_) ->
+      bprintf b "Fptrunc%d_%d(io, %a)\n" (roundup_bitwidth typ) (roundup_bitwidth t) bpr_gmw_value (typ,x)
 (*  | AssignInst(result_ty, [(ty,op)]) (* special instruction inserted by our compiler *) *)
   | Inttoptr((ty,op), result_ty,_) ->
       let bits_result = roundup_bitwidth result_ty in
@@ -359,7 +433,17 @@ let bpr_main b f =
           (String.concat ", " (List.map (fun bl -> sprintf "mask_%d" (State.bl_num bl.bname)) sources))
           (Garbled.govar var))
     (outputs_of_blocks blocks);
-  if VSet.mem State.V.vMemRes blocks_fv then begin
+  let loads = VSet.mem State.V.vMemRes blocks_fv in
+  let stores = VSet.mem State.V.vMemVal (outputs_of_blocks blocks) in
+  if options.oram && (loads || stores) then begin
+    (* One oblivious access per iteration, whether or not a block loads or stores *)
+    bprintf b "\n";
+    bprintf b "\t\t/* access memory */\n";
+    bprintf b "\t\t%sMemAccess(io, _vMemAct, _vMemLoc, _vMemSize, %s)\n"
+      (if loads then "_vMemRes = " else "")
+      (if stores then "_vMemVal" else "Uint32(io, 0)")
+  end;
+  if not options.oram && loads then begin
     (* We need to load from memory iff some block uses vMemRes *)
     bprintf b "\n";
     bprintf b "\t\t/* load from memory if necessary */\n";
@@ -367,7 +451,7 @@ let bpr_main b f =
     bprintf b "\t\t\t_vMemRes = Load(io, _vMemLoc, _vMemSize)\n";
     bprintf b "\t\t}\n";
   end;
-  if VSet.mem State.V.vMemVal (outputs_of_blocks blocks) then begin
+  if not options.oram && stores then begin
     (* We need to store to memory iff some block assigns vMemVal *)
     bprintf b "\n";
     bprintf b "\t\t/* store to memory if necessary */\n";
@@ -447,7 +531,10 @@ let bpr_globals b m =
   if !State.loc <> 0 then begin
     bprintf b "\tram := make([]byte, 0x%x)\n" !State.loc;
     Buffer.add_buffer b b1;
-    bprintf b "\tio.InitRam(ram)\n";
+    if options.oram then
+      bprintf b "\tInitMemory(io, ram)\n"
+    else
+      bprintf b "\tio.InitRam(ram)\n";
   end;
   bprintf b "}\n";
   bprintf b "\n"
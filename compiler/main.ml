@@ -785,6 +785,7 @@ begin
   let (x,args) = getopt "-keep-cil" args         in options.keep_cil <- x;
   let (x,args) = getopt "-delta" args            in options.delta <- x;
   let (x,args) = getopt1 "-circuitlib" args      in options.circuitlib <- x;
+  let (x,args) = getopt "-oram" args             in options.oram <- x;
   let (x,args) = getopt1 "-fname" args           in options.fname <- x;
   let (x,args) = getopt1 "-o" args               in options.output <- x;
   let (x,args) = getopt "-fv" args               in options.fv <- x;
@@ -814,6 +815,7 @@ begin
      printf "         -no-cil                     Do not run cil transformation (flattening)\n";
      printf "         -delta                      Delta printing\n";
      printf "         -circuitlib <lib>           Specify the circuit library (default is yao)\n";
+     printf "         -oram                       Keep memory in an oblivious RAM\n";
      printf "         -fname <function name>      Specify the function to compile (default is first function)\n";
      printf "         -o <file name>              Specify the output file (default is standard out)\n";
      printf "         -run                        Compile and run the program immediately\n";
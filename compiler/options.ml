@@ -7,6 +7,7 @@ type options = {
     mutable keep_cil: bool;
     mutable delta: bool;
     mutable circuitlib: string option;
+    mutable oram: bool;
     mutable fname: string option;
     mutable output: string option;
     mutable fv: bool;
@@ -31,6 +32,7 @@ let options = {
   keep_cil = false;
   delta = false;
   circuitlib = None;
+  oram = false;
   fname = None;
   output = None;
   fv = false;
@@ -281,6 +281,17 @@ let bytewidth ty =
   if (bits mod 8) <> 0 then Printf.eprintf "Warning: bitwidth not divisible by 8";
   bits/8 + (if (bits mod 8) <> 0 then 1 else 0)
 
+(* The bits of a floating-point constant of type typ, in decimal.  LLVM
+   writes a constant as a decimal or as the hex bits of a double, even
+   for a float. *)
+let float_bits (typ : Llabs.typ) s =
+  let x =
+    if String.length s > 2 && String.sub s 0 2 = "0x" then Int64.float_of_bits (Int64.of_string s)
+    else float_of_string s in
+  match typ with
+  | Llabs.Float -> Printf.sprintf "%lu" (Int32.bits_of_float x)
+  | _ -> Printf.sprintf "%Lu" (Int64.bits_of_float x)
+
 let global_locations = Hashtbl.create 10
 let loc = ref 0
 let alloc_globals m =
@@ -0,0 +1,41 @@
+/* Encryption under a key that no party knows: the AES-128 key is the
+   XOR of the parties' inputs, each repeated to fill 16 bytes, and its
+   SHA-256 digest is printed so that the key can be checked later
+   To compile
+       smpcc jointkey.c -circuitlib gmw
+   To run
+       go run *.go 4 5 9
+   where 4, 5, 9 are the inputs -- choose your own
+*/
+#include <stdio.h>
+
+extern unsigned int input(unsigned int);
+extern unsigned int num_peers();
+extern void aes128_encrypt(unsigned char *out, const unsigned char *key, const unsigned char *in);
+extern void sha256_digest(unsigned char *out, const unsigned char *msg, unsigned int len);
+
+unsigned int key[4];
+unsigned char block[16] = "attack at dawn!";
+unsigned char out[16];
+unsigned char digest[32];
+
+int main() {
+  for (unsigned int i = 0; i < num_peers(); i++) {
+    unsigned int x = input(i);
+    for (unsigned int j = 0; j < 4; j++) {
+      key[j] ^= x;
+    }
+  }
+  sha256_digest(digest, (unsigned char *)key, 16);
+  aes128_encrypt(out, (unsigned char *)key, block);
+  printf("Key digest ");
+  for (unsigned int i = 0; i < 32; i++) {
+    printf("%02x", digest[i]);
+  }
+  printf("\nCiphertext ");
+  for (unsigned int i = 0; i < 16; i++) {
+    printf("%02x", out[i]);
+  }
+  printf("\n");
+  return 0;
+}
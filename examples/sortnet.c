@@ -0,0 +1,32 @@
+/* Median of the parties' inputs, by an oblivious sort
+   To compile
+       smpcc sortnet.c -circuitlib gmw
+   To run
+       go run *.go 4 5 9
+   where 4, 5, 9 are the inputs -- choose your own
+
+   Unlike median.c, which sorts by mergesort, the sort reveals nothing
+   about the inputs.
+*/
+#include <stdio.h>
+
+#define MAX 16
+
+extern unsigned int input(unsigned int);
+extern unsigned int num_peers();
+extern void oblivious_sort(unsigned int *a, unsigned int n);
+
+unsigned int a[MAX];
+
+int main() {
+  /* unused slots sort to the end */
+  for (unsigned int i = 0; i < MAX; i++) {
+    a[i] = 0xffffffff;
+  }
+  for (unsigned int i = 0; i < num_peers(); i++) {
+    a[i] = input(i);
+  }
+  oblivious_sort(a, MAX);
+  printf("Median %d\n", a[num_peers() / 2]);
+  return 0;
+}
@@ -0,0 +1,37 @@
+/* Mean, variance and standard deviation of the parties' inputs, in
+   fixed point with 16 fractional bits
+   To compile
+       smpcc stats.c -circuitlib gmw
+   To run
+       go run *.go 4 5 9
+   where 4, 5, 9 are the inputs -- choose your own, below 100 so that
+   the sum of squares fits
+*/
+#include <stdio.h>
+
+#define FRAC 16
+
+extern unsigned int input(unsigned int);
+extern unsigned int num_peers();
+extern int fix_mul(int a, int b, int frac);
+extern int fix_div(int a, int b, int frac);
+extern int fix_sqrt(int a, int frac);
+
+int main() {
+  int n = num_peers() << FRAC;
+  int sum = 0;
+  int squares = 0;
+  for (unsigned int i = 0; i < num_peers(); i++) {
+    int x = input(i) << FRAC;
+    sum += x;
+    squares += fix_mul(x, x, FRAC);
+  }
+  int mean = fix_div(sum, n, FRAC);
+  int variance = fix_div(squares, n, FRAC) - fix_mul(mean, mean, FRAC);
+  int sd = fix_sqrt(variance, FRAC);
+  /* the integer part and four decimal places */
+  printf("Mean %d.%04d\n", mean >> FRAC, ((mean & 0xffff) * 10000) >> FRAC);
+  printf("Variance %d.%04d\n", variance >> FRAC, ((variance & 0xffff) * 10000) >> FRAC);
+  printf("Standard deviation %d.%04d\n", sd >> FRAC, ((sd & 0xffff) * 10000) >> FRAC);
+  return 0;
+}
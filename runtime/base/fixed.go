@@ -0,0 +1,36 @@
+package base
+
+import (
+	"math"
+	"math/big"
+)
+
+/* Constants of the fixed-point circuits of the runtimes */
+
+/* ln 2, as in package math, to more places than a float64 holds */
+var ln2, _ = new(big.Float).SetPrec(128).SetString("0.693147180559945309417232121458176568075500134360255254120680009")
+
+/* log2 e = 1/ln 2 with bits fractional bits, rounded, for bits up to 62 */
+func Log2E(bits uint) uint64 {
+	if bits > 62 {
+		panic("Log2E: too many bits")
+	}
+	x := new(big.Float).SetPrec(128).Quo(new(big.Float).SetMantExp(big.NewFloat(1), int(bits)), ln2)
+	x.Add(x, big.NewFloat(0.5))
+	r, _ := x.Uint64()
+	return r
+}
+
+/*
+The number of terms of the Taylor series of 2^f = e^(f ln 2), f in
+[0, 1), that leaves it within a quarter of 2^-frac
+*/
+func ExpTerms(frac uint) int {
+	/* the first term left out, ln 2^t/t!, is more than the rest together */
+	t, term := 0, 1.0
+	for term >= math.Ldexp(1, -int(frac)-3) {
+		t++
+		term *= math.Ln2 / float64(t)
+	}
+	return t
+}
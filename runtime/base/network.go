@@ -0,0 +1,194 @@
+package base
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+/*
+Data-oblivious networks, as lists of switches on the positions of an
+array, to be applied in order.  A switch of a sorting network is a
+comparator, which puts the smaller of its elements at I; a switch of a
+permutation network exchanges its elements or not as its control bit
+says.  The runtimes apply these to wires, keys and shares.
+*/
+
+type Switch struct {
+	I, J int
+}
+
+/*
+Batcher's odd-even merge sort on n elements, as if n were padded to a
+power of two with elements larger than any other, whose comparators
+are then dropped.  About n log^2 n / 4 comparators.
+*/
+func OddEvenMergeNetwork(n int) []Switch {
+	var net []Switch
+	for p := 1; p < n; p *= 2 {
+		for k := p; k >= 1; k /= 2 {
+			for j := k % p; j+k < n; j += 2 * k {
+				for i := 0; i < k && i+j+k < n; i++ {
+					if (i+j)/(2*p) == (i+j+k)/(2*p) {
+						net = append(net, Switch{i + j, i + j + k})
+					}
+				}
+			}
+		}
+	}
+	return net
+}
+
+/*
+Bitonic sort on n elements, padded in the same way; every comparator
+is ascending, the first of each merge comparing mirror images.  About
+n log^2 n / 2 comparators, twice as many as odd-even merge, but each
+layer compares every i with i^j for one j.
+*/
+func BitonicNetwork(n int) []Switch {
+	var net []Switch
+	for k := 2; k/2 < n; k *= 2 {
+		/* compare each block of k with its mirror image, then merge its halves */
+		net = bitonicLayer(net, n, k-1)
+		for j := k / 4; j > 0; j /= 2 {
+			net = bitonicLayer(net, n, j)
+		}
+	}
+	return net
+}
+
+/* Comparators on i and i^j */
+func bitonicLayer(net []Switch, n, j int) []Switch {
+	for i := 0; i < n; i++ {
+		if l := i ^ j; i < l && l < n {
+			net = append(net, Switch{i, l})
+		}
+	}
+	return net
+}
+
+/*
+Waksman's permutation network on n elements, of n-1 switches plus the
+networks on the top n/2 and the bottom n-n/2: a switch on each pair of
+inputs, which sends one to each subnetwork, and a switch on each pair
+of outputs but the last when n is even, whose first comes from the top.
+*/
+func WaksmanNetwork(n int) []Switch {
+	slots := make([]int, n)
+	for i := range slots {
+		slots[i] = i
+	}
+	return waksmanNetwork(slots, nil)
+}
+
+func waksmanNetwork(slots []int, net []Switch) []Switch {
+	n := len(slots)
+	if n < 2 {
+		return net
+	}
+	m := n / 2
+	top := make([]int, 0, m)
+	bottom := make([]int, 0, n-m)
+	for i := 0; i < m; i++ {
+		net = append(net, Switch{slots[2*i], slots[2*i+1]})
+		top = append(top, slots[2*i])
+		bottom = append(bottom, slots[2*i+1])
+	}
+	if n%2 == 1 {
+		bottom = append(bottom, slots[n-1])
+	}
+	net = waksmanNetwork(top, net)
+	net = waksmanNetwork(bottom, net)
+	for i := 0; i < (n-1)/2; i++ {
+		net = append(net, Switch{slots[2*i], slots[2*i+1]})
+	}
+	return net
+}
+
+/*
+The control bits of WaksmanNetwork(len(perm)) that move the element at
+position perm[j] to position j, found by the looping algorithm.
+*/
+func WaksmanControl(perm []int) []bool {
+	return waksmanControl(perm, nil)
+}
+
+func waksmanControl(perm []int, control []bool) []bool {
+	n := len(perm)
+	if n < 2 {
+		return control
+	}
+	m := n / 2
+	inv := make([]int, n)
+	for j, k := range perm {
+		inv[k] = j
+	}
+	const unset, top, bottom = 0, 1, 2
+	side := make([]int, n)
+	/*
+	   The elements of an input pair go to different subnetworks, and so
+	   do those of an output pair; follow the pairs alternately from k,
+	   until the cycle closes or a pair is missing.
+	*/
+	chain := func(k, s int) {
+		for side[k] == unset {
+			side[k] = s
+			if k >= 2*m {
+				return
+			}
+			k ^= 1
+			side[k] = top + bottom - s
+			j := inv[k]
+			if j >= 2*m {
+				return
+			}
+			k = perm[j^1]
+		}
+	}
+	if n%2 == 1 {
+		/* the last input and the last output have no switch, and are in the bottom */
+		chain(perm[n-1], bottom)
+	} else {
+		/* the last output switch is missing: its first output comes from the top */
+		chain(perm[n-2], top)
+	}
+	for k := range perm {
+		if side[k] == unset {
+			chain(k, top)
+		}
+	}
+	for i := 0; i < m; i++ {
+		control = append(control, side[2*i] == bottom)
+	}
+	topPerm := make([]int, m)
+	bottomPerm := make([]int, n-m)
+	for i := 0; i < m; i++ {
+		a, b := perm[2*i], perm[2*i+1]
+		if side[a] == bottom {
+			a, b = b, a
+		}
+		topPerm[i], bottomPerm[i] = a/2, b/2
+	}
+	if n%2 == 1 {
+		bottomPerm[m] = perm[n-1] / 2
+	}
+	control = waksmanControl(topPerm, control)
+	control = waksmanControl(bottomPerm, control)
+	for i := 0; i < (n-1)/2; i++ {
+		control = append(control, side[perm[2*i]] == bottom)
+	}
+	return control
+}
+
+/* A uniformly random permutation of 0..n-1 */
+func RandomPermutation(n int) []int {
+	perm := make([]int, n)
+	for i := range perm {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			panic("RandomPermutation: randomness allocation failed")
+		}
+		perm[i] = perm[j.Int64()]
+		perm[j.Int64()] = i
+	}
+	return perm
+}
@@ -0,0 +1,78 @@
+package base
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSortingNetworks(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n <= 33; n++ {
+		for name, net := range map[string][]Switch{"odd-even merge": OddEvenMergeNetwork(n), "bitonic": BitonicNetwork(n)} {
+			for trial := 0; trial < 20; trial++ {
+				xs := make([]int, n)
+				for i := range xs {
+					xs[i] = rnd.Intn(n + 1)
+				}
+				want := append([]int{}, xs...)
+				sort.Ints(want)
+				for _, sw := range net {
+					if xs[sw.I] > xs[sw.J] {
+						xs[sw.I], xs[sw.J] = xs[sw.J], xs[sw.I]
+					}
+				}
+				for i := range xs {
+					if xs[i] != want[i] {
+						t.Fatalf("%s network of %d: got %v, want %v", name, n, xs, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestWaksman(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n <= 33; n++ {
+		net := WaksmanNetwork(n)
+		for trial := 0; trial < 20; trial++ {
+			perm := rnd.Perm(n)
+			if trial == 0 {
+				perm = RandomPermutation(n)
+			}
+			control := WaksmanControl(perm)
+			if len(control) != len(net) {
+				t.Fatalf("%d elements: %d switches vs %d controls", n, len(net), len(control))
+			}
+			xs := make([]int, n)
+			for i := range xs {
+				xs[i] = i
+			}
+			for k, sw := range net {
+				if control[k] {
+					xs[sw.I], xs[sw.J] = xs[sw.J], xs[sw.I]
+				}
+			}
+			for j := range xs {
+				if xs[j] != perm[j] {
+					t.Fatalf("permutation %v: got %v", perm, xs)
+				}
+			}
+		}
+	}
+}
+
+func TestLog2E(t *testing.T) {
+	for _, bits := range []uint{0, 1, 16, 52, 62} {
+		want := math.Ldexp(math.Log2E, int(bits))
+		if got := float64(Log2E(bits)); math.Abs(got-want) > 0.5+want*0x1p-52 {
+			t.Errorf("Log2E(%d): got %d, want %g", bits, Log2E(bits), want)
+		}
+	}
+	/* past a float64: 2^62/ln 2, rounded, from a 60-digit expansion of ln 2 */
+	if got := Log2E(62); got != 0x5c551d94ae0bf85e {
+		t.Errorf("Log2E(62): got %x", got)
+	}
+}
@@ -54,6 +54,18 @@ func GetBit(vector []byte, index int) byte {
 	return (vector[index/8] >> (7 - uint(index)%8)) & 1
 }
 
+func SetBit(vector []byte, index int, v byte) {
+	mask := byte(1 << (7 - uint(index)%8))
+	switch v {
+	case 0:
+		vector[index/8] &^= mask
+	case 1:
+		vector[index/8] |= mask
+	default:
+		panic("SetBit: not a 0/1 bit")
+	}
+}
+
 func (self *Matrix8) GetRow(row int) []byte {
 	if row < 0 || row >= self.NumRows {
 		panic("matrix8.GetRow: out of bounds")
@@ -0,0 +1,292 @@
+/*
+Package bristol reads boolean circuits in Bristol Fashion, and in the
+older Bristol format, and runs them on the garbled circuit VMs and on
+gmw.  See https://nigelsmart.github.io/MPC-Circuits/ for the formats
+and for circuits such as AES-128, SHA-256 and adders.
+
+The wires of input value i come first, in order, and the wires of the
+outputs last; bit j of a value is wire j of its group.  An old Bristol
+file has two inputs and one output.
+*/
+package bristol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Op int
+
+const (
+	XOR  Op = iota
+	AND     /* In[0] & In[1] */
+	INV     /* ^In[0] */
+	EQ      /* the constant In[0], 0 or 1 */
+	EQW     /* a copy of In[0] */
+	MAND    /* In[i] & In[n+i] for each of the n outputs */
+)
+
+var ops = map[string]Op{"XOR": XOR, "AND": AND, "INV": INV, "EQ": EQ, "EQW": EQW, "MAND": MAND}
+
+func (op Op) String() string {
+	for name, x := range ops {
+		if x == op {
+			return name
+		}
+	}
+	return fmt.Sprintf("Op(%d)", int(op))
+}
+
+type Gate struct {
+	Op  Op
+	In  []int
+	Out []int
+}
+
+type Circuit struct {
+	NumWires int
+	Inputs   []int /* width of each input value */
+	Outputs  []int /* width of each output value */
+	Gates    []Gate
+}
+
+func ParseFile(name string) (*Circuit, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+func atoi(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err == nil && n < 0 {
+		err = fmt.Errorf("negative number %s", s)
+	}
+	return n, err
+}
+
+func atois(fields []string) ([]int, error) {
+	result := make([]int, len(fields))
+	for i, s := range fields {
+		n, err := atoi(s)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = n
+	}
+	return result, nil
+}
+
+/* A line giving a count followed by that many widths */
+func widths(line []string) ([]int, error) {
+	ns, err := atois(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(ns) == 0 || len(ns) != ns[0]+1 {
+		return nil, fmt.Errorf("bad list of widths")
+	}
+	return ns[1:], nil
+}
+
+func Parse(r io.Reader) (*Circuit, error) {
+	var lines [][]string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			lines = append(lines, fields)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("bristol: missing header")
+	}
+	header, err := atois(lines[0])
+	if err != nil || len(header) != 2 {
+		return nil, fmt.Errorf("bristol: bad header")
+	}
+	c := &Circuit{NumWires: header[1]}
+	fashion := false
+	if len(lines) > 2 {
+		_, err := atois(lines[2])
+		fashion = err == nil
+	}
+	var gates [][]string
+	if fashion {
+		/* Bristol Fashion: a line of inputs and a line of outputs */
+		if c.Inputs, err = widths(lines[1]); err != nil {
+			return nil, fmt.Errorf("bristol: inputs: %s", err)
+		}
+		if c.Outputs, err = widths(lines[2]); err != nil {
+			return nil, fmt.Errorf("bristol: outputs: %s", err)
+		}
+		gates = lines[3:]
+	} else {
+		/* old Bristol: n1 n2 n3, the sizes of two inputs and one output */
+		ns, err := atois(lines[1])
+		if err != nil || len(ns) != 3 {
+			return nil, fmt.Errorf("bristol: bad input and output sizes")
+		}
+		c.Inputs, c.Outputs = ns[:2], ns[2:]
+		gates = lines[2:]
+	}
+	if len(gates) != header[0] {
+		return nil, fmt.Errorf("bristol: expected %d gates, found %d", header[0], len(gates))
+	}
+	if sum(c.Inputs) > c.NumWires || sum(c.Outputs) > c.NumWires {
+		return nil, fmt.Errorf("bristol: more inputs or outputs than wires")
+	}
+	c.Gates = make([]Gate, len(gates))
+	for i, line := range gates {
+		g, err := c.parseGate(line)
+		if err != nil {
+			return nil, fmt.Errorf("bristol: gate %d: %s", i, err)
+		}
+		c.Gates[i] = g
+	}
+	return c, nil
+}
+
+func (c *Circuit) parseGate(line []string) (Gate, error) {
+	var g Gate
+	if len(line) < 3 {
+		return g, fmt.Errorf("too short")
+	}
+	op, ok := ops[line[len(line)-1]]
+	if !ok {
+		return g, fmt.Errorf("unknown gate %s", line[len(line)-1])
+	}
+	ns, err := atois(line[:len(line)-1])
+	if err != nil {
+		return g, err
+	}
+	nin, nout := ns[0], ns[1]
+	if len(ns) != 2+nin+nout {
+		return g, fmt.Errorf("wrong number of wires")
+	}
+	g = Gate{op, ns[2 : 2+nin], ns[2+nin:]}
+	arity := map[Op][2]int{XOR: {2, 1}, AND: {2, 1}, INV: {1, 1}, EQ: {1, 1}, EQW: {1, 1}}
+	if a, ok := arity[op]; ok && (nin != a[0] || nout != a[1]) || op == MAND && nin != 2*nout {
+		return g, fmt.Errorf("wrong number of wires for the gate")
+	}
+	for i, w := range g.In {
+		if op == EQ && w > 1 || op != EQ && w >= c.NumWires {
+			return g, fmt.Errorf("bad input %d", i)
+		}
+	}
+	for _, w := range g.Out {
+		if w >= c.NumWires {
+			return g, fmt.Errorf("bad output wire %d", w)
+		}
+	}
+	return g, nil
+}
+
+/* Write c in Bristol Fashion */
+func (c *Circuit) Write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "%d %d\n", len(c.Gates), c.NumWires)
+	for _, ns := range [][]int{c.Inputs, c.Outputs} {
+		fmt.Fprintf(b, "%d", len(ns))
+		for _, n := range ns {
+			fmt.Fprintf(b, " %d", n)
+		}
+		fmt.Fprintf(b, "\n")
+	}
+	fmt.Fprintf(b, "\n")
+	for _, g := range c.Gates {
+		fmt.Fprintf(b, "%d %d", len(g.In), len(g.Out))
+		for _, w := range append(g.In[:len(g.In):len(g.In)], g.Out...) {
+			fmt.Fprintf(b, " %d", w)
+		}
+		fmt.Fprintf(b, " %s\n", g.Op)
+	}
+	return b.Flush()
+}
+
+func (c *Circuit) WriteFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := c.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func sum(ns []int) int {
+	result := 0
+	for _, n := range ns {
+		result += n
+	}
+	return result
+}
+
+/* The first wire of each input */
+func (c *Circuit) inputWires() []int {
+	result := make([]int, len(c.Inputs))
+	for i := 1; i < len(result); i++ {
+		result[i] = result[i-1] + c.Inputs[i-1]
+	}
+	return result
+}
+
+/* The first wire of each output */
+func (c *Circuit) outputWires() []int {
+	result := make([]int, len(c.Outputs))
+	w := c.NumWires - sum(c.Outputs)
+	for i, n := range c.Outputs {
+		result[i] = w
+		w += n
+	}
+	return result
+}
+
+/* Parse a value of the given width, in decimal or with a 0x prefix in hex */
+func ParseValue(s string, width int) ([]bool, error) {
+	x, ok := new(big.Int).SetString(s, 0)
+	if !ok || x.Sign() < 0 {
+		return nil, fmt.Errorf("bad value %q", s)
+	}
+	if x.BitLen() > width {
+		return nil, fmt.Errorf("value %s does not fit in %d bits", s, width)
+	}
+	result := make([]bool, width)
+	for i := range result {
+		result[i] = x.Bit(i) == 1
+	}
+	return result, nil
+}
+
+/* A value in hex */
+func FormatValue(v []bool) string {
+	x := new(big.Int)
+	for i, b := range v {
+		if b {
+			x.SetBit(x, i, 1)
+		}
+	}
+	return fmt.Sprintf("0x%x", x)
+}
+
+/* v, at most 64 bits, as a uint64 */
+func toUint64(v []bool) uint64 {
+	x := uint64(0)
+	for i, b := range v {
+		if b {
+			x |= 1 << uint(i)
+		}
+	}
+	return x
+}
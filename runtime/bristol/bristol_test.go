@@ -0,0 +1,95 @@
+package bristol
+
+import (
+	"bytes"
+	"github.com/tjim/smpcc/runtime/gc/yao/sim"
+	"github.com/tjim/smpcc/runtime/gmw"
+	"strings"
+	"testing"
+)
+
+/* A 2-bit adder */
+const adder = `4 8
+2 2 2
+1 2
+
+2 1 0 2 4 AND
+2 1 1 3 5 XOR
+2 1 0 2 6 XOR
+2 1 5 4 7 XOR
+`
+
+const oldAdder = `4 8
+2 2 2
+
+2 1 0 2 4 AND
+2 1 1 3 5 XOR
+2 1 0 2 6 XOR
+2 1 5 4 7 XOR
+`
+
+func bits(x uint64, n int) []bool {
+	result := make([]bool, n)
+	for i := range result {
+		result[i] = x>>uint(i)&1 == 1
+	}
+	return result
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{adder, oldAdder} {
+		c, err := Parse(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(c.Inputs) != 2 || len(c.Outputs) != 1 || c.Outputs[0] != 2 || len(c.Gates) != 4 {
+			t.Errorf("parsed %+v", c)
+		}
+	}
+	if _, err := Parse(strings.NewReader("1 3\n1 1\n1 1\n\n2 1 0 7 2 AND\n")); err == nil {
+		t.Errorf("bad wire accepted")
+	}
+}
+
+func TestRun(t *testing.T) {
+	c, _ := Parse(strings.NewReader(adder))
+	for _, xy := range [][2]uint64{{1, 1}, {3, 2}} {
+		want := (xy[0] + xy[1]) % 4
+		g, e := sim.VMs(1)
+		ch := make(chan [][]bool)
+		go func() { ch <- GenMain(g[0], c, bits(xy[0], 2)) }()
+		er := EvalMain(e[0], c, bits(xy[1], 2))
+		gr := <-ch
+		if toUint64(gr[0]) != want || toUint64(er[0]) != want {
+			t.Errorf("gc: %d+%d gave %v %v", xy[0], xy[1], gr, er)
+		}
+		gmw.Simulation(nil, 0, func(io gmw.Io, ios []gmw.Io) {
+			r := GmwMain(io, c, bits(xy[io.Id()], 2))
+			if toUint64(r[0]) != want {
+				t.Errorf("gmw: %d+%d gave %v", xy[0], xy[1], r)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	c, _ := Parse(strings.NewReader(adder))
+	r := NewRecorder(func(bits int) uint64 { return 2 })
+	if got := GenMain(r, c, bits(3, 2)); toUint64(got[0]) != 1 {
+		t.Errorf("recorder: 3+2 gave %v", got)
+	}
+	var b bytes.Buffer
+	if err := r.Circuit().Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := Parse(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* the recorded adder reveals its sum twice, to each party */
+	g, e := sim.VMs(1)
+	go GenMain(g[0], rc, bits(1, 2))
+	if er := EvalMain(e[0], rc, bits(1, 2)); len(er) != 2 || toUint64(er[0]) != 2 || toUint64(er[1]) != 2 {
+		t.Errorf("recorded circuit: 1+1 gave %v", er)
+	}
+}
@@ -0,0 +1,147 @@
+package bristol
+
+import (
+	"fmt"
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+/* Run c on the generator's side, given the wires of its inputs; the result is the wires of its outputs */
+func (c *Circuit) Gen(vm gen.VM, inputs [][]gc.Wire) [][]gc.Wire {
+	w := make([]gc.Wire, c.NumWires)
+	for i, start := range c.inputWires() {
+		copy(w[start:start+c.Inputs[i]], inputs[i])
+	}
+	for _, g := range c.Gates {
+		switch g.Op {
+		case XOR:
+			w[g.Out[0]] = gen.Xor(vm, w[g.In[0]:g.In[0]+1], w[g.In[1]:g.In[1]+1])[0]
+		case AND:
+			w[g.Out[0]] = gen.And(vm, w[g.In[0]:g.In[0]+1], w[g.In[1]:g.In[1]+1])[0]
+		case INV:
+			w[g.Out[0]] = gen.Not(vm, w[g.In[0]:g.In[0]+1])[0]
+		case EQ:
+			w[g.Out[0]] = gen.Uint(vm, uint64(g.In[0]), 1)[0]
+		case EQW:
+			w[g.Out[0]] = w[g.In[0]]
+		case MAND:
+			n := len(g.Out)
+			a := make([]gc.Wire, 2*n)
+			for i, in := range g.In {
+				a[i] = w[in]
+			}
+			for i, x := range gen.And(vm, a[:n], a[n:]) {
+				w[g.Out[i]] = x
+			}
+		}
+	}
+	outputs := make([][]gc.Wire, len(c.Outputs))
+	for i, start := range c.outputWires() {
+		outputs[i] = w[start : start+c.Outputs[i]]
+	}
+	return outputs
+}
+
+/* Run c on the evaluator's side; see Gen */
+func (c *Circuit) Eval(vm eval.VM, inputs [][]gc.Key) [][]gc.Key {
+	w := make([]gc.Key, c.NumWires)
+	for i, start := range c.inputWires() {
+		copy(w[start:start+c.Inputs[i]], inputs[i])
+	}
+	for _, g := range c.Gates {
+		switch g.Op {
+		case XOR:
+			w[g.Out[0]] = eval.Xor(vm, w[g.In[0]:g.In[0]+1], w[g.In[1]:g.In[1]+1])[0]
+		case AND:
+			w[g.Out[0]] = eval.And(vm, w[g.In[0]:g.In[0]+1], w[g.In[1]:g.In[1]+1])[0]
+		case INV:
+			w[g.Out[0]] = eval.Not(vm, w[g.In[0]:g.In[0]+1])[0]
+		case EQ:
+			w[g.Out[0]] = eval.Uint(vm, uint64(g.In[0]), 1)[0]
+		case EQW:
+			w[g.Out[0]] = w[g.In[0]]
+		case MAND:
+			n := len(g.Out)
+			a := make([]gc.Key, 2*n)
+			for i, in := range g.In {
+				a[i] = w[in]
+			}
+			for i, x := range eval.And(vm, a[:n], a[n:]) {
+				w[g.Out[i]] = x
+			}
+		}
+	}
+	outputs := make([][]gc.Key, len(c.Outputs))
+	for i, start := range c.outputWires() {
+		outputs[i] = w[start : start+c.Outputs[i]]
+	}
+	return outputs
+}
+
+/* Two-party circuits have an input for each party; the generator is party 0 */
+func (c *Circuit) checkTwoParty() {
+	if len(c.Inputs) != 2 {
+		panic(fmt.Sprintf("bristol: a circuit with %d inputs is not a two-party circuit", len(c.Inputs)))
+	}
+}
+
+/*
+Run c as the generator, with input the generator's value for input 0;
+the evaluator supplies input 1.  Every output is revealed to both
+parties.
+*/
+func GenMain(vm gen.VM, c *Circuit, input []bool) [][]bool {
+	c.checkTwoParty()
+	if len(input) != c.Inputs[0] {
+		panic("bristol.GenMain: wrong input width")
+	}
+	var x, y []gc.Wire
+	for i := 0; i < len(input); i += 64 {
+		j := i + 64
+		if j > len(input) {
+			j = len(input)
+		}
+		x = append(x, gen.ShareTo1(vm, toUint64(input[i:j]), j-i)...)
+	}
+	for i := 0; i < c.Inputs[1]; i += 64 {
+		j := i + 64
+		if j > c.Inputs[1] {
+			j = c.Inputs[1]
+		}
+		y = append(y, gen.ShareTo0(vm, j-i)...)
+	}
+	var result [][]bool
+	for _, out := range c.Gen(vm, [][]gc.Wire{x, y}) {
+		result = append(result, gen.Reveal(vm, out))
+	}
+	return result
+}
+
+/* The evaluator's side of GenMain, with input its value for input 1 */
+func EvalMain(vm eval.VM, c *Circuit, input []bool) [][]bool {
+	c.checkTwoParty()
+	if len(input) != c.Inputs[1] {
+		panic("bristol.EvalMain: wrong input width")
+	}
+	var x, y []gc.Key
+	for i := 0; i < c.Inputs[0]; i += 64 {
+		j := i + 64
+		if j > c.Inputs[0] {
+			j = c.Inputs[0]
+		}
+		x = append(x, eval.ShareTo1(vm, j-i)...)
+	}
+	for i := 0; i < len(input); i += 64 {
+		j := i + 64
+		if j > len(input) {
+			j = len(input)
+		}
+		y = append(y, eval.ShareTo0(vm, toUint64(input[i:j]), j-i)...)
+	}
+	var result [][]bool
+	for _, out := range c.Eval(vm, [][]gc.Key{x, y}) {
+		result = append(result, eval.Reveal(vm, out))
+	}
+	return result
+}
@@ -0,0 +1,156 @@
+package bristol
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/tjim/smpcc/runtime/gmw"
+)
+
+/*
+AND depth of each gate.  gmw evaluates all of the AND gates of one
+depth in a single round.
+*/
+func (c *Circuit) depths() []int {
+	wire := make([]int, c.NumWires)
+	result := make([]int, len(c.Gates))
+	for i, g := range c.Gates {
+		d := 0
+		if g.Op != EQ {
+			for _, in := range g.In {
+				if wire[in] > d {
+					d = wire[in]
+				}
+			}
+		}
+		if g.Op == AND || g.Op == MAND {
+			d++
+		}
+		result[i] = d
+		for _, out := range g.Out {
+			wire[out] = d
+		}
+	}
+	return result
+}
+
+func pack(bits []bool) []uint64 {
+	result := make([]uint64, (len(bits)+63)/64)
+	for i, b := range bits {
+		if b {
+			result[i/64] |= 1 << uint(i%64)
+		}
+	}
+	return result
+}
+
+func unpack(words []uint64, n int) []bool {
+	result := make([]bool, n)
+	for i := range result {
+		result[i] = (words[i/64]>>uint(i%64))&1 == 1
+	}
+	return result
+}
+
+/* Run c on shares of its inputs; the result is shares of its outputs */
+func (c *Circuit) Gmw(io gmw.Io, inputs [][]bool) [][]bool {
+	w := make([]bool, c.NumWires)
+	for i, start := range c.inputWires() {
+		copy(w[start:start+c.Inputs[i]], inputs[i])
+	}
+	depths := c.depths()
+	maxDepth := 0
+	for _, d := range depths {
+		if d > maxDepth {
+			maxDepth = d
+		}
+	}
+	for d := 0; d <= maxDepth; d++ {
+		/* the AND gates of depth d, in one batch */
+		var xs, ys []bool
+		var outs []int
+		for i, g := range c.Gates {
+			if depths[i] != d || g.Op != AND && g.Op != MAND {
+				continue
+			}
+			n := len(g.Out)
+			for j := 0; j < n; j++ {
+				xs = append(xs, w[g.In[j]])
+				ys = append(ys, w[g.In[n+j]])
+			}
+			outs = append(outs, g.Out...)
+		}
+		if len(outs) > 0 {
+			zs := unpack(gmw.AndV64(io, pack(xs), pack(ys)), len(outs))
+			for i, out := range outs {
+				w[out] = zs[i]
+			}
+		}
+		/* then the local gates of depth d, in order */
+		for i, g := range c.Gates {
+			if depths[i] != d {
+				continue
+			}
+			switch g.Op {
+			case XOR:
+				w[g.Out[0]] = w[g.In[0]] != w[g.In[1]]
+			case INV:
+				w[g.Out[0]] = gmw.Not1(io, w[g.In[0]])
+			case EQ:
+				w[g.Out[0]] = gmw.Uint1(io, uint8(g.In[0]))
+			case EQW:
+				w[g.Out[0]] = w[g.In[0]]
+			}
+		}
+	}
+	outputs := make([][]bool, len(c.Outputs))
+	for i, start := range c.outputWires() {
+		outputs[i] = w[start : start+c.Outputs[i]]
+	}
+	return outputs
+}
+
+/*
+Run c with gmw.  Party i supplies input i, and input is this party's
+value for it; every output is opened to all parties.
+*/
+func GmwMain(io gmw.Io, c *Circuit, input []bool) [][]bool {
+	if len(c.Inputs) > io.N() {
+		panic("bristol.GmwMain: more inputs than parties")
+	}
+	inputs := make([][]bool, len(c.Inputs))
+	for party, n := range c.Inputs {
+		words := make([]uint64, (n+63)/64)
+		if party == io.Id() {
+			if len(input) != n {
+				panic("bristol.GmwMain: wrong input width")
+			}
+			/* split into random shares, one for each party */
+			words = pack(input)
+			buf := make([]byte, 8)
+			for i := 0; i < io.N(); i++ {
+				if i == party {
+					continue
+				}
+				for j := range words {
+					if _, err := rand.Read(buf); err != nil {
+						panic(err)
+					}
+					share := binary.LittleEndian.Uint64(buf)
+					words[j] ^= share
+					io.Send64(i, share)
+				}
+			}
+		} else {
+			for j := range words {
+				words[j] = io.Receive64(party)
+			}
+		}
+		inputs[party] = unpack(words, n)
+	}
+	outputs := c.Gmw(io, inputs)
+	result := make([][]bool, len(outputs))
+	for i, out := range outputs {
+		result[i] = unpack(gmw.OpenV64(io, pack(out)), len(out))
+	}
+	return result
+}
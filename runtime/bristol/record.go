@@ -0,0 +1,307 @@
+package bristol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+/*
+A Recorder is a gen.VM that garbles nothing; it runs the program in
+the clear and records every gate as a netlist, which Circuit and
+WriteJSON write out when the program finishes.  A Recorder may be
+shared by the VMs of all blocks.
+
+Each ShareTo0, ShareTo1 and Random call is an input of the netlist,
+in order, and each RevealTo0 and RevealTo1 call is an output.  A
+program that reveals values and acts on them (Load and Store reveal
+addresses, Input32 reveals the party) is recorded as the trace of a
+single run: the reveal is an output, a value that comes back to the
+circuit, such as a loaded value, is a new input, and the rest of the
+netlist is specialized to the revealed values.  The evaluator's
+inputs are taken from evalInput.
+
+Or is recorded as a ^ b ^ (a & b), as Bristol has no OR gate.  A wire
+of a Recorder is a single key, holding its wire number.
+*/
+type Recorder struct {
+	mu        sync.Mutex
+	evalInput func(bits int) uint64
+	values    []bool /* the value of each wire, in order of creation */
+	isInput   []bool
+	gates     []Gate
+	inputs    []group
+	outputs   []group
+	consts    [2]int /* the wires of False and True, or -1 */
+	session   *gen.Session
+}
+
+type group struct {
+	party int /* the party supplying an input or receiving an output, or -1 for Random */
+	wires []int
+}
+
+func NewRecorder(evalInput func(bits int) uint64) *Recorder {
+	return &Recorder{evalInput: evalInput, consts: [2]int{-1, -1}, session: gen.NewSession()}
+}
+
+func (r *Recorder) wire(w gc.Wire) int {
+	return int(binary.BigEndian.Uint64(w[0]))
+}
+
+func recorderWire(n int) gc.Wire {
+	k := make(gc.Key, 8)
+	binary.BigEndian.PutUint64(k, uint64(n))
+	return gc.Wire{k}
+}
+
+func (r *Recorder) newWire(v, input bool) gc.Wire {
+	r.values = append(r.values, v)
+	r.isInput = append(r.isInput, input)
+	return recorderWire(len(r.values) - 1)
+}
+
+func (r *Recorder) gate(op Op, a, b gc.Wire) gc.Wire {
+	x, y := r.wire(a), r.wire(b)
+	var v bool
+	if op == AND {
+		v = r.values[x] && r.values[y]
+	} else {
+		v = r.values[x] != r.values[y]
+	}
+	result := r.newWire(v, false)
+	r.gates = append(r.gates, Gate{op, []int{x, y}, []int{r.wire(result)}})
+	return result
+}
+
+func (r *Recorder) And(a, b []gc.Wire) []gc.Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in bristol.Recorder.And()")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]gc.Wire, len(a))
+	for i := range a {
+		result[i] = r.gate(AND, a[i], b[i])
+	}
+	return result
+}
+
+func (r *Recorder) Or(a, b []gc.Wire) []gc.Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in bristol.Recorder.Or()")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]gc.Wire, len(a))
+	for i := range a {
+		result[i] = r.gate(XOR, r.gate(XOR, a[i], b[i]), r.gate(AND, a[i], b[i]))
+	}
+	return result
+}
+
+func (r *Recorder) Xor(a, b []gc.Wire) []gc.Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in bristol.Recorder.Xor()")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]gc.Wire, len(a))
+	for i := range a {
+		result[i] = r.gate(XOR, a[i], b[i])
+	}
+	return result
+}
+
+func (r *Recorder) Mux(s, a, b []gc.Wire) []gc.Wire {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Wire mismatch in bristol.Recorder.Mux()")
+	}
+	return gc.MuxWires(r.And, r.Xor, s[0], a, b)
+}
+
+func (r *Recorder) constant(b int) []gc.Wire {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.consts[b] < 0 {
+		w := r.newWire(b == 1, false)
+		r.consts[b] = r.wire(w)
+		r.gates = append(r.gates, Gate{EQ, []int{b}, []int{r.consts[b]}})
+	}
+	return []gc.Wire{recorderWire(r.consts[b])}
+}
+
+func (r *Recorder) True() []gc.Wire {
+	return r.constant(1)
+}
+
+func (r *Recorder) False() []gc.Wire {
+	return r.constant(0)
+}
+
+func (r *Recorder) input(party int, a uint64, bits int) []gc.Wire {
+	if bits > 64 {
+		panic("bristol.Recorder: input of more than 64 bits")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]gc.Wire, bits)
+	g := group{party, make([]int, bits)}
+	for i := range result {
+		result[i] = r.newWire(a>>uint(i)&1 == 1, true)
+		g.wires[i] = r.wire(result[i])
+	}
+	r.inputs = append(r.inputs, g)
+	return result
+}
+
+func (r *Recorder) output(party int, a []gc.Wire) []bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]bool, len(a))
+	g := group{party, make([]int, len(a))}
+	for i := range a {
+		g.wires[i] = r.wire(a[i])
+		result[i] = r.values[g.wires[i]]
+	}
+	r.outputs = append(r.outputs, g)
+	return result
+}
+
+func (r *Recorder) ShareTo0(bits int) []gc.Wire {
+	return r.input(1, r.evalInput(bits), bits)
+}
+
+func (r *Recorder) ShareTo1(a uint64, bits int) []gc.Wire {
+	return r.input(0, a, bits)
+}
+
+func (r *Recorder) Session() *gen.Session {
+	return r.session
+}
+
+func (r *Recorder) Random(bits int) []gc.Wire {
+	k := make([]byte, 8)
+	gc.GenKey(k)
+	return r.input(-1, binary.BigEndian.Uint64(k), bits)
+}
+
+func (r *Recorder) RevealTo0(a []gc.Wire) []bool {
+	return r.output(0, a)
+}
+
+func (r *Recorder) RevealTo1(a []gc.Wire) {
+	r.output(1, a)
+}
+
+/*
+The circuit recorded so far, in Bristol Fashion wire order: the inputs
+first, then the other wires in order of creation, then a copy of each
+output.
+*/
+func (r *Recorder) Circuit() *Circuit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := &Circuit{}
+	number := make([]int, len(r.values))
+	for i, input := range r.isInput {
+		if input {
+			number[i] = c.NumWires
+			c.NumWires++
+		}
+	}
+	for i, input := range r.isInput {
+		if !input {
+			number[i] = c.NumWires
+			c.NumWires++
+		}
+	}
+	for _, g := range r.inputs {
+		c.Inputs = append(c.Inputs, len(g.wires))
+	}
+	for _, g := range r.gates {
+		in := g.In
+		if g.Op != EQ {
+			in = make([]int, len(g.In))
+			for i, w := range g.In {
+				in[i] = number[w]
+			}
+		}
+		c.Gates = append(c.Gates, Gate{g.Op, in, []int{number[g.Out[0]]}})
+	}
+	for _, g := range r.outputs {
+		c.Outputs = append(c.Outputs, len(g.wires))
+		for _, w := range g.wires {
+			c.Gates = append(c.Gates, Gate{EQW, []int{number[w]}, []int{c.NumWires}})
+			c.NumWires++
+		}
+	}
+	return c
+}
+
+type jsonGroup struct {
+	Party int   `json:"party"`
+	Wires []int `json:"wires"`
+}
+
+type jsonGate struct {
+	Op  string `json:"op"`
+	In  []int  `json:"in"`
+	Out []int  `json:"out"`
+}
+
+type jsonNetlist struct {
+	Wires   int         `json:"wires"`
+	Inputs  []jsonGroup `json:"inputs"`
+	Outputs []jsonGroup `json:"outputs"`
+	Gates   []jsonGate  `json:"gates"`
+}
+
+/*
+Write the recorded circuit as a JSON netlist: the wires of Circuit(),
+with the party of each input and output (-1 for Random), and the gates
+with their ops by name.
+*/
+func (r *Recorder) WriteJSON(w io.Writer) error {
+	c := r.Circuit()
+	n := jsonNetlist{Wires: c.NumWires}
+	for i, start := range c.inputWires() {
+		n.Inputs = append(n.Inputs, jsonGroup{r.inputs[i].party, span(start, c.Inputs[i])})
+	}
+	for i, start := range c.outputWires() {
+		n.Outputs = append(n.Outputs, jsonGroup{r.outputs[i].party, span(start, c.Outputs[i])})
+	}
+	for _, g := range c.Gates {
+		n.Gates = append(n.Gates, jsonGate{g.Op.String(), g.In, g.Out})
+	}
+	return json.NewEncoder(w).Encode(n)
+}
+
+/* Write Bristol Fashion, or a JSON netlist if name ends in .json */
+func (r *Recorder) WriteFile(name string) error {
+	if strings.HasSuffix(name, ".json") {
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		if err := r.WriteJSON(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return r.Circuit().WriteFile(name)
+}
+
+func span(start, n int) []int {
+	result := make([]int, n)
+	for i := range result {
+		result[i] = start + i
+	}
+	return result
+}
@@ -307,7 +307,7 @@ func session(nc *nats.Conn, msgReceived chan string, args []string) {
 
 		if io.Leads(p) {
 			// leader is server
-			// that means it receives in the fatchan sense
+			// that means it receives the requests of the client
 			// also it is going to act as sender for the base OT
 			pc.bindSend(x.ParamChan)
 			s1 := pc.bindRecv(x.NpRecvPk)
@@ -385,7 +385,7 @@ func session(nc *nats.Conn, msgReceived chan string, args []string) {
 			go gmw.ServerSideIOSetup(io, p, x, done)
 		} else {
 			//log.Println("Starting client side for", p)
-			go gmw.ClientSideIOSetup(io, p, x, false, done)
+			go gmw.ClientSideIOSetup(io, p, x, done)
 		}
 	}
 	for p := 0; p < numParties; p++ {
@@ -0,0 +1,76 @@
+/*
+Run a Bristol circuit with garbled circuits, like a compiled program:
+
+	bristol -circuit adder64.txt -sim 3 4
+
+or in two processes:
+
+	bristol -circuit adder64.txt -id 1 4 &
+	bristol -circuit adder64.txt 3
+
+A value is decimal or, with a 0x prefix, hex.  With -sim or -plain the first
+value is the generator's input and the second the evaluator's.  The
+other flags are those of compiled programs; -record writes the
+circuit back out, with its outputs revealed to both parties, and
+prints nothing.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/tjim/smpcc/runtime/bristol"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+	"github.com/tjim/smpcc/runtime/gc/runtime"
+	"os"
+)
+
+var circuit = flag.String("circuit", "", "Bristol or Bristol Fashion circuit file")
+
+func fatal(err error) {
+	fmt.Println("Error:", err)
+	os.Exit(1)
+}
+
+/* The circuit and the input of party */
+func setup(party int) (*bristol.Circuit, []bool) {
+	c, err := bristol.ParseFile(*circuit)
+	if err != nil {
+		fatal(err)
+	}
+	if len(c.Inputs) != 2 {
+		fatal(fmt.Errorf("%s has %d inputs, not 2", *circuit, len(c.Inputs)))
+	}
+	i := 0
+	if flag.Lookup("sim").Value.String() == "true" || flag.Lookup("plain").Value.String() == "true" {
+		i = party
+	}
+	if flag.NArg() <= i {
+		fatal(fmt.Errorf("missing the input of party %d", party))
+	}
+	v, err := bristol.ParseValue(flag.Arg(i), c.Inputs[party])
+	if err != nil {
+		fatal(err)
+	}
+	return c, v
+}
+
+func report(who string, outputs [][]bool) {
+	for _, out := range outputs {
+		fmt.Printf("%s: %s\n", who, bristol.FormatValue(out))
+	}
+}
+
+func main() {
+	runtime.Run(0, func(vms []gen.VM) {
+		c, v := setup(0)
+		outputs := bristol.GenMain(vms[0], c, v)
+		if flag.Lookup("record").Value.String() == "" {
+			report("gen", outputs)
+		}
+	}, func(vms []eval.VM) {
+		c, v := setup(1)
+		report("eval", bristol.EvalMain(vms[0], c, v))
+	})
+}
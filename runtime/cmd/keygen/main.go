@@ -0,0 +1,34 @@
+/*
+Make a private key for securing the connections of compiled programs
+and print its public key, in hex, for the other parties:
+
+	keygen -out party0.key
+
+With garbled circuits, each party passes its own key file to -key and
+the other's public key to -peer.  With GMW, each party passes its own
+key file to -key, and the public key of every party follows its
+host:port in the -config file.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/tjim/smpcc/runtime/transport"
+	"os"
+)
+
+func main() {
+	out := flag.String("out", "smpc.key", "private key file to write")
+	flag.Parse()
+	if _, err := os.Stat(*out); err == nil {
+		fmt.Printf("Error: %s exists\n", *out)
+		os.Exit(1)
+	}
+	pub, err := transport.GenerateKey(*out)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Println(transport.FormatPublicKey(pub))
+}
@@ -0,0 +1,49 @@
+package gc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/tjim/smpcc/runtime/base"
+	"github.com/tjim/smpcc/runtime/bit"
+)
+
+/* Parameters and helpers shared by the two sides of cut-and-choose, gen/cc.go and eval/cc.go */
+
+const (
+	CCHashBits = 40 // rows of the input consistency hash, and of the MAC on outputs to the generator
+	CCRandBits = 80 // random bits added to each generator input to hide it from the hash
+	CCShares   = 8  // each evaluator input bit is the XOR of this many OT choices
+)
+
+/* A commitment to a wire key */
+func Commit(k Key) Key {
+	h := sha256.Sum256(k)
+	return Key(h[:base.KEY_SIZE])
+}
+
+/* Generator input label n of a copy is sent encrypted under this pad of the copy's evaluation key */
+func CCPad(k Key, n uint64) Key {
+	block := make([]byte, base.KEY_SIZE)
+	binary.BigEndian.PutUint64(block, n)
+	return Key(Encrypt(k, block))
+}
+
+/* The rows x cols matrix of the input consistency hash chosen by seed */
+func CCMatrix(seed Key, rows, cols int) [][]bool {
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		panic(err)
+	}
+	buf := make([]byte, (rows*cols+7)/8)
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(buf, buf)
+	m := make([][]bool, rows)
+	for i := range m {
+		m[i] = make([]bool, cols)
+		for j := range m[i] {
+			m[i][j] = bit.GetBit(buf, i*cols+j) == 1
+		}
+	}
+	return m
+}
@@ -101,6 +101,36 @@ func GaXDKC_D(A, B, T, P Key) Key {
 	return XorKey(rho, P)
 }
 
+//--- Half gates
+
+// HalfGatesH is the hash H(K, T) = pi(2K ^ T) ^ (2K ^ T) used by the
+// half-gates scheme of Zahur, Rosulek and Evans, "Two Halves Make a
+// Whole", Eurocrypt 2015.  pi is the fixed-key aesprf and 2K is
+// doubling in GF(2^128).
+func HalfGatesH(K, T Key) Key {
+	if len(K) != 16 || len(T) != 16 {
+		panic("HalfGatesH: keys must be 16 bytes")
+	}
+	K = XorKey(double(K), T)
+	ciphertext := make([]byte, aes.BlockSize)
+	aesprf.Encrypt(ciphertext, K)
+	return XorKey(ciphertext, K)
+}
+
+// Doubling in GF(2^128), big-endian, reduction polynomial x^128+x^7+x^2+x+1
+func double(K Key) Key {
+	result := make(Key, len(K))
+	var carry byte
+	for i := len(K) - 1; i >= 0; i-- {
+		result[i] = K[i]<<1 | carry
+		carry = K[i] >> 7
+	}
+	if carry != 0 {
+		result[len(result)-1] ^= 0x87
+	}
+	return result
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a
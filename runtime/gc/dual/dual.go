@@ -0,0 +1,449 @@
+/*
+Package dual runs two-party garbled circuit programs by dual
+execution, after Mohassel and Franklin, "Efficiency tradeoffs for
+malicious two-party computation," PKC 2006, and Huang, Katz and Evans,
+"Quid-Pro-Quo-tocols: Strengthening semi-honest protocols with dual
+execution," IEEE S&P 2012.
+
+Each party is generator of one execution of the program and evaluator
+of the other: party 0 garbles execution A and party 1 garbles
+execution B, each over its own connection.  Every reveal is masked,
+so that the value revealed is random, and before either party uses
+it the parties run an equality test on the output wire labels of both
+executions.  A malicious party can make its garbled circuit compute
+something else, but then the test fails, so it learns at most one bit
+(whether the test fails) beyond its output.
+
+Party 0 runs the program's gen side with VM0s, and party 1 its eval
+side with VM1s.  Both do the work of execution A first and then of
+execution B, so that neither waits on the other.
+*/
+package dual
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/tjim/smpcc/runtime/base"
+	"github.com/tjim/smpcc/runtime/bit"
+	. "github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+	"github.com/tjim/smpcc/runtime/transport"
+	"log"
+)
+
+/* Inputs are shared at most this many bits at a time */
+const chunk = 64
+
+/* Sizes of the chunks of an n-bit input */
+func chunks(n int) []int {
+	var result []int
+	for ; n > chunk; n -= chunk {
+		result = append(result, chunk)
+	}
+	return append(result, n)
+}
+
+/* A random n bits, in bit.GetBit order */
+func randomBits(n int) []byte {
+	v := make([]byte, (n+7)/8)
+	GenKey(v)
+	return v
+}
+
+/* Bits i to i+n of v as a uint64 */
+func getUint64(v []byte, i, n int) uint64 {
+	x := uint64(0)
+	for j := 0; j < n; j++ {
+		x |= uint64(bit.GetBit(v, i+j)) << uint(j)
+	}
+	return x
+}
+
+func xorBits(a []bool, m []byte) []bool {
+	result := make([]bool, len(a))
+	for i := range a {
+		result[i] = a[i] != (bit.GetBit(m, i) == 1)
+	}
+	return result
+}
+
+func commit(t, r Key) Key {
+	h := sha256.New()
+	h.Write(t)
+	h.Write(r)
+	return h.Sum(nil)
+}
+
+func fail() {
+	panic("dual execution: the executions disagree, the other party cheated")
+}
+
+//--- Party 0
+
+/*
+A wire of a VM0 is the two keys of execution A followed by the key of
+execution B.
+*/
+type VM0 struct {
+	gen  gen.VM  // Execution A
+	eval eval.VM // Execution B
+	io   gen.IO  // Of execution A, for the equality test
+}
+
+func NewVM0(io gen.IO, genVM gen.VM, evalVM eval.VM) *VM0 {
+	return &VM0{genVM, evalVM, io}
+}
+
+func split0(a []Wire) ([]Wire, []Key) {
+	x := make([]Wire, len(a))
+	y := make([]Key, len(a))
+	for i := range a {
+		x[i], y[i] = a[i][:2:2], a[i][2]
+	}
+	return x, y
+}
+
+func join0(x []Wire, y []Key) []Wire {
+	result := make([]Wire, len(x))
+	for i := range x {
+		result[i] = Wire{x[i][0], x[i][1], y[i]}
+	}
+	return result
+}
+
+func (y *VM0) And(a, b []Wire) []Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in dual.VM0.And()")
+	}
+	a0, a1 := split0(a)
+	b0, b1 := split0(b)
+	return join0(y.gen.And(a0, b0), y.eval.And(a1, b1))
+}
+
+func (y *VM0) Or(a, b []Wire) []Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in dual.VM0.Or()")
+	}
+	a0, a1 := split0(a)
+	b0, b1 := split0(b)
+	return join0(y.gen.Or(a0, b0), y.eval.Or(a1, b1))
+}
+
+func (y *VM0) Xor(a, b []Wire) []Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in dual.VM0.Xor()")
+	}
+	a0, a1 := split0(a)
+	b0, b1 := split0(b)
+	return join0(y.gen.Xor(a0, b0), y.eval.Xor(a1, b1))
+}
+
+func (y *VM0) Mux(s, a, b []Wire) []Wire {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Wire mismatch in dual.VM0.Mux()")
+	}
+	s0, s1 := split0(s)
+	a0, a1 := split0(a)
+	b0, b1 := split0(b)
+	return join0(y.gen.Mux(s0, a0, b0), y.eval.Mux(s1, a1, b1))
+}
+
+func (y *VM0) True() []Wire {
+	return join0(y.gen.True(), y.eval.True())
+}
+
+func (y *VM0) False() []Wire {
+	return join0(y.gen.False(), y.eval.False())
+}
+
+/* An input of party 0, bit i of v (bit.GetBit) */
+func (y *VM0) input0(v []byte, n int) []Wire {
+	var result []Wire
+	i := 0
+	for _, m := range chunks(n) {
+		x := getUint64(v, i, m)
+		result = append(result, join0(y.gen.ShareTo1(x, m), y.eval.ShareTo0(x, m))...)
+		i += m
+	}
+	return result
+}
+
+/* An input of party 1 */
+func (y *VM0) input1(n int) []Wire {
+	var result []Wire
+	for _, m := range chunks(n) {
+		result = append(result, join0(y.gen.ShareTo0(m), y.eval.ShareTo1(m))...)
+	}
+	return result
+}
+
+func (y *VM0) ShareTo0(bits int) []Wire {
+	return y.input1(bits)
+}
+
+func (y *VM0) ShareTo1(a uint64, bits int) []Wire {
+	if bits > 64 {
+		panic("ShareTo1: bits > 64")
+	}
+	v := make([]byte, 8)
+	for i := 0; i < bits; i++ {
+		bit.SetBit(v, i, byte(a>>uint(i)&1))
+	}
+	return y.input0(v, bits)
+}
+
+/* The session of execution A, which party 0 garbles */
+func (y *VM0) Session() *gen.Session {
+	return y.gen.Session()
+}
+
+/* Random bits are the XOR of random inputs of both parties, so that they are the same in both executions */
+func (y *VM0) Random(bits int) []Wire {
+	return y.Xor(y.input0(randomBits(bits), bits), y.input1(bits))
+}
+
+/*
+Reveal a to both parties, after checking that both executions agree
+on it.  Each party hashes, for each bit, the key of execution A and
+the key of execution B for the value it got, and the hashes are
+compared by commit and open.  A party can compute the other's hash
+only if it knows the keys, and it only knows both keys of the
+execution it garbled, so it learns nothing from the test but whether
+the values are the same.
+*/
+func (y *VM0) open(a []Wire) []bool {
+	x, k := split0(a)
+	y.gen.RevealTo1(x)
+	v := y.eval.RevealTo1(k)
+	h := sha256.New()
+	for i := range a {
+		if v[i] {
+			h.Write(x[i][1])
+		} else {
+			h.Write(x[i][0])
+		}
+		h.Write(k[i])
+	}
+	t := Key(h.Sum(nil))
+	r := randomBits(8 * base.KEY_SIZE)
+	y.io.SendK(commit(t, r))
+	t1 := y.io.RecvK2()
+	y.io.SendK(t)
+	y.io.SendK(r)
+	if !bytes.Equal(t, t1) {
+		fail()
+	}
+	return v
+}
+
+func (y *VM0) RevealTo0(a []Wire) []bool {
+	m := randomBits(len(a))
+	return xorBits(y.open(y.Xor(a, y.input0(m, len(a)))), m)
+}
+
+func (y *VM0) RevealTo1(a []Wire) {
+	y.open(y.Xor(a, y.input1(len(a))))
+}
+
+//--- Party 1
+
+/*
+A key of a VM1 is the key of execution A followed by the two keys of
+execution B.
+*/
+type VM1 struct {
+	eval eval.VM // Execution A
+	gen  gen.VM  // Execution B
+	io   eval.IO // Of execution A, for the equality test
+}
+
+func NewVM1(io eval.IO, evalVM eval.VM, genVM gen.VM) *VM1 {
+	return &VM1{evalVM, genVM, io}
+}
+
+func split1(a []Key) ([]Key, []Wire) {
+	x := make([]Key, len(a))
+	y := make([]Wire, len(a))
+	for i := range a {
+		k := base.KEY_SIZE
+		x[i], y[i] = a[i][:k:k], Wire{a[i][k : 2*k : 2*k], a[i][2*k : 3*k : 3*k]}
+	}
+	return x, y
+}
+
+func join1(x []Key, y []Wire) []Key {
+	result := make([]Key, len(x))
+	for i := range x {
+		k := make(Key, 0, 3*base.KEY_SIZE)
+		result[i] = append(append(append(k, x[i]...), y[i][0]...), y[i][1]...)
+	}
+	return result
+}
+
+func (y *VM1) And(a, b []Key) []Key {
+	if len(a) != len(b) {
+		panic("Wire mismatch in dual.VM1.And()")
+	}
+	a0, a1 := split1(a)
+	b0, b1 := split1(b)
+	return join1(y.eval.And(a0, b0), y.gen.And(a1, b1))
+}
+
+func (y *VM1) Or(a, b []Key) []Key {
+	if len(a) != len(b) {
+		panic("Wire mismatch in dual.VM1.Or()")
+	}
+	a0, a1 := split1(a)
+	b0, b1 := split1(b)
+	return join1(y.eval.Or(a0, b0), y.gen.Or(a1, b1))
+}
+
+func (y *VM1) Xor(a, b []Key) []Key {
+	if len(a) != len(b) {
+		panic("Wire mismatch in dual.VM1.Xor()")
+	}
+	a0, a1 := split1(a)
+	b0, b1 := split1(b)
+	return join1(y.eval.Xor(a0, b0), y.gen.Xor(a1, b1))
+}
+
+func (y *VM1) Mux(s, a, b []Key) []Key {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Wire mismatch in dual.VM1.Mux()")
+	}
+	s0, s1 := split1(s)
+	a0, a1 := split1(a)
+	b0, b1 := split1(b)
+	return join1(y.eval.Mux(s0, a0, b0), y.gen.Mux(s1, a1, b1))
+}
+
+func (y *VM1) True() []Key {
+	return join1(y.eval.True(), y.gen.True())
+}
+
+func (y *VM1) False() []Key {
+	return join1(y.eval.False(), y.gen.False())
+}
+
+/* An input of party 0 */
+func (y *VM1) input0(n int) []Key {
+	var result []Key
+	for _, m := range chunks(n) {
+		result = append(result, join1(y.eval.ShareTo1(m), y.gen.ShareTo0(m))...)
+	}
+	return result
+}
+
+/* An input of party 1, bit i of v (bit.GetBit) */
+func (y *VM1) input1(v []byte, n int) []Key {
+	var result []Key
+	i := 0
+	for _, m := range chunks(n) {
+		x := getUint64(v, i, m)
+		result = append(result, join1(y.eval.ShareTo0(x, m), y.gen.ShareTo1(x, m))...)
+		i += m
+	}
+	return result
+}
+
+func (y *VM1) ShareTo0(a uint64, bits int) []Key {
+	if bits > 64 {
+		panic("ShareTo0: bits > 64")
+	}
+	v := make([]byte, 8)
+	for i := 0; i < bits; i++ {
+		bit.SetBit(v, i, byte(a>>uint(i)&1))
+	}
+	return y.input1(v, bits)
+}
+
+func (y *VM1) ShareTo1(bits int) []Key {
+	return y.input0(bits)
+}
+
+func (y *VM1) Random(bits int) []Key {
+	return y.Xor(y.input0(bits), y.input1(randomBits(bits), bits))
+}
+
+/* Mirrors VM0.open */
+func (y *VM1) open(a []Key) []bool {
+	k, x := split1(a)
+	v := y.eval.RevealTo1(k)
+	y.gen.RevealTo1(x)
+	h := sha256.New()
+	for i := range a {
+		h.Write(k[i])
+		if v[i] {
+			h.Write(x[i][1])
+		} else {
+			h.Write(x[i][0])
+		}
+	}
+	t := Key(h.Sum(nil))
+	c := y.io.RecvK()
+	y.io.SendK2(t)
+	t0 := y.io.RecvK()
+	r := y.io.RecvK()
+	if !bytes.Equal(commit(t0, r), c) || !bytes.Equal(t, t0) {
+		fail()
+	}
+	return v
+}
+
+func (y *VM1) RevealTo0(a []Key) {
+	y.open(y.Xor(a, y.input0(len(a))))
+}
+
+func (y *VM1) RevealTo1(a []Key) []bool {
+	m := randomBits(len(a))
+	return xorBits(y.open(y.Xor(a, y.input1(m, len(a)))), m)
+}
+
+//--- Running
+
+/*
+Party 0 connects to party 1 at addrA for execution A, and accepts a
+connection from party 1 at addrB for execution B.
+*/
+func Party0(addrA, addrB string, main func([]gen.VM), numBlocks int, newGenVM func(io gen.IO, id ConcurrentId, s *gen.Session) gen.VM, newEvalVM func(io eval.IO, id ConcurrentId) eval.VM) {
+	listener, err := transport.Listen(addrB)
+	if err != nil {
+		log.Fatalf("listen(%q): %s", addrB, err)
+	}
+	var iosB []eval.IO
+	var connB *transport.Conn
+	accepted := make(chan bool)
+	go func() {
+		iosB, connB = eval.Accept2(listener, numBlocks)
+		accepted <- true
+	}()
+	iosA, connA := gen.Dial2(addrA, numBlocks)
+	defer connA.Close()
+	<-accepted
+	defer connB.Close()
+
+	vms := make([]gen.VM, numBlocks)
+	s := gen.NewSession()
+	for i := range vms {
+		vms[i] = NewVM0(iosA[i], newGenVM(iosA[i], ConcurrentId(i), s), newEvalVM(iosB[i], ConcurrentId(i)))
+	}
+	main(vms)
+	gen.Flush(iosA)
+}
+
+/* Party 1, the other side of Party0 */
+func Party1(addrA, addrB string, main func([]eval.VM), numBlocks int, newGenVM func(io gen.IO, id ConcurrentId, s *gen.Session) gen.VM, newEvalVM func(io eval.IO, id ConcurrentId) eval.VM) {
+	iosA, connA := eval.Listen2(addrA, numBlocks)
+	defer connA.Close()
+	iosB, connB := gen.Dial2(addrB, numBlocks)
+	defer connB.Close()
+
+	vms := make([]eval.VM, numBlocks)
+	s := gen.NewSession()
+	for i := range vms {
+		vms[i] = NewVM1(iosA[i], newEvalVM(iosA[i], ConcurrentId(i)), newGenVM(iosB[i], ConcurrentId(i), s))
+	}
+	main(vms)
+	gen.Flush(iosB)
+}
@@ -0,0 +1,133 @@
+package dual_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/dual"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+	hgeval "github.com/tjim/smpcc/runtime/gc/halfgates/eval"
+	hggen "github.com/tjim/smpcc/runtime/gc/halfgates/gen"
+	yaoeval "github.com/tjim/smpcc/runtime/gc/yao/eval"
+	yaogen "github.com/tjim/smpcc/runtime/gc/yao/gen"
+)
+
+type backEnd struct {
+	newGenVM  func(io gen.IO, id gc.ConcurrentId, s *gen.Session) gen.VM
+	newEvalVM func(io eval.IO, id gc.ConcurrentId) eval.VM
+}
+
+var backEnds = map[string]backEnd{
+	"yao":       {yaogen.NewVM, yaoeval.NewVM},
+	"halfgates": {hggen.NewVM, hgeval.NewVM},
+}
+
+/* Connected gen and eval IOs over channels */
+func chanIOs() (gen.IO, eval.IO) {
+	io := gc.NewChanio()
+	gio := make(chan gen.IO)
+	go func() { gio <- gen.NewIOX(*io) }()
+	eio := eval.NewIOX(*io)
+	return <-gio, eio
+}
+
+/* The VMs of both parties; wrap, if not nil, wraps party 0's garbling of execution A */
+func dualVMs(be backEnd, wrap func(gen.VM) gen.VM) (gen.VM, eval.VM) {
+	gioA, eioA := chanIOs()
+	gioB, eioB := chanIOs()
+	genA := be.newGenVM(gioA, 0, gen.NewSession())
+	if wrap != nil {
+		genA = wrap(genA)
+	}
+	vm0 := dual.NewVM0(gioA, genA, be.newEvalVM(eioB, 0))
+	vm1 := dual.NewVM1(eioA, be.newEvalVM(eioA, 0), be.newGenVM(gioB, 0, gen.NewSession()))
+	return vm0, vm1
+}
+
+func toUint64(bits []bool) uint64 {
+	var result uint64
+	for i, b := range bits {
+		if b {
+			result |= 1 << uint(i)
+		}
+	}
+	return result
+}
+
+/* Party 0's a and party 1's b, their sum, product and and, and a random value xored with itself, revealed to both */
+func party0(vm gen.VM, a uint64) []uint64 {
+	x, y := vm.ShareTo1(a, 32), vm.ShareTo0(32)
+	r := vm.Random(100)
+	var result []uint64
+	for _, z := range [][]gc.Wire{gen.Add(vm, x, y), gen.Mul(vm, x, y), gen.And(vm, x, y), gen.Xor(vm, r, r)[:64]} {
+		result = append(result, toUint64(vm.RevealTo0(z)))
+		vm.RevealTo1(z)
+	}
+	return result
+}
+
+func party1(vm eval.VM, b uint64) []uint64 {
+	x, y := vm.ShareTo1(32), vm.ShareTo0(b, 32)
+	r := vm.Random(100)
+	var result []uint64
+	for _, z := range [][]gc.Key{eval.Add(vm, x, y), eval.Mul(vm, x, y), eval.And(vm, x, y), eval.Xor(vm, r, r)[:64]} {
+		vm.RevealTo0(z)
+		result = append(result, toUint64(vm.RevealTo1(z)))
+	}
+	return result
+}
+
+func TestDual(t *testing.T) {
+	const a, b = 1234567, 89
+	want := []uint64{(a + b) & 0xffffffff, (a * b) & 0xffffffff, a & b, 0}
+	for name, be := range backEnds {
+		vm0, vm1 := dualVMs(be, nil)
+		done := make(chan []uint64)
+		go func() { done <- party0(vm0, a) }()
+		r1 := party1(vm1, b)
+		r0 := <-done
+		for i := range want {
+			if r0[i] != want[i] || r1[i] != want[i] {
+				t.Errorf("%s, result %d: party 0 gets %d, party 1 gets %d, want %d", name, i, r0[i], r1[i], want[i])
+			}
+		}
+	}
+}
+
+/* A garbler that computes an Or where the circuit has an And */
+type cheatVM struct{ gen.VM }
+
+func (y cheatVM) And(a, b []gc.Wire) []gc.Wire {
+	return y.VM.Or(a, b)
+}
+
+/* Whether r is the panic of a failed equality test */
+func disagree(r interface{}) bool {
+	s, ok := r.(string)
+	return ok && strings.HasPrefix(s, "dual execution: the executions disagree")
+}
+
+func TestDualCheat(t *testing.T) {
+	for name, be := range backEnds {
+		vm0, vm1 := dualVMs(be, func(vm gen.VM) gen.VM { return cheatVM{vm} })
+		caught0 := make(chan interface{})
+		go func() {
+			defer func() { caught0 <- recover() }()
+			party0(vm0, 1234567)
+		}()
+		var caught1 interface{}
+		func() {
+			defer func() { caught1 = recover() }()
+			party1(vm1, 89)
+		}()
+		/* the sum of execution A has carries of a | b, and both parties find that it is not the sum of execution B */
+		if !disagree(caught1) {
+			t.Errorf("%s: party 1 did not catch party 0 cheating: %v", name, caught1)
+		}
+		if r := <-caught0; !disagree(r) {
+			t.Errorf("%s: party 0 did not find that the executions disagree: %v", name, r)
+		}
+	}
+}
@@ -0,0 +1,465 @@
+package eval
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/tjim/smpcc/runtime/base"
+	"github.com/tjim/smpcc/runtime/bit"
+	. "github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+	"github.com/tjim/smpcc/runtime/ot"
+	"math/big"
+)
+
+/*
+Cut-and-choose, the evaluator's side of gen/cc.go.  Copies that are
+evaluated use a back end eval VM.  Copies that are checked use a back
+end gen VM with the copy's seed, whose tables and keys must match the
+ones the generator sends.
+
+A key of a cut-and-choose VM is the keys of all copies, concatenated:
+the key of an evaluated copy, and both keys of a checked copy.
+*/
+type ccVM struct {
+	io     IO
+	check  []bool // Whether each copy is checked
+	keys   []Key  // The evaluation key, or the seed, of each copy
+	evals  []VM
+	checks []gen.VM
+	cios   []*ccCheckIO
+	off    []int  // Copy c of a key is key[off[c]:off[c+1]]
+	inputs uint64 // Generator input labels received so far, for CCPad
+}
+
+/* The IO of a checked copy: what it sends must match what the generator sends */
+type ccCheckIO struct {
+	IO
+	mute bool
+}
+
+func ccFail() {
+	panic("cut-and-choose: check failed, the generator cheated")
+}
+
+func (io *ccCheckIO) SendT(t GarbledTable) {
+	u := io.IO.RecvT()
+	if len(t) != len(u) {
+		ccFail()
+	}
+	for i := range t {
+		if !bytes.Equal(t[i], u[i]) {
+			ccFail()
+		}
+	}
+}
+
+func (io *ccCheckIO) SendK(k Key) {
+	if !io.mute && !bytes.Equal(k, io.IO.RecvK()) {
+		ccFail()
+	}
+}
+
+func (io *ccCheckIO) Flush() {
+}
+
+func (io *ccCheckIO) Send(a, b ot.Message) {
+	panic("ccCheckIO.Send(): unexpected OT")
+}
+
+func (io *ccCheckIO) SendM(a, b []ot.Message) {
+	if !io.mute {
+		panic("ccCheckIO.SendM(): unexpected OT")
+	}
+}
+
+func (io *ccCheckIO) SendMBits(a, b []byte) {
+	panic("ccCheckIO.SendMBits(): unexpected OT")
+}
+
+func (io *ccCheckIO) RecvK2() Key {
+	panic("ccCheckIO.RecvK2(): unexpected")
+}
+
+/* A random n bits, in bit.GetBit order */
+func randomBits(n int) []byte {
+	v := make([]byte, (n+7)/8)
+	GenKey(v)
+	return v
+}
+
+/* Choose about 3/5 of the copies to check, and at least one to evaluate */
+func chooseChecks(copies int) []bool {
+	checks := copies * 3 / 5
+	if checks < 1 {
+		checks = 1
+	}
+	if checks > copies-1 {
+		checks = copies - 1
+	}
+	perm := make([]int, copies)
+	for i := range perm {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			panic(err)
+		}
+		perm[i] = perm[j.Int64()]
+		perm[j.Int64()] = i
+	}
+	check := make([]bool, copies)
+	for _, c := range perm[:checks] {
+		check[c] = true
+	}
+	return check
+}
+
+/* Cut-and-choose VMs for ios, for a generator using gen.NewCCVMs with the back end of newVM and newGenVM */
+func NewCCVMs(ios []IO, copies int, newVM func(io IO, id ConcurrentId) VM, newGenVM func(io gen.IO, id ConcurrentId, s *gen.Session) gen.VM) []VM {
+	if copies < 2 {
+		panic("NewCCVMs: need at least 2 copies")
+	}
+	check := chooseChecks(copies)
+	r := make([]byte, (copies+7)/8)
+	off := make([]int, copies+1)
+	for c := range check {
+		off[c+1] = off[c] + base.KEY_SIZE
+		if check[c] {
+			bit.SetBit(r, c, 1)
+			off[c+1] += base.KEY_SIZE
+		}
+	}
+	keys := ReceiveKeys(ios[0], r, copies)
+	sessions := make([]*gen.Session, copies)
+	for c := range keys {
+		if check[c] {
+			sessions[c] = gen.NewSeededSession(keys[c])
+		}
+	}
+	vms := make([]VM, len(ios))
+	for i, io := range ios {
+		y := &ccVM{io: io, check: check, keys: keys, evals: make([]VM, copies), checks: make([]gen.VM, copies), cios: make([]*ccCheckIO, copies), off: off}
+		for c := range check {
+			if check[c] {
+				y.cios[c] = &ccCheckIO{IO: io}
+				y.checks[c] = newGenVM(y.cios[c], ConcurrentId(i), sessions[c])
+			} else {
+				y.evals[c] = newVM(io, ConcurrentId(i))
+			}
+		}
+		vms[i] = y
+	}
+	return vms
+}
+
+func ServerCC(addr string, main func([]VM), numBlocks int, newVM func(io IO, id ConcurrentId) VM, newGenVM func(io gen.IO, id ConcurrentId, s *gen.Session) gen.VM, copies int) {
+	ios, conn := Listen2(addr, numBlocks)
+	defer conn.Close()
+	main(NewCCVMs(ios, copies, newVM, newGenVM))
+}
+
+/* Both keys of a checked copy as one key, and back */
+func fromWires(w []Wire) []Key {
+	result := make([]Key, len(w))
+	for i := range w {
+		result[i] = append(append(Key{}, w[i][0]...), w[i][1]...)
+	}
+	return result
+}
+
+func toWires(a []Key) []Wire {
+	result := make([]Wire, len(a))
+	for i, k := range a {
+		result[i] = Wire{k[:base.KEY_SIZE], k[base.KEY_SIZE:]}
+	}
+	return result
+}
+
+/* Copy c of the keys a */
+func (y *ccVM) part(a []Key, c int) []Key {
+	result := make([]Key, len(a))
+	for i := range a {
+		result[i] = a[i][y.off[c]:y.off[c+1]:y.off[c+1]]
+	}
+	return result
+}
+
+/* Join the keys of f(c) for every copy c */
+func (y *ccVM) each(f func(c int) []Key) []Key {
+	var result []Key
+	for c := range y.check {
+		x := f(c)
+		if result == nil {
+			result = make([]Key, len(x))
+			for i := range result {
+				result[i] = make(Key, 0, y.off[len(y.check)])
+			}
+		}
+		for i := range result {
+			result[i] = append(result[i], x[i]...)
+		}
+	}
+	return result
+}
+
+func (y *ccVM) gate(a, b []Key, g func(gen.VM, []Wire, []Wire) []Wire, e func(VM, []Key, []Key) []Key) []Key {
+	return y.each(func(c int) []Key {
+		if y.check[c] {
+			return fromWires(g(y.checks[c], toWires(y.part(a, c)), toWires(y.part(b, c))))
+		}
+		return e(y.evals[c], y.part(a, c), y.part(b, c))
+	})
+}
+
+func (y *ccVM) And(a, b []Key) []Key {
+	if len(a) != len(b) {
+		panic("Wire mismatch in eval.ccVM.And()")
+	}
+	return y.gate(a, b, gen.VM.And, VM.And)
+}
+
+func (y *ccVM) Or(a, b []Key) []Key {
+	if len(a) != len(b) {
+		panic("Wire mismatch in eval.ccVM.Or()")
+	}
+	return y.gate(a, b, gen.VM.Or, VM.Or)
+}
+
+func (y *ccVM) Xor(a, b []Key) []Key {
+	if len(a) != len(b) {
+		panic("Wire mismatch in eval.ccVM.Xor()")
+	}
+	return y.gate(a, b, gen.VM.Xor, VM.Xor)
+}
+
+func (y *ccVM) Mux(s, a, b []Key) []Key {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Wire mismatch in eval.ccVM.Mux()")
+	}
+	return MuxKeys(y.And, y.Xor, s[0], a, b)
+}
+
+func (y *ccVM) True() []Key {
+	return y.each(func(c int) []Key {
+		if y.check[c] {
+			return fromWires(y.checks[c].True())
+		}
+		return y.evals[c].True()
+	})
+}
+
+func (y *ccVM) False() []Key {
+	return y.each(func(c int) []Key {
+		if y.check[c] {
+			return fromWires(y.checks[c].False())
+		}
+		return y.evals[c].False()
+	})
+}
+
+/* n new wires of checked copy c, as the generator makes them */
+func (y *ccVM) fresh(c, n int) []Wire {
+	y.cios[c].mute = true
+	defer func() { y.cios[c].mute = false }()
+	return y.checks[c].ShareTo0(n)
+}
+
+func (y *ccVM) hash(m [][]bool, a []Key) []Key {
+	result := make([]Key, len(m))
+	for j, row := range m {
+		acc := y.False()
+		for i, b := range row {
+			if b {
+				acc = y.Xor(acc, a[i:i+1])
+			}
+		}
+		result[j] = acc[0]
+	}
+	return result
+}
+
+/*
+Receive the generator's commitments to a and check them.  The result
+has the value of each bit of a in each evaluated copy, or -1 if the
+key matches neither commitment.
+*/
+func (y *ccVM) open(a []Key) [][]int {
+	result := make([][]int, len(a))
+	for i := range a {
+		result[i] = make([]int, len(y.check))
+		for c := range y.check {
+			h0, h1 := y.io.RecvK(), y.io.RecvK()
+			k := a[i][y.off[c]:y.off[c+1]]
+			result[i][c] = -1
+			if y.check[c] {
+				if !bytes.Equal(h0, Commit(k[:base.KEY_SIZE])) || !bytes.Equal(h1, Commit(k[base.KEY_SIZE:])) {
+					ccFail()
+				}
+				continue
+			}
+			switch h := Commit(k); {
+			case bytes.Equal(h, h0):
+				result[i][c] = 0
+			case bytes.Equal(h, h1):
+				result[i][c] = 1
+			}
+		}
+	}
+	return result
+}
+
+/* The majority of the evaluated copies, which must be more than half of them */
+func (y *ccVM) majority(vals [][]int) []bool {
+	evals := 0
+	for _, check := range y.check {
+		if !check {
+			evals++
+		}
+	}
+	result := make([]bool, len(vals))
+	for i, v := range vals {
+		count := [2]int{}
+		for _, x := range v {
+			if x >= 0 {
+				count[x]++
+			}
+		}
+		switch {
+		case 2*count[0] > evals:
+			result[i] = false
+		case 2*count[1] > evals:
+			result[i] = true
+		default:
+			panic("cut-and-choose: no majority output, the generator cheated")
+		}
+	}
+	return result
+}
+
+/* A generator input of n bits */
+func (y *ccVM) input(n int) []Key {
+	m := n + CCRandBits
+	a := y.each(func(c int) []Key {
+		var result []Key
+		if y.check[c] {
+			result = fromWires(y.fresh(c, m))
+		} else {
+			result = make([]Key, m)
+		}
+		for i := 0; i < m; i++ {
+			k := y.io.RecvK()
+			if !y.check[c] {
+				result[i] = XorKey(k, CCPad(y.keys[c], y.inputs+uint64(i)))
+			}
+		}
+		return result
+	})
+	y.inputs += uint64(m)
+
+	/* every evaluated copy must have the same input */
+	seed := randomBits(8 * base.KEY_SIZE)
+	y.io.SendK2(seed)
+	for _, v := range y.open(y.hash(CCMatrix(seed, CCHashBits, m), a)) {
+		val := -1
+		for c, x := range v {
+			if y.check[c] {
+				continue
+			}
+			if x < 0 || val >= 0 && x != val {
+				panic("cut-and-choose: the generator's inputs are inconsistent")
+			}
+			val = x
+		}
+	}
+	return a[:n]
+}
+
+func (y *ccVM) ShareTo1(bits int) []Key {
+	if bits > 64 {
+		panic("ShareTo1: bits > 64")
+	}
+	return y.input(bits)
+}
+
+/* An evaluator input, bit i of v (bit.GetBit) */
+func (y *ccVM) share0(v []byte, bits int) []Key {
+	n := CCShares * bits
+	r := randomBits(n)
+	for i := 0; i < bits; i++ {
+		x := bit.GetBit(v, i)
+		for j := 1; j < CCShares; j++ {
+			x ^= bit.GetBit(r, CCShares*i+j)
+		}
+		bit.SetBit(r, CCShares*i, x)
+	}
+	msgs := ReceiveKeys(y.io, r, n)
+	a := y.each(func(c int) []Key {
+		result := make([]Key, n)
+		if !y.check[c] {
+			for i := range result {
+				result[i] = msgs[i][c*base.KEY_SIZE : (c+1)*base.KEY_SIZE]
+			}
+			return result
+		}
+		w := y.fresh(c, n)
+		for i := range result {
+			if !bytes.Equal(msgs[i][c*base.KEY_SIZE:(c+1)*base.KEY_SIZE], w[i][bit.GetBit(r, i)]) {
+				ccFail()
+			}
+		}
+		return fromWires(w)
+	})
+	result := make([]Key, bits)
+	for i := range result {
+		acc := a[CCShares*i : CCShares*i+1]
+		for j := 1; j < CCShares; j++ {
+			acc = y.Xor(acc, a[CCShares*i+j:CCShares*i+j+1])
+		}
+		result[i] = acc[0]
+	}
+	return result
+}
+
+func (y *ccVM) ShareTo0(v uint64, bits int) []Key {
+	if bits > 64 {
+		panic("ShareTo0: bits > 64")
+	}
+	b := make([]byte, 8)
+	for i := 0; i < bits; i++ {
+		bit.SetBit(b, i, byte(v>>uint(i)&1))
+	}
+	return y.share0(b, bits)
+}
+
+func (y *ccVM) Random(bits int) []Key {
+	return y.Xor(y.input(bits), y.share0(randomBits(bits), bits))
+}
+
+func (y *ccVM) RevealTo1(a []Key) []bool {
+	return y.majority(y.open(a))
+}
+
+func (y *ccVM) mac(z, k, b []Key) []Key {
+	t := make([]Key, len(b))
+	for j := range t {
+		p := y.And(k[j*len(z):(j+1)*len(z)], z)
+		acc := b[j : j+1]
+		for i := range p {
+			acc = y.Xor(acc, p[i:i+1])
+		}
+		t[j] = acc[0]
+	}
+	return t
+}
+
+func (y *ccVM) RevealTo0(a []Key) {
+	n := len(a)
+	z := y.Xor(a, y.input(n))
+	t := y.mac(z, y.input(CCHashBits*n), y.input(CCHashBits))
+	zt := y.RevealTo1(append(z[:n:n], t...))
+	result := make([]byte, (len(zt)+7)/8)
+	for i, b := range zt {
+		if b {
+			bit.SetBit(result, i, 1)
+		}
+	}
+	y.io.SendK2(result)
+}
@@ -0,0 +1,119 @@
+package eval_test
+
+import (
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	gaxeval "github.com/tjim/smpcc/runtime/gc/gax/eval"
+	gaxgen "github.com/tjim/smpcc/runtime/gc/gax/gen"
+	gaxreval "github.com/tjim/smpcc/runtime/gc/gaxr/eval"
+	gaxrgen "github.com/tjim/smpcc/runtime/gc/gaxr/gen"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+	hgeval "github.com/tjim/smpcc/runtime/gc/halfgates/eval"
+	hggen "github.com/tjim/smpcc/runtime/gc/halfgates/gen"
+	yaoeval "github.com/tjim/smpcc/runtime/gc/yao/eval"
+	yaogen "github.com/tjim/smpcc/runtime/gc/yao/gen"
+	yaoreval "github.com/tjim/smpcc/runtime/gc/yaor/eval"
+	yaorgen "github.com/tjim/smpcc/runtime/gc/yaor/gen"
+)
+
+type backEnd struct {
+	newGenVM  func(io gen.IO, id gc.ConcurrentId, s *gen.Session) gen.VM
+	newEvalVM func(io eval.IO, id gc.ConcurrentId) eval.VM
+}
+
+var backEnds = map[string]backEnd{
+	"yao":       {yaogen.NewVM, yaoeval.NewVM},
+	"yaor":      {yaorgen.NewVM, yaoreval.NewVM},
+	"gax":       {gaxgen.NewVM, gaxeval.NewVM},
+	"gaxr":      {gaxrgen.NewVM, gaxreval.NewVM},
+	"halfgates": {hggen.NewVM, hgeval.NewVM},
+}
+
+/* Connected gen and eval IOs over channels */
+func chanIOs() (gen.IO, eval.IO) {
+	io := gc.NewChanio()
+	gio := make(chan gen.IO)
+	go func() { gio <- gen.NewIOX(*io) }()
+	eio := eval.NewIOX(*io)
+	return <-gio, eio
+}
+
+func toUint64(bits []bool) uint64 {
+	var result uint64
+	for i, b := range bits {
+		if b {
+			result |= 1 << uint(i)
+		}
+	}
+	return result
+}
+
+/* The generator's a and the evaluator's b, their sum and product, and a random value xored with itself, revealed to both */
+func ccGen(vm gen.VM, a uint64) []uint64 {
+	x, y := vm.ShareTo1(a, 32), vm.ShareTo0(32)
+	r := vm.Random(8)
+	var result []uint64
+	for _, z := range [][]gc.Wire{gen.Add(vm, x, y), gen.Mul(vm, x, y), gen.Xor(vm, r, r)} {
+		result = append(result, toUint64(vm.RevealTo0(z)))
+		vm.RevealTo1(z)
+	}
+	return result
+}
+
+func ccEval(vm eval.VM, b uint64) []uint64 {
+	x, y := vm.ShareTo1(32), vm.ShareTo0(b, 32)
+	r := vm.Random(8)
+	var result []uint64
+	for _, z := range [][]gc.Key{eval.Add(vm, x, y), eval.Mul(vm, x, y), eval.Xor(vm, r, r)} {
+		vm.RevealTo0(z)
+		result = append(result, toUint64(vm.RevealTo1(z)))
+	}
+	return result
+}
+
+func TestCC(t *testing.T) {
+	const a, b = 1234567, 89
+	want := []uint64{(a + b) & 0xffffffff, (a * b) & 0xffffffff, 0}
+	for name, be := range backEnds {
+		gio, eio := chanIOs()
+		done := make(chan []uint64)
+		go func() { done <- ccGen(gen.NewCCVMs([]gen.IO{gio}, 5, be.newGenVM)[0], a) }()
+		e := ccEval(eval.NewCCVMs([]eval.IO{eio}, 5, be.newEvalVM, be.newGenVM)[0], b)
+		g := <-done
+		for i := range want {
+			if g[i] != want[i] || e[i] != want[i] {
+				t.Errorf("%s, result %d: gen gives %d, eval gives %d, want %d", name, i, g[i], e[i], want[i])
+			}
+		}
+	}
+}
+
+/* A generator that garbles an Or where the circuit has an And */
+type cheatVM struct{ gen.VM }
+
+func (y cheatVM) And(a, b []gc.Wire) []gc.Wire {
+	return y.VM.Or(a, b)
+}
+
+func TestCCCheat(t *testing.T) {
+	for name, be := range backEnds {
+		be := be
+		/* every copy is corrupt, so whichever copies the evaluator checks, at least one is */
+		cheat := func(io gen.IO, id gc.ConcurrentId, s *gen.Session) gen.VM {
+			return cheatVM{be.newGenVM(io, id, s)}
+		}
+		gio, eio := chanIOs()
+		/* the generator is left waiting when the evaluator aborts */
+		go func() { ccGen(gen.NewCCVMs([]gen.IO{gio}, 5, cheat)[0], 1234567) }()
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: the evaluator did not catch the generator cheating", name)
+				}
+			}()
+			ccEval(eval.NewCCVMs([]eval.IO{eio}, 5, be.newEvalVM, be.newGenVM)[0], 89)
+		}()
+	}
+}
@@ -0,0 +1,98 @@
+package eval
+
+import "fmt"
+import base "github.com/tjim/smpcc/runtime/gc"
+
+/*
+Bit counting.  Counts are summed in a tree of ripple adders in which
+each adder takes one more bit of the input as its carry in, so a count
+of n bits costs about n ANDs, and its depth is the sum of the
+widths of the adders on a path, O(log^2 n).
+*/
+
+/* a+b+c for the k-bit a and b and the bit c, as k+1 bits */
+func addCarry(io VM, a, b []base.Key, c base.Key) []base.Key {
+	result := make([]base.Key, len(a)+1)
+	cw := []base.Key{c}
+	for i := range a {
+		ai := a[i : i+1]
+		bi := b[i : i+1]
+		bi_xor_c := Xor(io, bi, cw)
+		result[i] = Xor(io, ai, bi_xor_c)[0]
+		cw = Xor(io, cw, And(io, Xor(io, ai, cw), bi_xor_c))
+	}
+	result[len(a)] = cw[0]
+	return result
+}
+
+/* a, zero-extended or truncated to n bits */
+func resize(io VM, a []base.Key, n int) []base.Key {
+	if len(a) < n {
+		return Zext(io, a, n)
+	}
+	return a[:n]
+}
+
+/* The number of set bits of a, of as few bits as the tree gives */
+func count(io VM, a []base.Key) []base.Key {
+	n := len(a)
+	switch n {
+	case 1:
+		return a
+	case 2:
+		return []base.Key{Xor0(io, a[0], a[1]), And(io, a[0:1], a[1:2])[0]}
+	}
+	mid := (n - 1) / 2
+	l := count(io, a[:mid])
+	r := count(io, a[mid:n-1])
+	if len(l) < len(r) {
+		l = Zext(io, l, len(r))
+	}
+	return addCarry(io, l, r, a[n-1])
+}
+
+func Popcount(io VM, a []base.Key) []base.Key {
+	if len(a) == 0 {
+		panic("empty argument in eval.Popcount()")
+	}
+	return resize(io, count(io, a), len(a))
+}
+
+func HammingDistance(io VM, a, b []base.Key) []base.Key {
+	if len(a) != len(b) {
+		panic(fmt.Sprintf("Key mismatch in eval.HammingDistance(), %d vs %d", len(a), len(b)))
+	}
+	return Popcount(io, Xor(io, a, b))
+}
+
+/*
+The number of leading zeros of a, len(a) if a is 0, as the number of
+bits above which a is 0.  In a garbled circuit only the ANDs cost, so
+the ORs are chained rather than computed as a parallel prefix.
+*/
+func Ctlz(io VM, a []base.Key) []base.Key {
+	n := len(a)
+	if n == 0 {
+		panic("empty argument in eval.Ctlz()")
+	}
+	p := make([]base.Key, n)
+	p[n-1] = a[n-1]
+	for i := n - 2; i >= 0; i-- {
+		p[i] = Or0(io, a[i], p[i+1])
+	}
+	return Popcount(io, Not(io, p))
+}
+
+/* The number of trailing zeros of a, len(a) if a is 0 */
+func Cttz(io VM, a []base.Key) []base.Key {
+	n := len(a)
+	if n == 0 {
+		panic("empty argument in eval.Cttz()")
+	}
+	p := make([]base.Key, n)
+	p[0] = a[0]
+	for i := 1; i < n; i++ {
+		p[i] = Or0(io, a[i], p[i-1])
+	}
+	return Popcount(io, Not(io, p))
+}
@@ -0,0 +1,156 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/tjim/smpcc/runtime/base"
+	. "github.com/tjim/smpcc/runtime/gc"
+	"math"
+)
+
+/*
+Fixed point: a signed n-bit value a stands for a/2^frac, where frac,
+the fractional width, is between 1 and n/2.  Addition, subtraction
+and comparison are those of integers.  FixMul truncates toward
+negative infinity and FixMulRound rounds to nearest; the other
+functions truncate.  FixLog and FixSigmoid are good to a few units in
+the last place, and FixExp to a few units of 2^-frac relative to its
+result, plus one in the last place.  Results out of range are
+unspecified unless a function says otherwise.
+*/
+
+func checkFrac(op string, n, frac int) {
+	if frac < 1 || frac > n/2 {
+		panic(fmt.Sprintf("%s: fractional width %d of a %d-bit value", op, frac, n))
+	}
+}
+
+/* c in fixed point, rounded */
+func fixConst(io VM, c float64, n, frac int) []Key {
+	v := int64(math.Floor(math.Ldexp(c, frac) + 0.5))
+	if n > 64 {
+		return Sext(io, Int(io, v, 64), n)
+	}
+	return Int(io, v, n)
+}
+
+/* The product a*b, of n+frac bits, which holds the product of a and b as fixed point of 2*frac fractional bits */
+func fixProduct(io VM, a, b []Key, frac int) []Key {
+	w := len(a) + frac
+	return Mul(io, Sext(io, a, w), Sext(io, b, w))
+}
+
+func FixMul(io VM, a, b []Key, frac int) []Key {
+	if len(a) != len(b) {
+		panic(fmt.Sprintf("Key mismatch in eval.FixMul(), %d vs %d", len(a), len(b)))
+	}
+	checkFrac("FixMul", len(a), frac)
+	return Ashr(io, fixProduct(io, a, b, frac), frac)[:len(a)]
+}
+
+func FixMulRound(io VM, a, b []Key, frac int) []Key {
+	if len(a) != len(b) {
+		panic(fmt.Sprintf("Key mismatch in eval.FixMulRound(), %d vs %d", len(a), len(b)))
+	}
+	checkFrac("FixMulRound", len(a), frac)
+	p := fixProduct(io, a, b, frac)
+	p = Add(io, p, Zext(io, Uint(io, 1<<uint(frac-1), frac), len(p)))
+	return Ashr(io, p, frac)[:len(a)]
+}
+
+/* a/b, truncated toward zero */
+func FixDiv(io VM, a, b []Key, frac int) []Key {
+	if len(a) != len(b) {
+		panic(fmt.Sprintf("Key mismatch in eval.FixDiv(), %d vs %d", len(a), len(b)))
+	}
+	checkFrac("FixDiv", len(a), frac)
+	w := len(a) + frac
+	return Sdiv(io, Shl(io, Sext(io, a, w), frac), Sext(io, b, w))[:len(a)]
+}
+
+func FixRecip(io VM, a []Key, frac int) []Key {
+	return FixDiv(io, fixConst(io, 1, len(a), frac), a, frac)
+}
+
+/*
+The square root of a, the integer square root of a<<frac, found a bit
+at a time as in long division; negative a gives 0.
+*/
+func FixSqrt(io VM, a []Key, frac int) []Key {
+	n := len(a)
+	checkFrac("FixSqrt", n, frac)
+	h := (n + frac + 1) / 2
+	x := Shl(io, Zext(io, a, 2*h), frac)
+	root := zeros(io, h)
+	rem := zeros(io, h+2)
+	for i := h - 1; i >= 0; i-- {
+		rem = cat(x[2*i:2*i+2], rem[:h])
+		trial := cat(True(io), False(io), root)
+		d := Sub(io, Zext(io, rem, h+3), Zext(io, trial, h+3))
+		ge := Not(io, d[h+2:])
+		rem = Select(io, ge, d[:h+2], rem)
+		root = cat(ge, root[:h-1])
+	}
+	if h < n {
+		root = Zext(io, root, n)
+	}
+	return Select(io, a[n-1:], zeros(io, n), root)
+}
+
+/*
+e^a, as 2^(a log2 e) = 2^k 2^f with k an integer and f in [0, 1): 2^f
+by as many terms of its Taylor series as frac needs, and 2^k by a
+shift.  log2 e has n-2 fractional bits, so that a log2 e is good to
+the last place of frac for any a, and the error is relative: 2^f is
+good to a few units of 2^-frac, and 2^k scales the error with the
+result.  A result too large gives the largest value.
+*/
+func FixExp(io VM, a []Key, frac int) []Key {
+	n := len(a)
+	checkFrac("FixExp", n, frac)
+	/* one more bit, so that a log2 e does not overflow */
+	s := n - 2
+	w := n + 1 + s
+	y := Ashr(io, Mul(io, Sext(io, a, w), Zext(io, Uint(io, base.Log2E(uint(s)), n), w)), s)[:n+1]
+	k := Ashr(io, y, frac)
+	f := cat(y[:frac], zeros(io, n+1-frac))
+	terms := base.ExpTerms(uint(frac))
+	p := fixConst(io, math.Pow(math.Ln2, float64(terms-1))/math.Gamma(float64(terms)), n+1, frac)
+	for j := terms - 2; j >= 0; j-- {
+		p = Add(io, FixMul(io, p, f, frac), fixConst(io, math.Pow(math.Ln2, float64(j))/math.Gamma(float64(j+1)), n+1, frac))
+	}
+	r := Select(io, k[n:], LshrV(io, p, neg(io, k)), ShlV(io, p, k))
+	over := Icmp_sgt(io, k, fixConst(io, float64(n-2-frac), n+1, 0))
+	return Select(io, over, Uint(io, 1<<uint(n-1)-1, n), r[:n])
+}
+
+/*
+The natural log of a, as k ln 2 + ln m for a = m 2^k with m in [1, 2),
+and ln m = 2 atanh(u) = 2(u + u^3/3 + ...) for u = (m-1)/(m+1) in
+[0, 1/3).  a <= 0 gives the smallest value.
+*/
+func FixLog(io VM, a []Key, frac int) []Key {
+	n := len(a)
+	checkFrac("FixLog", n, frac)
+	m, k := normalize(io, a, Int(io, int64(n-1-frac), n))
+	m = Lshr(io, m, n-1-frac)
+	one := fixConst(io, 1, n, frac)
+	u := FixDiv(io, Sub(io, m, one), Add(io, m, one), frac)
+	u2 := FixMul(io, u, u, frac)
+	s := fixConst(io, 1.0/11, n, frac)
+	for j := 9; j >= 1; j -= 2 {
+		s = Add(io, FixMul(io, s, u2, frac), fixConst(io, 1/float64(j), n, frac))
+	}
+	r := Add(io, Shl(io, FixMul(io, s, u, frac), 1), Mul(io, k, fixConst(io, math.Ln2, n, frac)))
+	positive := Icmp_sgt(io, a, zeros(io, n))
+	return Select(io, positive, r, Uint(io, 1<<uint(n-1), n))
+}
+
+/* 1/(1+e^-a) */
+func FixSigmoid(io VM, a []Key, frac int) []Key {
+	n := len(a)
+	checkFrac("FixSigmoid", n, frac)
+	one := fixConst(io, 1, n, frac)
+	d := Add(io, one, FixExp(io, neg(io, a), frac))
+	/* 1+e^-a overflows only when the result is 0 */
+	return Select(io, Icmp_slt(io, d, one), zeros(io, n), FixRecip(io, d, frac))
+}
@@ -0,0 +1,420 @@
+package eval
+
+import "fmt"
+import base "github.com/tjim/smpcc/runtime/gc"
+
+/*
+Soft floating point: IEEE 754 binary32 and binary64 arithmetic on
+32- and 64-bit values, rounding to nearest, ties to even, with
+subnormals.  Every NaN result is the canonical quiet NaN.  As in
+Berkeley SoftFloat, a significand carries three bits below its last
+(guard, round and sticky) until it is rounded, and a right shift ORs
+the bits it drops into the sticky bit ("jamming").
+*/
+
+/* The widths of the exponent and fraction fields of a format */
+type floatFormat struct {
+	exp, frac int
+}
+
+func formatOf(n int) floatFormat {
+	switch n {
+	case 32:
+		return floatFormat{8, 23}
+	case 64:
+		return floatFormat{11, 52}
+	}
+	panic(fmt.Sprintf("no floating-point format of %d bits", n))
+}
+
+func formatOf2(op string, a, b []base.Key) floatFormat {
+	if len(a) != len(b) {
+		panic(fmt.Sprintf("Wire mismatch in eval.%s(), %d vs %d", op, len(a), len(b)))
+	}
+	return formatOf(len(a))
+}
+
+func (f floatFormat) bias() int64 {
+	return 1<<uint(f.exp-1) - 1
+}
+
+/* Unpacked exponents are signed, with room for products and quotients */
+func (f floatFormat) expWidth() int {
+	return f.exp + 3
+}
+
+type unpacked struct {
+	sign, nan, inf, zero []base.Key
+	exp                  []base.Key /* biased, 1 for a subnormal */
+	sig                  []base.Key /* f.frac+1 bits, with the leading bit */
+}
+
+func unpack(io VM, f floatFormat, a []base.Key) unpacked {
+	frac := a[:f.frac]
+	e := a[f.frac : f.frac+f.exp]
+	eZero := Icmp_eq(io, e, zeros(io, f.exp))
+	eMax := Icmp_eq(io, e, Uint(io, 1<<uint(f.exp)-1, f.exp))
+	fZero := Icmp_eq(io, frac, zeros(io, f.frac))
+	return unpacked{
+		sign: a[len(a)-1:],
+		nan:  And(io, eMax, Not(io, fZero)),
+		inf:  And(io, eMax, fZero),
+		zero: And(io, eZero, fZero),
+		exp:  Select(io, eZero, Uint(io, 1, f.expWidth()), Zext(io, e, f.expWidth())),
+		sig:  cat(frac, Not(io, eZero)),
+	}
+}
+
+func cat(x ...[]base.Key) []base.Key {
+	result := []base.Key{}
+	for _, a := range x {
+		result = append(result, a...)
+	}
+	return result
+}
+
+func signedZero(io VM, f floatFormat, s []base.Key) []base.Key {
+	return cat(zeros(io, f.exp+f.frac), s)
+}
+
+func infinity(io VM, f floatFormat, s []base.Key) []base.Key {
+	return cat(Uint(io, (1<<uint(f.exp)-1)<<uint(f.frac), f.exp+f.frac), s)
+}
+
+func quietNaN(io VM, f floatFormat) []base.Key {
+	return Uint(io, (1<<uint(f.exp+1)-1)<<uint(f.frac-1), 1+f.exp+f.frac)
+}
+
+/* a shifted right by a variable d, jamming */
+func shiftRightJam(io VM, a, d []base.Key) []base.Key {
+	n := len(a)
+	result := a
+	sticky := False(io)[0]
+	k := 0
+	for ; k < len(d) && 1<<uint(k) < n; k++ {
+		s := 1 << uint(k)
+		lost := And(io, d[k:k+1], []base.Key{TreeOr0(io, result[:s]...)})
+		sticky = Or0(io, sticky, lost[0])
+		result = Select(io, d[k:k+1], cat(result[s:], zeros(io, s)), result)
+	}
+	if k < len(d) {
+		big := []base.Key{TreeOr0(io, d[k:]...)}
+		lost := And(io, big, []base.Key{TreeOr0(io, result...)})
+		sticky = Or0(io, sticky, lost[0])
+		result = Select(io, big, zeros(io, n), result)
+	}
+	result = cat(result)
+	result[0] = Or0(io, result[0], sticky)
+	return result
+}
+
+/* The top n bits of a, jamming, or a padded below to n bits */
+func fit(io VM, a []base.Key, n int) []base.Key {
+	if len(a) <= n {
+		return cat(zeros(io, n-len(a)), a)
+	}
+	result := cat(a[len(a)-n:])
+	result[0] = Or0(io, result[0], TreeOr0(io, a[:len(a)-n]...))
+	return result
+}
+
+/* Shift m left until its top bit is set, taking the shift from the exponent e; m must not be 0 */
+func normalize(io VM, m, e []base.Key) ([]base.Key, []base.Key) {
+	n := len(m)
+	s := 1
+	for s*2 < n {
+		s *= 2
+	}
+	for ; s >= 1; s /= 2 {
+		z := Not(io, []base.Key{TreeOr0(io, m[n-s:]...)})
+		m = Select(io, z, cat(zeros(io, s), m[:n-s]), m)
+		e = Select(io, z, Sub(io, e, Uint(io, uint64(s), len(e))), e)
+	}
+	return m, e
+}
+
+/*
+m has a carry bit above the f.frac+4 bits that roundPack wants, and e
+is the exponent of the bit below it; if the carry is set, shift it
+down, jamming.
+*/
+func carry(io VM, m, e []base.Key) ([]base.Key, []base.Key) {
+	n := len(m)
+	c := m[n-1:]
+	shifted := cat(m[1:])
+	shifted[0] = Or0(io, shifted[0], m[0])
+	return Select(io, c, shifted, m[:n-1]), Select(io, c, Add(io, e, Uint(io, 1, len(e))), e)
+}
+
+/*
+Round m, a significand of f.frac+4 bits whose top bit has the biased
+exponent e, to nearest even, and pack it with the sign s.  A small e
+makes the result subnormal or zero and a large one makes it infinite.
+*/
+func roundPack(io VM, f floatFormat, s, e, m []base.Key) []base.Key {
+	ew := len(e)
+	one := Uint(io, 1, ew)
+	tiny := Icmp_slt(io, e, one)
+	m = Select(io, tiny, shiftRightJam(io, m, Sub(io, one, e)), m)
+	e = Select(io, tiny, one, e)
+	inc := And(io, m[2:3], []base.Key{Or0(io, m[3], Or0(io, m[1], m[0]))})
+	q := Add(io, Zext(io, m[3:], f.frac+2), Zext(io, inc, f.frac+2))
+	/* a carry out of the significand moves into the exponent */
+	packed := Add(io, cat(zeros(io, f.frac), Sub(io, e, one)), Zext(io, q, f.frac+ew))
+	overflow := Icmp_uge(io, packed[f.frac:], Uint(io, 1<<uint(f.exp)-1, ew))
+	return Select(io, overflow, infinity(io, f, s), cat(packed[:f.frac+f.exp], s))
+}
+
+func Fadd(io VM, a, b []base.Key) []base.Key {
+	f := formatOf2("Fadd", a, b)
+	n := len(a)
+	x := unpack(io, f, a)
+	y := unpack(io, f, b)
+	/* operate on the larger magnitude and the smaller */
+	swap := Icmp_ugt(io, b[:n-1], a[:n-1])
+	sa, sb := Select(io, swap, y.sign, x.sign), Select(io, swap, x.sign, y.sign)
+	ea, eb := Select(io, swap, y.exp, x.exp), Select(io, swap, x.exp, y.exp)
+	ma, mb := Select(io, swap, y.sig, x.sig), Select(io, swap, x.sig, y.sig)
+	sub := Xor(io, sa, sb)
+	wa := cat(zeros(io, 3), ma, zeros(io, 1))
+	wb := shiftRightJam(io, cat(zeros(io, 3), mb, zeros(io, 1)), Sub(io, ea, eb))
+	sum := Select(io, sub, Sub(io, wa, wb), Add(io, wa, wb))
+	m, e := carry(io, sum, ea)
+	m, e = normalize(io, m, e)
+	result := roundPack(io, f, sa, e, m)
+	/* an exact zero is -0 only for -0 + -0 */
+	exact := Icmp_eq(io, sum, zeros(io, len(sum)))
+	result = Select(io, exact, signedZero(io, f, And(io, sa, Not(io, sub))), result)
+	result = Select(io, y.inf, b, result)
+	result = Select(io, x.inf, a, result)
+	nan := Or(io, Or(io, x.nan, y.nan), And(io, And(io, x.inf, y.inf), Xor(io, x.sign, y.sign)))
+	return Select(io, nan, quietNaN(io, f), result)
+}
+
+func Fsub(io VM, a, b []base.Key) []base.Key {
+	formatOf2("Fsub", a, b)
+	return Fadd(io, a, cat(b[:len(b)-1], Not(io, b[len(b)-1:])))
+}
+
+/* The 2n-bit product of n-bit a and b, by shift and add */
+func mulWide(io VM, a, b []base.Key) []base.Key {
+	n := len(a)
+	hi := zeros(io, n)
+	lo := make([]base.Key, n)
+	for i := 0; i < n; i++ {
+		t := Add(io, Zext(io, hi, n+1), Zext(io, Mask(io, b[i:i+1], a), n+1))
+		lo[i] = t[0]
+		hi = t[1:]
+	}
+	return cat(lo, hi)
+}
+
+func Fmul(io VM, a, b []base.Key) []base.Key {
+	f := formatOf2("Fmul", a, b)
+	x := unpack(io, f, a)
+	y := unpack(io, f, b)
+	s := Xor(io, x.sign, y.sign)
+	mx, ex := normalize(io, x.sig, x.exp)
+	my, ey := normalize(io, y.sig, y.exp)
+	e := Sub(io, Add(io, ex, ey), Int(io, f.bias(), f.expWidth()))
+	m, e := carry(io, fit(io, mulWide(io, mx, my), f.frac+5), e)
+	result := roundPack(io, f, s, e, m)
+	zero := Or(io, x.zero, y.zero)
+	inf := Or(io, x.inf, y.inf)
+	result = Select(io, zero, signedZero(io, f, s), result)
+	result = Select(io, inf, infinity(io, f, s), result)
+	nan := Or(io, Or(io, x.nan, y.nan), And(io, zero, inf))
+	return Select(io, nan, quietNaN(io, f), result)
+}
+
+func Fdiv(io VM, a, b []base.Key) []base.Key {
+	f := formatOf2("Fdiv", a, b)
+	x := unpack(io, f, a)
+	y := unpack(io, f, b)
+	s := Xor(io, x.sign, y.sign)
+	mx, ex := normalize(io, x.sig, x.exp)
+	my, ey := normalize(io, y.sig, y.exp)
+	e := Add(io, Sub(io, ex, ey), Int(io, f.bias()-1, f.expWidth()))
+	/* restoring division, as in udivrem, of f.frac+5 quotient bits */
+	n := f.frac + 2
+	d := Zext(io, my, n+1)
+	r := Zext(io, mx, n+1)
+	q := make([]base.Key, f.frac+5)
+	for i := len(q) - 1; i >= 0; i-- {
+		t := Sub(io, r, d)
+		q[i] = Not(io, t[n:])[0]
+		r = Select(io, q[i:i+1], t, r)
+		r = cat(zeros(io, 1), r[:n])
+	}
+	q[0] = Or0(io, q[0], TreeOr0(io, r...))
+	m, e := carry(io, q, e)
+	result := roundPack(io, f, s, e, m)
+	result = Select(io, Or(io, x.zero, y.inf), signedZero(io, f, s), result)
+	result = Select(io, Or(io, x.inf, y.zero), infinity(io, f, s), result)
+	nan := Or(io, Or(io, x.nan, y.nan), Or(io, And(io, x.zero, y.zero), And(io, x.inf, y.inf)))
+	return Select(io, nan, quietNaN(io, f), result)
+}
+
+/* Whether a and b are unordered (either is a NaN), and if not, whether a = b, a < b and a > b */
+func fcmp(io VM, a, b []base.Key) (uno, eq, lt, gt []base.Key) {
+	f := formatOf2("Fcmp", a, b)
+	n := len(a)
+	x := unpack(io, f, a)
+	y := unpack(io, f, b)
+	uno = Or(io, x.nan, y.nan)
+	ord := Not(io, uno)
+	bothZero := And(io, x.zero, y.zero) /* +0 = -0 */
+	eq = And(io, ord, Or(io, bothZero, Icmp_eq(io, a, b)))
+	ltMag := Icmp_ult(io, a[:n-1], b[:n-1])
+	gtMag := Icmp_ugt(io, a[:n-1], b[:n-1])
+	differ := Xor(io, x.sign, y.sign)
+	ord = And(io, ord, Not(io, bothZero))
+	lt = And(io, ord, Select(io, differ, x.sign, Select(io, x.sign, gtMag, ltMag)))
+	gt = And(io, ord, Select(io, differ, y.sign, Select(io, x.sign, ltMag, gtMag)))
+	return
+}
+
+func Fcmp_false(io VM, a, b []base.Key) []base.Key {
+	return False(io)
+}
+
+func Fcmp_oeq(io VM, a, b []base.Key) []base.Key {
+	_, eq, _, _ := fcmp(io, a, b)
+	return eq
+}
+
+func Fcmp_ogt(io VM, a, b []base.Key) []base.Key {
+	_, _, _, gt := fcmp(io, a, b)
+	return gt
+}
+
+func Fcmp_oge(io VM, a, b []base.Key) []base.Key {
+	_, eq, _, gt := fcmp(io, a, b)
+	return Or(io, gt, eq)
+}
+
+func Fcmp_olt(io VM, a, b []base.Key) []base.Key {
+	_, _, lt, _ := fcmp(io, a, b)
+	return lt
+}
+
+func Fcmp_ole(io VM, a, b []base.Key) []base.Key {
+	_, eq, lt, _ := fcmp(io, a, b)
+	return Or(io, lt, eq)
+}
+
+func Fcmp_one(io VM, a, b []base.Key) []base.Key {
+	_, _, lt, gt := fcmp(io, a, b)
+	return Or(io, lt, gt)
+}
+
+func Fcmp_ord(io VM, a, b []base.Key) []base.Key {
+	uno, _, _, _ := fcmp(io, a, b)
+	return Not(io, uno)
+}
+
+func Fcmp_ueq(io VM, a, b []base.Key) []base.Key {
+	uno, eq, _, _ := fcmp(io, a, b)
+	return Or(io, uno, eq)
+}
+
+func Fcmp_ugt(io VM, a, b []base.Key) []base.Key {
+	uno, _, _, gt := fcmp(io, a, b)
+	return Or(io, uno, gt)
+}
+
+func Fcmp_uge(io VM, a, b []base.Key) []base.Key {
+	_, _, lt, _ := fcmp(io, a, b)
+	return Not(io, lt)
+}
+
+func Fcmp_ult(io VM, a, b []base.Key) []base.Key {
+	uno, _, lt, _ := fcmp(io, a, b)
+	return Or(io, uno, lt)
+}
+
+func Fcmp_ule(io VM, a, b []base.Key) []base.Key {
+	_, _, _, gt := fcmp(io, a, b)
+	return Not(io, gt)
+}
+
+func Fcmp_une(io VM, a, b []base.Key) []base.Key {
+	_, eq, _, _ := fcmp(io, a, b)
+	return Not(io, eq)
+}
+
+func Fcmp_uno(io VM, a, b []base.Key) []base.Key {
+	uno, _, _, _ := fcmp(io, a, b)
+	return uno
+}
+
+func Fcmp_true(io VM, a, b []base.Key) []base.Key {
+	return True(io)
+}
+
+/* The signed integer a as a float of width bits */
+func Sitofp(io VM, a []base.Key, width int) []base.Key {
+	return itofp(io, formatOf(width), a[len(a)-1:], abs(io, a))
+}
+
+/* The unsigned integer a as a float of width bits */
+func Uitofp(io VM, a []base.Key, width int) []base.Key {
+	return itofp(io, formatOf(width), False(io), a)
+}
+
+func itofp(io VM, f floatFormat, s, a []base.Key) []base.Key {
+	m, e := normalize(io, a, Int(io, f.bias()+int64(len(a))-1, f.expWidth()))
+	result := roundPack(io, f, s, e, fit(io, m, f.frac+4))
+	return Select(io, Icmp_eq(io, a, zeros(io, len(a))), signedZero(io, f, False(io)), result)
+}
+
+/* a truncated toward zero to a signed integer of width bits; out of range, the result is unspecified, as in C */
+func Fptosi(io VM, a []base.Key, width int) []base.Key {
+	x := unpack(io, formatOf(len(a)), a)
+	v := fptoi(io, formatOf(len(a)), x, width)
+	return Select(io, x.sign, neg(io, v), v)
+}
+
+/* a truncated toward zero to an unsigned integer of width bits; out of range, the result is unspecified, as in C */
+func Fptoui(io VM, a []base.Key, width int) []base.Key {
+	return fptoi(io, formatOf(len(a)), unpack(io, formatOf(len(a)), a), width)
+}
+
+func fptoi(io VM, f floatFormat, x unpacked, width int) []base.Key {
+	v := Zext(io, x.sig, width+f.frac+1)
+	/* the magnitude is x.sig << (x.exp - bias - frac) */
+	sh := Sub(io, x.exp, Int(io, f.bias()+int64(f.frac), f.expWidth()))
+	left := ShlV(io, v, sh)
+	right := LshrV(io, v, neg(io, sh))
+	return Select(io, sh[len(sh)-1:], right, left)[:width]
+}
+
+/* a, a binary32, as a binary64 */
+func Fpext(io VM, a []base.Key, width int) []base.Key {
+	if len(a) >= width {
+		panic("fpext must extend operand")
+	}
+	return fconvert(io, formatOf(len(a)), formatOf(width), a)
+}
+
+/* a, a binary64, rounded to a binary32 */
+func Fptrunc(io VM, a []base.Key, width int) []base.Key {
+	if len(a) <= width {
+		panic("fptrunc must truncate operand")
+	}
+	return fconvert(io, formatOf(len(a)), formatOf(width), a)
+}
+
+func fconvert(io VM, from, to floatFormat, a []base.Key) []base.Key {
+	x := unpack(io, from, a)
+	e := x.exp
+	if len(e) < to.expWidth() {
+		e = Sext(io, e, to.expWidth())
+	}
+	m, e := normalize(io, x.sig, e)
+	e = Add(io, e, Int(io, to.bias()-from.bias(), len(e)))
+	result := roundPack(io, to, x.sign, e, fit(io, m, to.frac+4))
+	result = Select(io, x.zero, signedZero(io, to, x.sign), result)
+	result = Select(io, x.inf, infinity(io, to, x.sign), result)
+	return Select(io, x.nan, quietNaN(io, to), result)
+}
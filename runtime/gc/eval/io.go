@@ -1,10 +1,11 @@
 package eval
 
 import (
-	"github.com/tjim/fatchan"
 	. "github.com/tjim/smpcc/runtime/gc"
 	"github.com/tjim/smpcc/runtime/ot"
+	"github.com/tjim/smpcc/runtime/transport"
 	"log"
+	"math/big"
 	"net"
 )
 
@@ -28,64 +29,96 @@ func NewIOX(io Chanio) *IOX {
 	}
 }
 
-func Server(addr string, main func([]VM), numBlocks int, newVM func(io IO, id ConcurrentId) VM) {
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		log.Fatalf("listen(%q): %s", addr, err)
+/* Receive n keys sent by gen.SendKeys; r packs the n selections, most significant bit first */
+func ReceiveKeys(io IO, r []byte, n int) []Key {
+	if len(r) != (n+7)/8 {
+		panic("ReceiveKeys: selection vector has the wrong size")
+	}
+	msgs := io.ReceiveM(r)
+	result := make([]Key, n)
+	for i := range result {
+		result[i] = Key(msgs[i])
 	}
+	return result
+}
 
-	conn, err := listener.Accept()
+/* Accept a connection from a gen client and agree on the protocol and number of blocks */
+func accept(listener net.Listener, protocol string, numBlocks int) *transport.Conn {
+	conn, err := transport.Accept(listener, Security)
 	if err != nil {
 		log.Fatalf("accept(): %s", err)
 	}
-	xport := fatchan.New(conn, nil)
-	nu := make(chan Chanio)
-	xport.ToChan(nu)
+	if err := conn.Handshake(HandshakeParams(protocol, numBlocks)); err != nil {
+		log.Fatalf("handshake: %s", err)
+	}
+	return conn
+}
+
+func Server(addr string, main func([]VM), numBlocks int, newVM func(io IO, id ConcurrentId) VM) {
+	listener, err := transport.Listen(addr)
+	if err != nil {
+		log.Fatalf("listen(%q): %s", addr, err)
+	}
+	conn := accept(listener, "gc", numBlocks)
+	defer conn.Close()
 
 	vms := make([]VM, numBlocks)
 	for i := range vms {
-		io := <-nu
-		vms[i] = newVM(NewIOX(io), ConcurrentId(i))
+		io := NewChanio()
+		io.Bind(conn, i, false)
+		vms[i] = newVM(NewIOX(*io), ConcurrentId(i))
 	}
 	main(vms)
 }
 
 func Server2(addr string, main func([]VM), numBlocks int, newVM func(io IO, id ConcurrentId) VM) {
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		log.Fatalf("listen(%q): %s", addr, err)
+	ios, conn := Listen2(addr, numBlocks)
+	defer conn.Close()
+	vms := make([]VM, numBlocks)
+	for i := range vms {
+		vms[i] = newVM(ios[i], ConcurrentId(i))
 	}
+	main(vms)
+}
 
-	conn, err := listener.Accept()
+/* Accept a connection from a gen.Client2 and set up one IO per block; the caller must close the returned connection when done */
+func Listen2(addr string, numBlocks int) ([]IO, *transport.Conn) {
+	listener, err := transport.Listen(addr)
 	if err != nil {
-		log.Fatalf("accept(): %s", err)
+		log.Fatalf("listen(%q): %s", addr, err)
 	}
-	xport := fatchan.New(conn, nil)
-	nu := make(chan PerNodePair)
-	xport.ToChan(nu)
+	return Accept2(listener, numBlocks)
+}
+
+/* Like Listen2, on a listener that is already open */
+func Accept2(listener net.Listener, numBlocks int) ([]IO, *transport.Conn) {
+	conn := accept(listener, "gc-stream", numBlocks)
+	return bind2(conn, numBlocks), conn
+}
 
-	x := <-nu
-	if numBlocks != len(x.BlockChans) {
-		panic("Block mismatch")
+/* Set up one IO per block on conn, from a gen.Client2 */
+func bind2(conn *transport.Conn, numBlocks int) []IO {
+	x := PerNodePair{
+		ot.NPChans{make(chan *big.Int), make(chan *big.Int), make(chan ot.HashedElGamalCiph)},
+		make([]PerBlock, numBlocks),
 	}
+	for i := range x.BlockChans {
+		x.BlockChans[i] = PerBlock{
+			ClientAsSender{make(chan ot.MessagePair), make(chan []byte)},
+			NewCircuitChans(0),
+		}
+	}
+	x.Bind(conn, false)
 
 	baseSender := ot.NewNPSender(x.NPChans.ParamChan, x.NPChans.NpRecvPk, x.NPChans.NpSendEncs)
 	receiver0 := ot.NewStreamReceiver(baseSender, x.BlockChans[0].CAS.R2S, x.BlockChans[0].CAS.S2R)
 	ios := make([]IO, numBlocks)
 	for i := 0; i < numBlocks; i++ {
-		tchan := x.BlockChans[i].Tchan
-		kchan := x.BlockChans[i].Kchan
-		kchan2 := x.BlockChans[i].Kchan2
 		if i == 0 {
-			ios[i] = IOX{CircuitChans{tchan, kchan, kchan2}, receiver0}
+			ios[i] = IOX{x.BlockChans[i].CircuitChans, receiver0}
 		} else {
-			ios[i] = IOX{CircuitChans{tchan, kchan, kchan2}, receiver0.Fork(x.BlockChans[i].CAS.R2S, x.BlockChans[i].CAS.S2R)}
+			ios[i] = IOX{x.BlockChans[i].CircuitChans, receiver0.Fork(x.BlockChans[i].CAS.R2S, x.BlockChans[i].CAS.S2R)}
 		}
 	}
-
-	vms := make([]VM, numBlocks)
-	for i := range vms {
-		vms[i] = newVM(ios[i], ConcurrentId(i))
-	}
-	main(vms)
+	return ios
 }
@@ -0,0 +1,197 @@
+package eval
+
+import (
+	. "github.com/tjim/smpcc/runtime/gc"
+)
+
+/*
+Public values, the evaluator's side of gen.PublicVMs.  A public key
+(see gc.PublicKey) carries a bit known to both parties, and the VMs
+must treat exactly the bits the generator's do as public.
+*/
+type publicVM struct {
+	vm VM
+}
+
+func PublicVMs(vms []VM) []VM {
+	result := make([]VM, len(vms))
+	for i := range vms {
+		result[i] = &publicVM{vms[i]}
+	}
+	return result
+}
+
+/* w, with a public value replaced by a back end constant */
+func (y *publicVM) key(w Key) Key {
+	if !IsPublicKey(w) {
+		return w
+	}
+	if PublicValue(w) {
+		return y.vm.True()[0]
+	}
+	return y.vm.False()[0]
+}
+
+/*
+A gate of the back end on the bits of a and b that public does not
+decide; public gives the result of a bit, or ok == false
+*/
+func (y *publicVM) gate(a, b []Key, public func(x, z Key) (w Key, ok bool), f func(a, b []Key) []Key) []Key {
+	result := make([]Key, len(a))
+	var xs, zs []Key
+	var is []int
+	for i := range a {
+		if w, ok := public(a[i], b[i]); ok {
+			result[i] = w
+			continue
+		}
+		xs = append(xs, y.key(a[i]))
+		zs = append(zs, y.key(b[i]))
+		is = append(is, i)
+	}
+	if len(is) > 0 {
+		for j, w := range f(xs, zs) {
+			result[is[j]] = w
+		}
+	}
+	return result
+}
+
+func (y *publicVM) And(a, b []Key) []Key {
+	if len(a) != len(b) {
+		panic("Key mismatch in eval.publicVM.And()")
+	}
+	return y.gate(a, b, func(x, z Key) (Key, bool) {
+		switch {
+		case IsPublicKey(x) && IsPublicKey(z):
+			return PublicKey(PublicValue(x) && PublicValue(z)), true
+		case IsPublicKey(x):
+			if PublicValue(x) {
+				return z, true
+			}
+			return x, true
+		case IsPublicKey(z):
+			if PublicValue(z) {
+				return x, true
+			}
+			return z, true
+		}
+		return nil, false
+	}, y.vm.And)
+}
+
+func (y *publicVM) Or(a, b []Key) []Key {
+	if len(a) != len(b) {
+		panic("Key mismatch in eval.publicVM.Or()")
+	}
+	return y.gate(a, b, func(x, z Key) (Key, bool) {
+		switch {
+		case IsPublicKey(x) && IsPublicKey(z):
+			return PublicKey(PublicValue(x) || PublicValue(z)), true
+		case IsPublicKey(x):
+			if PublicValue(x) {
+				return x, true
+			}
+			return z, true
+		case IsPublicKey(z):
+			if PublicValue(z) {
+				return z, true
+			}
+			return x, true
+		}
+		return nil, false
+	}, y.vm.Or)
+}
+
+/* An XOR with a public 1 goes to the back end, which negates for free */
+func (y *publicVM) Xor(a, b []Key) []Key {
+	if len(a) != len(b) {
+		panic("Key mismatch in eval.publicVM.Xor()")
+	}
+	return y.gate(a, b, func(x, z Key) (Key, bool) {
+		switch {
+		case IsPublicKey(x) && IsPublicKey(z):
+			return PublicKey(PublicValue(x) != PublicValue(z)), true
+		case IsPublicKey(x) && !PublicValue(x):
+			return z, true
+		case IsPublicKey(z) && !PublicValue(z):
+			return x, true
+		}
+		return nil, false
+	}, y.vm.Xor)
+}
+
+/* A public s picks a or b; otherwise only bits where a and b are the same public value skip the back end */
+func (y *publicVM) Mux(s, a, b []Key) []Key {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Key mismatch in eval.publicVM.Mux()")
+	}
+	if IsPublicKey(s[0]) {
+		if PublicValue(s[0]) {
+			return a
+		}
+		return b
+	}
+	return y.gate(a, b, func(x, z Key) (Key, bool) {
+		if IsPublicKey(x) && IsPublicKey(z) && PublicValue(x) == PublicValue(z) {
+			return x, true
+		}
+		return nil, false
+	}, func(a, b []Key) []Key { return y.vm.Mux(s, a, b) })
+}
+
+func (y *publicVM) True() []Key {
+	return []Key{PublicKey(true)}
+}
+
+func (y *publicVM) False() []Key {
+	return []Key{PublicKey(false)}
+}
+
+/* The bits of a that are not public, and their indices */
+func secret(a []Key) ([]Key, []int) {
+	var xs []Key
+	var is []int
+	for i := range a {
+		if !IsPublicKey(a[i]) {
+			xs = append(xs, a[i])
+			is = append(is, i)
+		}
+	}
+	return xs, is
+}
+
+func (y *publicVM) RevealTo0(a []Key) {
+	if xs, _ := secret(a); len(xs) > 0 {
+		y.vm.RevealTo0(xs)
+	}
+}
+
+/* Public bits are revealed already */
+func (y *publicVM) RevealTo1(a []Key) []bool {
+	result := make([]bool, len(a))
+	for i := range a {
+		if IsPublicKey(a[i]) {
+			result[i] = PublicValue(a[i])
+		}
+	}
+	xs, is := secret(a)
+	if len(xs) > 0 {
+		for j, v := range y.vm.RevealTo1(xs) {
+			result[is[j]] = v
+		}
+	}
+	return result
+}
+
+func (y *publicVM) ShareTo0(v uint64, bits int) []Key {
+	return y.vm.ShareTo0(v, bits)
+}
+
+func (y *publicVM) ShareTo1(bits int) []Key {
+	return y.vm.ShareTo1(bits)
+}
+
+func (y *publicVM) Random(bits int) []Key {
+	return y.vm.Random(bits)
+}
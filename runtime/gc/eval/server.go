@@ -0,0 +1,288 @@
+package eval
+
+import (
+	"fmt"
+	. "github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/transport"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+A SessionServer evaluates a program for many generators: each
+connection from a gen.Client2 is a session with its own IOs and VMs,
+and runs main once.  Sessions run at the same time, up to a limit, and
+each logs to stderr with its own prefix.
+
+A session fails, without disturbing the others, when the generator
+goes away or cheats, or main panics: the panic is logged, the
+session's connection is cancelled, so that nothing waits on the
+generator, and every goroutine of the session runs to its end.  main
+must wait for the goroutines it starts, as compiled programs do.
+*/
+type SessionServer struct {
+	listener  net.Listener
+	main      func([]VM)
+	numBlocks int
+	newVMs    func(ios []IO) []VM
+	slots     chan bool /* one per running session, nil for no limit */
+
+	mu       sync.Mutex
+	shutdown bool
+	count    int
+	sessions sync.WaitGroup
+}
+
+/*
+Listen on addr for sessions of main, each with VMs made by newVMs from
+its IOs, and run at most maxSessions of them at once, or any number if
+maxSessions is 0.
+*/
+func NewSessionServer(addr string, main func([]VM), numBlocks int, newVMs func(ios []IO) []VM, maxSessions int) (*SessionServer, error) {
+	listener, err := transport.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &SessionServer{listener: listener, main: main, numBlocks: numBlocks, newVMs: newVMs}
+	if maxSessions > 0 {
+		s.slots = make(chan bool, maxSessions)
+	}
+	return s, nil
+}
+
+/* One VM per IO, made by newVM, as Server2 makes them */
+func VMsOf(newVM func(io IO, id ConcurrentId) VM) func(ios []IO) []VM {
+	return func(ios []IO) []VM {
+		vms := make([]VM, len(ios))
+		for i := range vms {
+			vms[i] = newVM(ios[i], ConcurrentId(i))
+		}
+		return vms
+	}
+}
+
+/*
+Accept sessions until Shutdown is called, then wait for the running
+sessions to finish.  The error is that of the listener, if it fails.
+*/
+func (s *SessionServer) Serve() error {
+	log.Printf("serving sessions on %s", s.listener.Addr())
+	for {
+		if s.slots != nil {
+			s.slots <- true
+		}
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			shutdown := s.shutdown
+			s.mu.Unlock()
+			s.sessions.Wait()
+			if shutdown {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.count++
+		n := s.count
+		s.sessions.Add(1)
+		s.mu.Unlock()
+		go s.session(n, conn)
+	}
+}
+
+/* Stop accepting sessions; Serve returns when the running sessions are done */
+func (s *SessionServer) Shutdown() {
+	s.mu.Lock()
+	s.shutdown = true
+	s.mu.Unlock()
+	s.listener.Close()
+}
+
+/* The state of a session, shared by its VMs */
+type session struct {
+	log    *log.Logger
+	conn   *transport.Conn
+	once   sync.Once
+	failed chan bool
+	err    interface{}
+}
+
+/* Record the first failure and cancel the connection, so that nothing of the session waits on the generator */
+func (x *session) fail(r interface{}) {
+	x.once.Do(func() {
+		x.err = r
+		close(x.failed)
+		x.conn.Cancel()
+	})
+}
+
+func (x *session) isFailed() bool {
+	select {
+	case <-x.failed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *SessionServer) session(n int, raw net.Conn) {
+	defer s.sessions.Done()
+	if s.slots != nil {
+		defer func() { <-s.slots }()
+	}
+	x := &session{log: log.New(os.Stderr, fmt.Sprintf("session %d: ", n), log.LstdFlags), failed: make(chan bool)}
+	x.log.Printf("connection from %s", raw.RemoteAddr())
+	conn, err := transport.Secure(raw, Security, false)
+	if err != nil {
+		x.log.Printf("%s", err)
+		return
+	}
+	defer conn.Close()
+	if err := conn.Handshake(HandshakeParams("gc-stream", s.numBlocks)); err != nil {
+		x.log.Printf("handshake: %s", err)
+		return
+	}
+	x.conn = conn
+	start := time.Now()
+	s.run(x)
+	if x.isFailed() {
+		x.log.Printf("failed after %v: %v", time.Since(start), x.err)
+	} else {
+		x.log.Printf("done in %v", time.Since(start))
+	}
+}
+
+/* Run main for session x; a panic on the way fails the session, not the process */
+func (s *SessionServer) run(x *session) {
+	defer func() {
+		if r := recover(); r != nil {
+			x.fail(r)
+		}
+	}()
+	vms := s.newVMs(bind2(x.conn, s.numBlocks))
+	for i := range vms {
+		vms[i] = &sessionVM{vms[i], x, i == 0}
+	}
+	s.main(vms)
+}
+
+/*
+A VM of a session.  vms[0] belongs to the goroutine running main, and
+its panics go up to run.  The others belong to goroutines that main
+starts and waits for, which must not end early: their VMs recover, and
+once the session has failed they answer at once with meaningless keys
+and bits of the right lengths, so that the goroutines run to their end
+and main, at its next use of vms[0], panics up to run.
+*/
+type sessionVM struct {
+	vm   VM
+	x    *session
+	main bool
+}
+
+/* Call f and return true, or false if the session has failed, before or in f, and the caller must make up its answer */
+func (y *sessionVM) call(f func()) (ok bool) {
+	if y.x.isFailed() {
+		if y.main {
+			panic("another goroutine of the session failed")
+		}
+		return false
+	}
+	if !y.main {
+		defer func() {
+			if r := recover(); r != nil {
+				y.x.fail(r)
+				ok = false
+			}
+		}()
+	}
+	f()
+	return true
+}
+
+/* Meaningless keys, which a publicVM takes as secret */
+func failedKeys(n int) []Key {
+	keys := make([]Key, n)
+	for i := range keys {
+		keys[i] = make(Key, 16)
+	}
+	return keys
+}
+
+func (y *sessionVM) And(a, b []Key) (r []Key) {
+	if !y.call(func() { r = y.vm.And(a, b) }) {
+		r = failedKeys(len(a))
+	}
+	return
+}
+
+func (y *sessionVM) Or(a, b []Key) (r []Key) {
+	if !y.call(func() { r = y.vm.Or(a, b) }) {
+		r = failedKeys(len(a))
+	}
+	return
+}
+
+func (y *sessionVM) Xor(a, b []Key) (r []Key) {
+	if !y.call(func() { r = y.vm.Xor(a, b) }) {
+		r = failedKeys(len(a))
+	}
+	return
+}
+
+func (y *sessionVM) Mux(s, a, b []Key) (r []Key) {
+	if !y.call(func() { r = y.vm.Mux(s, a, b) }) {
+		r = failedKeys(len(a))
+	}
+	return
+}
+
+func (y *sessionVM) True() (r []Key) {
+	if !y.call(func() { r = y.vm.True() }) {
+		r = failedKeys(1)
+	}
+	return
+}
+
+func (y *sessionVM) False() (r []Key) {
+	if !y.call(func() { r = y.vm.False() }) {
+		r = failedKeys(1)
+	}
+	return
+}
+
+func (y *sessionVM) RevealTo0(a []Key) {
+	y.call(func() { y.vm.RevealTo0(a) })
+}
+
+func (y *sessionVM) RevealTo1(a []Key) (r []bool) {
+	if !y.call(func() { r = y.vm.RevealTo1(a) }) {
+		r = make([]bool, len(a))
+	}
+	return
+}
+
+func (y *sessionVM) ShareTo0(v uint64, bits int) (r []Key) {
+	if !y.call(func() { r = y.vm.ShareTo0(v, bits) }) {
+		r = failedKeys(bits)
+	}
+	return
+}
+
+func (y *sessionVM) ShareTo1(bits int) (r []Key) {
+	if !y.call(func() { r = y.vm.ShareTo1(bits) }) {
+		r = failedKeys(bits)
+	}
+	return
+}
+
+func (y *sessionVM) Random(bits int) (r []Key) {
+	if !y.call(func() { r = y.vm.Random(bits) }) {
+		r = failedKeys(bits)
+	}
+	return
+}
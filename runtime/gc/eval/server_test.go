@@ -0,0 +1,110 @@
+package eval_test
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+	hgeval "github.com/tjim/smpcc/runtime/gc/halfgates/eval"
+	hggen "github.com/tjim/smpcc/runtime/gc/halfgates/gen"
+)
+
+/* The generator's a + b, with the sum in a block of its own, as compiled programs run blocks */
+func evalSum(vms []eval.VM) {
+	a := vms[0].ShareTo1(32)
+	ch := make(chan []gc.Key, 1)
+	go func() { ch <- eval.Add(vms[1], a, vms[1].ShareTo1(32)) }()
+	vms[0].RevealTo0(<-ch)
+}
+
+func genSum(vms []gen.VM, a, b uint64, next chan bool) uint64 {
+	x := vms[0].ShareTo1(a, 32)
+	<-next
+	ch := make(chan []gc.Wire, 1)
+	go func() { ch <- gen.Add(vms[1], x, vms[1].ShareTo1(b, 32)) }()
+	r := uint64(0)
+	for i, bit := range vms[0].RevealTo0(<-ch) {
+		if bit {
+			r |= 1 << uint(i)
+		}
+	}
+	return r
+}
+
+func TestSessions(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	addr := "unix:" + filepath.Join(t.TempDir(), "socket")
+	ended := make(chan bool, 2)
+	main := func(vms []eval.VM) {
+		defer func() { ended <- true }()
+		evalSum(vms)
+	}
+	s, err := eval.NewSessionServer(addr, main, 2, eval.VMsOf(hgeval.NewVM), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() { served <- s.Serve() }()
+
+	/* The first session waits, halfway, for the second, which fails */
+	next := make(chan bool)
+	sum := make(chan uint64)
+	go gen.Client2(addr, func(vms []gen.VM) { sum <- genSum(vms, 1234, 5678, next) }, 2, hggen.NewVM)
+	ios, conn := gen.Dial2(addr, 2)
+	vms := []gen.VM{hggen.NewVM(ios[0], 0, gen.NewSession()), hggen.NewVM(ios[1], 1, gen.NewSession())}
+	vms[0].ShareTo1(1, 32)
+	gen.Flush(ios)
+	conn.Close()
+	select {
+	case <-ended:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the failed session did not end")
+	}
+	close(next)
+	if r := <-sum; r != 1234+5678 {
+		t.Errorf("1234 + 5678 = %d", r)
+	}
+	<-ended
+
+	s.Shutdown()
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	/* Nothing of either session is left running */
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > goroutines; {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines before, %d after:\n%s", goroutines, runtime.NumGoroutine(), buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSessionPanic(t *testing.T) {
+	addr := "unix:" + filepath.Join(t.TempDir(), "socket")
+	ended := make(chan bool)
+	main := func(vms []eval.VM) {
+		defer func() { ended <- true }()
+		panic("a bug in main")
+	}
+	s, err := eval.NewSessionServer(addr, main, 1, eval.VMsOf(hgeval.NewVM), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() { served <- s.Serve() }()
+	/* The panic ends the session, and the server goes on to the next */
+	for i := 0; i < 2; i++ {
+		_, conn := gen.Dial2(addr, 1)
+		<-ended
+		conn.Close()
+	}
+	s.Shutdown()
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+}
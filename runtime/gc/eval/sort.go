@@ -0,0 +1,122 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/tjim/smpcc/runtime/base"
+	. "github.com/tjim/smpcc/runtime/gc"
+)
+
+/* commented in gen/sort.go */
+
+/* Exchange xs[i] and xs[j] if s */
+func exchange(io VM, s []Key, xs [][]Key, i, j int) {
+	d := Mask(io, s, Xor(io, xs[i], xs[j]))
+	xs[i] = Xor(io, xs[i], d)
+	xs[j] = Xor(io, xs[j], d)
+}
+
+/* Put the smaller of the unsigned keys[i] and keys[j] at i; payloads, if not nil, move with the keys */
+func CompareSwap(io VM, keys, payloads [][]Key, i, j int) {
+	if len(keys[i]) != len(keys[j]) {
+		panic(fmt.Sprintf("Key mismatch in eval.CompareSwap(), %d vs %d", len(keys[i]), len(keys[j])))
+	}
+	s := Icmp_ugt(io, keys[i], keys[j])
+	exchange(io, s, keys, i, j)
+	if payloads != nil {
+		exchange(io, s, payloads, i, j)
+	}
+}
+
+func sortBy(io VM, net []base.Switch, keys, payloads [][]Key) {
+	if payloads != nil && len(payloads) != len(keys) {
+		panic(fmt.Sprintf("Key mismatch in eval.sortBy(), %d keys vs %d payloads", len(keys), len(payloads)))
+	}
+	for _, sw := range net {
+		CompareSwap(io, keys, payloads, sw.I, sw.J)
+	}
+}
+
+func OddEvenMergeSort(io VM, keys, payloads [][]Key) {
+	sortBy(io, base.OddEvenMergeNetwork(len(keys)), keys, payloads)
+}
+
+func BitonicSort(io VM, keys, payloads [][]Key) {
+	sortBy(io, base.BitonicNetwork(len(keys)), keys, payloads)
+}
+
+/* Permute xs by base.WaksmanNetwork(len(xs)), one bit of control per switch */
+func Waksman(io VM, xs [][]Key, control []Key) {
+	net := base.WaksmanNetwork(len(xs))
+	if len(control) != len(net) {
+		panic(fmt.Sprintf("Key mismatch in eval.Waksman(), %d switches vs %d controls", len(net), len(control)))
+	}
+	for k, sw := range net {
+		exchange(io, control[k:k+1], xs, sw.I, sw.J)
+	}
+}
+
+/* n bits of the generator's input, as shareBitsTo1 of gen sends them */
+func shareBitsTo1(io VM, n int) []Key {
+	var result []Key
+	for i := 0; i < n; i += 64 {
+		m := n - i
+		if m > 64 {
+			m = 64
+		}
+		result = append(result, ShareTo1(io, m)...)
+	}
+	return result
+}
+
+/* The evaluator's bits as its input, 64 to a message */
+func shareBitsTo0(io VM, bits []bool) []Key {
+	var result []Key
+	for i := 0; i < len(bits); i += 64 {
+		n := len(bits) - i
+		if n > 64 {
+			n = 64
+		}
+		x := uint64(0)
+		for j := 0; j < n; j++ {
+			if bits[i+j] {
+				x |= 1 << uint(j)
+			}
+		}
+		result = append(result, ShareTo0(io, x, n)...)
+	}
+	return result
+}
+
+func Shuffle(io VM, xs [][]Key) {
+	control := base.WaksmanControl(base.RandomPermutation(len(xs)))
+	Waksman(io, xs, shareBitsTo1(io, len(control)))
+	Waksman(io, xs, shareBitsTo0(io, control))
+}
+
+func loadArray(io VM, loc []Key, n int) [][]Key {
+	RevealTo0(io, loc)
+	xs := make([][]Key, n)
+	for i := range xs {
+		xs[i] = ShareTo1(io, 32)
+	}
+	return xs
+}
+
+func storeArray(io VM, loc []Key, xs [][]Key) {
+	RevealTo0(io, loc)
+	for i := range xs {
+		RevealTo0(io, xs[i])
+	}
+}
+
+func SortMemory(io VM, mask, loc []Key, n int) {
+	if len(mask) != 1 {
+		panic("SortMemory")
+	}
+	if !Reveal(io, mask)[0] {
+		return
+	}
+	xs := loadArray(io, loc, n)
+	OddEvenMergeSort(io, xs, nil)
+	storeArray(io, loc, xs)
+}
@@ -0,0 +1,39 @@
+package eval
+
+import (
+	"bufio"
+	"encoding/gob"
+	. "github.com/tjim/smpcc/runtime/gc"
+	"log"
+	"os"
+)
+
+/*
+StoreIO reads garbled tables from a local copy of a store made by
+gen.Offline (see gc/store.go) instead of receiving them from the
+generator; everything else still goes over the wrapped IO.  The
+generator must replay the store with localTables set.
+*/
+type StoreIO struct {
+	IO
+	dec *gob.Decoder
+}
+
+func NewStoreIO(io IO, dir string, id ConcurrentId) *StoreIO {
+	f, err := os.Open(EvalStoreFile(dir, id))
+	if err != nil {
+		log.Fatalf("NewStoreIO: %s", err)
+	}
+	return &StoreIO{io, gob.NewDecoder(bufio.NewReader(f))}
+}
+
+func (io *StoreIO) RecvT() GarbledTable {
+	var r StoreRecord
+	if err := io.dec.Decode(&r); err != nil {
+		log.Fatalf("StoreIO.RecvT(): %s", err)
+	}
+	if r.Kind != RecTable {
+		panic("StoreIO.RecvT(): expected a garbled table")
+	}
+	return r.T
+}
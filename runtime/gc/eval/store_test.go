@@ -0,0 +1,121 @@
+package eval_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+const storeA, storeB = 1234567, 89
+
+/*
+The generator's a and the evaluator's b, their sum in block 0 and
+product in block 1, revealed to the evaluator; the generator gets only
+a public value, which needs no answer from the evaluator
+*/
+func storeGen(vms []gen.VM) uint64 {
+	vms = gen.PublicVMs(vms)
+	x, y := vms[0].ShareTo1(storeA, 32), vms[0].ShareTo0(32)
+	gen.RevealTo1(vms[0], gen.Add(vms[0], x, y))
+	gen.RevealTo1(vms[1], gen.Mul(vms[1], x, y))
+	return toUint64(gen.RevealTo0(vms[0], gen.Add(vms[0], gen.Uint(vms[0], 2, 8), gen.Uint(vms[0], 3, 8))))
+}
+
+func storeEval(vms []eval.VM) []uint64 {
+	vms = eval.PublicVMs(vms)
+	x, y := vms[0].ShareTo1(32), vms[0].ShareTo0(storeB, 32)
+	sum := toUint64(eval.RevealTo1(vms[0], eval.Add(vms[0], x, y)))
+	product := toUint64(eval.RevealTo1(vms[1], eval.Mul(vms[1], x, y)))
+	eval.RevealTo0(vms[0], eval.Add(vms[0], eval.Uint(vms[0], 2, 8), eval.Uint(vms[0], 3, 8)))
+	return []uint64{sum, product}
+}
+
+/*
+Run the test named test again in a new process, with the environment
+variable STORE_TEST set to what, and return its output; the process
+must fail, as log.Fatalf ends it
+*/
+func fails(t *testing.T, test, what string, env ...string) string {
+	cmd := exec.Command(os.Args[0], "-test.run=^"+test+"$")
+	cmd.Env = append(append(os.Environ(), "STORE_TEST="+what), env...)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("%s succeeded: %s", what, out)
+	}
+	return string(out)
+}
+
+/* Garble offline, replay online to an evaluator, and compare with a live run */
+func TestOffline(t *testing.T) {
+	if os.Getenv("STORE_TEST") == "replay" {
+		/* a second replay of the store of the parent process */
+		gen.Online(os.Getenv("STORE_ADDR"), os.Getenv("STORE_DIR"), 2, false)
+		return
+	}
+	be := backEnds["yao"]
+	gios, eios := make([]gen.IO, 2), make([]eval.IO, 2)
+	for i := range gios {
+		gios[i], eios[i] = chanIOs()
+	}
+	s := gen.NewSession()
+	live := make(chan uint64)
+	go func() {
+		live <- storeGen([]gen.VM{be.newGenVM(gios[0], 0, s), be.newGenVM(gios[1], 1, s)})
+	}()
+	want := storeEval([]eval.VM{be.newEvalVM(eios[0], 0), be.newEvalVM(eios[1], 1)})
+	if public := <-live; public != 5 || want[0] != storeA+storeB || want[1] != storeA*storeB {
+		t.Fatalf("live run: the generator got %d, the evaluator %v", public, want)
+	}
+	for _, localTables := range []bool{false, true} {
+		dir := t.TempDir()
+		addr := "unix:" + filepath.Join(dir, "sock")
+		var public uint64
+		gen.Offline(dir, func(vms []gen.VM) { public = storeGen(vms) }, 2, be.newGenVM)
+		if public != 5 {
+			t.Errorf("offline, the generator got %d, want 5", public)
+		}
+		newVM := be.newEvalVM
+		if localTables {
+			newVM = func(io eval.IO, id gc.ConcurrentId) eval.VM {
+				return be.newEvalVM(eval.NewStoreIO(io, dir, id), id)
+			}
+		}
+		got := make(chan []uint64)
+		go eval.Server2(addr, func(vms []eval.VM) { got <- storeEval(vms) }, 2, newVM)
+		gen.Online(addr, dir, 2, localTables)
+		if r := <-got; r[0] != want[0] || r[1] != want[1] {
+			t.Errorf("online with local tables %v: the evaluator got %v, want %v", localTables, r, want)
+		}
+		/* the store is used up, and a second replay fails before it connects */
+		out := fails(t, "TestOffline", "replay", "STORE_DIR="+dir, "STORE_ADDR="+addr)
+		if !strings.Contains(out, "has already been replayed") {
+			t.Errorf("a second replay did not find the store used: %s", out)
+		}
+	}
+}
+
+/* A program that reveals a secret value to the generator fails offline, and leaves nothing to replay */
+func TestOfflineReveal(t *testing.T) {
+	dir := os.Getenv("STORE_DIR")
+	if os.Getenv("STORE_TEST") == "reveal" {
+		gen.Offline(dir, func(vms []gen.VM) {
+			vms = gen.PublicVMs(vms)
+			gen.RevealTo0(vms[0], vms[0].ShareTo0(8))
+		}, 1, backEnds["yao"].newGenVM)
+		return
+	}
+	dir = t.TempDir()
+	out := fails(t, "TestOfflineReveal", "reveal", "STORE_DIR="+dir)
+	if !strings.Contains(out, "cannot be garbled offline") {
+		t.Errorf("revealing to the generator offline: %s", out)
+	}
+	if _, err := os.Stat(gc.GenStoreFile(dir, 0)); err == nil {
+		t.Error("a store that reveals to the generator was left to replay")
+	}
+}
@@ -7,17 +7,21 @@ import (
 	"github.com/tjim/smpcc/runtime/bit"
 	"github.com/tjim/smpcc/runtime/gc"
 	basegen "github.com/tjim/smpcc/runtime/gc/gen"
-	"github.com/tjim/smpcc/runtime/ot"
 )
 
 type vm struct {
 	io           basegen.IO
 	concurrentId gc.ConcurrentId
 	gateId       uint16
+	key0         gc.Key           // The XOR random constant, shared by the VMs of a session
+	genKey       func([]byte)     // Source of random keys, see basegen.Session.Rand
+	session      *basegen.Session // Of the VM, see Session
+	const0       gc.Wire          // A wire for a constant 0 bit with unbounded fanout
+	const1       gc.Wire          // A wire for a constant 1 bit with unbounded fanout
 }
 
-func NewVM(io basegen.IO, id gc.ConcurrentId) basegen.VM {
-	return vm{io, id, 0}
+func NewVM(io basegen.IO, id gc.ConcurrentId, s *basegen.Session) basegen.VM {
+	return &vm{io: io, concurrentId: id, key0: s.Key0, genKey: s.Rand(id), session: s}
 }
 
 func slot(keys []gc.Key) int {
@@ -48,7 +52,7 @@ func encrypt_slot_nonoptimized(t gc.GarbledTable, plaintext []byte, keys []gc.Ke
 	t[slot(keys)] = encrypt_nonoptimized(keys, plaintext)
 }
 
-func (gax vm) encrypt_slot(t gc.GarbledTable, plaintext []byte, keys ...gc.Key) {
+func (gax *vm) encrypt_slot(t gc.GarbledTable, plaintext []byte, keys ...gc.Key) {
 	if len(keys) != 2 {
 		// log.Println("Non optimized encrypt_slot")
 		encrypt_slot_nonoptimized(t, plaintext, keys)
@@ -65,64 +69,44 @@ func (gax vm) encrypt_slot(t gc.GarbledTable, plaintext []byte, keys ...gc.Key)
 	t[slot(keys)] = encrypt(keys, plaintext, tweak)
 }
 
-var key0 gc.Key    // The XOR random constant
-var const0 gc.Wire // A wire for a constant 0 bit with unbounded fanout
-var const1 gc.Wire // A wire for a constant 1 bit with unbounded fanout
-
-func init_key0() {
-	if key0 != nil {
-		return
-	}
-	key0 = make([]byte, base.KEY_SIZE)
-	gc.GenKey(key0) // least significant bit is random...
-	key0[0] |= 1    // ...force it to 1
-}
-
-func init_constants(io basegen.IO) {
-	if const0 == nil {
-		const0 = genWire()
-		const1 = genWire()
-		io.SendK(const0[0])
-		io.SendK(const1[1])
+func (y *vm) init_constants() {
+	if y.const0 == nil {
+		y.const0 = y.genWire()
+		y.const1 = y.genWire()
+		y.io.SendK(y.const0[0])
+		y.io.SendK(y.const1[1])
 	}
 }
 
-func reset() {
-	key0 = nil
-	const0 = nil
-	const1 = nil
-}
-
 // Generates two keys of size KEY_SIZE and returns the pair
-func genWire() gc.Wire {
-	init_key0()
+func (y *vm) genWire() gc.Wire {
 	k0 := make([]byte, base.KEY_SIZE)
-	gc.GenKey(k0)
-	k1 := gc.XorKey(k0, key0)
+	y.genKey(k0)
+	k1 := gc.XorKey(k0, y.key0)
 	return []gc.Key{k0, k1}
 }
 
 // Generates an array of wires. A wire is a pair of keys.
-func genWires(size int) []gc.Wire {
+func (y *vm) genWires(size int) []gc.Wire {
 	if size <= 0 {
 		panic("genWires with request <= 0")
 	}
 	res := make([]gc.Wire, size)
 	for i := 0; i < size; i++ {
-		res[i] = genWire()
+		res[i] = y.genWire()
 	}
 	return res
 }
 
 /* http://www.llvm.org/docs/LangRef.html */
 
-func (y vm) And(a, b []gc.Wire) []gc.Wire {
+func (y *vm) And(a, b []gc.Wire) []gc.Wire {
 	if len(a) != len(b) {
 		panic("Wire mismatch in gen.And()")
 	}
 	result := make([]gc.Wire, len(a))
 	for i := 0; i < len(a); i++ {
-		w := genWire()
+		w := y.genWire()
 		result[i] = w
 		t := make([]gc.Ciphertext, 4)
 		y.encrypt_slot(t, w[0], a[i][0], b[i][0])
@@ -134,13 +118,13 @@ func (y vm) And(a, b []gc.Wire) []gc.Wire {
 	return result
 }
 
-func (y vm) Or(a, b []gc.Wire) []gc.Wire {
+func (y *vm) Or(a, b []gc.Wire) []gc.Wire {
 	if len(a) != len(b) {
 		panic("Wire mismatch in gen.Or()")
 	}
 	result := make([]gc.Wire, len(a))
 	for i := 0; i < len(a); i++ {
-		w := genWire()
+		w := y.genWire()
 		result[i] = w
 		t := make([]gc.Ciphertext, 4)
 		y.encrypt_slot(t, w[0], a[i][0], b[i][0])
@@ -152,7 +136,7 @@ func (y vm) Or(a, b []gc.Wire) []gc.Wire {
 	return result
 }
 
-func (y vm) Xor(a, b []gc.Wire) []gc.Wire {
+func (y *vm) Xor(a, b []gc.Wire) []gc.Wire {
 	if len(a) != len(b) {
 		panic("Xor(): mismatch")
 	}
@@ -165,18 +149,25 @@ func (y vm) Xor(a, b []gc.Wire) []gc.Wire {
 	return result
 }
 
-func (y vm) True() []gc.Wire {
-	init_constants(y.io)
-	return []gc.Wire{const1}
+func (y *vm) Mux(s, a, b []gc.Wire) []gc.Wire {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Mux(): mismatch")
+	}
+	return gc.MuxWires(y.And, y.Xor, s[0], a, b)
+}
+
+func (y *vm) True() []gc.Wire {
+	y.init_constants()
+	return []gc.Wire{y.const1}
 }
 
-func (y vm) False() []gc.Wire {
-	init_constants(y.io)
-	return []gc.Wire{const0}
+func (y *vm) False() []gc.Wire {
+	y.init_constants()
+	return []gc.Wire{y.const0}
 }
 
 /* Reveal to party 0 = gen */
-func (y vm) RevealTo0(a []gc.Wire) []bool {
+func (y *vm) RevealTo0(a []gc.Wire) []bool {
 	result := make([]bool, len(a))
 	for i := 0; i < len(a); i++ {
 		bit := resolveKey(a[i], y.io.RecvK2())
@@ -190,10 +181,10 @@ func (y vm) RevealTo0(a []gc.Wire) []bool {
 }
 
 /* Reveal to party 1 = eval */
-func (y vm) RevealTo1(a []gc.Wire) {
+func (y *vm) RevealTo1(a []gc.Wire) {
 	for i := 0; i < len(a); i++ {
 		t := make([]gc.Ciphertext, 2)
-		w := genWire()
+		w := y.genWire()
 		w[0][0] = 0
 		w[1][0] = 1
 		y.encrypt_slot(t, w[0], a[i][0])
@@ -202,23 +193,27 @@ func (y vm) RevealTo1(a []gc.Wire) {
 	}
 }
 
-func (y vm) ShareTo0(bits int) []gc.Wire {
+func (y *vm) ShareTo0(bits int) []gc.Wire {
 	a := make([]gc.Wire, bits)
+	k0 := make([]gc.Key, bits)
+	k1 := make([]gc.Key, bits)
 	for i := 0; i < len(a); i++ {
-		w := genWire()
+		w := y.genWire()
 		a[i] = w
-		y.io.Send(ot.Message(w[0]), ot.Message(w[1]))
+		k0[i] = w[0]
+		k1[i] = w[1]
 	}
+	basegen.SendKeys(y.io, k0, k1)
 	return a
 }
 
-func (y vm) ShareTo1(a uint64, bits int) []gc.Wire {
+func (y *vm) ShareTo1(a uint64, bits int) []gc.Wire {
 	if bits > 64 {
 		panic("BT: bits > 64")
 	}
 	result := make([]gc.Wire, bits)
 	for i := 0; i < bits; i++ {
-		w := genWire()
+		w := y.genWire()
 		result[i] = w
 		if (a>>uint(i))%2 == 0 {
 			y.io.SendK(w[0])
@@ -229,8 +224,12 @@ func (y vm) ShareTo1(a uint64, bits int) []gc.Wire {
 	return result
 }
 
+func (y *vm) Session() *basegen.Session {
+	return y.session
+}
+
 // Random generates random bits.
-func (y vm) Random(bits int) []gc.Wire {
+func (y *vm) Random(bits int) []gc.Wire {
 	if bits < 1 {
 		panic("Random: bits < 1")
 	}
@@ -240,17 +239,20 @@ func (y vm) Random(bits int) []gc.Wire {
 		numBytes++
 	}
 	random := make([]byte, numBytes)
-	gc.GenKey(random)
+	y.genKey(random)
+	k0 := make([]gc.Key, bits)
+	k1 := make([]gc.Key, bits)
 	for i, _ := range result {
-		w := genWire()
+		w := y.genWire()
 		result[i] = w
 		switch bit.GetBit(random, i) {
 		case 0:
-			y.io.Send(ot.Message(w[0]), ot.Message(w[1]))
+			k0[i], k1[i] = w[0], w[1]
 		default:
-			y.io.Send(ot.Message(w[1]), ot.Message(w[0]))
+			k0[i], k1[i] = w[1], w[0]
 		}
 	}
+	basegen.SendKeys(y.io, k0, k1)
 	return result
 }
 
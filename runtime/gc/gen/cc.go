@@ -0,0 +1,324 @@
+package gen
+
+import (
+	"bytes"
+	"github.com/tjim/smpcc/runtime/base"
+	"github.com/tjim/smpcc/runtime/bit"
+	. "github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/ot"
+)
+
+/*
+Cut-and-choose.  The back end VMs are secure only against a
+semi-honest evaluator.  A cut-and-choose VM garbles copies of the
+circuit with a back end, each copy in its own seeded Session.  For
+every copy the evaluator obtains by OT either an evaluation key, and
+evaluates the copy, or the seed, and checks the copy by garbling it
+again (see eval/cc.go); the generator does not learn which.  About
+3/5 of the copies are checked, and the evaluator's outputs are the
+majority of the evaluated copies, so a generator that cheats gets
+caught or outvoted except with probability about 2^(-0.32 copies).
+
+  - The generator's input labels are encrypted under the evaluation
+    keys, and each input comes with a random hash (padded with
+    CCRandBits random bits) of it in every copy, which the evaluator
+    checks for consistency.
+
+  - The evaluator's inputs are encoded as the XOR of CCShares OT
+    choices, so that selective failure attacks learn little.  One OT
+    carries the labels of all copies, and checked copies verify them.
+
+  - Outputs to the evaluator are sent as commitments to both labels of
+    each output wire.
+
+  - Outputs to the generator are masked by a random input of the
+    generator and MACed, and the evaluator sends them back.
+
+A wire of a cut-and-choose VM is the pairs of keys of all copies,
+concatenated.
+*/
+type ccVM struct {
+	io      IO
+	keys    []Key // The evaluation key of each copy
+	copies  []VM
+	cios    []*ccCopyIO
+	inputs  uint64   // Generator input labels sent so far, for CCPad
+	session *Session // For the program's memory; the copies have seeded sessions of their own
+}
+
+/* The IO of a copy; copies never do OTs, and send no keys while muted */
+type ccCopyIO struct {
+	IO
+	mute bool
+}
+
+func (io *ccCopyIO) SendK(k Key) {
+	if !io.mute {
+		io.IO.SendK(k)
+	}
+}
+
+func (io *ccCopyIO) SendM(a, b []ot.Message) {
+	if !io.mute {
+		panic("ccCopyIO.SendM(): unexpected OT")
+	}
+}
+
+/* Cut-and-choose VMs for ios, garbling copies with newVM; the evaluator must use eval.NewCCVMs */
+func NewCCVMs(ios []IO, copies int, newVM func(io IO, id ConcurrentId, s *Session) VM) []VM {
+	if copies < 2 {
+		panic("NewCCVMs: need at least 2 copies")
+	}
+	keys := make([]Key, copies)
+	seeds := make([]Key, copies)
+	sessions := make([]*Session, copies)
+	for c := range keys {
+		keys[c] = make([]byte, base.KEY_SIZE)
+		seeds[c] = make([]byte, base.KEY_SIZE)
+		GenKey(keys[c])
+		GenKey(seeds[c])
+		sessions[c] = NewSeededSession(seeds[c])
+	}
+	SendKeys(ios[0], keys, seeds)
+	s := NewSession()
+	vms := make([]VM, len(ios))
+	for i, io := range ios {
+		y := &ccVM{io: io, keys: keys, copies: make([]VM, copies), cios: make([]*ccCopyIO, copies), session: s}
+		for c := range y.copies {
+			y.cios[c] = &ccCopyIO{IO: io}
+			y.copies[c] = newVM(y.cios[c], ConcurrentId(i), sessions[c])
+		}
+		vms[i] = y
+	}
+	return vms
+}
+
+func ClientCC(addr string, main func([]VM), numBlocks int, newVM func(io IO, id ConcurrentId, s *Session) VM, copies int) {
+	ios, conn := Dial2(addr, numBlocks)
+	defer conn.Close()
+	main(NewCCVMs(ios, copies, newVM))
+	Flush(ios)
+}
+
+/* Copy c of the wires a */
+func (y *ccVM) part(a []Wire, c int) []Wire {
+	result := make([]Wire, len(a))
+	for i := range a {
+		result[i] = a[i][2*c : 2*c+2 : 2*c+2]
+	}
+	return result
+}
+
+/* Join the wires of f(c) for every copy c */
+func (y *ccVM) each(f func(c int) []Wire) []Wire {
+	var result []Wire
+	for c := range y.copies {
+		x := f(c)
+		if result == nil {
+			result = make([]Wire, len(x))
+			for i := range result {
+				result[i] = make(Wire, 0, 2*len(y.copies))
+			}
+		}
+		for i := range result {
+			result[i] = append(result[i], x[i]...)
+		}
+	}
+	return result
+}
+
+func (y *ccVM) gate(a, b []Wire, g func(VM, []Wire, []Wire) []Wire) []Wire {
+	return y.each(func(c int) []Wire {
+		return g(y.copies[c], y.part(a, c), y.part(b, c))
+	})
+}
+
+func (y *ccVM) And(a, b []Wire) []Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in gen.ccVM.And()")
+	}
+	return y.gate(a, b, VM.And)
+}
+
+func (y *ccVM) Or(a, b []Wire) []Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in gen.ccVM.Or()")
+	}
+	return y.gate(a, b, VM.Or)
+}
+
+func (y *ccVM) Xor(a, b []Wire) []Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in gen.ccVM.Xor()")
+	}
+	return y.gate(a, b, VM.Xor)
+}
+
+func (y *ccVM) Mux(s, a, b []Wire) []Wire {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Wire mismatch in gen.ccVM.Mux()")
+	}
+	return MuxWires(y.And, y.Xor, s[0], a, b)
+}
+
+func (y *ccVM) True() []Wire {
+	return y.each(func(c int) []Wire { return y.copies[c].True() })
+}
+
+func (y *ccVM) False() []Wire {
+	return y.each(func(c int) []Wire { return y.copies[c].False() })
+}
+
+/* n new wires, sending nothing */
+func (y *ccVM) fresh(n int) []Wire {
+	return y.each(func(c int) []Wire {
+		y.cios[c].mute = true
+		defer func() { y.cios[c].mute = false }()
+		return y.copies[c].ShareTo0(n)
+	})
+}
+
+func randomBits(n int) []byte {
+	v := make([]byte, (n+7)/8)
+	GenKey(v)
+	return v
+}
+
+/* m·a, with the XOR of no wires being 0 */
+func (y *ccVM) hash(m [][]bool, a []Wire) []Wire {
+	result := make([]Wire, len(m))
+	for j, row := range m {
+		acc := y.False()
+		for i, b := range row {
+			if b {
+				acc = y.Xor(acc, a[i:i+1])
+			}
+		}
+		result[j] = acc[0]
+	}
+	return result
+}
+
+/* Send the commitments to both keys of a, in every copy */
+func (y *ccVM) commit(a []Wire) {
+	for i := range a {
+		for c := range y.copies {
+			y.io.SendK(Commit(a[i][2*c]))
+			y.io.SendK(Commit(a[i][2*c+1]))
+		}
+	}
+}
+
+/* A generator input of n bits, bit i of v (bit.GetBit) */
+func (y *ccVM) input(v []byte, n int) []Wire {
+	r := randomBits(CCRandBits)
+	a := y.fresh(n + CCRandBits)
+	bitOf := func(i int) byte {
+		if i < n {
+			return bit.GetBit(v, i)
+		}
+		return bit.GetBit(r, i-n)
+	}
+	for c, k := range y.keys {
+		for i := range a {
+			label := a[i][2*c+int(bitOf(i))]
+			y.io.SendK(XorKey(label, CCPad(k, y.inputs+uint64(i))))
+		}
+	}
+	y.inputs += uint64(len(a))
+	y.commit(y.hash(CCMatrix(y.io.RecvK2(), CCHashBits, len(a)), a))
+	return a[:n]
+}
+
+func (y *ccVM) ShareTo1(a uint64, bits int) []Wire {
+	if bits > 64 {
+		panic("ShareTo1: bits > 64")
+	}
+	v := make([]byte, 8)
+	for i := 0; i < bits; i++ {
+		bit.SetBit(v, i, byte(a>>uint(i)&1))
+	}
+	return y.input(v, bits)
+}
+
+func (y *ccVM) ShareTo0(bits int) []Wire {
+	a := y.fresh(CCShares * bits)
+	m0 := make([]Key, len(a))
+	m1 := make([]Key, len(a))
+	for i := range a {
+		for c := range y.copies {
+			m0[i] = append(m0[i], a[i][2*c]...)
+			m1[i] = append(m1[i], a[i][2*c+1]...)
+		}
+	}
+	SendKeys(y.io, m0, m1)
+	result := make([]Wire, bits)
+	for i := range result {
+		acc := a[CCShares*i : CCShares*i+1]
+		for j := 1; j < CCShares; j++ {
+			acc = y.Xor(acc, a[CCShares*i+j:CCShares*i+j+1])
+		}
+		result[i] = acc[0]
+	}
+	return result
+}
+
+func (y *ccVM) Session() *Session {
+	return y.session
+}
+
+/* Random bits are the XOR of random inputs of both parties */
+func (y *ccVM) Random(bits int) []Wire {
+	return y.Xor(y.input(randomBits(bits), bits), y.ShareTo0(bits))
+}
+
+func (y *ccVM) RevealTo1(a []Wire) {
+	y.commit(a)
+}
+
+/* t_j = b_j ^ (k_j · z), in the circuit */
+func (y *ccVM) mac(z, k, b []Wire) []Wire {
+	t := make([]Wire, len(b))
+	for j := range t {
+		p := y.And(k[j*len(z):(j+1)*len(z)], z)
+		acc := b[j : j+1]
+		for i := range p {
+			acc = y.Xor(acc, p[i:i+1])
+		}
+		t[j] = acc[0]
+	}
+	return t
+}
+
+func (y *ccVM) RevealTo0(a []Wire) []bool {
+	n := len(a)
+	m, k, b := randomBits(n), randomBits(CCHashBits*n), randomBits(CCHashBits)
+	z := y.Xor(a, y.input(m, n))
+	t := y.mac(z, y.input(k, CCHashBits*n), y.input(b, CCHashBits))
+	y.RevealTo1(append(z[:n:n], t...))
+
+	/* the evaluator sends z and t back; t shows that z is the output of the circuit */
+	zt := y.io.RecvK2()
+	if len(zt) != (n+CCHashBits+7)/8 {
+		panic("gen.ccVM.RevealTo0(): bad output from the evaluator")
+	}
+	expected := make([]byte, len(zt))
+	for i := 0; i < n; i++ {
+		bit.SetBit(expected, i, bit.GetBit(zt, i))
+	}
+	for j := 0; j < CCHashBits; j++ {
+		tj := bit.GetBit(b, j)
+		for i := 0; i < n; i++ {
+			tj ^= bit.GetBit(k, j*n+i) & bit.GetBit(zt, i)
+		}
+		bit.SetBit(expected, n+j, tj)
+	}
+	if !bytes.Equal(expected, zt) {
+		panic("cut-and-choose: the evaluator sent a bad output")
+	}
+	result := make([]bool, n)
+	for i := range result {
+		result[i] = bit.GetBit(zt, i) != bit.GetBit(m, i)
+	}
+	return result
+}
@@ -0,0 +1,343 @@
+package gen
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/tjim/smpcc/runtime/base"
+	. "github.com/tjim/smpcc/runtime/gc"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+/* What a program costs, for a block, an iteration or in total */
+type CostCounts struct {
+	And     int `json:"and"`
+	Or      int `json:"or"`
+	Xor     int `json:"xor"`
+	Depth   int `json:"depth"`   /* the greatest depth of a wire computed */
+	Inputs  int `json:"inputs"`  /* generator input bits, ShareTo1 */
+	OTs     int `json:"ots"`     /* evaluator input and random bits, ShareTo0 and Random */
+	Reveal0 int `json:"reveal0"` /* bits revealed to the generator */
+	Reveal1 int `json:"reveal1"` /* bits revealed to the evaluator */
+}
+
+func (c *CostCounts) add(d CostCounts) {
+	c.And += d.And
+	c.Or += d.Or
+	c.Xor += d.Xor
+	if d.Depth > c.Depth {
+		c.Depth = d.Depth
+	}
+	c.Inputs += d.Inputs
+	c.OTs += d.OTs
+	c.Reveal0 += d.Reveal0
+	c.Reveal1 += d.Reveal1
+}
+
+/* Bytes sent for each gate or revealed bit by a back end */
+type CostModel struct {
+	And, Or, Reveal1 int
+}
+
+/* An OT extension sends two masked keys and a column of the receiver's matrix */
+const costOTBytes = 3 * base.KEY_SIZE
+
+var CostModels = map[string]CostModel{
+	"yao":       {4 * base.KEY_SIZE, 4 * base.KEY_SIZE, 2 * base.KEY_SIZE},
+	"yaor":      {3 * base.KEY_SIZE, 3 * base.KEY_SIZE, 2 * base.KEY_SIZE},
+	"gax":       {4 * base.KEY_SIZE, 4 * base.KEY_SIZE, 2 * base.KEY_SIZE},
+	"gaxr":      {3 * base.KEY_SIZE, 3 * base.KEY_SIZE, 2 * base.KEY_SIZE},
+	"halfgates": {2 * base.KEY_SIZE, 2 * base.KEY_SIZE, 1},
+}
+
+/* The size of the garbled tables */
+func (m CostModel) TableBytes(c CostCounts) int {
+	return c.And*m.And + c.Or*m.Or + c.Reveal1*m.Reveal1
+}
+
+/* The tables, plus input keys, OTs and output keys sent to the generator */
+func (m CostModel) Bytes(c CostCounts) int {
+	return m.TableBytes(c) + (c.Inputs+c.Reveal0)*base.KEY_SIZE + c.OTs*costOTBytes
+}
+
+type CostBlock struct {
+	Name       string       `json:"name"`
+	Total      CostCounts   `json:"total"`
+	Iterations []CostCounts `json:"iterations"`
+}
+
+type CostReport struct {
+	mu           sync.Mutex
+	newIteration bool
+	Iterations   int          `json:"iterations"`
+	Blocks       []*CostBlock `json:"blocks"`
+	Total        CostCounts   `json:"total"`
+}
+
+/*
+Cost analysis.  A cost VM garbles nothing: it runs the program in the
+clear and counts what each back end would have to do, so that the
+cost of a program can be predicted without running it for real.
+
+The counts are kept for each VM, named after the block that uses it,
+and for each iteration of the program's main loop.  vms[0] is the
+main loop, "main", and vms[i+1] is block i, "blocki" (the compiled
+function geni).  An iteration begins when a block runs after the main
+loop has revealed something (whether it is done); iteration 0 is the
+main loop's work before the first block runs.
+
+A wire of a cost VM is a single key, holding its value and its depth,
+the number of AND and OR gates on the longest path from an input.
+*/
+type costVM struct {
+	r         *CostReport
+	block     int
+	evalInput func(bits int) uint64
+	session   *Session /* for the program's memory */
+}
+
+/* n cost VMs and their report; the evaluator's inputs are taken from evalInput */
+func NewCostVMs(n int, evalInput func(bits int) uint64) ([]VM, *CostReport) {
+	r := &CostReport{newIteration: true}
+	s := NewSession()
+	vms := make([]VM, n)
+	for i := range vms {
+		name := "main"
+		if i > 0 {
+			name = fmt.Sprintf("block%d", i-1)
+		}
+		r.Blocks = append(r.Blocks, &CostBlock{Name: name})
+		vms[i] = &costVM{r, i, evalInput, s}
+	}
+	return vms, r
+}
+
+/* The counts of the current iteration of y's block; the caller holds y.r.mu */
+func (y *costVM) counts() *CostCounts {
+	r := y.r
+	if y.block > 0 && r.newIteration {
+		r.Iterations++
+		r.newIteration = false
+	}
+	b := r.Blocks[y.block]
+	for len(b.Iterations) <= r.Iterations {
+		b.Iterations = append(b.Iterations, CostCounts{})
+	}
+	return &b.Iterations[r.Iterations]
+}
+
+func costWire(v bool, depth int) Wire {
+	k := make(Key, 5)
+	if v {
+		k[0] = 1
+	}
+	binary.BigEndian.PutUint32(k[1:], uint32(depth))
+	return Wire{k}
+}
+
+func costValue(w Wire) (bool, int) {
+	return w[0][0] == 1, int(binary.BigEndian.Uint32(w[0][1:]))
+}
+
+func (y *costVM) gate(a, b []Wire, and bool, f func(x, z bool) bool, tally func(c *CostCounts)) []Wire {
+	y.r.mu.Lock()
+	defer y.r.mu.Unlock()
+	c := y.counts()
+	tally(c)
+	result := make([]Wire, len(a))
+	for i := range a {
+		x, dx := costValue(a[i])
+		z, dz := costValue(b[i])
+		if dz > dx {
+			dx = dz
+		}
+		if and {
+			dx++
+		}
+		if dx > c.Depth {
+			c.Depth = dx
+		}
+		result[i] = costWire(f(x, z), dx)
+	}
+	return result
+}
+
+func (y *costVM) And(a, b []Wire) []Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in gen.costVM.And()")
+	}
+	return y.gate(a, b, true, func(x, z bool) bool { return x && z }, func(c *CostCounts) { c.And += len(a) })
+}
+
+func (y *costVM) Or(a, b []Wire) []Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in gen.costVM.Or()")
+	}
+	return y.gate(a, b, true, func(x, z bool) bool { return x || z }, func(c *CostCounts) { c.Or += len(a) })
+}
+
+func (y *costVM) Xor(a, b []Wire) []Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in gen.costVM.Xor()")
+	}
+	return y.gate(a, b, false, func(x, z bool) bool { return x != z }, func(c *CostCounts) { c.Xor += len(a) })
+}
+
+func (y *costVM) Mux(s, a, b []Wire) []Wire {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Wire mismatch in gen.costVM.Mux()")
+	}
+	return MuxWires(y.And, y.Xor, s[0], a, b)
+}
+
+func (y *costVM) count(f func(c *CostCounts)) {
+	y.r.mu.Lock()
+	defer y.r.mu.Unlock()
+	f(y.counts())
+}
+
+func (y *costVM) True() []Wire {
+	return []Wire{costWire(true, 0)}
+}
+
+func (y *costVM) False() []Wire {
+	return []Wire{costWire(false, 0)}
+}
+
+func (y *costVM) input(a uint64, bits int) []Wire {
+	result := make([]Wire, bits)
+	for i := range result {
+		result[i] = costWire(a>>uint(i)&1 == 1, 0)
+	}
+	return result
+}
+
+func (y *costVM) ShareTo0(bits int) []Wire {
+	y.count(func(c *CostCounts) { c.OTs += bits })
+	return y.input(y.evalInput(bits), bits)
+}
+
+func (y *costVM) ShareTo1(a uint64, bits int) []Wire {
+	if bits > 64 {
+		panic("ShareTo1: bits > 64")
+	}
+	y.count(func(c *CostCounts) { c.Inputs += bits })
+	return y.input(a, bits)
+}
+
+func (y *costVM) Random(bits int) []Wire {
+	y.count(func(c *CostCounts) { c.OTs += bits })
+	k := make([]byte, 8)
+	GenKey(k)
+	return y.input(binary.BigEndian.Uint64(k), bits)
+}
+
+func (y *costVM) Session() *Session {
+	return y.session
+}
+
+/* A reveal by the main loop ends the iteration */
+func (y *costVM) reveal(f func(c *CostCounts)) {
+	y.r.mu.Lock()
+	defer y.r.mu.Unlock()
+	f(y.counts())
+	if y.block == 0 {
+		y.r.newIteration = true
+	}
+}
+
+func (y *costVM) RevealTo0(a []Wire) []bool {
+	y.reveal(func(c *CostCounts) { c.Reveal0 += len(a) })
+	result := make([]bool, len(a))
+	for i := range a {
+		result[i], _ = costValue(a[i])
+	}
+	return result
+}
+
+func (y *costVM) RevealTo1(a []Wire) {
+	y.reveal(func(c *CostCounts) { c.Reveal1 += len(a) })
+}
+
+/* Fill in the totals; the VMs must be finished */
+func (r *CostReport) total() {
+	r.Total = CostCounts{}
+	for _, b := range r.Blocks {
+		b.Total = CostCounts{}
+		for _, c := range b.Iterations {
+			b.Total.add(c)
+		}
+		r.Total.add(b.Total)
+	}
+}
+
+func costRow(w io.Writer, name string, c CostCounts) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+		name, c.And, c.Or, c.Xor, c.Depth, c.Inputs, c.OTs, c.Reveal0, c.Reveal1)
+}
+
+func (r *CostReport) Write(w io.Writer) error {
+	r.total()
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\tand\tor\txor\tdepth\tinputs\tOTs\treveal0\treveal1\t\n")
+	for _, b := range r.Blocks {
+		costRow(tw, b.Name, b.Total)
+	}
+	costRow(tw, "total", r.Total)
+	fmt.Fprintf(tw, "\t\t\t\t\t\t\t\t\t\n")
+	for i := 0; i <= r.Iterations; i++ {
+		var c CostCounts
+		for _, b := range r.Blocks {
+			if i < len(b.Iterations) {
+				c.add(b.Iterations[i])
+			}
+		}
+		costRow(tw, fmt.Sprintf("iteration %d", i), c)
+	}
+	fmt.Fprintf(tw, "\t\t\t\t\t\t\t\t\t\n")
+	fmt.Fprintf(tw, "back end\ttable bytes\ttotal bytes\t\n")
+	for _, name := range []string{"yao", "yaor", "gax", "gaxr", "halfgates"} {
+		m := CostModels[name]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t\n", name, m.TableBytes(r.Total), m.Bytes(r.Total))
+	}
+	return tw.Flush()
+}
+
+/* The report as JSON, with the predicted bytes of each back end */
+func (r *CostReport) WriteJSON(w io.Writer) error {
+	r.total()
+	type prediction struct {
+		TableBytes int `json:"table_bytes"`
+		Bytes      int `json:"bytes"`
+	}
+	predicted := make(map[string]prediction)
+	for name, m := range CostModels {
+		predicted[name] = prediction{m.TableBytes(r.Total), m.Bytes(r.Total)}
+	}
+	return json.NewEncoder(w).Encode(struct {
+		*CostReport
+		Predicted map[string]prediction `json:"predicted"`
+	}{r, predicted})
+}
+
+/* Write the report as text, or as JSON if name ends in .json */
+func (r *CostReport) WriteFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(name, ".json") {
+		err = r.WriteJSON(f)
+	} else {
+		err = r.Write(f)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,70 @@
+package gen_test
+
+import (
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+func TestCostMux(t *testing.T) {
+	vms, report := gen.NewCostVMs(1, nil)
+	io := vms[0]
+	gen.Mux(io, io.ShareTo1(1, 1), io.ShareTo1(3, 8), io.ShareTo1(5, 8))
+	c := report.Blocks[0].Iterations[0]
+	if c.And != 8 || c.Depth != 1 {
+		t.Errorf("Mux of 8 bits: %d ANDs of depth %d, want 8 of depth 1", c.And, c.Depth)
+	}
+}
+
+/* An n-bit Add is n ANDs, the last carry included, on a chain of depth n */
+func TestCostAdd(t *testing.T) {
+	for _, n := range []int{1, 8, 32} {
+		vms, report := gen.NewCostVMs(1, func(bits int) uint64 { return 5 })
+		io := vms[0]
+		sum := gen.Add(io, io.ShareTo1(3, n), io.ShareTo0(n))
+		if r := toUint64(io.RevealTo0(sum)); r != 8&(1<<uint(n)-1) {
+			t.Errorf("%d bits: 3 + 5 = %d", n, r)
+		}
+		c := report.Blocks[0].Iterations[0]
+		want := gen.CostCounts{And: n, Xor: 4*n - 3, Depth: n, Inputs: n, OTs: n, Reveal0: n}
+		if c != want {
+			t.Errorf("Add of %d bits: got %+v, want %+v", n, c, want)
+		}
+		/* tables of the ANDs, the generator's input keys and the output keys, and the OTs */
+		for name, bytes := range map[string]int{"yao": 64*n + 16*2*n + 48*n, "halfgates": 32*n + 16*2*n + 48*n} {
+			if b := gen.CostModels[name].Bytes(c); b != bytes {
+				t.Errorf("Add of %d bits with %s: %d bytes, want %d", n, name, b, bytes)
+			}
+		}
+	}
+}
+
+/* The main loop counts an iteration each time it reveals before a block runs */
+func TestCostIterations(t *testing.T) {
+	vms, report := gen.NewCostVMs(2, func(bits int) uint64 { return 5 })
+	x := gen.Uint(vms[0], 0, 8)
+	for i := 0; i < 3; i++ {
+		done := make(chan bool)
+		go func() {
+			x = gen.Add(vms[1], x, vms[1].ShareTo0(8))
+			done <- true
+		}()
+		<-done
+		gen.Reveal(vms[0], gen.Icmp_eq(vms[0], x, gen.Uint(vms[0], 15, 8)))
+	}
+	if report.Iterations != 3 {
+		t.Fatalf("%d iterations, want 3", report.Iterations)
+	}
+	main, block := report.Blocks[0], report.Blocks[1]
+	for i := 1; i <= 3; i++ {
+		if c := block.Iterations[i]; c.And != 8 || c.OTs != 8 {
+			t.Errorf("block0, iteration %d: got %+v, want 8 ANDs and 8 OTs", i, c)
+		}
+		if c := main.Iterations[i]; c.Reveal0 != 1 || c.Reveal1 != 1 || c.OTs != 0 {
+			t.Errorf("main, iteration %d: got %+v, want a bit revealed to each side", i, c)
+		}
+	}
+	if c := block.Iterations[0]; c != (gen.CostCounts{}) {
+		t.Errorf("block0 ran in iteration 0: %+v", c)
+	}
+}
@@ -0,0 +1,536 @@
+package gen
+
+import (
+	"fmt"
+	"github.com/tjim/smpcc/runtime/base"
+	. "github.com/tjim/smpcc/runtime/gc"
+)
+
+/*
+Circuits for AES, SHA-256, SHA-1 and ChaCha20, far smaller than those
+compiled from C.  Byte k of a key, message or result is wires 8k to
+8k+7, low bit first, as a little-endian load of it gives them.  Only
+ANDs cost: an AES-128 encryption takes 6800 and AES-256 9520, all in
+S-boxes, and a block of SHA-256 about 22700, of SHA-1 about 12000 and
+of ChaCha20 about 10400, mostly in 32-bit additions.
+*/
+
+/*
+The AES S-box on bytes held bitsliced, x[i] the bits i of all of them.
+This is the depth-16 circuit of Boyar and Peralta, of 34 ANDs, in
+which U0 is the high bit and S0 the high bit of the result.
+*/
+func sbox(io VM, x [8][]Wire) [8][]Wire {
+	xor := func(a, b []Wire) []Wire { return Xor(io, a, b) }
+	and := func(a, b []Wire) []Wire { return And(io, a, b) }
+	xnor := func(a, b []Wire) []Wire { return Not(io, Xor(io, a, b)) }
+	U0, U1, U2, U3, U4, U5, U6, U7 := x[7], x[6], x[5], x[4], x[3], x[2], x[1], x[0]
+	T1 := xor(U0, U3)
+	T2 := xor(U0, U5)
+	T3 := xor(U0, U6)
+	T4 := xor(U3, U5)
+	T5 := xor(U4, U6)
+	T6 := xor(T1, T5)
+	T7 := xor(U1, U2)
+	T8 := xor(U7, T6)
+	T9 := xor(U7, T7)
+	T10 := xor(T6, T7)
+	T11 := xor(U1, U5)
+	T12 := xor(U2, U5)
+	T13 := xor(T3, T4)
+	T14 := xor(T6, T11)
+	T15 := xor(T5, T11)
+	T16 := xor(T5, T12)
+	T17 := xor(T9, T16)
+	T18 := xor(U3, U7)
+	T19 := xor(T7, T18)
+	T20 := xor(T1, T19)
+	T21 := xor(U6, U7)
+	T22 := xor(T7, T21)
+	T23 := xor(T2, T22)
+	T24 := xor(T2, T10)
+	T25 := xor(T20, T17)
+	T26 := xor(T3, T16)
+	T27 := xor(T1, T12)
+	M1 := and(T13, T6)
+	M2 := and(T23, T8)
+	M3 := xor(T14, M1)
+	M4 := and(T19, U7)
+	M5 := xor(M4, M1)
+	M6 := and(T3, T16)
+	M7 := and(T22, T9)
+	M8 := xor(T26, M6)
+	M9 := and(T20, T17)
+	M10 := xor(M9, M6)
+	M11 := and(T1, T15)
+	M12 := and(T4, T27)
+	M13 := xor(M12, M11)
+	M14 := and(T2, T10)
+	M15 := xor(M14, M11)
+	M16 := xor(M3, M2)
+	M17 := xor(M5, T24)
+	M18 := xor(M8, M7)
+	M19 := xor(M10, M15)
+	M20 := xor(M16, M13)
+	M21 := xor(M17, M15)
+	M22 := xor(M18, M13)
+	M23 := xor(M19, T25)
+	M24 := xor(M22, M23)
+	M25 := and(M22, M20)
+	M26 := xor(M21, M25)
+	M27 := xor(M20, M21)
+	M28 := xor(M23, M25)
+	M29 := and(M28, M27)
+	M30 := and(M26, M24)
+	M31 := and(M20, M23)
+	M32 := and(M27, M31)
+	M33 := xor(M27, M25)
+	M34 := and(M21, M22)
+	M35 := and(M24, M34)
+	M36 := xor(M24, M25)
+	M37 := xor(M21, M29)
+	M38 := xor(M32, M33)
+	M39 := xor(M23, M30)
+	M40 := xor(M35, M36)
+	M41 := xor(M38, M40)
+	M42 := xor(M37, M39)
+	M43 := xor(M37, M38)
+	M44 := xor(M39, M40)
+	M45 := xor(M42, M41)
+	M46 := and(M44, T6)
+	M47 := and(M40, T8)
+	M48 := and(M39, U7)
+	M49 := and(M43, T16)
+	M50 := and(M38, T9)
+	M51 := and(M37, T17)
+	M52 := and(M42, T15)
+	M53 := and(M45, T27)
+	M54 := and(M41, T10)
+	M55 := and(M44, T13)
+	M56 := and(M40, T23)
+	M57 := and(M39, T19)
+	M58 := and(M43, T3)
+	M59 := and(M38, T22)
+	M60 := and(M37, T20)
+	M61 := and(M42, T1)
+	M62 := and(M45, T4)
+	M63 := and(M41, T2)
+	L0 := xor(M61, M62)
+	L1 := xor(M50, M56)
+	L2 := xor(M46, M48)
+	L3 := xor(M47, M55)
+	L4 := xor(M54, M58)
+	L5 := xor(M49, M61)
+	L6 := xor(M62, L5)
+	L7 := xor(M46, L3)
+	L8 := xor(M51, M59)
+	L9 := xor(M52, M53)
+	L10 := xor(M53, L4)
+	L11 := xor(M60, L2)
+	L12 := xor(M48, M51)
+	L13 := xor(M50, L0)
+	L14 := xor(M52, M61)
+	L15 := xor(M55, L1)
+	L16 := xor(M56, L0)
+	L17 := xor(M57, L1)
+	L18 := xor(M58, L8)
+	L19 := xor(M63, L4)
+	L20 := xor(L0, L1)
+	L21 := xor(L1, L7)
+	L22 := xor(L3, L12)
+	L23 := xor(L18, L2)
+	L24 := xor(L15, L9)
+	L25 := xor(L6, L10)
+	L26 := xor(L7, L9)
+	L27 := xor(L8, L10)
+	L28 := xor(L11, L14)
+	L29 := xor(L11, L17)
+	S0 := xor(L6, L24)
+	S1 := xnor(L16, L26)
+	S2 := xnor(L19, L28)
+	S3 := xor(L6, L21)
+	S4 := xor(L20, L22)
+	S5 := xor(L25, L29)
+	S6 := xnor(L13, L27)
+	S7 := xnor(L6, L23)
+	return [8][]Wire{S7, S6, S5, S4, S3, S2, S1, S0}
+}
+
+/* The bytes of a */
+func bytesOf(a []Wire) [][]Wire {
+	result := make([][]Wire, len(a)/8)
+	for k := range result {
+		result[k] = a[8*k : 8*k+8]
+	}
+	return result
+}
+
+func joinBytes(bs [][]Wire) []Wire {
+	var result []Wire
+	for _, b := range bs {
+		result = append(result, b...)
+	}
+	return result
+}
+
+/* The S-box on each of bs, all in one circuit */
+func subBytes(io VM, bs [][]Wire) [][]Wire {
+	var x [8][]Wire
+	for i := range x {
+		x[i] = make([]Wire, len(bs))
+		for k := range bs {
+			x[i][k] = bs[k][i]
+		}
+	}
+	y := sbox(io, x)
+	result := make([][]Wire, len(bs))
+	for k := range result {
+		result[k] = make([]Wire, 8)
+		for i := range y {
+			result[k][i] = y[i][k]
+		}
+	}
+	return result
+}
+
+/* b times x in GF(2^8), linear and so free */
+func xtime(io VM, b []Wire) []Wire {
+	result := []Wire{b[7], b[0], b[1], b[2], b[3], b[4], b[5], b[6]}
+	for _, i := range []int{1, 3, 4} {
+		result[i] = Xor(io, result[i:i+1], b[7:8])[0]
+	}
+	return result
+}
+
+/* The columns of the state are bytes 4c to 4c+3 */
+func mixColumns(io VM, s [][]Wire) [][]Wire {
+	result := make([][]Wire, 16)
+	for c := 0; c < 16; c += 4 {
+		a := s[c : c+4]
+		all := Xor(io, Xor(io, a[0], a[1]), Xor(io, a[2], a[3]))
+		for i := range a {
+			result[c+i] = Xor(io, Xor(io, a[i], all), xtime(io, Xor(io, a[i], a[(i+1)%4])))
+		}
+	}
+	return result
+}
+
+/* The round keys of AES with the key of 4nk bytes, as bytes */
+func expandKey(io VM, key []Wire, nk int) [][]Wire {
+	nr := nk + 6
+	w := bytesOf(key)
+	rcon := uint64(1)
+	for i := nk; i < 4*(nr+1); i++ {
+		t := w[4*i-4 : 4*i]
+		if i%nk == 0 {
+			t = subBytes(io, [][]Wire{t[1], t[2], t[3], t[0]})
+			t[0] = Xor(io, t[0], Uint(io, rcon, 8))
+			rcon = rcon<<1 ^ (rcon>>7)*0x11b
+		} else if nk > 6 && i%nk == 4 {
+			t = subBytes(io, t)
+		}
+		for j := range t {
+			w = append(w, Xor(io, w[4*(i-nk)+j], t[j]))
+		}
+	}
+	return w
+}
+
+func aesEncrypt(io VM, key, block []Wire, op string) []Wire {
+	if len(block) != 128 {
+		panic(fmt.Sprintf("Wire mismatch in gen.%s(), block of %d bits", op, len(block)))
+	}
+	nk := len(key) / 32
+	nr := nk + 6
+	w := expandKey(io, key, nk)
+	s := bytesOf(block)
+	for k := range s {
+		s[k] = Xor(io, s[k], w[k])
+	}
+	for r := 1; r <= nr; r++ {
+		s = subBytes(io, s)
+		/* ShiftRows: byte k is in row k%4 */
+		t := make([][]Wire, 16)
+		for k := range t {
+			t[k] = s[(k+4*(k%4))%16]
+		}
+		if r < nr {
+			t = mixColumns(io, t)
+		}
+		for k := range t {
+			t[k] = Xor(io, t[k], w[16*r+k])
+		}
+		s = t
+	}
+	return joinBytes(s)
+}
+
+/* The AES-128 encryption of the 16 bytes of block under the 16 bytes of key */
+func AES128(io VM, key, block []Wire) []Wire {
+	if len(key) != 128 {
+		panic(fmt.Sprintf("Wire mismatch in gen.AES128(), key of %d bits", len(key)))
+	}
+	return aesEncrypt(io, key, block, "AES128")
+}
+
+func AES256(io VM, key, block []Wire) []Wire {
+	if len(key) != 256 {
+		panic(fmt.Sprintf("Wire mismatch in gen.AES256(), key of %d bits", len(key)))
+	}
+	return aesEncrypt(io, key, block, "AES256")
+}
+
+/* 32-bit words, as SHA and ChaCha20 use them; rotations and shifts are free */
+func rotr(a []Wire, n int) []Wire {
+	result := make([]Wire, 32)
+	for i := range result {
+		result[i] = a[(i+n)%32]
+	}
+	return result
+}
+
+func shr(io VM, a []Wire, n int) []Wire {
+	return Zext(io, a[n:], 32)
+}
+
+func xor3(io VM, a, b, c []Wire) []Wire {
+	return Xor(io, Xor(io, a, b), c)
+}
+
+/* The big-endian word of 4 bytes */
+func beWord(bs [][]Wire) []Wire {
+	return joinBytes([][]Wire{bs[3], bs[2], bs[1], bs[0]})
+}
+
+/* The bytes of msg, padded for SHA */
+func shaPadded(io VM, msg []Wire, op string) [][]Wire {
+	if len(msg)%8 != 0 {
+		panic(fmt.Sprintf("Wire mismatch in gen.%s(), message of %d bits", op, len(msg)))
+	}
+	bs := bytesOf(msg)
+	for _, p := range base.SHAPadding(len(bs)) {
+		bs = append(bs, Uint(io, uint64(p), 8))
+	}
+	return bs
+}
+
+/* The hash value h as bytes, each word big-endian */
+func shaDigest(h [][]Wire) []Wire {
+	var result []Wire
+	for _, w := range h {
+		result = append(result, joinBytes([][]Wire{w[24:32], w[16:24], w[8:16], w[0:8]})...)
+	}
+	return result
+}
+
+/* The SHA-256 compression of the 64 bytes of block into h */
+func sha256Block(io VM, h [][]Wire, block [][]Wire) [][]Wire {
+	w := make([][]Wire, 64)
+	for t := 0; t < 16; t++ {
+		w[t] = beWord(block[4*t : 4*t+4])
+	}
+	for t := 16; t < 64; t++ {
+		s0 := xor3(io, rotr(w[t-15], 7), rotr(w[t-15], 18), shr(io, w[t-15], 3))
+		s1 := xor3(io, rotr(w[t-2], 17), rotr(w[t-2], 19), shr(io, w[t-2], 10))
+		w[t] = Add(io, Add(io, w[t-16], s0), Add(io, w[t-7], s1))
+	}
+	a, b, c, d, e, f, g, hh := h[0], h[1], h[2], h[3], h[4], h[5], h[6], h[7]
+	for t := 0; t < 64; t++ {
+		s1 := xor3(io, rotr(e, 6), rotr(e, 11), rotr(e, 25))
+		ch := Xor(io, g, And(io, e, Xor(io, f, g)))
+		t1 := Add(io, Add(io, hh, s1), Add(io, Add(io, ch, Uint(io, uint64(base.SHA256K[t]), 32)), w[t]))
+		s0 := xor3(io, rotr(a, 2), rotr(a, 13), rotr(a, 22))
+		maj := Xor(io, a, And(io, Xor(io, a, b), Xor(io, a, c)))
+		t2 := Add(io, s0, maj)
+		hh, g, f, e, d, c, b, a = g, f, e, Add(io, d, t1), c, b, a, Add(io, t1, t2)
+	}
+	result := make([][]Wire, 8)
+	for i, x := range [][]Wire{a, b, c, d, e, f, g, hh} {
+		result[i] = Add(io, h[i], x)
+	}
+	return result
+}
+
+/* The SHA-256 digest, 32 bytes, of the bytes of msg, whose length is public */
+func SHA256(io VM, msg []Wire) []Wire {
+	bs := shaPadded(io, msg, "SHA256")
+	h := make([][]Wire, 8)
+	for i := range h {
+		h[i] = Uint(io, uint64(base.SHA256H[i]), 32)
+	}
+	for i := 0; i < len(bs); i += 64 {
+		h = sha256Block(io, h, bs[i:i+64])
+	}
+	return shaDigest(h)
+}
+
+func sha1Block(io VM, h [][]Wire, block [][]Wire) [][]Wire {
+	w := make([][]Wire, 80)
+	for t := 0; t < 16; t++ {
+		w[t] = beWord(block[4*t : 4*t+4])
+	}
+	for t := 16; t < 80; t++ {
+		w[t] = rotr(Xor(io, xor3(io, w[t-3], w[t-8], w[t-14]), w[t-16]), 31)
+	}
+	a, b, c, d, e := h[0], h[1], h[2], h[3], h[4]
+	for t := 0; t < 80; t++ {
+		var f []Wire
+		switch t / 20 {
+		case 0:
+			f = Xor(io, d, And(io, b, Xor(io, c, d)))
+		case 2:
+			f = Xor(io, b, And(io, Xor(io, b, c), Xor(io, b, d)))
+		default:
+			f = xor3(io, b, c, d)
+		}
+		k := Uint(io, uint64(base.SHA1K[t/20]), 32)
+		x := Add(io, Add(io, rotr(a, 27), f), Add(io, Add(io, e, k), w[t]))
+		e, d, c, b, a = d, c, rotr(b, 2), a, x
+	}
+	result := make([][]Wire, 5)
+	for i, x := range [][]Wire{a, b, c, d, e} {
+		result[i] = Add(io, h[i], x)
+	}
+	return result
+}
+
+/* The SHA-1 digest, 20 bytes, of the bytes of msg, whose length is public */
+func SHA1(io VM, msg []Wire) []Wire {
+	bs := shaPadded(io, msg, "SHA1")
+	h := make([][]Wire, 5)
+	for i := range h {
+		h[i] = Uint(io, uint64(base.SHA1H[i]), 32)
+	}
+	for i := 0; i < len(bs); i += 64 {
+		h = sha1Block(io, h, bs[i:i+64])
+	}
+	return shaDigest(h)
+}
+
+/*
+The ChaCha20 block function of RFC 8439: 64 bytes of keystream for the
+32 bytes of key, the 32-bit block counter and the 12 bytes of nonce.
+*/
+func ChaCha20Block(io VM, key, counter, nonce []Wire) []Wire {
+	if len(key) != 256 || len(counter) != 32 || len(nonce) != 96 {
+		panic(fmt.Sprintf("Wire mismatch in gen.ChaCha20Block(), %d, %d, %d bits", len(key), len(counter), len(nonce)))
+	}
+	var s [16][]Wire
+	for i := 0; i < 4; i++ {
+		s[i] = Uint(io, uint64(base.ChaChaSigma[i]), 32)
+	}
+	/* the words are little-endian, so each is just 32 wires */
+	for i := 0; i < 8; i++ {
+		s[4+i] = key[32*i : 32*i+32]
+	}
+	s[12] = counter
+	for i := 0; i < 3; i++ {
+		s[13+i] = nonce[32*i : 32*i+32]
+	}
+	x := s
+	qr := func(a, b, c, d int) {
+		x[a] = Add(io, x[a], x[b])
+		x[d] = rotr(Xor(io, x[d], x[a]), 16)
+		x[c] = Add(io, x[c], x[d])
+		x[b] = rotr(Xor(io, x[b], x[c]), 20)
+		x[a] = Add(io, x[a], x[b])
+		x[d] = rotr(Xor(io, x[d], x[a]), 24)
+		x[c] = Add(io, x[c], x[d])
+		x[b] = rotr(Xor(io, x[b], x[c]), 25)
+	}
+	for i := 0; i < 10; i++ {
+		qr(0, 4, 8, 12)
+		qr(1, 5, 9, 13)
+		qr(2, 6, 10, 14)
+		qr(3, 7, 11, 15)
+		qr(0, 5, 10, 15)
+		qr(1, 6, 11, 12)
+		qr(2, 7, 8, 13)
+		qr(3, 4, 9, 14)
+	}
+	var result []Wire
+	for i := range x {
+		result = append(result, Add(io, x[i], s[i])...)
+	}
+	return result
+}
+
+/* The n bytes at loc, read from the generator's memory */
+func loadBytes(io VM, loc []Wire, n int) []Wire {
+	address := int(Reveal0Uint64(io, loc))
+	ram := io.Session().Ram
+	var result []Wire
+	for i := 0; i < n; i += 8 {
+		m := n - i
+		if m > 8 {
+			m = 8
+		}
+		x := uint64(0)
+		for j := 0; j < m; j++ {
+			x |= uint64(ram[address+i+j]) << uint(8*j)
+		}
+		result = append(result, ShareTo1(io, x, 8*m)...)
+	}
+	return result
+}
+
+func storeBytes(io VM, loc, a []Wire) {
+	address := int(Reveal0Uint64(io, loc))
+	ram := io.Session().Ram
+	for i := 0; i < len(a); i += 64 {
+		chunk := a[i:]
+		if len(chunk) > 64 {
+			chunk = chunk[:64]
+		}
+		x := Reveal0Uint64(io, chunk)
+		for j := 0; j < len(chunk)/8; j++ {
+			ram[address+i/8+j] = byte(x >> uint(8*j))
+		}
+	}
+}
+
+func active(io VM, mask []Wire, op string) bool {
+	if len(mask) != 1 {
+		panic(op)
+	}
+	return Reveal(io, mask)[0]
+}
+
+/*
+The forms for C, which do nothing unless mask is true, like
+SortMemory.  Each reads its arguments from memory and writes its
+result at out, all at public addresses.  Memory is the generator's, in
+the clear, so the generator learns keys and messages; to hide them,
+call the functions above on wires from ShareTo0 and ShareTo1.
+*/
+func AES128Memory(io VM, mask, out, key, in []Wire) {
+	if active(io, mask, "AES128Memory") {
+		storeBytes(io, out, AES128(io, loadBytes(io, key, 16), loadBytes(io, in, 16)))
+	}
+}
+
+func AES256Memory(io VM, mask, out, key, in []Wire) {
+	if active(io, mask, "AES256Memory") {
+		storeBytes(io, out, AES256(io, loadBytes(io, key, 32), loadBytes(io, in, 16)))
+	}
+}
+
+/* The digest of the n bytes at msg */
+func SHA256Memory(io VM, mask, out, msg []Wire, n int) {
+	if active(io, mask, "SHA256Memory") {
+		storeBytes(io, out, SHA256(io, loadBytes(io, msg, n)))
+	}
+}
+
+func SHA1Memory(io VM, mask, out, msg []Wire, n int) {
+	if active(io, mask, "SHA1Memory") {
+		storeBytes(io, out, SHA1(io, loadBytes(io, msg, n)))
+	}
+}
+
+/* The counter is a value, not in memory */
+func ChaCha20Memory(io VM, mask, out, key, counter, nonce []Wire) {
+	if active(io, mask, "ChaCha20Memory") {
+		storeBytes(io, out, ChaCha20Block(io, loadBytes(io, key, 32), counter, loadBytes(io, nonce, 12)))
+	}
+}
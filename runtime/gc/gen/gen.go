@@ -7,6 +7,7 @@ type VM interface {
 	And(a, b []base.Wire) []base.Wire
 	Or(a, b []base.Wire) []base.Wire
 	Xor(a, b []base.Wire) []base.Wire
+	Mux(s, a, b []base.Wire) []base.Wire
 	True() []base.Wire
 	False() []base.Wire
 	RevealTo0(a []base.Wire) []bool
@@ -14,6 +15,7 @@ type VM interface {
 	ShareTo0(bits int) []base.Wire
 	ShareTo1(a uint64, bits int) []base.Wire
 	Random(bits int) []base.Wire
+	Session() *Session
 }
 
 func Mul(io VM, a, b []base.Wire) []base.Wire {
@@ -23,10 +25,9 @@ func Mul(io VM, a, b []base.Wire) []base.Wire {
 	if len(a) == 0 {
 		panic("empty arguments in Mul()")
 	}
-	zeros := Uint(io, 0, len(a))
-	result := Select(io, b[0:1], a, zeros)
+	result := Select(io, b[0:1], a, zeros(io, len(a)))
 	for i := 1; i < len(b); i++ {
-		a_shifted := Uint(io, 0, len(a))
+		a_shifted := zeros(io, len(a))
 		for j := 0; i+j < len(a); j++ {
 			a_shifted[j+i] = a[j]
 		}
@@ -80,7 +81,81 @@ func Sub(io VM, a, b []base.Wire) []base.Wire {
 	return result
 }
 
-/* constant shift left; TODO: variable Shl */
+/*
+Restoring division.  The partial remainder r carries one extra bit so
+that the top bit of r-b is its sign: r is kept below b, so after
+shifting in the next bit of a, r < 2b and r-b fits.  Division by zero
+gives a quotient of all ones and a remainder of a, so a signed
+division by zero gives -1, or 1 if a is negative.  The most negative
+value divided by -1 wraps around to itself, as in Go.
+*/
+func udivrem(io VM, a, b []base.Wire) ([]base.Wire, []base.Wire) {
+	n := len(a)
+	if n != len(b) {
+		panic(fmt.Sprintf("Wire mismatch in gen.udivrem(), %d vs %d", n, len(b)))
+	}
+	if n == 0 {
+		panic("empty arguments in gen.udivrem()")
+	}
+	bx := Zext(io, b, n+1)
+	q := make([]base.Wire, n)
+	r := zeros(io, n+1)
+	for i := n - 1; i >= 0; i-- {
+		r = append([]base.Wire{a[i]}, r[:n]...) /* r = r<<1 | a[i] */
+		d := Sub(io, r, bx)
+		q[i] = Not(io, d[n:])[0]
+		r = Select(io, q[i:i+1], d, r)
+	}
+	return q, r[:n]
+}
+
+func Udiv(io VM, a, b []base.Wire) []base.Wire {
+	q, _ := udivrem(io, a, b)
+	return q
+}
+
+func Urem(io VM, a, b []base.Wire) []base.Wire {
+	_, r := udivrem(io, a, b)
+	return r
+}
+
+func zeros(io VM, n int) []base.Wire {
+	z := False(io)[0]
+	result := make([]base.Wire, n)
+	for i := range result {
+		result[i] = z
+	}
+	return result
+}
+
+func neg(io VM, a []base.Wire) []base.Wire {
+	return Sub(io, zeros(io, len(a)), a)
+}
+
+func abs(io VM, a []base.Wire) []base.Wire {
+	return Select(io, a[len(a)-1:], neg(io, a), a)
+}
+
+/* signed division truncates toward zero, as in C */
+func Sdiv(io VM, a, b []base.Wire) []base.Wire {
+	if len(a) == 0 || len(b) == 0 {
+		panic("empty arguments in gen.Sdiv()")
+	}
+	q, _ := udivrem(io, abs(io, a), abs(io, b))
+	s := Xor(io, a[len(a)-1:], b[len(b)-1:])
+	return Select(io, s, neg(io, q), q)
+}
+
+/* the remainder has the sign of the dividend, as in C */
+func Srem(io VM, a, b []base.Wire) []base.Wire {
+	if len(a) == 0 || len(b) == 0 {
+		panic("empty arguments in gen.Srem()")
+	}
+	_, r := udivrem(io, abs(io, a), abs(io, b))
+	return Select(io, a[len(a)-1:], neg(io, r), r)
+}
+
+/* constant shift left; see ShlV for a variable shift */
 func Shl(io VM, a []base.Wire, b int) []base.Wire {
 	if len(a) <= b {
 		panic("Shl() too far")
@@ -93,7 +168,7 @@ func Shl(io VM, a []base.Wire, b int) []base.Wire {
 	return append(zeros, a...)[:len(a)]
 }
 
-/* constant logical shift right; TODO: variable Lshr */
+/* constant logical shift right; see LshrV for a variable shift */
 func Lshr(io VM, a []base.Wire, b int) []base.Wire {
 	if len(a) <= b {
 		panic("Lshr() too far")
@@ -102,7 +177,7 @@ func Lshr(io VM, a []base.Wire, b int) []base.Wire {
 	return result[b:]
 }
 
-/* constant arithmetic shift right; TODO: variable Ashr */
+/* constant arithmetic shift right; see AshrV for a variable shift */
 func Ashr(io VM, a []base.Wire, b int) []base.Wire {
 	if len(a) <= b {
 		panic("Ashr() too far")
@@ -111,6 +186,56 @@ func Ashr(io VM, a []base.Wire, b int) []base.Wire {
 	return result[b:]
 }
 
+/* variable shift left; shifting by len(a) or more gives 0 */
+func ShlV(io VM, a, b []base.Wire) []base.Wire {
+	return shiftV(io, a, b, -1, False(io)[0])
+}
+
+/* variable logical shift right; shifting by len(a) or more gives 0 */
+func LshrV(io VM, a, b []base.Wire) []base.Wire {
+	return shiftV(io, a, b, 1, False(io)[0])
+}
+
+/* variable arithmetic shift right; shifting by len(a) or more gives the sign bits */
+func AshrV(io VM, a, b []base.Wire) []base.Wire {
+	if len(a) == 0 {
+		panic("AshrV: empty value")
+	}
+	return shiftV(io, a, b, 1, a[len(a)-1])
+}
+
+/*
+A barrel shifter: stage k moves a by 2^k bits toward the low end
+(dir 1) or the high end (dir -1) if bit k of b is set, shifting in
+fill.  All of the stages that would shift a out entirely are merged
+into one.
+*/
+func shiftV(io VM, a, b []base.Wire, dir int, fill base.Wire) []base.Wire {
+	n := len(a)
+	result := a
+	k := 0
+	for ; k < len(b) && 1<<uint(k) < n; k++ {
+		d := dir * (1 << uint(k))
+		shifted := make([]base.Wire, n)
+		for i := range shifted {
+			if 0 <= i+d && i+d < n {
+				shifted[i] = result[i+d]
+			} else {
+				shifted[i] = fill
+			}
+		}
+		result = Select(io, b[k:k+1], shifted, result)
+	}
+	if k < len(b) {
+		fills := make([]base.Wire, n)
+		for i := range fills {
+			fills[i] = fill
+		}
+		result = Select(io, []base.Wire{treeOr0(io, b[k:]...)}, fills, result)
+	}
+	return result
+}
+
 func And(io VM, a, b []base.Wire) []base.Wire {
 	return io.And(a, b)
 }
@@ -123,6 +248,18 @@ func Xor(io VM, a, b []base.Wire) []base.Wire {
 	return io.Xor(a, b)
 }
 
+/*
+a if the single bit s is 1, else b.  Mux is a method of VM so that a
+back end may garble it natively; one without a gadget of its own uses
+gc.MuxWires, one AND per bit
+*/
+func Mux(io VM, s, a, b []base.Wire) []base.Wire {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Wire mismatch in gen.Mux()")
+	}
+	return io.Mux(s, a, b)
+}
+
 func Trunc(io VM, a []base.Wire, b int) []base.Wire {
 	if len(a) <= b {
 		panic("trunc must truncate operand")
@@ -239,12 +376,7 @@ func Select(io VM, s, a, b []base.Wire) []base.Wire {
 	if len(a) != len(b) {
 		panic("Wire mismatch in gen.Select()")
 	}
-	result := make([]base.Wire, len(a))
-
-	for i := 0; i < len(a); i++ {
-		result[i] = Xor(io, b[i:i+1], And(io, s, Xor(io, a[i:i+1], b[i:i+1])))[0]
-	}
-	return result
+	return io.Mux(s, a, b)
 }
 
 func Mask(io VM, s, a []base.Wire) []base.Wire {
@@ -323,18 +455,79 @@ func Input32(io VM, mask []base.Wire, party []base.Wire, next_arg func() uint64)
 // If s == 0 it returns c0, if s == 1 it returns c1, etc.
 // If s is not the index of any c, it returns dflt.
 func Switch(io VM, s, dflt []base.Wire, cases ...[]base.Wire) []base.Wire {
-	if len(cases) == 0 {
+	return MuxN(io, s, dflt, cases...)
+}
+
+/*
+xs[s], or dflt when s is out of range: a tree of Muxes on the low bits
+of s, one AND per bit of the values for each of xs, and one more on the
+high bits of s
+*/
+func MuxN(io VM, s, dflt []base.Wire, xs ...[]base.Wire) []base.Wire {
+	for _, x := range xs {
+		if len(x) != len(dflt) {
+			panic("Wire mismatch in gen.MuxN()")
+		}
+	}
+	k := 0
+	for k < len(s) && 1<<uint(k) < len(xs) {
+		k++
+	}
+	if len(xs) > 1<<uint(k) {
+		xs = xs[:1<<uint(k)] /* s cannot reach the rest */
+	}
+	level := xs
+	for j := 0; j < k; j++ {
+		next := make([][]base.Wire, (len(level)+1)/2)
+		for i := range next {
+			if 2*i+1 < len(level) {
+				next[i] = Mux(io, s[j:j+1], level[2*i+1], level[2*i])
+			} else {
+				/* past the end, the odd indices select dflt */
+				next[i] = Mux(io, s[j:j+1], dflt, level[2*i])
+			}
+		}
+		level = next
+	}
+	if len(level) == 0 {
 		return dflt
 	}
-	masks := make([]base.Wire, len(cases))
-	masked_cases := make([][]base.Wire, len(cases))
-	for i := 0; i < len(cases); i++ {
-		masks[i] = Icmp_eq(io, s, Uint(io, uint64(i), len(s)))[0]
-		masked_cases[i] = Mask(io, []base.Wire{masks[i]}, cases[i])
+	if k < len(s) {
+		return Mux(io, []base.Wire{treeOr0(io, s[k:]...)}, dflt, level[0])
 	}
-	m := TreeXor0(io, masks...)
-	x := TreeXor(io, masked_cases...)
-	return Select(io, []base.Wire{m}, x, dflt)
+	return level[0]
+}
+
+/*
+The one of xs whose mask is 1, or dflt if none is, where at most one of
+masks is 1: dflt ^ (masks[0] & (xs[0] ^ dflt)) ^ ..., one AND per bit of
+each of xs, all in a single call of And
+*/
+func MuxHot(io VM, masks []base.Wire, dflt []base.Wire, xs ...[]base.Wire) []base.Wire {
+	if len(masks) != len(xs) {
+		panic("Wire mismatch in gen.MuxHot()")
+	}
+	if len(xs) == 0 {
+		return dflt
+	}
+	n := len(dflt)
+	ss := make([]base.Wire, 0, n*len(xs))
+	ds := make([]base.Wire, 0, n*len(xs))
+	for i, x := range xs {
+		if len(x) != n {
+			panic("Wire mismatch in gen.MuxHot()")
+		}
+		for j := 0; j < n; j++ {
+			ss = append(ss, masks[i])
+		}
+		ds = append(ds, Xor(io, x, dflt)...)
+	}
+	ds = And(io, ss, ds)
+	parts := [][]base.Wire{dflt}
+	for i := range xs {
+		parts = append(parts, ds[i*n:(i+1)*n])
+	}
+	return TreeXor(io, parts...)
 }
 
 func TreeOr(io VM, x ...[]base.Wire) []base.Wire {
@@ -532,11 +725,9 @@ func Random(io VM, bits int) []base.Wire {
 	return io.Random(bits)
 }
 
-/* Gen side ram, initialized by each program for a particular size */
-var Ram []byte
-
-func InitRam(contents []byte) {
-	Ram = contents
+/* Gen side ram of the session of io, initialized by each program for a particular size */
+func InitRam(io VM, contents []byte) {
+	io.Session().Ram = contents
 }
 
 /* commented in gmw/vm.go */
@@ -569,6 +760,9 @@ func Unary(io VM, b []base.Wire, y int) []base.Wire {
 			}
 		}
 	}
+	if lowbits == nil { /* b has no bits above y */
+		lowbits = b
+	}
 	unary := unaryB(io, lowbits)
 	lowresult := make([]base.Wire, y)
 	copy(lowresult, unary[:y])
@@ -593,9 +787,10 @@ func Load(io VM, loc, eltsize []base.Wire) []base.Wire {
 		panic(fmt.Sprintf("Load: bad element size %d", bytes))
 	case 1, 2, 4, 8:
 	}
+	ram := io.Session().Ram
 	x := uint64(0)
 	for j := 0; j < bytes; j++ {
-		byte_j := uint64(Ram[address+j])
+		byte_j := uint64(ram[address+j])
 		x += byte_j << uint(j*8)
 	}
 	fmt.Printf("0x%x\n", x)
@@ -613,8 +808,9 @@ func Store(io VM, loc, eltsize, val []base.Wire) {
 	}
 	x := Reveal0Uint32(io, val)
 	fmt.Printf("Storing Ram[0x%08x]<%d> = 0x%x\n", address, bytes, x)
+	ram := io.Session().Ram
 	for j := 0; j < bytes; j++ {
 		byte_j := byte(x>>uint(j*8)) & 0xff
-		Ram[address+j] = byte_j
+		ram[address+j] = byte_j
 	}
 }
@@ -1,13 +1,11 @@
 package gen
 
 import (
-	"github.com/tjim/fatchan"
 	. "github.com/tjim/smpcc/runtime/gc"
 	"github.com/tjim/smpcc/runtime/ot"
+	"github.com/tjim/smpcc/runtime/transport"
 	"log"
 	"math/big"
-	"net"
-	"time"
 )
 
 type IO interface {
@@ -15,6 +13,7 @@ type IO interface {
 	SendT(t GarbledTable)
 	SendK(t Key)
 	RecvK2() Key
+	Flush()
 }
 
 /* TODO: instead of exposing IOX make it private and use IO externally */
@@ -31,45 +30,82 @@ func NewIOX(io Chanio) *IOX {
 	return result
 }
 
-func NewIO(nu chan Chanio) IO {
-	io := NewChanio()
-	nu <- *io
-	return NewIOX(*io)
+/*
+Transfer one key of each pair (a[i], b[i]) by OT, all in one batch, to
+a matching eval.ReceiveKeys.  SendM needs a multiple of 8 pairs, so
+pad with dummy pairs.
+*/
+func SendKeys(io IO, a, b []Key) {
+	if len(a) != len(b) {
+		panic("SendKeys: must send pairs of keys")
+	}
+	n := 8 * ((len(a) + 7) / 8)
+	m0 := make([]ot.Message, n)
+	m1 := make([]ot.Message, n)
+	for i := range m0 {
+		if i < len(a) {
+			m0[i] = ot.Message(a[i])
+			m1[i] = ot.Message(b[i])
+		} else {
+			m0[i] = []byte{0x00}
+			m1[i] = []byte{0x00}
+		}
+	}
+	io.SendM(m0, m1)
 }
 
-func Client(addr string, main func([]VM), numBlocks int, newVM func(io IO, id ConcurrentId) VM) {
-	server, err := net.Dial("tcp", addr)
+/* Connect to an eval server and agree on the protocol and number of blocks */
+func dial(addr, protocol string, numBlocks int) *transport.Conn {
+	conn, err := transport.Dial(addr, Security)
 	if err != nil {
 		log.Fatalf("dial(%q): %s", addr, err)
 	}
+	if err := conn.Handshake(HandshakeParams(protocol, numBlocks)); err != nil {
+		log.Fatalf("handshake with %q: %s", addr, err)
+	}
+	return conn
+}
 
-	xport := fatchan.New(server, nil)
-	nu := make(chan Chanio)
-	xport.FromChan(nu)
+func Client(addr string, main func([]VM), numBlocks int, newVM func(io IO, id ConcurrentId, s *Session) VM) {
+	conn := dial(addr, "gc", numBlocks)
+	defer conn.Close()
 
-	defer close(nu)
 	vms := make([]VM, numBlocks)
+	ios := make([]IO, numBlocks)
+	s := NewSession()
 	for i := range vms {
-		io := NewIO(nu)
-		vms[i] = newVM(io, ConcurrentId(i))
+		io := NewChanio()
+		io.Bind(conn, i, true)
+		ios[i] = NewIOX(*io)
+		vms[i] = newVM(ios[i], ConcurrentId(i), s)
 	}
-	// temporary hack to avoid a fatchan deadlock
-	// (this allows the eval side to finish registering channels and start block goroutines before we send on the channels)
-	time.Sleep(time.Second)
 	main(vms)
+	Flush(ios)
 }
 
-func Client2(addr string, main func([]VM), numBlocks int, newVM func(io IO, id ConcurrentId) VM) {
-	server, err := net.Dial("tcp", addr)
-	if err != nil {
-		log.Fatalf("dial(%q): %s", addr, err)
+func Client2(addr string, main func([]VM), numBlocks int, newVM func(io IO, id ConcurrentId, s *Session) VM) {
+	ios, conn := Dial2(addr, numBlocks)
+	defer conn.Close()
+
+	vms := make([]VM, numBlocks)
+	s := NewSession()
+	for i := range vms {
+		vms[i] = newVM(ios[i], ConcurrentId(i), s)
 	}
+	main(vms)
+	Flush(ios)
+}
 
-	xport := fatchan.New(server, nil)
-	nu := make(chan PerNodePair)
-	xport.FromChan(nu)
+/* Send the tables still waiting in the pages of ios; call it before closing their connection */
+func Flush(ios []IO) {
+	for _, io := range ios {
+		io.Flush()
+	}
+}
 
-	defer close(nu)
+/* Connect to an eval.Server2 and set up one IO per block; the caller must close the returned connection when done */
+func Dial2(addr string, numBlocks int) ([]IO, *transport.Conn) {
+	conn := dial(addr, "gc-stream", numBlocks)
 
 	ParamChan := make(chan *big.Int)
 	NpRecvPk := make(chan *big.Int)
@@ -82,12 +118,9 @@ func Client2(addr string, main func([]VM), numBlocks int, newVM func(io IO, id C
 	for i := 0; i < numBlocks; i++ {
 		S2R := make(chan ot.MessagePair)
 		R2S := make(chan []byte)
-		Tchan := make(chan GarbledTable)
-		Kchan := make(chan Key)
-		Kchan2 := make(chan Key)
-		x.BlockChans[i] = PerBlock{ClientAsSender{S2R, R2S}, CircuitChans{Tchan, Kchan, Kchan2}}
+		x.BlockChans[i] = PerBlock{ClientAsSender{S2R, R2S}, NewCircuitChans(0)}
 	}
-	nu <- x
+	x.Bind(conn, true)
 	sender0 := ot.NewStreamSender(baseReceiver, x.BlockChans[0].CAS.S2R, x.BlockChans[0].CAS.R2S)
 	for i := 0; i < numBlocks; i++ {
 		var sender ot.Sender
@@ -98,13 +131,5 @@ func Client2(addr string, main func([]VM), numBlocks int, newVM func(io IO, id C
 		}
 		ios[i] = IOX{x.BlockChans[i].CircuitChans, sender}
 	}
-
-	vms := make([]VM, numBlocks)
-	for i := range vms {
-		vms[i] = newVM(ios[i], ConcurrentId(i))
-	}
-	// temporary hack to avoid a fatchan deadlock
-	// (this allows the eval side to finish registering channels and start block goroutines before we send on the channels)
-	time.Sleep(time.Second)
-	main(vms)
+	return ios, conn
 }
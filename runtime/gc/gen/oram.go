@@ -0,0 +1,295 @@
+package gen
+
+import (
+	base "github.com/tjim/smpcc/runtime/gc"
+)
+
+/*
+Oblivious memory.  Load and Store reveal every address to the
+generator and keep memory in the clear on the generator's side.  An
+ORam keeps its contents in wires, and an access does not reveal which
+element it touched.
+
+LinearRam touches every element on each access, which is cheapest for
+small arrays.  TreeRam is the binary tree ORAM of Shi, Chan, Stefanov
+and Li, "Oblivious RAM with O((log N)^3) worst-case cost," Asiacrypt
+2011; each access touches one path of O(log N) buckets, plus its
+position map, which is itself an ORam.  Its buckets have room for
+log N + 4 elements; an element that finds none free is lost, and the
+next access reveals that one was, and panics, before it reads anything.
+
+Both sides must create and access their ORams in the same order; the
+eval side mirrors this file.
+*/
+type ORam interface {
+	// Access returns the element at index and replaces it with
+	// update(element).  update is called exactly once.  Elements that
+	// were never written are 0.  index must be less than the size of
+	// the ORam; other indexes touch unspecified elements.
+	Access(io VM, index []base.Wire, update func([]base.Wire) []base.Wire) []base.Wire
+}
+
+/* arrays up to this many elements use a linear scan */
+const linearRamMax = 64
+
+/* An ORam of n elements of width bits, all 0 */
+func NewORam(io VM, n, width int) ORam {
+	if n <= linearRamMax {
+		return NewLinearRam(io, n, width)
+	}
+	return NewTreeRam(io, n, width)
+}
+
+func ORamRead(io VM, m ORam, index []base.Wire) []base.Wire {
+	return m.Access(io, index, func(x []base.Wire) []base.Wire { return x })
+}
+
+func ORamWrite(io VM, m ORam, index, val []base.Wire) {
+	m.Access(io, index, func(x []base.Wire) []base.Wire { return val })
+}
+
+/* number of bits needed to index n elements */
+func bitsFor(n int) int {
+	bits := 0
+	for 1<<uint(bits) < n {
+		bits++
+	}
+	return bits
+}
+
+//--- Linear scan
+
+type LinearRam struct {
+	elts [][]base.Wire
+}
+
+func NewLinearRam(io VM, n, width int) *LinearRam {
+	if n < 1 {
+		panic("NewLinearRam: n < 1")
+	}
+	elts := make([][]base.Wire, n)
+	for i := range elts {
+		elts[i] = zeros(io, width)
+	}
+	return &LinearRam{elts}
+}
+
+func (m *LinearRam) Access(io VM, index []base.Wire, update func([]base.Wire) []base.Wire) []base.Wire {
+	if n := bitsFor(len(m.elts)); len(index) < n { /* Unary needs a bit for every element */
+		index = Zext(io, index, n)
+	}
+	sel := Unary(io, index, len(m.elts))
+	masked := make([][]base.Wire, len(m.elts))
+	for i, e := range m.elts {
+		masked[i] = Mask(io, sel[i:i+1], e)
+	}
+	old := TreeXor(io, masked...)
+	val := update(old)
+	for i, e := range m.elts {
+		m.elts[i] = Select(io, sel[i:i+1], val, e)
+	}
+	return old
+}
+
+//--- Binary tree ORAM
+
+/* leaves per position map element */
+const posPack = 8
+
+type slot struct {
+	valid []base.Wire
+	index []base.Wire
+	leaf  []base.Wire
+	data  []base.Wire
+}
+
+/*
+The tree has 2^depth leaves.  buckets is in heap order: bucket 1 is
+the root and the children of bucket b are 2b and 2b+1.  Each element
+lives in a bucket on the path from the root to its leaf, and the
+position map records the leaf of each element, posPack to an element
+of posmap, with a valid bit to mark leaves that have been assigned.
+*/
+type TreeRam struct {
+	width    int
+	depth    int
+	buckets  [][]slot
+	posmap   ORam
+	evict    []int       /* next bucket to evict at each level, round robin */
+	overflow []base.Wire /* whether an element has been lost */
+}
+
+func NewTreeRam(io VM, n, width int) *TreeRam {
+	depth := bitsFor(n)
+	if depth < 3 {
+		depth = 3
+	}
+	z := depth + 4 /* slots per bucket */
+	buckets := make([][]slot, 2<<uint(depth))
+	for b := 1; b < len(buckets); b++ {
+		buckets[b] = make([]slot, z)
+		for i := range buckets[b] {
+			buckets[b][i] = slot{zeros(io, 1), zeros(io, depth), zeros(io, depth), zeros(io, width)}
+		}
+	}
+	posmap := NewORam(io, (n+posPack-1)/posPack, posPack*(depth+1))
+	return &TreeRam{width, depth, buckets, posmap, make([]int, depth), zeros(io, 1)}
+}
+
+/* Truncate or extend index to depth bits; the high bits of an index in range are 0 */
+func (m *TreeRam) fit(io VM, index []base.Wire) []base.Wire {
+	switch {
+	case len(index) > m.depth:
+		return index[:m.depth]
+	case len(index) < m.depth:
+		return Zext(io, index, m.depth)
+	}
+	return index
+}
+
+/* Look up the leaf of index in the position map and replace it with newLeaf */
+func (m *TreeRam) remap(io VM, index, newLeaf []base.Wire) []base.Wire {
+	sel := Unary(io, index[:3], posPack)
+	w := m.depth + 1
+	var leaf []base.Wire
+	m.posmap.Access(io, index[3:], func(old []base.Wire) []base.Wire {
+		masked := make([][]base.Wire, posPack)
+		result := make([]base.Wire, 0, len(old))
+		for j := 0; j < posPack; j++ {
+			e := old[j*w : (j+1)*w]
+			masked[j] = Mask(io, sel[j:j+1], e)
+			result = append(result, Select(io, sel[j:j+1], append(Uint(io, 1, 1), newLeaf...), e)...)
+		}
+		leaf = TreeXor(io, masked...)
+		return result
+	})
+	/* an element that was never assigned a leaf is not in the tree; visit a random path */
+	return Select(io, leaf[:1], leaf[1:], Random(io, m.depth))
+}
+
+/* Put item into the first free slot of bucket b if cond, and note in m.overflow if there is none */
+func (m *TreeRam) insert(io VM, b int, cond []base.Wire, item slot) {
+	todo := cond
+	for i := range m.buckets[b] {
+		s := &m.buckets[b][i]
+		put := And(io, todo, Not(io, s.valid))
+		s.valid = Or(io, s.valid, put)
+		s.index = Select(io, put, item.index, s.index)
+		s.leaf = Select(io, put, item.leaf, s.leaf)
+		s.data = Select(io, put, item.data, s.data)
+		todo = And(io, todo, Not(io, put))
+	}
+	m.overflow = Or(io, m.overflow, todo)
+}
+
+/* Move one element, if any, from bucket b at level d down toward its leaf */
+func (m *TreeRam) evictBucket(io VM, b, d int) {
+	todo := True(io)
+	item := slot{zeros(io, 1), zeros(io, m.depth), zeros(io, m.depth), zeros(io, m.width)}
+	for i := range m.buckets[b] {
+		s := &m.buckets[b][i]
+		take := And(io, todo, s.valid)
+		item.index = Xor(io, item.index, Mask(io, take, s.index))
+		item.leaf = Xor(io, item.leaf, Mask(io, take, s.leaf))
+		item.data = Xor(io, item.data, Mask(io, take, s.data))
+		s.valid = And(io, s.valid, Not(io, take))
+		todo = And(io, todo, Not(io, take))
+	}
+	have := Not(io, todo)
+	right := item.leaf[m.depth-1-d : m.depth-d]
+	m.insert(io, 2*b, And(io, have, Not(io, right)), item)
+	m.insert(io, 2*b+1, And(io, have, right), item)
+}
+
+func (m *TreeRam) Access(io VM, index []base.Wire, update func([]base.Wire) []base.Wire) []base.Wire {
+	index = m.fit(io, index)
+	newLeaf := Random(io, m.depth)
+	/* the leaf, and whether an element has been lost, which must be revealed before the path is read */
+	r := Reveal(io, append(m.remap(io, index, newLeaf), m.overflow...))
+	if r[m.depth] {
+		panic("TreeRam: a bucket overflowed, and an element is lost")
+	}
+	leaf := r[:m.depth]
+
+	/* read and remove the element from the path to its leaf */
+	old := zeros(io, m.width)
+	b := 1
+	for d := 0; d <= m.depth; d++ {
+		for i := range m.buckets[b] {
+			s := &m.buckets[b][i]
+			match := And(io, s.valid, Icmp_eq(io, s.index, index))
+			old = Xor(io, old, Mask(io, match, s.data))
+			s.valid = And(io, s.valid, Not(io, match))
+		}
+		if d < m.depth {
+			b = 2 * b
+			if leaf[m.depth-1-d] {
+				b++
+			}
+		}
+	}
+
+	m.insert(io, 1, True(io), slot{True(io), index, newLeaf, update(old)})
+
+	/* evict two buckets at every level above the leaves */
+	for d := 0; d < m.depth; d++ {
+		for k := 0; k < 2; k++ {
+			m.evictBucket(io, 1<<uint(d)+m.evict[d]%(1<<uint(d)), d)
+			m.evict[d]++
+		}
+	}
+	return old
+}
+
+//--- Memory for compiled programs
+
+/*
+With the compiler's -oram flag, a program keeps its memory in an ORam
+of 64-bit words instead of the gen-side Ram, and every iteration of
+its main loop makes one MemAccess whether or not it loads or stores.
+Accesses must be naturally aligned, as the C compiler makes them.
+The memory is a variable of the program's main, as on the eval side.
+*/
+
+/* The words of contents are the generator's input; no contents give no memory */
+func InitMemory(io VM, contents []byte) ORam {
+	words := (len(contents) + 7) / 8
+	if words == 0 {
+		return nil
+	}
+	mem := NewORam(io, words, 64)
+	bits := bitsFor(words)
+	for i := 0; i < words; i++ {
+		x := uint64(0)
+		for j := 0; j < 8 && 8*i+j < len(contents); j++ {
+			x |= uint64(contents[8*i+j]) << uint(8*j)
+		}
+		ORamWrite(io, mem, Uint(io, uint64(i), bits), ShareTo1(io, x, 64))
+	}
+	return mem
+}
+
+/* act is 1 for a load and 2 for a store of val in mem; the result is the loaded value */
+func MemAccess(io VM, mem ORam, act, loc, eltsize, val []base.Wire) []base.Wire {
+	if mem == nil {
+		panic("MemAccess: memory not initialized")
+	}
+	sh := append(zeros(io, 3), loc[:3]...) /* bit offset within the word */
+	mask := TreeXor(io,
+		Mask(io, Icmp_eq(io, eltsize, Uint(io, 1, len(eltsize))), Uint(io, 0xff, 64)),
+		Mask(io, Icmp_eq(io, eltsize, Uint(io, 2, len(eltsize))), Uint(io, 0xffff, 64)),
+		Mask(io, Icmp_eq(io, eltsize, Uint(io, 4, len(eltsize))), Uint(io, 0xffffffff, 64)),
+		Mask(io, Icmp_eq(io, eltsize, Uint(io, 8, len(eltsize))), Uint(io, ^uint64(0), 64)))
+	mask = ShlV(io, mask, sh)
+	v := val
+	if len(v) < 64 {
+		v = Zext(io, v, 64)
+	}
+	v = ShlV(io, v, sh)
+	isStore := Icmp_eq(io, act, Uint(io, 2, len(act)))
+	old := mem.Access(io, loc[3:], func(w []base.Wire) []base.Wire {
+		stored := Or(io, And(io, w, Not(io, mask)), And(io, v, mask))
+		return Select(io, isStore, stored, w)
+	})
+	return LshrV(io, And(io, old, mask), sh)
+}
@@ -0,0 +1,210 @@
+package gen
+
+import (
+	. "github.com/tjim/smpcc/runtime/gc"
+)
+
+/*
+Public values.  Compiled code is full of constants, and a back end
+garbles an AND or OR with a constant like any other gate.  A public
+VM wraps a back end VM, carrying the bits known to both parties as
+public wires (see gc.PublicWire) that garble nothing: a gate on two
+public bits is computed in the clear, an AND or OR with one public bit
+is a copy of the other operand or a constant, and an XOR with one is
+a copy or a free negation.  Only the remaining bits reach the back
+end, in a single call for each gate.
+
+True and False are public, and so is everything computed from them
+alone.  Both parties decide what is public from the program, not from
+the secret values, so the evaluator must use eval.PublicVMs.
+*/
+type publicVM struct {
+	vm VM
+}
+
+func PublicVMs(vms []VM) []VM {
+	result := make([]VM, len(vms))
+	for i := range vms {
+		result[i] = &publicVM{vms[i]}
+	}
+	return result
+}
+
+/* w, with a public value replaced by a back end constant */
+func (y *publicVM) wire(w Wire) Wire {
+	if !IsPublicWire(w) {
+		return w
+	}
+	if PublicValue(w[0]) {
+		return y.vm.True()[0]
+	}
+	return y.vm.False()[0]
+}
+
+/*
+A gate of the back end on the bits of a and b that public does not
+decide; public gives the result of a bit, or ok == false
+*/
+func (y *publicVM) gate(a, b []Wire, public func(x, z Wire) (w Wire, ok bool), f func(a, b []Wire) []Wire) []Wire {
+	result := make([]Wire, len(a))
+	var xs, zs []Wire
+	var is []int
+	for i := range a {
+		if w, ok := public(a[i], b[i]); ok {
+			result[i] = w
+			continue
+		}
+		xs = append(xs, y.wire(a[i]))
+		zs = append(zs, y.wire(b[i]))
+		is = append(is, i)
+	}
+	if len(is) > 0 {
+		for j, w := range f(xs, zs) {
+			result[is[j]] = w
+		}
+	}
+	return result
+}
+
+func (y *publicVM) And(a, b []Wire) []Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in gen.publicVM.And()")
+	}
+	return y.gate(a, b, func(x, z Wire) (Wire, bool) {
+		switch {
+		case IsPublicWire(x) && IsPublicWire(z):
+			return PublicWire(PublicValue(x[0]) && PublicValue(z[0])), true
+		case IsPublicWire(x):
+			if PublicValue(x[0]) {
+				return z, true
+			}
+			return x, true
+		case IsPublicWire(z):
+			if PublicValue(z[0]) {
+				return x, true
+			}
+			return z, true
+		}
+		return nil, false
+	}, y.vm.And)
+}
+
+func (y *publicVM) Or(a, b []Wire) []Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in gen.publicVM.Or()")
+	}
+	return y.gate(a, b, func(x, z Wire) (Wire, bool) {
+		switch {
+		case IsPublicWire(x) && IsPublicWire(z):
+			return PublicWire(PublicValue(x[0]) || PublicValue(z[0])), true
+		case IsPublicWire(x):
+			if PublicValue(x[0]) {
+				return x, true
+			}
+			return z, true
+		case IsPublicWire(z):
+			if PublicValue(z[0]) {
+				return z, true
+			}
+			return x, true
+		}
+		return nil, false
+	}, y.vm.Or)
+}
+
+/* An XOR with a public 1 goes to the back end, which negates for free */
+func (y *publicVM) Xor(a, b []Wire) []Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in gen.publicVM.Xor()")
+	}
+	return y.gate(a, b, func(x, z Wire) (Wire, bool) {
+		switch {
+		case IsPublicWire(x) && IsPublicWire(z):
+			return PublicWire(PublicValue(x[0]) != PublicValue(z[0])), true
+		case IsPublicWire(x) && !PublicValue(x[0]):
+			return z, true
+		case IsPublicWire(z) && !PublicValue(z[0]):
+			return x, true
+		}
+		return nil, false
+	}, y.vm.Xor)
+}
+
+/* A public s picks a or b; otherwise only bits where a and b are the same public value skip the back end */
+func (y *publicVM) Mux(s, a, b []Wire) []Wire {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Wire mismatch in gen.publicVM.Mux()")
+	}
+	if IsPublicWire(s[0]) {
+		if PublicValue(s[0][0]) {
+			return a
+		}
+		return b
+	}
+	return y.gate(a, b, func(x, z Wire) (Wire, bool) {
+		if IsPublicWire(x) && IsPublicWire(z) && PublicValue(x[0]) == PublicValue(z[0]) {
+			return x, true
+		}
+		return nil, false
+	}, func(a, b []Wire) []Wire { return y.vm.Mux(s, a, b) })
+}
+
+func (y *publicVM) True() []Wire {
+	return []Wire{PublicWire(true)}
+}
+
+func (y *publicVM) False() []Wire {
+	return []Wire{PublicWire(false)}
+}
+
+/* The bits of a that are not public, and their indices */
+func secret(a []Wire) ([]Wire, []int) {
+	var xs []Wire
+	var is []int
+	for i := range a {
+		if !IsPublicWire(a[i]) {
+			xs = append(xs, a[i])
+			is = append(is, i)
+		}
+	}
+	return xs, is
+}
+
+/* Public bits are revealed already */
+func (y *publicVM) Session() *Session {
+	return y.vm.Session()
+}
+
+func (y *publicVM) RevealTo0(a []Wire) []bool {
+	result := make([]bool, len(a))
+	for i := range a {
+		if IsPublicWire(a[i]) {
+			result[i] = PublicValue(a[i][0])
+		}
+	}
+	xs, is := secret(a)
+	if len(xs) > 0 {
+		for j, v := range y.vm.RevealTo0(xs) {
+			result[is[j]] = v
+		}
+	}
+	return result
+}
+
+func (y *publicVM) RevealTo1(a []Wire) {
+	if xs, _ := secret(a); len(xs) > 0 {
+		y.vm.RevealTo1(xs)
+	}
+}
+
+func (y *publicVM) ShareTo0(bits int) []Wire {
+	return y.vm.ShareTo0(bits)
+}
+
+func (y *publicVM) ShareTo1(a uint64, bits int) []Wire {
+	return y.vm.ShareTo1(a, bits)
+}
+
+func (y *publicVM) Random(bits int) []Wire {
+	return y.vm.Random(bits)
+}
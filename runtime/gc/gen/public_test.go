@@ -0,0 +1,159 @@
+package gen_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+	"github.com/tjim/smpcc/runtime/gc/halfgates/sim"
+	"github.com/tjim/smpcc/runtime/gc/plain"
+)
+
+func toUint64(bits []bool) uint64 {
+	var result uint64
+	for i, b := range bits {
+		if b {
+			result |= 1 << uint(i)
+		}
+	}
+	return result
+}
+
+/* The n-bit value a as the generator's input, except that the bits of public are public constants */
+func genInput(io gen.VM, a, public uint64, n int) []gc.Wire {
+	x := io.ShareTo1(a, n)
+	for i := range x {
+		if public>>uint(i)&1 == 1 {
+			x[i] = gen.Uint(io, a>>uint(i)&1, 1)[0]
+		}
+	}
+	return x
+}
+
+func evalInput(io eval.VM, a, public uint64, n int) []gc.Key {
+	x := io.ShareTo1(n)
+	for i := range x {
+		if public>>uint(i)&1 == 1 {
+			x[i] = eval.Uint(io, a>>uint(i)&1, 1)[0]
+		}
+	}
+	return x
+}
+
+/* The answer of f on gen and eval VMs, revealed to both, which must agree */
+func run(t *testing.T, gvm gen.VM, evm eval.VM, a, b, public uint64, n int, fg func(gen.VM, []gc.Wire, []gc.Wire) []gc.Wire, fe func(eval.VM, []gc.Key, []gc.Key) []gc.Key) uint64 {
+	done := make(chan uint64)
+	go func() {
+		r := fe(evm, evalInput(evm, a, public, n), evalInput(evm, b, public>>32, n))
+		evm.RevealTo0(r)
+		done <- toUint64(evm.RevealTo1(r))
+	}()
+	r := fg(gvm, genInput(gvm, a, public, n), genInput(gvm, b, public>>32, n))
+	g := toUint64(gvm.RevealTo0(r))
+	gvm.RevealTo1(r)
+	if e := <-done; g != e {
+		t.Fatalf("%x, %x: gen gives %x, eval gives %x", a, b, g, e)
+	}
+	return g
+}
+
+/*
+f of a and b on public halfgates VMs, where a has the public bits of
+the low half of public and b those of the high half, against f on
+plain VMs, where every bit is secret
+*/
+func publicOp(t *testing.T, a, b, public uint64, n int, fg func(gen.VM, []gc.Wire, []gc.Wire) []gc.Wire, fe func(eval.VM, []gc.Key, []gc.Key) []gc.Key) {
+	gvms, evms := sim.VMs(1)
+	got := run(t, gen.PublicVMs(gvms)[0], eval.PublicVMs(evms)[0], a, b, public, n, fg, fe)
+	gvms, evms = plain.VMs(1)
+	if want := run(t, gvms[0], evms[0], a, b, 0, n, fg, fe); got != want {
+		t.Errorf("%x, %x with public bits %x: got %x, want %x", a, b, public, got, want)
+	}
+}
+
+type op struct {
+	name string
+	n    int
+	g    func(gen.VM, []gc.Wire, []gc.Wire) []gc.Wire
+	e    func(eval.VM, []gc.Key, []gc.Key) []gc.Key
+}
+
+func unary(name string, n int, g func(gen.VM, []gc.Wire) []gc.Wire, e func(eval.VM, []gc.Key) []gc.Key) op {
+	return op{name, n,
+		func(io gen.VM, a, _ []gc.Wire) []gc.Wire { return g(io, a) },
+		func(io eval.VM, a, _ []gc.Key) []gc.Key { return e(io, a) }}
+}
+
+func fixed(name string, g func(gen.VM, []gc.Wire, []gc.Wire, int) []gc.Wire, e func(eval.VM, []gc.Key, []gc.Key, int) []gc.Key) op {
+	return op{name, 32,
+		func(io gen.VM, a, b []gc.Wire) []gc.Wire { return g(io, a, b, 16) },
+		func(io eval.VM, a, b []gc.Key) []gc.Key { return e(io, a, b, 16) }}
+}
+
+func fixedUnary(name string, g func(gen.VM, []gc.Wire, int) []gc.Wire, e func(eval.VM, []gc.Key, int) []gc.Key) op {
+	return op{name, 32,
+		func(io gen.VM, a, _ []gc.Wire) []gc.Wire { return g(io, a, 16) },
+		func(io eval.VM, a, _ []gc.Key) []gc.Key { return e(io, a, 16) }}
+}
+
+func TestPublicMixed(t *testing.T) {
+	ops := []op{
+		unary("popcount", 32, gen.Popcount, eval.Popcount),
+		unary("ctlz", 32, gen.Ctlz, eval.Ctlz),
+		unary("cttz", 32, gen.Cttz, eval.Cttz),
+		unary("popcount of a zext", 2,
+			func(io gen.VM, a []gc.Wire) []gc.Wire { return gen.Popcount(io, gen.Zext(io, a[:1], 2)) },
+			func(io eval.VM, a []gc.Key) []gc.Key { return eval.Popcount(io, eval.Zext(io, a[:1], 2)) }),
+		{"hamming distance", 32, gen.HammingDistance, eval.HammingDistance},
+		{"add", 32, gen.Add, eval.Add},
+		{"mul", 16, gen.Mul, eval.Mul},
+		{"fadd", 32, gen.Fadd, eval.Fadd},
+		{"fmul", 32, gen.Fmul, eval.Fmul},
+		{"fdiv", 32, gen.Fdiv, eval.Fdiv},
+		{"fcmp olt", 32, gen.Fcmp_olt, eval.Fcmp_olt},
+		fixed("fixmul", gen.FixMul, eval.FixMul),
+		fixed("fixdiv", gen.FixDiv, eval.FixDiv),
+		fixedUnary("fixsqrt", gen.FixSqrt, eval.FixSqrt),
+		fixedUnary("fixexp", gen.FixExp, eval.FixExp),
+		fixedUnary("fixlog", gen.FixLog, eval.FixLog),
+	}
+	rnd := rand.New(rand.NewSource(1))
+	a, b := uint64(math.Float32bits(3.25)), uint64(math.Float32bits(-0.5))
+	for _, o := range ops {
+		/* all public, all secret, and random mixtures */
+		for _, public := range []uint64{^uint64(0), 0, rnd.Uint64(), rnd.Uint64()} {
+			t.Run(o.name, func(t *testing.T) { publicOp(t, a, b, public, o.n, o.g, o.e) })
+		}
+		a, b = a^rnd.Uint64()&0xffff, b^rnd.Uint64()&0xffff
+	}
+}
+
+/* x*7 + 3, masked to its low byte unless x > 100, so constants meet secrets in every kind of gate */
+func publicGen(io gen.VM, x []gc.Wire) []gc.Wire {
+	y := gen.Add(io, gen.Mul(io, x, gen.Uint(io, 7, 16)), gen.Uint(io, 3, 16))
+	big := gen.Icmp_ugt(io, x, gen.Uint(io, 100, 16))
+	return gen.Select(io, big, y, gen.And(io, y, gen.Uint(io, 0xff, 16)))
+}
+
+func TestPublicCost(t *testing.T) {
+	count := func(public bool) int {
+		vms, report := gen.NewCostVMs(1, nil)
+		if public {
+			vms = gen.PublicVMs(vms)
+		}
+		publicGen(vms[0], vms[0].ShareTo1(5, 16))
+		return report.Blocks[0].Iterations[0].And
+	}
+	if all, public := count(false), count(true); public >= all {
+		t.Errorf("%d ANDs with public constants, %d without", public, all)
+	}
+	vms, report := gen.NewCostVMs(1, nil)
+	vms = gen.PublicVMs(vms)
+	gen.And(vms[0], vms[0].ShareTo1(5, 16), gen.Uint(vms[0], 0xff, 16))
+	if n := report.Blocks[0].Iterations[0].And; n != 0 {
+		t.Errorf("an AND with a constant: %d ANDs", n)
+	}
+}
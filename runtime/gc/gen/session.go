@@ -0,0 +1,65 @@
+package gen
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"github.com/tjim/smpcc/runtime/base"
+	. "github.com/tjim/smpcc/runtime/gc"
+)
+
+/*
+A Session holds the garbler state shared by the VMs of one
+computation.  Wires flow freely between the VMs of a session (block
+goroutines receive arguments from the main VM), so they must all be
+garbled under the same free-XOR offset.  VMs of different sessions
+share nothing, so several computations can run in one process.  The
+generator's memory (see InitRam) belongs to the session too.
+*/
+type Session struct {
+	Key0 Key    // The XOR random constant
+	seed Key    // If not nil, all keys of the session are derived from it
+	Ram  []byte // The generator's memory, for Load and Store
+}
+
+func NewSession() *Session {
+	key0 := make([]byte, base.KEY_SIZE)
+	GenKey(key0) // least significant bit is random...
+	key0[0] |= 1 // ...force it to 1
+	return &Session{Key0: key0}
+}
+
+/*
+A seeded session garbles deterministically: anyone who knows the seed
+can garble the same circuit again, as long as each VM makes the same
+calls.  Cut-and-choose (see cc.go) uses this to check copies of a
+circuit.
+*/
+func NewSeededSession(seed Key) *Session {
+	s := &Session{seed: seed}
+	key0 := make([]byte, base.KEY_SIZE)
+	s.Rand(-1)(key0)
+	key0[0] |= 1
+	s.Key0 = key0
+	return s
+}
+
+/* The source of random wire keys for the VM id of the session */
+func (s *Session) Rand(id ConcurrentId) func([]byte) {
+	if s.seed == nil {
+		return GenKey
+	}
+	block, err := aes.NewCipher(s.seed)
+	if err != nil {
+		panic(err)
+	}
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv, uint64(id))
+	stream := cipher.NewCTR(block, iv)
+	return func(buf []byte) {
+		for i := range buf {
+			buf[i] = 0
+		}
+		stream.XORKeyStream(buf, buf)
+	}
+}
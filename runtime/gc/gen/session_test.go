@@ -0,0 +1,71 @@
+package gen_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	gaxgen "github.com/tjim/smpcc/runtime/gc/gax/gen"
+	gaxrgen "github.com/tjim/smpcc/runtime/gc/gaxr/gen"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+	hggen "github.com/tjim/smpcc/runtime/gc/halfgates/gen"
+	yaogen "github.com/tjim/smpcc/runtime/gc/yao/gen"
+	yaorgen "github.com/tjim/smpcc/runtime/gc/yaor/gen"
+	"github.com/tjim/smpcc/runtime/ot"
+)
+
+/* An IO that keeps what a generator sends, and needs no evaluator */
+type recordIO struct {
+	gen.IO
+	sent [][]byte
+}
+
+func (io *recordIO) SendT(t gc.GarbledTable) {
+	for _, c := range t {
+		io.sent = append(io.sent, c)
+	}
+}
+
+func (io *recordIO) SendK(k gc.Key) {
+	io.sent = append(io.sent, k)
+}
+
+func (io *recordIO) SendM(a, b []ot.Message) {
+	for i := range a {
+		io.sent = append(io.sent, a[i], b[i])
+	}
+}
+
+/* What a VM of a session seeded with seed sends for some gates and random bits */
+func seededRun(newVM func(io gen.IO, id gc.ConcurrentId, s *gen.Session) gen.VM, seed gc.Key) [][]byte {
+	io := &recordIO{}
+	vm := newVM(io, 0, gen.NewSeededSession(seed))
+	r := vm.Random(20)
+	x := vm.ShareTo1(0x5a5a5, 20)
+	vm.RevealTo1(gen.Xor(vm, gen.And(vm, r, x), gen.Or(vm, r, gen.Not(vm, x))))
+	return io.sent
+}
+
+/* A seeded session garbles the same circuit, random bits included, the same way every time */
+func TestSeededSession(t *testing.T) {
+	for name, newVM := range map[string]func(io gen.IO, id gc.ConcurrentId, s *gen.Session) gen.VM{
+		"yao":       yaogen.NewVM,
+		"yaor":      yaorgen.NewVM,
+		"gax":       gaxgen.NewVM,
+		"gaxr":      gaxrgen.NewVM,
+		"halfgates": hggen.NewVM,
+	} {
+		seed := make(gc.Key, 16)
+		gc.GenKey(seed)
+		a, b := seededRun(newVM, seed), seededRun(newVM, seed)
+		if len(a) != len(b) {
+			t.Fatalf("%s: %d messages, then %d", name, len(a), len(b))
+		}
+		for i := range a {
+			if !bytes.Equal(a[i], b[i]) {
+				t.Errorf("%s: message %d differs, %x then %x", name, i, a[i], b[i])
+				break
+			}
+		}
+	}
+}
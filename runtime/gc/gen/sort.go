@@ -0,0 +1,148 @@
+package gen
+
+import (
+	"fmt"
+	"github.com/tjim/smpcc/runtime/base"
+	. "github.com/tjim/smpcc/runtime/gc"
+)
+
+/*
+Oblivious sorting and shuffling, by the networks of runtime/base.  The
+switches applied do not depend on the values, so a program that sorts
+this way reveals nothing through its control flow or its memory
+accesses, as a sort in C through the block machinery does.
+*/
+
+/* Exchange xs[i] and xs[j] if s */
+func exchange(io VM, s []Wire, xs [][]Wire, i, j int) {
+	d := Mask(io, s, Xor(io, xs[i], xs[j]))
+	xs[i] = Xor(io, xs[i], d)
+	xs[j] = Xor(io, xs[j], d)
+}
+
+/* Put the smaller of the unsigned keys[i] and keys[j] at i; payloads, if not nil, move with the keys */
+func CompareSwap(io VM, keys, payloads [][]Wire, i, j int) {
+	if len(keys[i]) != len(keys[j]) {
+		panic(fmt.Sprintf("Wire mismatch in gen.CompareSwap(), %d vs %d", len(keys[i]), len(keys[j])))
+	}
+	s := Icmp_ugt(io, keys[i], keys[j])
+	exchange(io, s, keys, i, j)
+	if payloads != nil {
+		exchange(io, s, payloads, i, j)
+	}
+}
+
+func sortBy(io VM, net []base.Switch, keys, payloads [][]Wire) {
+	if payloads != nil && len(payloads) != len(keys) {
+		panic(fmt.Sprintf("Wire mismatch in gen.sortBy(), %d keys vs %d payloads", len(keys), len(payloads)))
+	}
+	for _, sw := range net {
+		CompareSwap(io, keys, payloads, sw.I, sw.J)
+	}
+}
+
+func OddEvenMergeSort(io VM, keys, payloads [][]Wire) {
+	sortBy(io, base.OddEvenMergeNetwork(len(keys)), keys, payloads)
+}
+
+func BitonicSort(io VM, keys, payloads [][]Wire) {
+	sortBy(io, base.BitonicNetwork(len(keys)), keys, payloads)
+}
+
+/* Permute xs by base.WaksmanNetwork(len(xs)), one bit of control per switch */
+func Waksman(io VM, xs [][]Wire, control []Wire) {
+	net := base.WaksmanNetwork(len(xs))
+	if len(control) != len(net) {
+		panic(fmt.Sprintf("Wire mismatch in gen.Waksman(), %d switches vs %d controls", len(net), len(control)))
+	}
+	for k, sw := range net {
+		exchange(io, control[k:k+1], xs, sw.I, sw.J)
+	}
+}
+
+/* The generator's bits as its input, 64 to a message */
+func shareBitsTo1(io VM, bits []bool) []Wire {
+	var result []Wire
+	for i := 0; i < len(bits); i += 64 {
+		n := len(bits) - i
+		if n > 64 {
+			n = 64
+		}
+		x := uint64(0)
+		for j := 0; j < n; j++ {
+			if bits[i+j] {
+				x |= 1 << uint(j)
+			}
+		}
+		result = append(result, ShareTo1(io, x, n)...)
+	}
+	return result
+}
+
+/* n bits of the evaluator's input, as shareBitsTo0 of eval sends them */
+func shareBitsTo0(io VM, n int) []Wire {
+	var result []Wire
+	for i := 0; i < n; i += 64 {
+		m := n - i
+		if m > 64 {
+			m = 64
+		}
+		result = append(result, ShareTo0(io, m)...)
+	}
+	return result
+}
+
+/*
+Shuffle xs by a random permutation that neither party knows: the
+generator's permutation and then the evaluator's, each routed through
+a Waksman network by control bits that only its chooser knows.
+*/
+func Shuffle(io VM, xs [][]Wire) {
+	control := base.WaksmanControl(base.RandomPermutation(len(xs)))
+	Waksman(io, xs, shareBitsTo1(io, control))
+	Waksman(io, xs, shareBitsTo0(io, len(control)))
+}
+
+/* The n 32-bit values at loc, read from the generator's memory */
+func loadArray(io VM, loc []Wire, n int) [][]Wire {
+	address := int(Reveal0Uint64(io, loc))
+	ram := io.Session().Ram
+	xs := make([][]Wire, n)
+	for i := range xs {
+		x := uint64(0)
+		for j := 0; j < 4; j++ {
+			x |= uint64(ram[address+4*i+j]) << uint(j*8)
+		}
+		xs[i] = ShareTo1(io, x, 32)
+	}
+	return xs
+}
+
+func storeArray(io VM, loc []Wire, xs [][]Wire) {
+	address := int(Reveal0Uint64(io, loc))
+	ram := io.Session().Ram
+	for i := range xs {
+		x := Reveal0Uint32(io, xs[i])
+		for j := 0; j < 4; j++ {
+			ram[address+4*i+j] = byte(x >> uint(j*8))
+		}
+	}
+}
+
+/*
+Sort the n unsigned ints at loc in place, for oblivious_sort of C.
+Like LoadDebug, it does nothing unless mask is true.  Memory is the
+generator's, in the clear, so the sort hides the order from the
+evaluator only; its use is to replace a data-dependent sort in C.
+*/
+func SortMemory(io VM, mask, loc []Wire, n int) {
+	if len(mask) != 1 {
+		panic("SortMemory")
+	}
+	if !Reveal(io, mask)[0] {
+		return
+	}
+	xs := loadArray(io, loc, n)
+	OddEvenMergeSort(io, xs, nil)
+	storeArray(io, loc, xs)
+}
@@ -0,0 +1,198 @@
+package gen
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	. "github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/ot"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+/*
+StoreIO garbles into a store (see gc/store.go) instead of sending to
+an evaluator.  Input-wire label pairs are recorded rather than
+obliviously transferred, and keys for the generator's own inputs are
+fixed when the circuit is garbled.  Nothing secret can be revealed to
+the generator offline, since nobody is there to answer, so a program
+that needs a secret value, e.g., the address of a Load or Store or the
+condition that ends its main loop, cannot be garbled offline: RecvK2
+removes the files of the store, so that it cannot be replayed, and
+exits.  Public values are revealed by gen.PublicVMs
+without asking the evaluator.
+*/
+type StoreIO struct {
+	genFile, evalFile *os.File
+	genBuf, evalBuf   *bufio.Writer
+	gen, eval         *gob.Encoder
+}
+
+func NewStoreIO(dir string, id ConcurrentId) *StoreIO {
+	genFile, err := os.Create(GenStoreFile(dir, id))
+	if err != nil {
+		log.Fatalf("NewStoreIO: %s", err)
+	}
+	evalFile, err := os.Create(EvalStoreFile(dir, id))
+	if err != nil {
+		log.Fatalf("NewStoreIO: %s", err)
+	}
+	genBuf := bufio.NewWriter(genFile)
+	evalBuf := bufio.NewWriter(evalFile)
+	return &StoreIO{genFile, evalFile, genBuf, evalBuf, gob.NewEncoder(genBuf), gob.NewEncoder(evalBuf)}
+}
+
+func (io *StoreIO) record(enc *gob.Encoder, r StoreRecord) {
+	if err := enc.Encode(r); err != nil {
+		log.Fatalf("StoreIO: %s", err)
+	}
+}
+
+func (io *StoreIO) SendT(t GarbledTable) {
+	io.record(io.gen, StoreRecord{Kind: RecTable, T: t})
+	io.record(io.eval, StoreRecord{Kind: RecTable, T: t})
+}
+
+func (io *StoreIO) SendK(k Key) {
+	io.record(io.gen, StoreRecord{Kind: RecKey, K: k})
+}
+
+func (io *StoreIO) RecvK2() Key {
+	os.Remove(io.genFile.Name())
+	os.Remove(io.evalFile.Name())
+	log.Fatalf("StoreIO: the program reveals a secret value to the generator, so it cannot be garbled offline")
+	return nil
+}
+
+/* Records are written as they are made */
+func (io *StoreIO) Flush() {
+}
+
+func (io *StoreIO) Send(m0, m1 ot.Message) {
+	io.record(io.gen, StoreRecord{Kind: RecOT, A: []ot.Message{m0}, B: []ot.Message{m1}})
+}
+
+func (io *StoreIO) SendM(a, b []ot.Message) {
+	io.record(io.gen, StoreRecord{Kind: RecOTM, A: a, B: b})
+}
+
+func (io *StoreIO) SendMBits(a, b []byte) {
+	io.record(io.gen, StoreRecord{Kind: RecOTMBits, A: []ot.Message{a}, B: []ot.Message{b}})
+}
+
+func (io *StoreIO) Close() {
+	for _, b := range []*bufio.Writer{io.genBuf, io.evalBuf} {
+		if err := b.Flush(); err != nil {
+			log.Fatalf("StoreIO: %s", err)
+		}
+	}
+	io.genFile.Close()
+	io.evalFile.Close()
+}
+
+/* Offline phase: run the generator program, garbling into the store dir */
+func Offline(dir string, main func([]VM), numBlocks int, newVM func(io IO, id ConcurrentId, s *Session) VM) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatalf("Offline: %s", err)
+	}
+	ios := make([]*StoreIO, numBlocks)
+	vms := make([]VM, numBlocks)
+	s := NewSession()
+	for i := range vms {
+		ios[i] = NewStoreIO(dir, ConcurrentId(i))
+		vms[i] = newVM(ios[i], ConcurrentId(i), s)
+	}
+	main(vms)
+	for _, io := range ios {
+		io.Close()
+	}
+}
+
+/*
+Take the store file of VM id for a replay by renaming it to
+gen.<id>.used, atomically, so that a store is replayed at most once:
+the same labels sent again for other inputs would give the evaluator
+both labels of a wire.
+*/
+func consume(dir string, id ConcurrentId) (*os.File, error) {
+	name := GenStoreFile(dir, id)
+	if err := os.Rename(name, name+".used"); err != nil {
+		if _, used := os.Stat(name + ".used"); used == nil {
+			return nil, fmt.Errorf("%s has already been replayed", name)
+		}
+		return nil, err
+	}
+	return os.Open(name + ".used")
+}
+
+/*
+Replay sends the records of VM id's store file over io, in order, and
+consumes the file, so that it cannot be replayed again.  If the
+evaluator already has its own copy of the tables (localTables) they
+are not sent again.
+*/
+func Replay(out IO, dir string, id ConcurrentId, localTables bool) {
+	f, err := consume(dir, id)
+	if err != nil {
+		log.Fatalf("Replay: %s", err)
+	}
+	replay(out, f, localTables)
+}
+
+func replay(out IO, f *os.File, localTables bool) {
+	defer f.Close()
+	dec := gob.NewDecoder(bufio.NewReader(f))
+	for {
+		var r StoreRecord
+		if err := dec.Decode(&r); err == io.EOF {
+			return
+		} else if err != nil {
+			log.Fatalf("Replay: %s", err)
+		}
+		switch r.Kind {
+		case RecTable:
+			if !localTables {
+				out.SendT(r.T)
+			}
+		case RecKey:
+			out.SendK(r.K)
+		case RecOT:
+			out.Send(r.A[0], r.B[0])
+		case RecOTM:
+			out.SendM(r.A, r.B)
+		case RecOTMBits:
+			out.SendMBits(r.A[0], r.B[0])
+		default:
+			log.Fatalf("Replay: unknown record kind %d", r.Kind)
+		}
+	}
+}
+
+/*
+Online phase: consume a store made by Offline, then connect to the
+evaluator and replay it
+*/
+func Online(addr string, dir string, numBlocks int, localTables bool) {
+	files := make([]*os.File, numBlocks)
+	for i := range files {
+		f, err := consume(dir, ConcurrentId(i))
+		if err != nil {
+			log.Fatalf("Online: %s", err)
+		}
+		files[i] = f
+	}
+	ios, conn := Dial2(addr, numBlocks)
+	defer conn.Close()
+	var wg sync.WaitGroup
+	for i := range ios {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			replay(ios[i], files[i], localTables)
+		}(i)
+	}
+	wg.Wait()
+	Flush(ios)
+}
@@ -0,0 +1,36 @@
+package gen
+
+import (
+	"bufio"
+	"encoding/gob"
+	"testing"
+
+	. "github.com/tjim/smpcc/runtime/gc"
+)
+
+func TestStoreUsedOnce(t *testing.T) {
+	dir, other := t.TempDir(), t.TempDir()
+	in := NewStoreIO(dir, 0)
+	in.SendT(GarbledTable{Ciphertext{1, 2}})
+	in.SendK(Key{3})
+	in.Close()
+	/* Replaying a store into another copies it, and uses it up */
+	out := NewStoreIO(other, 0)
+	Replay(out, dir, 0, false)
+	out.Close()
+	if _, err := consume(dir, 0); err == nil {
+		t.Fatal("a store was replayed twice")
+	}
+	f, err := consume(other, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dec := gob.NewDecoder(bufio.NewReader(f))
+	for _, kind := range []byte{RecTable, RecKey} {
+		var r StoreRecord
+		if err := dec.Decode(&r); err != nil || r.Kind != kind {
+			t.Fatalf("record of kind %d, want %d: %v", r.Kind, kind, err)
+		}
+	}
+}
@@ -31,6 +31,55 @@ func XorKey(a, b Key) Key {
 	return result
 }
 
+/*
+b ^ (s & (a ^ b)), a where s is 1 and b where it is 0, in a back end
+with free XOR: a single call of and, on s repeated, so one AND per bit.
+This is the Mux of every back end that has no better gadget.
+*/
+func MuxWires(and, xor func(a, b []Wire) []Wire, s Wire, a, b []Wire) []Wire {
+	ss := make([]Wire, len(a))
+	for i := range ss {
+		ss[i] = s
+	}
+	return xor(b, and(ss, xor(a, b)))
+}
+
+func MuxKeys(and, xor func(a, b []Key) []Key, s Key, a, b []Key) []Key {
+	ss := make([]Key, len(a))
+	for i := range ss {
+		ss[i] = s
+	}
+	return xor(b, and(ss, xor(a, b)))
+}
+
+/*
+A public bit, known to both parties, is carried by a one-byte key
+holding its value in place of a garbled wire; see gen.PublicVMs
+*/
+func PublicKey(b bool) Key {
+	if b {
+		return Key{1}
+	}
+	return Key{0}
+}
+
+func PublicWire(b bool) Wire {
+	return Wire{PublicKey(b)}
+}
+
+func IsPublicKey(k Key) bool {
+	return len(k) == 1
+}
+
+func IsPublicWire(w Wire) bool {
+	return len(w) == 1 && IsPublicKey(w[0])
+}
+
+/* The value of a public key */
+func PublicValue(k Key) bool {
+	return k[0] == 1
+}
+
 // Fills keyBuf with random bytes
 func GenKey(keyBuf []byte) {
 	n, err := io.ReadFull(rand.Reader, keyBuf)
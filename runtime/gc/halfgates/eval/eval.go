@@ -0,0 +1,167 @@
+package eval
+
+import (
+	"github.com/tjim/smpcc/runtime/base"
+	"github.com/tjim/smpcc/runtime/bit"
+	"github.com/tjim/smpcc/runtime/gc"
+	baseeval "github.com/tjim/smpcc/runtime/gc/eval"
+)
+
+type vm struct {
+	io           baseeval.IO
+	concurrentId gc.ConcurrentId
+	gateId       uint64
+	const0       gc.Key
+	const1       gc.Key
+}
+
+func NewVM(io baseeval.IO, id gc.ConcurrentId) baseeval.VM {
+	return &vm{io: io, concurrentId: id}
+}
+
+func (y *vm) init_constants() {
+	if y.const0 == nil {
+		y.const0 = y.io.RecvK()
+		y.const1 = y.io.RecvK()
+	}
+}
+
+// Must match the generator's tweaks, see halfgates/gen
+func (y *vm) computeTweak(half uint64) gc.Key {
+	tweak := make([]byte, base.KEY_SIZE)
+	j := 2*y.gateId + half
+	var i uint
+	for i = 0; i < 8; i++ {
+		tweak[i] = byte(j >> (8 * i))
+		tweak[i+8] = byte(y.concurrentId >> (8 * i))
+	}
+	return tweak
+}
+
+func lsb(k gc.Key) byte {
+	return k[0] % 2
+}
+
+// Evaluate one garbled AND gate from its two ciphertexts
+func (y *vm) and(a, b gc.Key) gc.Key {
+	t := y.io.RecvT()
+	if len(t) != 2 {
+		panic("eval.And(): expected a half-gates table")
+	}
+	tg, te := gc.Key(t[0]), gc.Key(t[1])
+	j0 := y.computeTweak(0)
+	j1 := y.computeTweak(1)
+	y.gateId++
+
+	wg := gc.HalfGatesH(a, j0)
+	if lsb(a) == 1 {
+		wg = gc.XorKey(wg, tg)
+	}
+	we := gc.HalfGatesH(b, j1)
+	if lsb(b) == 1 {
+		we = gc.XorKey(we, gc.XorKey(te, a))
+	}
+	return gc.XorKey(wg, we)
+}
+
+func (y *vm) bitwise_binary_operator(a, b []gc.Key) []gc.Key {
+	if len(a) != len(b) {
+		panic("Wire mismatch in eval.bitwise_binary_operator()")
+	}
+	result := make([]gc.Key, len(a))
+	for i := 0; i < len(a); i++ {
+		result[i] = y.and(a[i], b[i])
+	}
+	return result
+}
+
+func (y *vm) And(a, b []gc.Key) []gc.Key {
+	return y.bitwise_binary_operator(a, b)
+}
+
+// The generator garbles OR as an AND gate with swapped keys
+func (y *vm) Or(a, b []gc.Key) []gc.Key {
+	return y.bitwise_binary_operator(a, b)
+}
+
+func (y *vm) Xor(a, b []gc.Key) []gc.Key {
+	if len(a) != len(b) {
+		panic("Xor(): mismatch")
+	}
+	result := make([]gc.Key, len(a))
+	for i := 0; i < len(a); i++ {
+		result[i] = gc.XorKey(a[i], b[i])
+	}
+	return result
+}
+
+func (y *vm) Mux(s, a, b []gc.Key) []gc.Key {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Mux(): mismatch")
+	}
+	return gc.MuxKeys(y.And, y.Xor, s[0], a, b)
+}
+
+func (y *vm) True() []gc.Key {
+	y.init_constants()
+	return []gc.Key{y.const1}
+}
+
+func (y *vm) False() []gc.Key {
+	y.init_constants()
+	return []gc.Key{y.const0}
+}
+
+/* Reveal to party 0 = gen */
+func (y *vm) RevealTo0(a []gc.Key) {
+	for i := 0; i < len(a); i++ {
+		y.io.SendK2(a[i])
+	}
+}
+
+/* Reveal to party 1 = eval */
+func (y *vm) RevealTo1(a []gc.Key) []bool {
+	result := make([]bool, len(a))
+	for i := 0; i < len(a); i++ {
+		t := y.io.RecvT()
+		if len(t) != 1 || len(t[0]) != 1 {
+			panic("eval.Reveal(): invalid response")
+		}
+		result[i] = (lsb(a[i]) ^ t[0][0]) == 1
+	}
+	return result
+}
+
+func (y *vm) ShareTo0(v uint64, bits int) []gc.Key {
+	r := make([]byte, (bits+7)/8)
+	for i := 0; i < bits; i++ {
+		bit.SetBit(r, i, byte((v>>uint(i))%2))
+	}
+	return baseeval.ReceiveKeys(y.io, r, bits)
+}
+
+// Random generates random bits.
+func (y *vm) Random(bits int) []gc.Key {
+	if bits < 1 {
+		panic("Random: bits < 1")
+	}
+	numBytes := bits / 8
+	if bits%8 != 0 {
+		numBytes++
+	}
+	random := make([]byte, numBytes)
+	gc.GenKey(random)
+	return baseeval.ReceiveKeys(y.io, random, bits)
+}
+
+/* Bit transfer: Generator knows the bits, evaluator gets keys */
+func (y *vm) ShareTo1(bits int) []gc.Key {
+	if bits > 64 {
+		panic("BT: bits > 64")
+	}
+	result := make([]gc.Key, bits)
+	for i := 0; i < bits; i++ {
+		result[i] = y.io.RecvK()
+	}
+	return result
+}
@@ -0,0 +1,251 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/tjim/smpcc/runtime/base"
+	"github.com/tjim/smpcc/runtime/bit"
+	"github.com/tjim/smpcc/runtime/gc"
+	basegen "github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+// Half gates: "Two Halves Make a Whole: Reducing Data Transfer in
+// Garbled Circuits using Half Gates," by Zahur, Rosulek and Evans.
+// Eurocrypt 2015.  Each AND or OR gate costs two ciphertexts.
+
+type vm struct {
+	io           basegen.IO
+	concurrentId gc.ConcurrentId
+	gateId       uint64
+	key0         gc.Key           // The XOR random constant, shared by the VMs of a session
+	genKey       func([]byte)     // Source of random keys, see basegen.Session.Rand
+	session      *basegen.Session // Of the VM, see Session
+	const0       gc.Wire          // A wire for a constant 0 bit with unbounded fanout
+	const1       gc.Wire          // A wire for a constant 1 bit with unbounded fanout
+}
+
+func NewVM(io basegen.IO, id gc.ConcurrentId, s *basegen.Session) basegen.VM {
+	return &vm{io: io, concurrentId: id, key0: s.Key0, genKey: s.Rand(id), session: s}
+}
+
+// The tweak of a half gate; each gate uses two, j = 2*gateId and j' = 2*gateId+1
+func (y *vm) computeTweak(half uint64) gc.Key {
+	tweak := make([]byte, base.KEY_SIZE)
+	j := 2*y.gateId + half
+	var i uint
+	for i = 0; i < 8; i++ {
+		tweak[i] = byte(j >> (8 * i))
+		tweak[i+8] = byte(y.concurrentId >> (8 * i))
+	}
+	return tweak
+}
+
+func (y *vm) init_constants() {
+	if y.const0 == nil {
+		y.const0 = y.genWire()
+		y.const1 = y.genWire()
+		y.io.SendK(y.const0[0])
+		y.io.SendK(y.const1[1])
+	}
+}
+
+// Generates two keys of size KEY_SIZE and returns the pair
+func (y *vm) genWire() gc.Wire {
+	k0 := make([]byte, base.KEY_SIZE)
+	y.genKey(k0)
+	k1 := gc.XorKey(k0, y.key0)
+	return []gc.Key{k0, k1}
+}
+
+// The point-and-permute bit of a key
+func lsb(k gc.Key) byte {
+	return k[0] % 2
+}
+
+// Swapping the keys of a wire negates the bit it carries, at no cost to the evaluator
+func swap(w gc.Wire) gc.Wire {
+	return []gc.Key{w[1], w[0]}
+}
+
+// Garble one AND gate as a generator half gate plus an evaluator half gate
+func (y *vm) and(a, b gc.Wire) gc.Wire {
+	pa := lsb(a[0])
+	pb := lsb(b[0])
+	j0 := y.computeTweak(0)
+	j1 := y.computeTweak(1)
+	y.gateId++
+
+	// generator half gate
+	ha0 := gc.HalfGatesH(a[0], j0)
+	tg := gc.XorKey(ha0, gc.HalfGatesH(a[1], j0))
+	if pb == 1 {
+		tg = gc.XorKey(tg, y.key0)
+	}
+	wg := ha0
+	if pa == 1 {
+		wg = gc.XorKey(wg, tg)
+	}
+
+	// evaluator half gate
+	hb0 := gc.HalfGatesH(b[0], j1)
+	te := gc.XorKey(gc.XorKey(hb0, gc.HalfGatesH(b[1], j1)), a[0])
+	we := hb0
+	if pb == 1 {
+		we = gc.XorKey(we, gc.XorKey(te, a[0]))
+	}
+
+	y.io.SendT([]gc.Ciphertext{gc.Ciphertext(tg), gc.Ciphertext(te)})
+	k0 := gc.XorKey(wg, we)
+	return []gc.Key{k0, gc.XorKey(k0, y.key0)}
+}
+
+/* http://www.llvm.org/docs/LangRef.html */
+
+func (y *vm) And(a, b []gc.Wire) []gc.Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in gen.And()")
+	}
+	result := make([]gc.Wire, len(a))
+	for i := 0; i < len(a); i++ {
+		result[i] = y.and(a[i], b[i])
+	}
+	return result
+}
+
+// a OR b == NOT(NOT a AND NOT b)
+func (y *vm) Or(a, b []gc.Wire) []gc.Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in gen.Or()")
+	}
+	result := make([]gc.Wire, len(a))
+	for i := 0; i < len(a); i++ {
+		result[i] = swap(y.and(swap(a[i]), swap(b[i])))
+	}
+	return result
+}
+
+func (y *vm) Xor(a, b []gc.Wire) []gc.Wire {
+	if len(a) != len(b) {
+		panic("Xor(): mismatch")
+	}
+	result := make([]gc.Wire, len(a))
+	for i := 0; i < len(a); i++ {
+		k0 := gc.XorKey(a[i][0], b[i][0])
+		k1 := gc.XorKey(a[i][0], b[i][1])
+		result[i] = []gc.Key{k0, k1}
+	}
+	return result
+}
+
+func (y *vm) Mux(s, a, b []gc.Wire) []gc.Wire {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Mux(): mismatch")
+	}
+	return gc.MuxWires(y.And, y.Xor, s[0], a, b)
+}
+
+func (y *vm) True() []gc.Wire {
+	y.init_constants()
+	return []gc.Wire{y.const1}
+}
+
+func (y *vm) False() []gc.Wire {
+	y.init_constants()
+	return []gc.Wire{y.const0}
+}
+
+/* Reveal to party 0 = gen */
+func (y *vm) RevealTo0(a []gc.Wire) []bool {
+	result := make([]bool, len(a))
+	for i := 0; i < len(a); i++ {
+		bit := resolveKey(a[i], y.io.RecvK2())
+		if bit == 0 {
+			result[i] = false
+		} else {
+			result[i] = true
+		}
+	}
+	return result
+}
+
+/* Reveal to party 1 = eval; decoding information is the point-and-permute bit of the 0 key */
+func (y *vm) RevealTo1(a []gc.Wire) {
+	for i := 0; i < len(a); i++ {
+		t := []gc.Ciphertext{gc.Ciphertext{lsb(a[i][0])}}
+		y.io.SendT(t)
+	}
+}
+
+func (y *vm) ShareTo0(bits int) []gc.Wire {
+	a := make([]gc.Wire, bits)
+	k0 := make([]gc.Key, bits)
+	k1 := make([]gc.Key, bits)
+	for i := 0; i < len(a); i++ {
+		w := y.genWire()
+		a[i] = w
+		k0[i] = w[0]
+		k1[i] = w[1]
+	}
+	basegen.SendKeys(y.io, k0, k1)
+	return a
+}
+
+func (y *vm) ShareTo1(a uint64, bits int) []gc.Wire {
+	if bits > 64 {
+		panic("BT: bits > 64")
+	}
+	result := make([]gc.Wire, bits)
+	for i := 0; i < bits; i++ {
+		w := y.genWire()
+		result[i] = w
+		if (a>>uint(i))%2 == 0 {
+			y.io.SendK(w[0])
+		} else {
+			y.io.SendK(w[1])
+		}
+	}
+	return result
+}
+
+func (y *vm) Session() *basegen.Session {
+	return y.session
+}
+
+// Random generates random bits.
+func (y *vm) Random(bits int) []gc.Wire {
+	if bits < 1 {
+		panic("Random: bits < 1")
+	}
+	result := make([]gc.Wire, bits)
+	numBytes := bits / 8
+	if bits%8 != 0 {
+		numBytes++
+	}
+	random := make([]byte, numBytes)
+	y.genKey(random)
+	k0 := make([]gc.Key, bits)
+	k1 := make([]gc.Key, bits)
+	for i, _ := range result {
+		w := y.genWire()
+		result[i] = w
+		switch bit.GetBit(random, i) {
+		case 0:
+			k0[i], k1[i] = w[0], w[1]
+		default:
+			k0[i], k1[i] = w[1], w[0]
+		}
+	}
+	basegen.SendKeys(y.io, k0, k1)
+	return result
+}
+
+func resolveKey(w gc.Wire, k gc.Key) int {
+	if bytes.Equal(k, w[0]) {
+		return 0
+	} else if bytes.Equal(k, w[1]) {
+		return 1
+	} else {
+		panic(fmt.Sprintf("resolveKey(): key and wire mismatch\nKey: %v\nWire: %v\n", k, w))
+	}
+	panic("unreachable")
+}
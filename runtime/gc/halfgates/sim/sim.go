@@ -0,0 +1,36 @@
+package sim
+
+import (
+	"github.com/tjim/smpcc/runtime/gc"
+	baseeval "github.com/tjim/smpcc/runtime/gc/eval"
+	basegen "github.com/tjim/smpcc/runtime/gc/gen"
+	"github.com/tjim/smpcc/runtime/gc/halfgates/eval"
+	"github.com/tjim/smpcc/runtime/gc/halfgates/gen"
+)
+
+func pairVM(id gc.ConcurrentId, s *basegen.Session) (basegen.VM, baseeval.VM) {
+	io := gc.NewChanio()
+	gchan := make(chan basegen.IOX, 1)
+	echan := make(chan baseeval.IOX, 1)
+	go func() {
+		echan <- *baseeval.NewIOX(*io)
+	}()
+	go func() {
+		gchan <- *basegen.NewIOX(*io)
+	}()
+	gio := <-gchan
+	eio := <-echan
+	return gen.NewVM(&gio, id, s), eval.NewVM(&eio, id)
+}
+
+func VMs(n int) ([]basegen.VM, []baseeval.VM) {
+	result1 := make([]basegen.VM, n)
+	result2 := make([]baseeval.VM, n)
+	s := basegen.NewSession()
+	for i := 0; i < n; i++ {
+		gio, eio := pairVM(gc.ConcurrentId(i), s)
+		result1[i] = gio
+		result2[i] = eio
+	}
+	return result1, result2
+}
@@ -0,0 +1,121 @@
+package sim_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+	"github.com/tjim/smpcc/runtime/gc/halfgates/sim"
+	yaosim "github.com/tjim/smpcc/runtime/gc/yao/sim"
+)
+
+func toUint64(bits []bool) uint64 {
+	var result uint64
+	for i, b := range bits {
+		if b {
+			result |= 1 << uint(i)
+		}
+	}
+	return result
+}
+
+/* Where an input comes from: the generator, the evaluator, or a constant */
+type source int
+
+const (
+	fromGen source = iota
+	fromEval
+	fromConst
+)
+
+var sources = []source{fromGen, fromEval, fromConst}
+
+func genInput(io gen.VM, s source, a uint64, n int) []gc.Wire {
+	switch s {
+	case fromGen:
+		return io.ShareTo1(a, n)
+	case fromEval:
+		return io.ShareTo0(n)
+	}
+	return gen.Uint(io, a, n)
+}
+
+func evalInput(io eval.VM, s source, a uint64, n int) []gc.Key {
+	switch s {
+	case fromGen:
+		return io.ShareTo1(n)
+	case fromEval:
+		return io.ShareTo0(a, n)
+	}
+	return eval.Uint(io, a, n)
+}
+
+type op struct {
+	name string
+	fg   func(gen.VM, []gc.Wire, []gc.Wire) []gc.Wire
+	fe   func(eval.VM, []gc.Key, []gc.Key) []gc.Key
+	want func(a, b uint64) uint64
+}
+
+var ops = []op{
+	{"And", func(io gen.VM, a, b []gc.Wire) []gc.Wire { return io.And(a, b) }, func(io eval.VM, a, b []gc.Key) []gc.Key { return io.And(a, b) }, func(a, b uint64) uint64 { return a & b }},
+	{"Or", func(io gen.VM, a, b []gc.Wire) []gc.Wire { return io.Or(a, b) }, func(io eval.VM, a, b []gc.Key) []gc.Key { return io.Or(a, b) }, func(a, b uint64) uint64 { return a | b }},
+	{"Xor", func(io gen.VM, a, b []gc.Wire) []gc.Wire { return io.Xor(a, b) }, func(io eval.VM, a, b []gc.Key) []gc.Key { return io.Xor(a, b) }, func(a, b uint64) uint64 { return a ^ b }},
+	{"Not", func(io gen.VM, a, b []gc.Wire) []gc.Wire { return gen.Not(io, a) }, func(io eval.VM, a, b []gc.Key) []gc.Key { return eval.Not(io, a) }, func(a, b uint64) uint64 { return ^a }},
+	{"Random", func(io gen.VM, a, b []gc.Wire) []gc.Wire { r := io.Random(len(a)); return io.Xor(io.Xor(a, r), r) }, func(io eval.VM, a, b []gc.Key) []gc.Key { r := io.Random(len(a)); return io.Xor(io.Xor(a, r), r) }, func(a, b uint64) uint64 { return a }},
+	{"Add", gen.Add, eval.Add, func(a, b uint64) uint64 { return a + b }},
+	{"Mul", gen.Mul, eval.Mul, func(a, b uint64) uint64 { return a * b }},
+	{"Icmp_ult", gen.Icmp_ult, eval.Icmp_ult, func(a, b uint64) uint64 {
+		if a < b {
+			return 1
+		}
+		return 0
+	}},
+}
+
+/* The result of o on a and b, from sources sa and sb, revealed to the generator and to the evaluator */
+func run(gvm gen.VM, evm eval.VM, o op, sa, sb source, a, b uint64, n int) (uint64, uint64) {
+	done := make(chan uint64)
+	go func() {
+		r := o.fe(evm, evalInput(evm, sa, a, n), evalInput(evm, sb, b, n))
+		evm.RevealTo0(r)
+		done <- toUint64(evm.RevealTo1(r))
+	}()
+	r := o.fg(gvm, genInput(gvm, sa, a, n), genInput(gvm, sb, b, n))
+	g := toUint64(gvm.RevealTo0(r))
+	gvm.RevealTo1(r)
+	return g, <-done
+}
+
+/* Every gate of halfgates, on inputs from every source, against yao and the clear */
+func TestGates(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	type operands struct {
+		a, b uint64
+		n    int
+	}
+	/* 0011 and 0101 give every pair of bits */
+	cases := []operands{{3, 5, 4}}
+	for i := 0; i < 3; i++ {
+		cases = append(cases, operands{uint64(rnd.Uint32()), uint64(rnd.Uint32()), 32})
+	}
+	gvms, evms := sim.VMs(1)
+	ygvms, yevms := yaosim.VMs(1)
+	for _, o := range ops {
+		for _, sa := range sources {
+			for _, sb := range sources {
+				for _, c := range cases {
+					mask := uint64(1)<<uint(c.n) - 1
+					want := o.want(c.a, c.b) & mask
+					g, e := run(gvms[0], evms[0], o, sa, sb, c.a, c.b, c.n)
+					yg, ye := run(ygvms[0], yevms[0], o, sa, sb, c.a, c.b, c.n)
+					if g != want || e != want || yg != ye || g != yg {
+						t.Errorf("%s(%x from %d, %x from %d): halfgates gives %x to gen and %x to eval, yao %x and %x, want %x", o.name, c.a, sa, c.b, sb, g, e, yg, ye, want)
+					}
+				}
+			}
+		}
+	}
+}
@@ -1,18 +1,48 @@
 package gc
 
 import (
+	"github.com/tjim/smpcc/runtime/base"
 	"github.com/tjim/smpcc/runtime/ot"
+	"github.com/tjim/smpcc/runtime/transport"
 	"math/big"
+	"strconv"
 )
 
+/*
+The generator is the client of a connection: it sends tables and keys
+and receives Kchan2.  Tables travel in pages (see pages.go), on Tchan
+in a simulation and unbuffered on a connection.
+*/
 type CircuitChans struct {
-	Tchan  chan GarbledTable `fatchan:"request"`
-	Kchan  chan Key          `fatchan:"request"`
-	Kchan2 chan Key          `fatchan:"reply"`
+	Tchan  chan []byte
+	Kchan  chan Key
+	Kchan2 chan Key
+	pages  *tablePages
+}
+
+/* Make CircuitChans whose key channels have the given buffer size */
+func NewCircuitChans(buffer int) CircuitChans {
+	tchan := make(chan []byte, TablePagesInFlight)
+	return CircuitChans{tchan, make(chan Key, buffer), make(chan Key, buffer), newTablePages(tchan)}
+}
+
+const circuitStreams = 3
+
+/* Carry the channels over conn, on streams id, id+1 and id+2 */
+func (io CircuitChans) Bind(conn *transport.Conn, id uint32, client bool) {
+	io.pages.ch = make(chan []byte)
+	conn.BindWindow(id, io.pages.ch, client, TablePagesInFlight)
+	conn.Bind(id+1, io.Kchan, client)
+	conn.Bind(id+2, io.Kchan2, !client)
 }
 
 func (io CircuitChans) SendT(x GarbledTable) {
-	io.Tchan <- x
+	io.pages.send(x)
+}
+
+/* Send the tables of the current page without waiting for it to fill */
+func (io CircuitChans) Flush() {
+	io.pages.flush()
 }
 
 func (io CircuitChans) SendK(x Key) {
@@ -20,6 +50,7 @@ func (io CircuitChans) SendK(x Key) {
 }
 
 func (io CircuitChans) RecvK2() Key {
+	io.pages.flush()
 	result := <-io.Kchan2
 	return result
 }
@@ -28,9 +59,9 @@ func (io CircuitChans) SendK2(x Key) {
 	io.Kchan2 <- x
 }
 
+/* The table returned is only valid until the next call */
 func (io CircuitChans) RecvT() GarbledTable {
-	result := <-io.Tchan
-	return result
+	return io.pages.recv()
 }
 
 func (io CircuitChans) RecvK() Key {
@@ -46,11 +77,7 @@ type Chanio struct {
 
 func NewChanio() (io *Chanio) {
 	io = &Chanio{
-		CircuitChans{
-			make(chan GarbledTable, 50),
-			make(chan Key, 50),
-			make(chan Key, 50),
-		},
+		NewCircuitChans(50),
 		ot.NPChans{
 			make(chan *big.Int, 100),
 			make(chan *big.Int, 1),
@@ -64,10 +91,23 @@ func NewChanio() (io *Chanio) {
 	return io
 }
 
+/* The first stream of block on a connection carrying one Chanio per block */
+func chanioStream(block int) uint32 {
+	return uint32(1 + block*(circuitStreams+ot.NPStreams+ot.ExtStreams))
+}
+
+/* Carry the channels of block over conn */
+func (io Chanio) Bind(conn *transport.Conn, block int, client bool) {
+	id := chanioStream(block)
+	io.CircuitChans.Bind(conn, id, client)
+	io.NPChans.Bind(conn, id+circuitStreams, client)
+	io.ExtChans.Bind(conn, id+circuitStreams+ot.NPStreams, client)
+}
+
 // Stream OT version
 type ClientAsSender struct {
-	S2R chan ot.MessagePair `fatchan:"request"` // One per sender/receiver pair, sender->receiver
-	R2S chan []byte         `fatchan:"reply"`   // One per sender/receiver pair, receiver->sender
+	S2R chan ot.MessagePair // One per sender/receiver pair, sender->receiver
+	R2S chan []byte         // One per sender/receiver pair, receiver->sender
 }
 
 type PerBlock struct {
@@ -79,3 +119,43 @@ type PerNodePair struct {
 	ot.NPChans
 	BlockChans []PerBlock
 }
+
+const blockStreams = circuitStreams + 2
+
+/*
+The first stream of block on a connection carrying a PerNodePair: the
+NPChans come first, then the channels of each block in turn.
+*/
+func blockStream(block int) uint32 {
+	return uint32(1 + ot.NPStreams + block*blockStreams)
+}
+
+/* Carry the channels over conn; the generator is the client */
+func (x PerNodePair) Bind(conn *transport.Conn, client bool) {
+	x.NPChans.Bind(conn, 1, client)
+	for i, b := range x.BlockChans {
+		id := blockStream(i)
+		b.CircuitChans.Bind(conn, id, client)
+		conn.Bind(id+circuitStreams, b.CAS.S2R, client)
+		conn.Bind(id+circuitStreams+1, b.CAS.R2S, !client)
+	}
+}
+
+/*
+If not nil, the connections made by gen and eval, and by dual, are
+authenticated and encrypted
+*/
+var Security *transport.Security
+
+/*
+The params of a connection: the protocol, "gc" for one Chanio per
+block or "gc-stream" for a PerNodePair, the number of blocks and the
+key size, which both sides must agree on.
+*/
+func HandshakeParams(protocol string, numBlocks int) transport.Params {
+	return transport.Params{
+		"protocol": protocol,
+		"blocks":   strconv.Itoa(numBlocks),
+		"key size": strconv.Itoa(base.KEY_SIZE),
+	}
+}
@@ -0,0 +1,130 @@
+package gc
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+Garbled tables travel between the generator and the evaluator in
+pages: SendT packs each table into the current page of its block,
+and the page is sent when it is full, when the generator waits for
+the evaluator (RecvK2), on Flush, or TableFlushDelay after its first
+table, whichever is first.  The delay bounds how long the evaluator
+can wait for a table that the generator has made, e.g., while the
+generator's block waits for another block.
+
+A page is a sequence of tables, each a byte giving the number of
+ciphertexts, then each ciphertext as a byte giving its length and
+the bytes.
+
+At most TablePagesInFlight pages of a block are sent and not yet read
+by the evaluator, and on a connection one more is held by the
+generator's transport until credit returns; past that SendT waits, so
+a fast generator cannot fill the evaluator's memory.  On a connection
+the pages travel on an unbuffered channel, so that the evaluator
+returns credit for a page when RecvT takes it, not when it arrives.
+Both must be set before the IOs are made.
+*/
+var TablePageSize = 64 << 10
+var TablePagesInFlight = 16
+var TableFlushDelay = time.Millisecond
+
+var pagePool = sync.Pool{New: func() interface{} { return make([]byte, 0, TablePageSize) }}
+
+/* The page state of a CircuitChans, for the generator, the evaluator or both (in simulation) */
+type tablePages struct {
+	ch chan []byte /* Tchan, or the channel of the connection once bound */
+
+	mu    sync.Mutex /* held by the generator's methods */
+	page  []byte
+	timer *time.Timer
+
+	in   []byte /* the unread tables of the current page */
+	last []byte /* the current page, to recycle when it is read */
+	t    GarbledTable
+}
+
+func newTablePages(ch chan []byte) *tablePages {
+	p := &tablePages{ch: ch, t: make(GarbledTable, 0, 4)}
+	p.timer = time.AfterFunc(time.Hour, p.flush)
+	p.timer.Stop()
+	return p
+}
+
+func newPage(n int) []byte {
+	page := pagePool.Get().([]byte)
+	if cap(page) < TablePageSize || cap(page) < n {
+		if n < TablePageSize {
+			n = TablePageSize
+		}
+		page = make([]byte, 0, n)
+	}
+	return page[:0]
+}
+
+func (p *tablePages) send(t GarbledTable) {
+	if len(t) > 255 {
+		panic("SendT(): too many ciphertexts for a table page")
+	}
+	n := 1
+	for _, c := range t {
+		if len(c) > 255 {
+			panic("SendT(): ciphertext too long for a table page")
+		}
+		n += 1 + len(c)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.page != nil && len(p.page)+n > cap(p.page) {
+		p.sendPage()
+	}
+	if p.page == nil {
+		p.page = newPage(n)
+		p.timer.Reset(TableFlushDelay)
+	}
+	p.page = append(p.page, byte(len(t)))
+	for _, c := range t {
+		p.page = append(p.page, byte(len(c)))
+		p.page = append(p.page, c...)
+	}
+}
+
+/* Send the current page, if any; the caller holds p.mu */
+func (p *tablePages) sendPage() {
+	if p.page == nil {
+		return
+	}
+	p.timer.Stop()
+	p.ch <- p.page
+	p.page = nil
+}
+
+func (p *tablePages) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sendPage()
+}
+
+/* The next table, which is valid until the next call */
+func (p *tablePages) recv() GarbledTable {
+	if len(p.in) == 0 {
+		if p.last != nil {
+			pagePool.Put(p.last[:0])
+		}
+		page, ok := <-p.ch
+		if !ok {
+			panic("RecvT(): the generator has gone")
+		}
+		p.in, p.last = page, page
+	}
+	n := int(p.in[0])
+	p.in = p.in[1:]
+	p.t = p.t[:0]
+	for i := 0; i < n; i++ {
+		l := int(p.in[0])
+		p.t = append(p.t, Ciphertext(p.in[1:1+l:1+l]))
+		p.in = p.in[1+l:]
+	}
+	return p.t
+}
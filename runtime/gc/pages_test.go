@@ -0,0 +1,48 @@
+package gc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tjim/smpcc/runtime/transport"
+)
+
+func TestPagesInFlight(t *testing.T) {
+	defer func(n int) { TablePagesInFlight = n }(TablePagesInFlight)
+	TablePagesInFlight = 2
+	a, b := net.Pipe()
+	c0, c1 := transport.NewConn(a), transport.NewConn(b)
+	errs := make(chan error)
+	go func() { errs <- c1.Handshake(transport.Params{"protocol": "test"}) }()
+	if err := c0.Handshake(transport.Params{"protocol": "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	defer b.Close()
+	g, e := NewCircuitChans(0), NewCircuitChans(0)
+	g.Bind(c0, 1, true)
+	e.Bind(c1, 1, false)
+	/* A page of one table each, and the number of pages the generator has let go */
+	const pages = 8
+	sent := make(chan int, pages)
+	go func() {
+		for i := 0; i < pages; i++ {
+			g.SendT(GarbledTable{Ciphertext{byte(i)}})
+			g.Flush()
+			sent <- i + 1
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if n := len(sent); n != TablePagesInFlight+1 {
+		t.Fatalf("%d pages let go with none read, want %d", n, TablePagesInFlight+1)
+	}
+	for i := 0; i < pages; i++ {
+		if x := e.RecvT(); len(x) != 1 || x[0][0] != byte(i) {
+			t.Fatalf("table %d: received %v", i, x)
+		}
+	}
+}
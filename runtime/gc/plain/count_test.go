@@ -0,0 +1,43 @@
+package plain
+
+import (
+	mbits "math/bits"
+	"math/rand"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+func TestCount(t *testing.T) {
+	xs := []uint64{0, 1, 1 << 63, ^uint64(0), 0x8000000080000000, 0x00ff00ff00ff0000}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 8; i++ {
+		xs = append(xs, rnd.Uint64(), rnd.Uint64()>>uint(rnd.Intn(64)))
+	}
+	for i, x := range xs {
+		y := xs[(i+1)%len(xs)]
+		if r := unaryOp(t, x, 64, gen.Popcount, eval.Popcount); r != uint64(mbits.OnesCount64(x)) {
+			t.Errorf("popcount %x: got %d", x, r)
+		}
+		if r := binaryOp(t, x, y, 64, gen.HammingDistance, eval.HammingDistance); r != uint64(mbits.OnesCount64(x^y)) {
+			t.Errorf("distance %x %x: got %d", x, y, r)
+		}
+		if r := unaryOp(t, x, 64, gen.Ctlz, eval.Ctlz); r != uint64(mbits.LeadingZeros64(x)) {
+			t.Errorf("ctlz %x: got %d", x, r)
+		}
+		if r := unaryOp(t, x, 64, gen.Cttz, eval.Cttz); r != uint64(mbits.TrailingZeros64(x)) {
+			t.Errorf("cttz %x: got %d", x, r)
+		}
+		/* odd widths, where the tree is lopsided */
+		for _, n := range []int{1, 3, 5, 13, 33} {
+			xn := x & (1<<uint(n) - 1)
+			if r := unaryOp(t, xn, n, gen.Popcount, eval.Popcount); r != uint64(mbits.OnesCount64(xn)) {
+				t.Errorf("popcount %x of %d bits: got %d", xn, n, r)
+			}
+			if r := unaryOp(t, xn, n, gen.Ctlz, eval.Ctlz); r != uint64(mbits.LeadingZeros64(xn)-64+n) {
+				t.Errorf("ctlz %x of %d bits: got %d", xn, n, r)
+			}
+		}
+	}
+}
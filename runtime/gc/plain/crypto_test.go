@@ -0,0 +1,65 @@
+package plain
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+func TestCrypto(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rnd.Read(b)
+		return b
+	}
+	for _, n := range []int{16, 32} {
+		key, block := random(n), random(16)
+		want := make([]byte, 16)
+		c, _ := aes.NewCipher(key)
+		c.Encrypt(want, block)
+		fg, fe := gen.AES128, eval.AES128
+		if n == 32 {
+			fg, fe = gen.AES256, eval.AES256
+		}
+		got := bytesOp(t, [][]byte{key, block},
+			func(io gen.VM, a [][]gc.Wire) []gc.Wire { return fg(io, a[0], a[1]) },
+			func(io eval.VM, a [][]gc.Key) []gc.Key { return fe(io, a[0], a[1]) })
+		if !bytes.Equal(got, want) {
+			t.Errorf("AES-%d of %x under %x: got %x, want %x", 8*n, block, key, got, want)
+		}
+	}
+	/* lengths around the padding boundaries */
+	for _, n := range []int{0, 3, 55, 56, 64, 100} {
+		msg := random(n)
+		hash := func(fg func(gen.VM, []gc.Wire) []gc.Wire, fe func(eval.VM, []gc.Key) []gc.Key) []byte {
+			return bytesOp(t, [][]byte{msg},
+				func(io gen.VM, a [][]gc.Wire) []gc.Wire { return fg(io, a[0]) },
+				func(io eval.VM, a [][]gc.Key) []gc.Key { return fe(io, a[0]) })
+		}
+		if got, want := hash(gen.SHA256, eval.SHA256), sha256.Sum256(msg); !bytes.Equal(got, want[:]) {
+			t.Errorf("SHA-256 of %d bytes: got %x, want %x", n, got, want)
+		}
+		if got, want := hash(gen.SHA1, eval.SHA1), sha1.Sum(msg); !bytes.Equal(got, want[:]) {
+			t.Errorf("SHA-1 of %d bytes: got %x, want %x", n, got, want)
+		}
+	}
+	/* the test vector of RFC 8439, 2.3.2 */
+	key, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	nonce, _ := hex.DecodeString("000000090000004a00000000")
+	want, _ := hex.DecodeString("10f1e7e4d13b5915500fdd1fa32071c4c7d1f4c733c068030422aa9ac3d46c4e" +
+		"d2826446079faa0914c2d705d98b02a2b5129cd1de164eb9cbd083e8a2503c4e")
+	got := bytesOp(t, [][]byte{key, {1, 0, 0, 0}, nonce}, func(io gen.VM, a [][]gc.Wire) []gc.Wire { return gen.ChaCha20Block(io, a[0], a[1], a[2]) },
+		func(io eval.VM, a [][]gc.Key) []gc.Key { return eval.ChaCha20Block(io, a[0], a[1], a[2]) })
+	if !bytes.Equal(got, want) {
+		t.Errorf("ChaCha20: got %x, want %x", got, want)
+	}
+}
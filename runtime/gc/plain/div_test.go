@@ -0,0 +1,59 @@
+package plain
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+/*
+The quotient and remainder of n-bit a and b, unsigned and signed, as
+Go's operators give them, or as the circuits define them for b = 0
+*/
+func divRem(a, b uint64, n int) [4]uint64 {
+	mask := ^uint64(0) >> uint(64-n)
+	sa := int64(a<<uint(64-n)) >> uint(64-n)
+	sb := int64(b<<uint(64-n)) >> uint(64-n)
+	if b == 0 {
+		sq := int64(-1)
+		if sa < 0 {
+			sq = 1
+		}
+		return [4]uint64{mask, a, uint64(sq) & mask, a}
+	}
+	return [4]uint64{a / b, a % b, uint64(sa/sb) & mask, uint64(sa%sb) & mask}
+}
+
+func TestDiv(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 8, 32, 64} {
+		mask := ^uint64(0) >> uint(64-n)
+		min := uint64(1) << uint(n-1)
+		/* division by 0, the most negative value by -1, and operands of every sign */
+		cases := [][2]uint64{{0, 0}, {5, 0}, {min, 0}, {mask, 0}, {min, mask}, {min, 1}, {mask, mask}, {0, 3}, {3, 3}}
+		for i := 0; i < 12; i++ {
+			a, b := rnd.Uint64()&mask, rnd.Uint64()&mask
+			if i%3 == 0 {
+				b >>= uint(n / 2) /* a small divisor, for quotients of many bits */
+			}
+			cases = append(cases, [2]uint64{a, b})
+		}
+		for _, c := range cases {
+			a, b := c[0]&mask, c[1]&mask
+			want := divRem(a, b, n)
+			got := [4]uint64{
+				binaryOp(t, a, b, n, gen.Udiv, eval.Udiv),
+				binaryOp(t, a, b, n, gen.Urem, eval.Urem),
+				binaryOp(t, a, b, n, gen.Sdiv, eval.Sdiv),
+				binaryOp(t, a, b, n, gen.Srem, eval.Srem),
+			}
+			for i, name := range []string{"/", "%", "signed /", "signed %"} {
+				if got[i] != want[i] {
+					t.Errorf("%d bits: %x %s %x: got %x, want %x", n, a, name, b, got[i], want[i])
+				}
+			}
+		}
+	}
+}
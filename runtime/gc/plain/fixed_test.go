@@ -0,0 +1,78 @@
+package plain
+
+import (
+	"math"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+/* A fixed-point operation with frac fractional bits, as binaryOp */
+func fixedOp(t *testing.T, a, b float64, n, frac int, fg func(gen.VM, []gc.Wire, []gc.Wire, int) []gc.Wire, fe func(eval.VM, []gc.Key, []gc.Key, int) []gc.Key) float64 {
+	fix := func(x float64) uint64 { return uint64(int64(math.Floor(math.Ldexp(x, frac)))) }
+	r := binaryOp(t, fix(a), fix(b), n,
+		func(io gen.VM, x, y []gc.Wire) []gc.Wire { return fg(io, x, y, frac) },
+		func(io eval.VM, x, y []gc.Key) []gc.Key { return fe(io, x, y, frac) })
+	return math.Ldexp(float64(int64(r<<uint(64-n))>>uint(64-n)), -frac)
+}
+
+/* A fixed-point function of one argument, as fixedOp */
+func fixedUnaryOp(t *testing.T, a float64, n, frac int, fg func(gen.VM, []gc.Wire, int) []gc.Wire, fe func(eval.VM, []gc.Key, int) []gc.Key) float64 {
+	return fixedOp(t, a, 0, n, frac,
+		func(io gen.VM, x, _ []gc.Wire, frac int) []gc.Wire { return fg(io, x, frac) },
+		func(io eval.VM, x, _ []gc.Key, frac int) []gc.Key { return fe(io, x, frac) })
+}
+
+func TestFixed(t *testing.T) {
+	for _, f := range []struct{ n, frac int }{{32, 16}, {64, 24}, {16, 8}} {
+		ulp := math.Ldexp(1, -f.frac)
+		near := func(got, want, tol float64) bool { return math.Abs(got-want) <= tol*ulp }
+		/* inputs exactly representable, so that only the results are rounded */
+		fix := func(x float64) float64 { return math.Ldexp(math.Floor(math.Ldexp(x, f.frac)), -f.frac) }
+		/* the error of exp is relative: a few units of 2^-frac times the result, plus the last place */
+		exp := func(x float64) {
+			if r := fixedUnaryOp(t, x, f.n, f.frac, gen.FixExp, eval.FixExp); !near(r, math.Exp(x), 1+6*math.Exp(x)) {
+				t.Errorf("%d.%d: exp %g: got %g, want %g", f.n, f.frac, x, r, math.Exp(x))
+			}
+		}
+		/* up to the largest result, where the error is largest */
+		for _, d := range []float64{0, 0.3, 1.7} {
+			exp(fix(float64(f.n-2-f.frac)*math.Ln2 - d))
+		}
+		for _, x := range []float64{0.5, -1.25, 3, 7.75, -10.5, 0.01, 100} {
+			x := fix(x)
+			y := fix(-x/3 + 1)
+			if math.Abs(x*y) < math.Ldexp(1, f.n-2-f.frac) {
+				if r := fixedOp(t, x, y, f.n, f.frac, gen.FixMul, eval.FixMul); !near(r, x*y, 2) {
+					t.Errorf("%d.%d: %g * %g: got %g", f.n, f.frac, x, y, r)
+				}
+				if r := fixedOp(t, x, y, f.n, f.frac, gen.FixMulRound, eval.FixMulRound); !near(r, x*y, 1) {
+					t.Errorf("%d.%d: %g * %g rounded: got %g", f.n, f.frac, x, y, r)
+				}
+			}
+			if r := fixedOp(t, x, y, f.n, f.frac, gen.FixDiv, eval.FixDiv); !near(r, x/y, 2+math.Abs(x/y/y)) {
+				t.Errorf("%d.%d: %g / %g: got %g", f.n, f.frac, x, y, r)
+			}
+			if r := fixedUnaryOp(t, y, f.n, f.frac, gen.FixRecip, eval.FixRecip); !near(r, 1/y, 2+math.Abs(1/y/y)) {
+				t.Errorf("%d.%d: 1/%g: got %g", f.n, f.frac, y, r)
+			}
+			if r := fixedUnaryOp(t, x, f.n, f.frac, gen.FixSqrt, eval.FixSqrt); x >= 0 && !near(r, math.Sqrt(x), 1) || x < 0 && r != 0 {
+				t.Errorf("%d.%d: sqrt %g: got %g", f.n, f.frac, x, r)
+			}
+			if x < 5 {
+				exp(x)
+			}
+			if r := fixedUnaryOp(t, x, f.n, f.frac, gen.FixLog, eval.FixLog); x > 0 && !near(r, math.Log(x), 8) {
+				t.Errorf("%d.%d: log %g: got %g, want %g", f.n, f.frac, x, r, math.Log(x))
+			}
+			if r := fixedUnaryOp(t, x, f.n, f.frac, gen.FixSigmoid, eval.FixSigmoid); !near(r, 1/(1+math.Exp(-x)), 8) {
+				t.Errorf("%d.%d: sigmoid %g: got %g, want %g", f.n, f.frac, x, r, 1/(1+math.Exp(-x)))
+			}
+		}
+		if r := fixedUnaryOp(t, 100, f.n, f.frac, gen.FixExp, eval.FixExp); r != math.Ldexp(1, f.n-1-f.frac)-ulp {
+			t.Errorf("%d.%d: exp 100: got %g", f.n, f.frac, r)
+		}
+	}
+}
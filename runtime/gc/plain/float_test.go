@@ -0,0 +1,145 @@
+package plain
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+var float64s = []float64{0, math.Copysign(0, -1), 1, -1, 1.5, 2, 3, -0.1, 1e300, -1e-300,
+	math.MaxFloat64, -math.MaxFloat64, math.SmallestNonzeroFloat64, 0x1p-1022, 0x1p-1022 - 0x1p-1074,
+	math.Inf(1), math.Inf(-1), math.NaN()}
+
+var float32s = []float32{0, float32(math.Copysign(0, -1)), 1, -1, 1.5, 2, 3, -0.1, 1e30, -1e-30,
+	math.MaxFloat32, -math.MaxFloat32, math.SmallestNonzeroFloat32, 0x1p-126, 0x1p-126 - 0x1p-149,
+	float32(math.Inf(1)), float32(math.Inf(-1)), float32(math.NaN())}
+
+func same64(got uint64, want float64) bool {
+	return got == math.Float64bits(want) || math.IsNaN(want) && got == 0x7ff8000000000000
+}
+
+func same32(got uint64, want float32) bool {
+	return got == uint64(math.Float32bits(want)) || want != want && got == 0x7fc00000
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestFloat64(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	xs := append([]float64{}, float64s...)
+	for i := 0; i < 8; i++ {
+		xs = append(xs, math.Float64frombits(rnd.Uint64()), rnd.NormFloat64())
+	}
+	for _, x := range xs {
+		for _, y := range float64s {
+			a, b := math.Float64bits(x), math.Float64bits(y)
+			if r := binaryOp(t, a, b, 64, gen.Fadd, eval.Fadd); !same64(r, x+y) {
+				t.Errorf("%g + %g: got %x, want %g", x, y, r, x+y)
+			}
+			if r := binaryOp(t, a, b, 64, gen.Fsub, eval.Fsub); !same64(r, x-y) {
+				t.Errorf("%g - %g: got %x, want %g", x, y, r, x-y)
+			}
+			if r := binaryOp(t, a, b, 64, gen.Fmul, eval.Fmul); !same64(r, x*y) {
+				t.Errorf("%g * %g: got %x, want %g", x, y, r, x*y)
+			}
+			if r := binaryOp(t, a, b, 64, gen.Fdiv, eval.Fdiv); !same64(r, x/y) {
+				t.Errorf("%g / %g: got %x, want %g", x, y, r, x/y)
+			}
+			if r := binaryOp(t, a, b, 64, gen.Fcmp_olt, eval.Fcmp_olt); r != b2u(x < y) {
+				t.Errorf("%g < %g: got %d", x, y, r)
+			}
+			if r := binaryOp(t, a, b, 64, gen.Fcmp_oeq, eval.Fcmp_oeq); r != b2u(x == y) {
+				t.Errorf("%g == %g: got %d", x, y, r)
+			}
+			if r := binaryOp(t, a, b, 64, gen.Fcmp_uge, eval.Fcmp_uge); r != b2u(!(x < y)) {
+				t.Errorf("!(%g < %g): got %d", x, y, r)
+			}
+		}
+	}
+}
+
+func TestFloat32(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	xs := append([]float32{}, float32s...)
+	for i := 0; i < 8; i++ {
+		xs = append(xs, math.Float32frombits(rnd.Uint32()), float32(rnd.NormFloat64()))
+	}
+	for _, x := range xs {
+		for _, y := range float32s {
+			a, b := uint64(math.Float32bits(x)), uint64(math.Float32bits(y))
+			if r := binaryOp(t, a, b, 32, gen.Fadd, eval.Fadd); !same32(r, x+y) {
+				t.Errorf("%g + %g: got %x, want %g", x, y, r, x+y)
+			}
+			if r := binaryOp(t, a, b, 32, gen.Fmul, eval.Fmul); !same32(r, x*y) {
+				t.Errorf("%g * %g: got %x, want %g", x, y, r, x*y)
+			}
+			if r := binaryOp(t, a, b, 32, gen.Fdiv, eval.Fdiv); !same32(r, x/y) {
+				t.Errorf("%g / %g: got %x, want %g", x, y, r, x/y)
+			}
+			if r := binaryOp(t, a, b, 32, gen.Fcmp_ole, eval.Fcmp_ole); r != b2u(x <= y) {
+				t.Errorf("%g <= %g: got %d", x, y, r)
+			}
+		}
+	}
+}
+
+/* A conversion of an n-bit a to width bits, as unaryOp */
+func convOp(t *testing.T, a uint64, n int, fg func(gen.VM, []gc.Wire, int) []gc.Wire, fe func(eval.VM, []gc.Key, int) []gc.Key, width int) uint64 {
+	return unaryOp(t, a, n,
+		func(io gen.VM, x []gc.Wire) []gc.Wire { return fg(io, x, width) },
+		func(io eval.VM, x []gc.Key) []gc.Key { return fe(io, x, width) })
+}
+
+func TestFloatConversions(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	ints := []int64{0, 1, -1, 3, 1<<24 + 1, 1<<53 + 1, -1 << 63, 1<<63 - 1}
+	for i := 0; i < 20; i++ {
+		ints = append(ints, int64(rnd.Uint64()), rnd.Int63n(1<<30)-1<<29)
+	}
+	for _, i := range ints {
+		a := uint64(i)
+		if r := convOp(t, a, 64, gen.Sitofp, eval.Sitofp, 64); !same64(r, float64(i)) {
+			t.Errorf("sitofp %d: got %x, want %g", i, r, float64(i))
+		}
+		if r := convOp(t, a, 64, gen.Uitofp, eval.Uitofp, 64); !same64(r, float64(uint64(i))) {
+			t.Errorf("uitofp %d: got %x, want %g", uint64(i), r, float64(uint64(i)))
+		}
+		if r := convOp(t, a, 64, gen.Sitofp, eval.Sitofp, 32); !same32(r, float32(i)) {
+			t.Errorf("sitofp %d: got %x, want %g", i, r, float32(i))
+		}
+		if r := convOp(t, a&0xffffffff, 32, gen.Uitofp, eval.Uitofp, 32); !same32(r, float32(uint32(i))) {
+			t.Errorf("uitofp %d: got %x, want %g", uint32(i), r, float32(uint32(i)))
+		}
+	}
+	for _, x := range append(float64s, 1e18, -1e18, 0.99, -7.5, 12345.678, 0x1p-1030, 0x1.fffffffp127) {
+		a := math.Float64bits(x)
+		if !math.IsNaN(x) && !math.IsInf(x, 0) && math.Abs(x) < 1<<63 {
+			if r := convOp(t, a, 64, gen.Fptosi, eval.Fptosi, 64); int64(r) != int64(x) {
+				t.Errorf("fptosi %g: got %d", x, int64(r))
+			}
+		}
+		if r := convOp(t, a, 64, gen.Fptrunc, eval.Fptrunc, 32); !same32(r, float32(x)) {
+			t.Errorf("fptrunc %g: got %x, want %g", x, r, float32(x))
+		}
+	}
+	for _, x := range float32s {
+		a := uint64(math.Float32bits(x))
+		if r := convOp(t, a, 32, gen.Fpext, eval.Fpext, 64); !same64(r, float64(x)) {
+			t.Errorf("fpext %g: got %x, want %g", x, r, float64(x))
+		}
+		if !math.IsNaN(float64(x)) && !math.IsInf(float64(x), 0) && math.Abs(float64(x)) < 1<<31 {
+			if r := convOp(t, a, 32, gen.Fptosi, eval.Fptosi, 32); int32(r) != int32(x) {
+				t.Errorf("fptosi %g: got %d", x, int32(r))
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package plain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+/*
+Drivers for the tests of the circuits of gen and eval: each runs a
+function on plain generator and evaluator VMs, which must agree.
+*/
+
+func toUint64(bits []bool) uint64 {
+	var result uint64
+	for i, b := range bits {
+		if b {
+			result |= 1 << uint(i)
+		}
+	}
+	return result
+}
+
+/* f of the n-bit values a and b */
+func binaryOp(t *testing.T, a, b uint64, n int, fg func(gen.VM, []gc.Wire, []gc.Wire) []gc.Wire, fe func(eval.VM, []gc.Key, []gc.Key) []gc.Key) uint64 {
+	gvms, evms := VMs(1)
+	g := toUint64(gvms[0].RevealTo0(fg(gvms[0], gen.Uint(gvms[0], a, n), gen.Uint(gvms[0], b, n))))
+	e := toUint64(evms[0].RevealTo1(fe(evms[0], eval.Uint(evms[0], a, n), eval.Uint(evms[0], b, n))))
+	if g != e {
+		t.Fatalf("%x, %x: gen gives %x, eval gives %x", a, b, g, e)
+	}
+	return g
+}
+
+/* f of the n-bit value a */
+func unaryOp(t *testing.T, a uint64, n int, fg func(gen.VM, []gc.Wire) []gc.Wire, fe func(eval.VM, []gc.Key) []gc.Key) uint64 {
+	return binaryOp(t, a, 0, n,
+		func(io gen.VM, x, _ []gc.Wire) []gc.Wire { return fg(io, x) },
+		func(io eval.VM, x, _ []gc.Key) []gc.Key { return fe(io, x) })
+}
+
+func toBytes(bits []bool) []byte {
+	result := make([]byte, len(bits)/8)
+	for i, b := range bits {
+		if b {
+			result[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return result
+}
+
+/* f of the byte strings args */
+func bytesOp(t *testing.T, args [][]byte, fg func(gen.VM, [][]gc.Wire) []gc.Wire, fe func(eval.VM, [][]gc.Key) []gc.Key) []byte {
+	gvms, evms := VMs(1)
+	gargs := make([][]gc.Wire, len(args))
+	eargs := make([][]gc.Key, len(args))
+	for i, a := range args {
+		for _, b := range a {
+			gargs[i] = append(gargs[i], gen.Uint(gvms[0], uint64(b), 8)...)
+			eargs[i] = append(eargs[i], eval.Uint(evms[0], uint64(b), 8)...)
+		}
+	}
+	g := toBytes(gvms[0].RevealTo0(fg(gvms[0], gargs)))
+	e := toBytes(evms[0].RevealTo1(fe(evms[0], eargs)))
+	if !bytes.Equal(g, e) {
+		t.Fatalf("%x: gen gives %x, eval gives %x", args, g, e)
+	}
+	return g
+}
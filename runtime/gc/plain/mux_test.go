@@ -0,0 +1,98 @@
+package plain
+
+import (
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+func TestMux(t *testing.T) {
+	for _, s := range []uint64{0, 1} {
+		fg := func(io gen.VM, a, b []gc.Wire) []gc.Wire { return gen.Mux(io, a[:1], gen.Uint(io, 0xa5, 8), b) }
+		fe := func(io eval.VM, a, b []gc.Key) []gc.Key { return eval.Mux(io, a[:1], eval.Uint(io, 0xa5, 8), b) }
+		want := uint64(0x3c)
+		if s == 1 {
+			want = 0xa5
+		}
+		if r := binaryOp(t, s, 0x3c, 8, fg, fe); r != want {
+			t.Errorf("Mux of %d: got %x, want %x", s, r, want)
+		}
+	}
+}
+
+func TestMuxN(t *testing.T) {
+	const dflt = 15
+	for _, n := range []int{0, 1, 2, 3, 5, 8, 13, 16, 20} {
+		for s := uint64(0); s < 16; s++ {
+			fg := func(io gen.VM, a, b []gc.Wire) []gc.Wire {
+				cases := make([][]gc.Wire, n)
+				for i := range cases {
+					cases[i] = gen.Uint(io, uint64(14-i)&15, 4)
+				}
+				return gen.MuxN(io, a, b, cases...)
+			}
+			fe := func(io eval.VM, a, b []gc.Key) []gc.Key {
+				cases := make([][]gc.Key, n)
+				for i := range cases {
+					cases[i] = eval.Uint(io, uint64(14-i)&15, 4)
+				}
+				return eval.MuxN(io, a, b, cases...)
+			}
+			want := uint64(dflt)
+			if s < uint64(n) {
+				want = (14 - s) & 15
+			}
+			if r := binaryOp(t, s, dflt, 4, fg, fe); r != want {
+				t.Errorf("case %d of %d: got %d, want %d", s, n, r, want)
+			}
+		}
+	}
+	/* MuxHot of three values, with mask hot, or none */
+	for hot := uint64(0); hot < 4; hot++ {
+		fg := func(io gen.VM, a, b []gc.Wire) []gc.Wire {
+			return gen.MuxHot(io, a[:3], b, gen.Uint(io, 3, 4), gen.Uint(io, 5, 4), gen.Uint(io, 9, 4))
+		}
+		fe := func(io eval.VM, a, b []gc.Key) []gc.Key {
+			return eval.MuxHot(io, a[:3], b, eval.Uint(io, 3, 4), eval.Uint(io, 5, 4), eval.Uint(io, 9, 4))
+		}
+		want := []uint64{3, 5, 9, dflt}[hot]
+		if r := binaryOp(t, 1<<hot, dflt, 4, fg, fe); r != want {
+			t.Errorf("MuxHot of mask %d: got %d, want %d", hot, r, want)
+		}
+	}
+}
+
+/* A back end with a Mux of its own, which counts its calls */
+type muxVM struct {
+	gen.VM
+	calls *int
+}
+
+func (y muxVM) Mux(s, a, b []gc.Wire) []gc.Wire {
+	*y.calls++
+	return y.VM.Mux(s, a, b)
+}
+
+/* Mux, Select and MuxN go through the back end's Mux */
+func TestMuxMethod(t *testing.T) {
+	calls := 0
+	fg := func(io gen.VM, a, b []gc.Wire) []gc.Wire {
+		io = muxVM{io, &calls}
+		x := gen.Select(io, a[:1], gen.Mux(io, a[:1], b, a), a)
+		return gen.MuxN(io, a[:2], x, a, b, x)
+	}
+	fe := func(io eval.VM, a, b []gc.Key) []gc.Key {
+		x := eval.Select(io, a[:1], eval.Mux(io, a[:1], b, a), a)
+		return eval.MuxN(io, a[:2], x, a, b, x)
+	}
+	/* s = 1 picks b, then case 1 of MuxN, which is b again */
+	if r := binaryOp(t, 1, 6, 4, fg, fe); r != 6 {
+		t.Errorf("got %d, want 6", r)
+	}
+	/* MuxN of three cases is a tree of three Muxes */
+	if calls != 5 {
+		t.Errorf("the back end's Mux was called %d times, want 5", calls)
+	}
+}
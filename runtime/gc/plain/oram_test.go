@@ -0,0 +1,153 @@
+package plain
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+/* A write of val at index, or a read if not write */
+type access struct {
+	write      bool
+	index, val uint64
+}
+
+/* What each access returns, the old element, on a slice in place of an ORam */
+func accessSlice(n int, accesses []access) []uint64 {
+	elts := make([]uint64, n)
+	var result []uint64
+	for _, a := range accesses {
+		result = append(result, elts[a.index])
+		if a.write {
+			elts[a.index] = a.val
+		}
+	}
+	return result
+}
+
+/*
+The results of accesses to a TreeRam of n 32-bit elements, on gvm and
+evm at once, which must agree, up to the first panic, which is
+returned
+*/
+func accessTreeRam(t *testing.T, gvm gen.VM, evm eval.VM, n int, accesses []access) ([]uint64, interface{}) {
+	bits := 0
+	for 1<<uint(bits) < n {
+		bits++
+	}
+	type result struct {
+		r     []uint64
+		panic interface{}
+	}
+	done := make(chan result)
+	go func() {
+		var x result
+		defer func() { x.panic = recover(); done <- x }()
+		m := eval.NewTreeRam(evm, n, 32)
+		for _, a := range accesses {
+			val := eval.Uint(evm, a.val, 32)
+			update := func(old []gc.Key) []gc.Key { return eval.Select(evm, eval.Uint(evm, boolBit(a.write), 1), val, old) }
+			x.r = append(x.r, toUint64(evm.RevealTo1(m.Access(evm, eval.Uint(evm, a.index, bits), update))))
+		}
+	}()
+	var g result
+	func() {
+		defer func() { g.panic = recover() }()
+		m := gen.NewTreeRam(gvm, n, 32)
+		for _, a := range accesses {
+			val := gen.Uint(gvm, a.val, 32)
+			update := func(old []gc.Wire) []gc.Wire { return gen.Select(gvm, gen.Uint(gvm, boolBit(a.write), 1), val, old) }
+			g.r = append(g.r, toUint64(gvm.RevealTo0(m.Access(gvm, gen.Uint(gvm, a.index, bits), update))))
+		}
+	}()
+	e := <-done
+	if len(g.r) != len(e.r) || (g.panic == nil) != (e.panic == nil) {
+		t.Fatalf("gen gives %d results and panics with %v, eval %d and %v", len(g.r), g.panic, len(e.r), e.panic)
+	}
+	for i := range g.r {
+		if g.r[i] != e.r[i] {
+			t.Fatalf("access %d: gen gives %x, eval gives %x", i, g.r[i], e.r[i])
+		}
+	}
+	return g.r, g.panic
+}
+
+func boolBit(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+/* VMs whose random values are 0, which puts every element of a TreeRam on the path to leaf 0 */
+type genLeaf0 struct{ gen.VM }
+
+func (y genLeaf0) Random(n int) []gc.Wire {
+	return gen.Uint(y.VM, 0, n)
+}
+
+type evalLeaf0 struct{ eval.VM }
+
+func (y evalLeaf0) Random(n int) []gc.Key {
+	return eval.Uint(y.VM, 0, n)
+}
+
+/* Check the results of accesses against a slice, up to the panic, if any */
+func checkAccesses(t *testing.T, name string, n int, accesses []access, r []uint64) {
+	want := accessSlice(n, accesses)
+	for i := range r {
+		if r[i] != want[i] {
+			t.Fatalf("%s: access %d, %v: got %x, want %x", name, i, accesses[i], r[i], want[i])
+		}
+	}
+}
+
+func TestTreeRam(t *testing.T) {
+	const n = 100
+	rnd := rand.New(rand.NewSource(1))
+	/* Random accesses, half of them writes to the same three elements */
+	var accesses []access
+	for i := 0; i < 300; i++ {
+		a := access{rnd.Intn(2) == 0, uint64(rnd.Intn(n)), uint64(rnd.Uint32())}
+		if i%2 == 0 {
+			a.write, a.index = true, uint64(i%3)
+		}
+		accesses = append(accesses, a)
+	}
+	gvms, evms := VMs(1)
+	r, failure := accessTreeRam(t, gvms[0], evms[0], n, accesses)
+	if failure != nil {
+		t.Fatal(failure)
+	}
+	checkAccesses(t, "random leaves", n, accesses, r)
+
+	/* Many writes to a few elements, all on one path */
+	accesses = nil
+	for i := 0; i < 200; i++ {
+		accesses = append(accesses, access{i%4 != 3, uint64(i % 5), uint64(rnd.Uint32())})
+	}
+	gvms, evms = VMs(1)
+	r, failure = accessTreeRam(t, genLeaf0{gvms[0]}, evalLeaf0{evms[0]}, n, accesses)
+	if failure != nil {
+		t.Fatal(failure)
+	}
+	checkAccesses(t, "few elements on one path", n, accesses, r)
+
+	/* More elements than the path has room for: the loss must be found before a read returns wrong data */
+	accesses = nil
+	for i := 0; i < n; i++ {
+		accesses = append(accesses, access{true, uint64(i), uint64(i + 1)})
+	}
+	for i := 0; i < n; i++ {
+		accesses = append(accesses, access{false, uint64(i), 0})
+	}
+	gvms, evms = VMs(1)
+	r, failure = accessTreeRam(t, genLeaf0{gvms[0]}, evalLeaf0{evms[0]}, n, accesses)
+	if failure == nil {
+		t.Fatalf("%d elements on one path, and no overflow", n)
+	}
+	checkAccesses(t, "overflow", n, accesses, r)
+}
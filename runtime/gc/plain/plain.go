@@ -0,0 +1,225 @@
+/*
+Package plain is a cleartext back end for compiled programs.  A key
+is just the value of its wire, one byte, and a generator wire is that
+key alone, so a program runs without any cryptography and computes
+the answer that the garbled circuit back ends should.
+
+The generator and the evaluator still run separately, and each party
+supplies its own inputs: the generator sends its inputs and random
+values to the evaluator in the clear, and the evaluator sends its
+inputs to the generator.
+*/
+package plain
+
+import (
+	"encoding/binary"
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+var keys = [2]gc.Key{{0}, {1}}
+
+func key(b bool) gc.Key {
+	if b {
+		return keys[1]
+	}
+	return keys[0]
+}
+
+func value(k gc.Key) bool {
+	return k[0] == 1
+}
+
+func bits(a uint64, n int) []gc.Key {
+	result := make([]gc.Key, n)
+	for i := range result {
+		result[i] = key(a>>uint(i)&1 == 1)
+	}
+	return result
+}
+
+func values(a []gc.Key) []bool {
+	result := make([]bool, len(a))
+	for i := range a {
+		result[i] = value(a[i])
+	}
+	return result
+}
+
+func gate(a, b []gc.Key, f func(x, y bool) bool) []gc.Key {
+	result := make([]gc.Key, len(a))
+	for i := range a {
+		result[i] = key(f(value(a[i]), value(b[i])))
+	}
+	return result
+}
+
+func and(x, y bool) bool { return x && y }
+func or(x, y bool) bool  { return x || y }
+func xor(x, y bool) bool { return x != y }
+
+type genVM struct {
+	toEval   chan uint64
+	fromEval chan uint64
+	session  *gen.Session
+}
+
+func wires(a []gc.Key) []gc.Wire {
+	result := make([]gc.Wire, len(a))
+	for i := range a {
+		result[i] = gc.Wire{a[i]}
+	}
+	return result
+}
+
+func unwires(a []gc.Wire) []gc.Key {
+	result := make([]gc.Key, len(a))
+	for i := range a {
+		result[i] = a[i][0]
+	}
+	return result
+}
+
+func (y *genVM) And(a, b []gc.Wire) []gc.Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in plain gen.And()")
+	}
+	return wires(gate(unwires(a), unwires(b), and))
+}
+
+func (y *genVM) Or(a, b []gc.Wire) []gc.Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in plain gen.Or()")
+	}
+	return wires(gate(unwires(a), unwires(b), or))
+}
+
+func (y *genVM) Xor(a, b []gc.Wire) []gc.Wire {
+	if len(a) != len(b) {
+		panic("Wire mismatch in plain gen.Xor()")
+	}
+	return wires(gate(unwires(a), unwires(b), xor))
+}
+
+func (y *genVM) Mux(s, a, b []gc.Wire) []gc.Wire {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Wire mismatch in plain gen.Mux()")
+	}
+	return gc.MuxWires(y.And, y.Xor, s[0], a, b)
+}
+
+func (y *genVM) True() []gc.Wire {
+	return []gc.Wire{{keys[1]}}
+}
+
+func (y *genVM) False() []gc.Wire {
+	return []gc.Wire{{keys[0]}}
+}
+
+func (y *genVM) Session() *gen.Session {
+	return y.session
+}
+
+func (y *genVM) RevealTo0(a []gc.Wire) []bool {
+	return values(unwires(a))
+}
+
+func (y *genVM) RevealTo1(a []gc.Wire) {
+}
+
+func (y *genVM) ShareTo0(n int) []gc.Wire {
+	return wires(bits(<-y.fromEval, n))
+}
+
+func (y *genVM) ShareTo1(a uint64, n int) []gc.Wire {
+	if n > 64 {
+		panic("ShareTo1: bits > 64")
+	}
+	y.toEval <- a
+	return wires(bits(a, n))
+}
+
+func (y *genVM) Random(n int) []gc.Wire {
+	k := make([]byte, 8)
+	gc.GenKey(k)
+	return y.ShareTo1(binary.BigEndian.Uint64(k), n)
+}
+
+type evalVM struct {
+	toGen   chan uint64
+	fromGen chan uint64
+}
+
+func (y *evalVM) And(a, b []gc.Key) []gc.Key {
+	if len(a) != len(b) {
+		panic("Wire mismatch in plain eval.And()")
+	}
+	return gate(a, b, and)
+}
+
+func (y *evalVM) Or(a, b []gc.Key) []gc.Key {
+	if len(a) != len(b) {
+		panic("Wire mismatch in plain eval.Or()")
+	}
+	return gate(a, b, or)
+}
+
+func (y *evalVM) Xor(a, b []gc.Key) []gc.Key {
+	if len(a) != len(b) {
+		panic("Wire mismatch in plain eval.Xor()")
+	}
+	return gate(a, b, xor)
+}
+
+func (y *evalVM) Mux(s, a, b []gc.Key) []gc.Key {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Wire mismatch in plain eval.Mux()")
+	}
+	return gc.MuxKeys(y.And, y.Xor, s[0], a, b)
+}
+
+func (y *evalVM) True() []gc.Key {
+	return []gc.Key{keys[1]}
+}
+
+func (y *evalVM) False() []gc.Key {
+	return []gc.Key{keys[0]}
+}
+
+func (y *evalVM) RevealTo0(a []gc.Key) {
+}
+
+func (y *evalVM) RevealTo1(a []gc.Key) []bool {
+	return values(a)
+}
+
+func (y *evalVM) ShareTo0(v uint64, n int) []gc.Key {
+	if n > 64 {
+		panic("ShareTo0: bits > 64")
+	}
+	y.toGen <- v
+	return bits(v, n)
+}
+
+func (y *evalVM) ShareTo1(n int) []gc.Key {
+	return bits(<-y.fromGen, n)
+}
+
+func (y *evalVM) Random(n int) []gc.Key {
+	return y.ShareTo1(n)
+}
+
+/* n pairs of connected cleartext VMs, like sim.VMs of the other back ends */
+func VMs(n int) ([]gen.VM, []eval.VM) {
+	gvms := make([]gen.VM, n)
+	evms := make([]eval.VM, n)
+	s := gen.NewSession()
+	for i := range gvms {
+		g2e := make(chan uint64, 1)
+		e2g := make(chan uint64, 1)
+		gvms[i] = &genVM{g2e, e2g, s}
+		evms[i] = &evalVM{e2g, g2e}
+	}
+	return gvms, evms
+}
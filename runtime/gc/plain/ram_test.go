@@ -0,0 +1,63 @@
+package plain
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+/*
+A session that loads the word at 0, which holds first, then stores and
+loads back each of vals; it returns what each load gave the generator
+and the evaluator
+*/
+func ramSession(first uint32, vals []uint64) (g, e []uint64) {
+	gvms, evms := VMs(1)
+	gio, eio := gvms[0], evms[0]
+	gen.InitRam(gio, []byte{byte(first), byte(first >> 8), byte(first >> 16), byte(first >> 24)})
+	done := make(chan bool)
+	go func() {
+		loc, size := eval.Uint(eio, 0, 64), eval.Uint(eio, 4, 32)
+		e = append(e, toUint64(eio.RevealTo1(eval.Load(eio, loc, size))))
+		for _, v := range vals {
+			eval.Store(eio, loc, size, eval.Uint(eio, v, 32))
+			e = append(e, toUint64(eio.RevealTo1(eval.Load(eio, loc, size))))
+		}
+		done <- true
+	}()
+	loc, size := gen.Uint(gio, 0, 64), gen.Uint(gio, 4, 32)
+	g = append(g, toUint64(gio.RevealTo0(gen.Load(gio, loc, size))))
+	for _, v := range vals {
+		gen.Store(gio, loc, size, gen.Uint(gio, v, 32))
+		g = append(g, toUint64(gio.RevealTo0(gen.Load(gio, loc, size))))
+	}
+	<-done
+	return g, e
+}
+
+/* Sessions running at once, each with its own memory, do not see each other's stores */
+func TestRamSessions(t *testing.T) {
+	const n = 4
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vals := make([]uint64, 20)
+			for j := range vals {
+				vals[j] = uint64(1000*i + j)
+			}
+			g, e := ramSession(uint32(100*i), vals)
+			want := append([]uint64{uint64(100 * i)}, vals...)
+			for j := range want {
+				if g[j] != want[j] || e[j] != want[j] {
+					t.Errorf("session %d, load %d: gen got %d, eval got %d, want %d", i, j, g[j], e[j], want[j])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,40 @@
+package plain
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+/* Shift amounts worth testing for n bits, before truncating to n bits: 0, small, n-1, n and past it, and the largest */
+func shiftAmounts(n int) []uint64 {
+	return []uint64{0, 1, 3, uint64(n - 1), uint64(n), uint64(n + 1), 2*uint64(n) - 1, ^uint64(0)}
+}
+
+/* The variable shifts against Go's, which also give 0, or the sign bits, for amounts of the width or more */
+func TestShiftV(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 8, 32, 64} {
+		mask := ^uint64(0) >> uint(64-n)
+		xs := []uint64{mask, 1 << uint(n-1), rnd.Uint64() & mask, rnd.Uint64() & mask >> 1}
+		for _, x := range xs {
+			for _, s := range shiftAmounts(n) {
+				s &= mask
+				sext := int64(x<<uint(64-n)) >> uint(64-n)
+				want := []uint64{x << s & mask, x >> s, uint64(sext>>s) & mask}
+				got := []uint64{
+					binaryOp(t, x, s, n, gen.ShlV, eval.ShlV),
+					binaryOp(t, x, s, n, gen.LshrV, eval.LshrV),
+					binaryOp(t, x, s, n, gen.AshrV, eval.AshrV),
+				}
+				for i, name := range []string{"<<", ">>", "signed >>"} {
+					if got[i] != want[i] {
+						t.Errorf("%d bits: %x %s %d: got %x, want %x", n, x, name, s, got[i], want[i])
+					}
+				}
+			}
+		}
+	}
+}
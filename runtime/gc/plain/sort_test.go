@@ -0,0 +1,109 @@
+package plain
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/eval"
+	"github.com/tjim/smpcc/runtime/gc/gen"
+)
+
+func TestSort(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	sorters := map[string]struct {
+		g func(gen.VM, [][]gc.Wire, [][]gc.Wire)
+		e func(eval.VM, [][]gc.Key, [][]gc.Key)
+	}{
+		"odd-even merge": {gen.OddEvenMergeSort, eval.OddEvenMergeSort},
+		"bitonic":        {gen.BitonicSort, eval.BitonicSort},
+	}
+	for _, n := range []int{0, 1, 2, 3, 5, 8, 13} {
+		xs := make([]uint64, n)
+		for i := range xs {
+			xs[i] = uint64(rnd.Intn(1 << 12))
+			if i%2 == 1 {
+				xs[i] = uint64(rnd.Intn(4)) /* repeats */
+			}
+		}
+		want := append([]uint64{}, xs...)
+		sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+		for name, s := range sorters {
+			gvms, evms := VMs(1)
+			gk, gp := make([][]gc.Wire, n), make([][]gc.Wire, n)
+			ek, ep := make([][]gc.Key, n), make([][]gc.Key, n)
+			for i, x := range xs {
+				gk[i], gp[i] = gen.Uint(gvms[0], x, 12), gen.Uint(gvms[0], uint64(i), 8)
+				ek[i], ep[i] = eval.Uint(evms[0], x, 12), eval.Uint(evms[0], uint64(i), 8)
+			}
+			s.g(gvms[0], gk, gp)
+			s.e(evms[0], ek, ep)
+			for i := range xs {
+				k := toUint64(gvms[0].RevealTo0(gk[i]))
+				p := toUint64(gvms[0].RevealTo0(gp[i]))
+				if k != toUint64(evms[0].RevealTo1(ek[i])) || p != toUint64(evms[0].RevealTo1(ep[i])) {
+					t.Fatalf("%s sort of %v: gen and eval differ at %d", name, xs, i)
+				}
+				if k != want[i] || xs[p] != k {
+					t.Fatalf("%s sort of %v: got key %d payload %d at %d", name, xs, k, p, i)
+				}
+			}
+		}
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	for _, n := range []int{1, 2, 7, 16} {
+		gvms, evms := VMs(1)
+		go func() {
+			xs := make([][]gc.Key, n)
+			for i := range xs {
+				xs[i] = eval.Uint(evms[0], uint64(i), 8)
+			}
+			eval.Shuffle(evms[0], xs)
+			for _, x := range xs {
+				evms[0].RevealTo0(x)
+			}
+		}()
+		xs := make([][]gc.Wire, n)
+		for i := range xs {
+			xs[i] = gen.Uint(gvms[0], uint64(i), 8)
+		}
+		gen.Shuffle(gvms[0], xs)
+		seen := make([]bool, n)
+		for _, x := range xs {
+			j := toUint64(gvms[0].RevealTo0(x))
+			if j >= uint64(n) || seen[j] {
+				t.Fatalf("shuffle of %d: %d twice or out of range", n, j)
+			}
+			seen[j] = true
+		}
+	}
+}
+
+func TestSortMemory(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 2, 7, 16} {
+		ram := make([]byte, 8+4*n)
+		for i, j := range rnd.Perm(n) {
+			ram[8+4*i] = byte(j)
+			ram[8+4*i+3] = byte(100 - j)
+		}
+		gvms, evms := VMs(1)
+		gen.InitRam(gvms[0], ram)
+		done := make(chan bool)
+		go func() {
+			eval.SortMemory(evms[0], evms[0].True(), eval.Uint(evms[0], 8, 64), n)
+			done <- true
+		}()
+		/* the high bytes sort descending indices */
+		gen.SortMemory(gvms[0], gvms[0].True(), gen.Uint(gvms[0], 8, 64), n)
+		<-done
+		for i := 0; i < n; i++ {
+			if ram[8+4*i] != byte(n-1-i) {
+				t.Fatalf("sort of %d: got %v", n, ram)
+			}
+		}
+	}
+}
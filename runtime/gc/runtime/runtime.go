@@ -3,28 +3,99 @@ package runtime
 import (
 	"flag"
 	"fmt"
+	"github.com/tjim/smpcc/runtime/bristol"
+	"github.com/tjim/smpcc/runtime/gc"
+	"github.com/tjim/smpcc/runtime/gc/dual"
 	"github.com/tjim/smpcc/runtime/gc/eval"
+	gaxeval "github.com/tjim/smpcc/runtime/gc/gax/eval"
+	gaxgen "github.com/tjim/smpcc/runtime/gc/gax/gen"
+	gaxsim "github.com/tjim/smpcc/runtime/gc/gax/sim"
+	gaxreval "github.com/tjim/smpcc/runtime/gc/gaxr/eval"
+	gaxrgen "github.com/tjim/smpcc/runtime/gc/gaxr/gen"
+	gaxrsim "github.com/tjim/smpcc/runtime/gc/gaxr/sim"
 	"github.com/tjim/smpcc/runtime/gc/gen"
-	vmeval "github.com/tjim/smpcc/runtime/gc/yao/eval"
-	vmgen "github.com/tjim/smpcc/runtime/gc/yao/gen"
-	"github.com/tjim/smpcc/runtime/gc/yao/sim"
+	halfgateseval "github.com/tjim/smpcc/runtime/gc/halfgates/eval"
+	halfgatesgen "github.com/tjim/smpcc/runtime/gc/halfgates/gen"
+	halfgatessim "github.com/tjim/smpcc/runtime/gc/halfgates/sim"
+	"github.com/tjim/smpcc/runtime/gc/plain"
+	yaoeval "github.com/tjim/smpcc/runtime/gc/yao/eval"
+	yaogen "github.com/tjim/smpcc/runtime/gc/yao/gen"
+	yaosim "github.com/tjim/smpcc/runtime/gc/yao/sim"
+	yaoreval "github.com/tjim/smpcc/runtime/gc/yaor/eval"
+	yaorgen "github.com/tjim/smpcc/runtime/gc/yaor/gen"
+	yaorsim "github.com/tjim/smpcc/runtime/gc/yaor/sim"
+	"github.com/tjim/smpcc/runtime/transport"
+	"log"
 	"os"
+	"os/signal"
 	"runtime/pprof"
+	"syscall"
 )
 
+type backend struct {
+	newGenVM  func(io gen.IO, id gc.ConcurrentId, s *gen.Session) gen.VM
+	newEvalVM func(io eval.IO, id gc.ConcurrentId) eval.VM
+	simVMs    func(n int) ([]gen.VM, []eval.VM)
+}
+
+var backends = map[string]backend{
+	"yao":       {yaogen.NewVM, yaoeval.NewVM, yaosim.VMs},
+	"yaor":      {yaorgen.NewVM, yaoreval.NewVM, yaorsim.VMs},
+	"gax":       {gaxgen.NewVM, gaxeval.NewVM, gaxsim.VMs},
+	"gaxr":      {gaxrgen.NewVM, gaxreval.NewVM, gaxrsim.VMs},
+	"halfgates": {halfgatesgen.NewVM, halfgateseval.NewVM, halfgatessim.VMs},
+}
+
+// The garbled circuit back end; compiled programs may set this before calling Run,
+// and it can be overridden with the -circuitlib flag
+var CircuitLib = "yao"
+
 var id int
 var addr string
 var args []string
 var do_old bool
 var do_sim bool
 var do_pprof bool
+var do_offline bool
+var do_online bool
+var store string
+var local_tables bool
+var copies int
+var do_dual bool
+var dual_addr string
+var record string
+var cost string
+var do_plain bool
+var key_file string
+var peer_key string
+var do_serve bool
+var max_sessions int
+var no_public bool
 
 func init_args() {
 	flag.BoolVar(&do_pprof, "pprof", false, "run for profiling")
 	flag.BoolVar(&do_old, "old", false, "use old, non-multiplex OT (default false)")
 	flag.BoolVar(&do_sim, "sim", false, "run in simulation mode, single process (default false)")
+	flag.BoolVar(&do_offline, "offline", false, "generator: garble into the -store directory and exit (default false)")
+	flag.BoolVar(&do_online, "online", false, "generator: send the circuit garbled by -offline instead of garbling (default false)")
+	flag.StringVar(&store, "store", "circuit.store", "garbled circuit store directory (default circuit.store)")
+	flag.BoolVar(&local_tables, "localtables", false, "online: the evaluator reads garbled tables from its copy of the store (default false)")
+	flag.IntVar(&copies, "copies", 0, "garble this many copies for cut-and-choose, secure against a malicious generator; both parties must agree (default 0, semi-honest)")
+	flag.BoolVar(&do_dual, "dual", false, "dual execution: each party garbles a copy of the program for the other, leaking at most one bit to a cheating party (default false)")
+	flag.StringVar(&dual_addr, "dualaddr", "127.0.0.1:3043", "network address of the second execution of -dual, host:port or unix:path (default 127.0.0.1:3043)")
+	flag.StringVar(&record, "record", "", "run the generator in the clear and write the circuit to this file, in Bristol Fashion, or as JSON if it ends in .json; inputs are read from the command line as with -sim")
+	flag.StringVar(&cost, "cost", "", "run the generator in the clear and write a report of the program's gates and traffic to this file, as JSON if it ends in .json; inputs are read from the command line as with -sim")
+	flag.BoolVar(&do_plain, "plain", false, "run in the clear in a single process, with inputs as for -sim, to check a program's answer (default false)")
+	flag.StringVar(&key_file, "key", "", "secure the connection with TLS, authenticated by this party's private key file, as made by keygen; needs -peer")
+	flag.StringVar(&peer_key, "peer", "", "the other party's public key, in hex, for -key")
+	flag.IntVar(&gc.TablePageSize, "pagesize", gc.TablePageSize, "size in bytes of the pages of garbled tables sent to the evaluator")
+	flag.IntVar(&gc.TablePagesInFlight, "tablepages", gc.TablePagesInFlight, "pages of garbled tables per block the generator may send ahead of the evaluator; one more may wait to be sent")
+	flag.BoolVar(&do_serve, "serve", false, "evaluator: serve a session to each generator that connects, until interrupted (default false)")
+	flag.IntVar(&max_sessions, "sessions", 0, "with -serve, run at most this many sessions at once (default 0, no limit)")
+	flag.BoolVar(&no_public, "nopublic", false, "garble the bits known to both parties, such as constants, like any others; both parties must agree (default false)")
 	flag.IntVar(&id, "id", 0, "identity (default 0)")
-	flag.StringVar(&addr, "addr", "127.0.0.1:3042", "network address (default 127.0.0.1:3042)")
+	flag.StringVar(&addr, "addr", "127.0.0.1:3042", "network address, host:port or unix:path (default 127.0.0.1:3042)")
+	flag.StringVar(&CircuitLib, "circuitlib", CircuitLib, "garbled circuit back end: yao, yaor, gax, gaxr or halfgates")
 	flag.Parse()
 	args = flag.Args()
 }
@@ -39,6 +110,23 @@ func next_arg() uint64 {
 	return uint64(arg)
 }
 
+/* Connected pairs of IOs, for simulating cut-and-choose */
+func simIOs(n int) ([]gen.IO, []eval.IO) {
+	gios := make([]gen.IO, n)
+	eios := make([]eval.IO, n)
+	for i := range gios {
+		io := gc.NewChanio()
+		done := make(chan bool)
+		go func(i int) {
+			gios[i] = gen.NewIOX(*io)
+			done <- true
+		}(i)
+		eios[i] = eval.NewIOX(*io)
+		<-done
+	}
+	return gios, eios
+}
+
 func Run(numBlocks int, gen_main func([]gen.VM), eval_main func([]eval.VM)) {
 	init_args()
 	if do_pprof {
@@ -50,18 +138,155 @@ func Run(numBlocks int, gen_main func([]gen.VM), eval_main func([]eval.VM)) {
 		pprof.StartCPUProfile(f)
 		defer pprof.StopCPUProfile()
 	}
-	if do_sim {
-		gvms, evms := sim.VMs(numBlocks + 1)
+	b, ok := backends[CircuitLib]
+	if !ok {
+		fmt.Printf("Error: unknown circuit library %s\n", CircuitLib)
+		os.Exit(1)
+	}
+	if (do_offline || do_online) && (id != 0 || do_sim || do_old) {
+		fmt.Println("Error: -offline and -online are for the generator (-id 0) with the stream OT")
+		os.Exit(1)
+	}
+	if copies > 0 && (do_offline || do_online || do_old || do_dual) {
+		fmt.Println("Error: -copies does not work with -offline, -online, -old or -dual")
+		os.Exit(1)
+	}
+	if do_dual && (do_offline || do_online || do_old || local_tables) {
+		fmt.Println("Error: -dual does not work with -offline, -online, -old or -localtables")
+		os.Exit(1)
+	}
+	if gc.TablePageSize < 1 || gc.TablePagesInFlight < 1 {
+		fmt.Println("Error: -pagesize and -tablepages must be positive")
+		os.Exit(1)
+	}
+	if gc.TablePageSize > transport.MaxFrame {
+		fmt.Printf("Error: -pagesize must be at most %d, the longest frame the transport reads\n", transport.MaxFrame)
+		os.Exit(1)
+	}
+	if do_serve && (id == 0 || do_sim || do_offline || do_online || do_old || do_dual || local_tables) {
+		fmt.Println("Error: -serve is for the evaluator, and does not work with -sim, -offline, -online, -old, -dual or -localtables")
+		os.Exit(1)
+	}
+	if (key_file == "") != (peer_key == "") {
+		fmt.Println("Error: -key and -peer go together")
+		os.Exit(1)
+	}
+	if key_file != "" {
+		key, err := transport.LoadKey(key_file)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			os.Exit(1)
+		}
+		peer, err := transport.ParsePublicKey(peer_key)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			os.Exit(1)
+		}
+		gc.Security = &transport.Security{Key: key, Peer: peer}
+	}
+	if !no_public && record == "" {
+		/* the recorder must see every gate, constant or not */
+		gmain, emain := gen_main, eval_main
+		gen_main = func(vms []gen.VM) { gmain(gen.PublicVMs(vms)) }
+		eval_main = func(vms []eval.VM) { emain(eval.PublicVMs(vms)) }
+	}
+	if record != "" {
+		r := bristol.NewRecorder(func(bits int) uint64 { return next_arg() })
+		vms := make([]gen.VM, numBlocks+1)
+		for i := range vms {
+			vms[i] = r
+		}
+		gen_main(vms)
+		if err := r.WriteFile(record); err != nil {
+			fmt.Println("Error: ", err)
+			os.Exit(1)
+		}
+	} else if cost != "" {
+		vms, r := gen.NewCostVMs(numBlocks+1, func(bits int) uint64 { return next_arg() })
+		gen_main(vms)
+		if err := r.WriteFile(cost); err != nil {
+			fmt.Println("Error: ", err)
+			os.Exit(1)
+		}
+	} else if do_plain {
+		gvms, evms := plain.VMs(numBlocks + 1)
+		go gen_main(gvms)
+		eval_main(evms)
+		fmt.Println("Done")
+	} else if do_sim && do_dual {
+		iosA, eiosA := simIOs(numBlocks + 1)
+		giosB, iosB := simIOs(numBlocks + 1)
+		s0, s1 := gen.NewSession(), gen.NewSession()
+		vms0 := make([]gen.VM, numBlocks+1)
+		vms1 := make([]eval.VM, numBlocks+1)
+		for i := range vms0 {
+			id := gc.ConcurrentId(i)
+			vms0[i] = dual.NewVM0(iosA[i], b.newGenVM(iosA[i], id, s0), b.newEvalVM(iosB[i], id))
+			vms1[i] = dual.NewVM1(eiosA[i], b.newEvalVM(eiosA[i], id), b.newGenVM(giosB[i], id, s1))
+		}
+		go gen_main(vms0)
+		eval_main(vms1)
+		fmt.Println("Done")
+	} else if do_sim && copies > 0 {
+		gios, eios := simIOs(numBlocks + 1)
+		go func() { gen_main(gen.NewCCVMs(gios, copies, b.newGenVM)) }()
+		eval_main(eval.NewCCVMs(eios, copies, b.newEvalVM, b.newGenVM))
+		fmt.Println("Done")
+	} else if do_sim {
+		gvms, evms := b.simVMs(numBlocks + 1)
 		go gen_main(gvms)
 		eval_main(evms)
 		fmt.Println("Done")
+	} else if id == 0 && do_offline {
+		gen.Offline(store, gen_main, numBlocks+1, b.newGenVM)
+	} else if id == 0 && do_online {
+		gen.Online(addr, store, numBlocks+1, local_tables)
+	} else if id == 0 && do_dual {
+		dual.Party0(addr, dual_addr, gen_main, numBlocks+1, b.newGenVM, b.newEvalVM)
+	} else if do_dual {
+		dual.Party1(addr, dual_addr, eval_main, numBlocks+1, b.newGenVM, b.newEvalVM)
+	} else if id == 0 && copies > 0 {
+		gen.ClientCC(addr, gen_main, numBlocks+1, b.newGenVM, copies)
 	} else if id == 0 && do_old {
-		gen.Client(addr, gen_main, numBlocks+1, vmgen.NewVM)
+		gen.Client(addr, gen_main, numBlocks+1, b.newGenVM)
 	} else if id == 0 {
-		gen.Client2(addr, gen_main, numBlocks+1, vmgen.NewVM)
+		gen.Client2(addr, gen_main, numBlocks+1, b.newGenVM)
+	} else if do_serve {
+		newVMs := eval.VMsOf(b.newEvalVM)
+		if copies > 0 {
+			newVMs = func(ios []eval.IO) []eval.VM { return eval.NewCCVMs(ios, copies, b.newEvalVM, b.newGenVM) }
+		}
+		serve(eval_main, numBlocks+1, newVMs)
 	} else if do_old {
-		eval.Server(addr, eval_main, numBlocks+1, vmeval.NewVM)
+		eval.Server(addr, eval_main, numBlocks+1, b.newEvalVM)
+	} else if copies > 0 {
+		eval.ServerCC(addr, eval_main, numBlocks+1, b.newEvalVM, b.newGenVM, copies)
+	} else if local_tables {
+		newVM := func(io eval.IO, id gc.ConcurrentId) eval.VM {
+			return b.newEvalVM(eval.NewStoreIO(io, store, id), id)
+		}
+		eval.Server2(addr, eval_main, numBlocks+1, newVM)
 	} else {
-		eval.Server2(addr, eval_main, numBlocks+1, vmeval.NewVM)
+		eval.Server2(addr, eval_main, numBlocks+1, b.newEvalVM)
+	}
+}
+
+/* Serve sessions until SIGINT or SIGTERM, then let the running sessions finish */
+func serve(eval_main func([]eval.VM), numBlocks int, newVMs func([]eval.IO) []eval.VM) {
+	s, err := eval.NewSessionServer(addr, eval_main, numBlocks, newVMs, max_sessions)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		log.Printf("shutting down when the running sessions are done")
+		s.Shutdown()
+	}()
+	if err := s.Serve(); err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
 	}
 }
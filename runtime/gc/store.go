@@ -0,0 +1,40 @@
+package gc
+
+import (
+	"fmt"
+	"github.com/tjim/smpcc/runtime/ot"
+	"path/filepath"
+)
+
+/*
+A garbled circuit store holds everything a generator VM sends to its
+evaluator, garbled ahead of time and recorded in order, so that it can
+be replayed later during a cheaper online phase.  A store is a
+directory with two files per VM: gen.<id> holds every record and stays
+with the generator; eval.<id> holds only the garbled tables and can be
+given to the evaluator before the online phase.  A store is used
+once: the replay renames gen.<id> to gen.<id>.used as it starts.
+*/
+
+const (
+	RecTable   = iota // a garbled table, SendT
+	RecKey            // a key, SendK
+	RecOT             // one input-wire label pair, Send
+	RecOTM            // a batch of input-wire label pairs, SendM
+	RecOTMBits        // a batch of bit pairs, SendMBits
+)
+
+type StoreRecord struct {
+	Kind byte
+	T    GarbledTable
+	K    Key
+	A, B []ot.Message
+}
+
+func GenStoreFile(dir string, id ConcurrentId) string {
+	return filepath.Join(dir, fmt.Sprintf("gen.%d", id))
+}
+
+func EvalStoreFile(dir string, id ConcurrentId) string {
+	return filepath.Join(dir, fmt.Sprintf("eval.%d", id))
+}
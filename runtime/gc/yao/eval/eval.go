@@ -5,33 +5,26 @@ import (
 	"github.com/tjim/smpcc/runtime/gc"
 	baseeval "github.com/tjim/smpcc/runtime/gc/eval"
 	"github.com/tjim/smpcc/runtime/gc/yao/gen"
-	"github.com/tjim/smpcc/runtime/ot"
 )
 
 type vm struct {
-	io baseeval.IO
+	io     baseeval.IO
+	const0 gc.Key
+	const1 gc.Key
 }
 
 func NewVM(io baseeval.IO, id gc.ConcurrentId) baseeval.VM {
 	// id only to have the same type as other gc back ends (yaor, gax, gaxr)
-	return vm{io}
+	return &vm{io: io}
 }
 
-var const0 gc.Key
-var const1 gc.Key
-
-func init_constants(io baseeval.IO) {
-	if const0 == nil {
-		const0 = io.RecvK()
-		const1 = io.RecvK()
+func (y *vm) init_constants() {
+	if y.const0 == nil {
+		y.const0 = y.io.RecvK()
+		y.const1 = y.io.RecvK()
 	}
 }
 
-func reset() {
-	const0 = nil
-	const1 = nil
-}
-
 func bitwise_binary_operator(io baseeval.IO, a, b []gc.Key) []gc.Key {
 	if len(a) != len(b) {
 		panic("Wire mismatch in eval.bitwise_binary_operator()")
@@ -44,15 +37,15 @@ func bitwise_binary_operator(io baseeval.IO, a, b []gc.Key) []gc.Key {
 	return result
 }
 
-func (y vm) And(a, b []gc.Key) []gc.Key {
+func (y *vm) And(a, b []gc.Key) []gc.Key {
 	return bitwise_binary_operator(y.io, a, b)
 }
 
-func (y vm) Or(a, b []gc.Key) []gc.Key {
+func (y *vm) Or(a, b []gc.Key) []gc.Key {
 	return bitwise_binary_operator(y.io, a, b)
 }
 
-func (y vm) Xor(a, b []gc.Key) []gc.Key {
+func (y *vm) Xor(a, b []gc.Key) []gc.Key {
 	if len(a) != len(b) {
 		panic("Xor(): mismatch")
 	}
@@ -63,25 +56,32 @@ func (y vm) Xor(a, b []gc.Key) []gc.Key {
 	return result
 }
 
-func (y vm) True() []gc.Key {
-	init_constants(y.io)
-	return []gc.Key{const1}
+func (y *vm) Mux(s, a, b []gc.Key) []gc.Key {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Mux(): mismatch")
+	}
+	return gc.MuxKeys(y.And, y.Xor, s[0], a, b)
+}
+
+func (y *vm) True() []gc.Key {
+	y.init_constants()
+	return []gc.Key{y.const1}
 }
 
-func (y vm) False() []gc.Key {
-	init_constants(y.io)
-	return []gc.Key{const0}
+func (y *vm) False() []gc.Key {
+	y.init_constants()
+	return []gc.Key{y.const0}
 }
 
 /* Reveal to party 0 = gen */
-func (y vm) RevealTo0(a []gc.Key) {
+func (y *vm) RevealTo0(a []gc.Key) {
 	for i := 0; i < len(a); i++ {
 		y.io.SendK2(a[i])
 	}
 }
 
 /* Reveal to party 1 = eval */
-func (y vm) RevealTo1(a []gc.Key) []bool {
+func (y *vm) RevealTo1(a []gc.Key) []bool {
 	result := make([]bool, len(a))
 	for i := 0; i < len(a); i++ {
 		t := y.io.RecvT()
@@ -97,51 +97,30 @@ func (y vm) RevealTo1(a []gc.Key) []bool {
 	return result
 }
 
-func (y vm) ShareTo0(v uint64, bits int) []gc.Key {
-	a := make([]bool, bits)
-	for i := 0; i < len(a); i++ {
-		bit := (v >> uint(i)) % 2
-		if bit == 1 {
-			a[i] = true
-		} else {
-			a[i] = false
-		}
-	}
-	result := make([]gc.Key, len(a))
-	for i := 0; i < len(a); i++ {
-		selector := ot.Selector(0)
-		if a[i] {
-			selector = 1
-		}
-		result[i] = gc.Key(y.io.Receive(selector))
+func (y *vm) ShareTo0(v uint64, bits int) []gc.Key {
+	r := make([]byte, (bits+7)/8)
+	for i := 0; i < bits; i++ {
+		bit.SetBit(r, i, byte((v>>uint(i))%2))
 	}
-	return result
+	return baseeval.ReceiveKeys(y.io, r, bits)
 }
 
 // Random generates random bits.
-func (y vm) Random(bits int) []gc.Key {
+func (y *vm) Random(bits int) []gc.Key {
 	if bits < 1 {
 		panic("Random: bits < 1")
 	}
-	result := make([]gc.Key, bits)
 	numBytes := bits / 8
 	if bits%8 != 0 {
 		numBytes++
 	}
 	random := make([]byte, numBytes)
 	gc.GenKey(random)
-	for i, _ := range result {
-		selector := ot.Selector(0)
-		if bit.GetBit(random, i) != 0 {
-			selector = 1
-		}
-		result[i] = gc.Key(y.io.Receive(selector))
-	}
-	return result
+	return baseeval.ReceiveKeys(y.io, random, bits)
 }
 
 /* Bit transfer: Generator knows the bits, evaluator gets keys */
-func (y vm) ShareTo1(bits int) []gc.Key {
+func (y *vm) ShareTo1(bits int) []gc.Key {
 	if bits > 64 {
 		panic("BT: bits > 64")
 	}
@@ -5,17 +5,18 @@ import (
 	"github.com/tjim/smpcc/runtime/bit"
 	"github.com/tjim/smpcc/runtime/gc"
 	baseeval "github.com/tjim/smpcc/runtime/gc/eval"
-	"github.com/tjim/smpcc/runtime/ot"
 )
 
 type vm struct {
 	io           baseeval.IO
 	concurrentId gc.ConcurrentId
 	gateId       uint16
+	const0       gc.Key
+	const1       gc.Key
 }
 
 func NewVM(io baseeval.IO, id gc.ConcurrentId) baseeval.VM {
-	return vm{io, id, 0}
+	return &vm{io: io, concurrentId: id}
 }
 
 const (
@@ -26,21 +27,13 @@ var (
 	ALL_ZEROS gc.Key = make([]byte, KEY_SIZE)
 )
 
-var const0 gc.Key
-var const1 gc.Key
-
-func init_constants(io baseeval.IO) {
-	if const0 == nil {
-		const0 = io.RecvK()
-		const1 = io.RecvK()
+func (y *vm) init_constants() {
+	if y.const0 == nil {
+		y.const0 = y.io.RecvK()
+		y.const1 = y.io.RecvK()
 	}
 }
 
-func reset() {
-	const0 = nil
-	const1 = nil
-}
-
 func slot(keys []gc.Key) int {
 	result := 0
 	for i := 0; i < len(keys); i++ {
@@ -79,7 +72,7 @@ func encrypt(keys []gc.Key, result []byte) []byte {
 	return result
 }
 
-func (gax vm) Decrypt(t gc.GarbledTable, keys ...gc.Key) []byte {
+func (gax *vm) Decrypt(t gc.GarbledTable, keys ...gc.Key) []byte {
 	if len(keys) != 2 {
 		// log.Println("Non-optimized decrypt slot")
 		return Decrypt_nonoptimized(t, keys)
@@ -88,7 +81,7 @@ func (gax vm) Decrypt(t gc.GarbledTable, keys ...gc.Key) []byte {
 	return decrypt(keys, t[slot(keys)])
 }
 
-func (y vm) bitwise_binary_operator(io baseeval.IO, a, b []gc.Key) []gc.Key {
+func (y *vm) bitwise_binary_operator(io baseeval.IO, a, b []gc.Key) []gc.Key {
 	if len(a) != len(b) {
 		panic("Wire mismatch in eval.bitwise_binary_operator()")
 	}
@@ -106,15 +99,15 @@ func (y vm) bitwise_binary_operator(io baseeval.IO, a, b []gc.Key) []gc.Key {
 	return result
 }
 
-func (y vm) And(a, b []gc.Key) []gc.Key {
+func (y *vm) And(a, b []gc.Key) []gc.Key {
 	return y.bitwise_binary_operator(y.io, a, b)
 }
 
-func (y vm) Or(a, b []gc.Key) []gc.Key {
+func (y *vm) Or(a, b []gc.Key) []gc.Key {
 	return y.bitwise_binary_operator(y.io, a, b)
 }
 
-func (y vm) Xor(a, b []gc.Key) []gc.Key {
+func (y *vm) Xor(a, b []gc.Key) []gc.Key {
 	if len(a) != len(b) {
 		panic("Xor(): mismatch")
 	}
@@ -125,25 +118,32 @@ func (y vm) Xor(a, b []gc.Key) []gc.Key {
 	return result
 }
 
-func (y vm) True() []gc.Key {
-	init_constants(y.io)
-	return []gc.Key{const1}
+func (y *vm) Mux(s, a, b []gc.Key) []gc.Key {
+	if len(s) != 1 || len(a) != len(b) {
+		panic("Mux(): mismatch")
+	}
+	return gc.MuxKeys(y.And, y.Xor, s[0], a, b)
+}
+
+func (y *vm) True() []gc.Key {
+	y.init_constants()
+	return []gc.Key{y.const1}
 }
 
-func (y vm) False() []gc.Key {
-	init_constants(y.io)
-	return []gc.Key{const0}
+func (y *vm) False() []gc.Key {
+	y.init_constants()
+	return []gc.Key{y.const0}
 }
 
 /* Reveal to party 0 = gen */
-func (y vm) RevealTo0(a []gc.Key) {
+func (y *vm) RevealTo0(a []gc.Key) {
 	for i := 0; i < len(a); i++ {
 		y.io.SendK2(a[i])
 	}
 }
 
 /* Reveal to party 1 = eval */
-func (y vm) RevealTo1(a []gc.Key) []bool {
+func (y *vm) RevealTo1(a []gc.Key) []bool {
 	result := make([]bool, len(a))
 	for i := 0; i < len(a); i++ {
 		t := y.io.RecvT()
@@ -159,51 +159,30 @@ func (y vm) RevealTo1(a []gc.Key) []bool {
 	return result
 }
 
-func (y vm) ShareTo0(v uint64, bits int) []gc.Key {
-	a := make([]bool, bits)
-	for i := 0; i < len(a); i++ {
-		bit := (v >> uint(i)) % 2
-		if bit == 1 {
-			a[i] = true
-		} else {
-			a[i] = false
-		}
-	}
-	result := make([]gc.Key, len(a))
-	for i := 0; i < len(a); i++ {
-		selector := ot.Selector(0)
-		if a[i] {
-			selector = 1
-		}
-		result[i] = gc.Key(y.io.Receive(selector))
+func (y *vm) ShareTo0(v uint64, bits int) []gc.Key {
+	r := make([]byte, (bits+7)/8)
+	for i := 0; i < bits; i++ {
+		bit.SetBit(r, i, byte((v>>uint(i))%2))
 	}
-	return result
+	return baseeval.ReceiveKeys(y.io, r, bits)
 }
 
 // Random generates random bits.
-func (y vm) Random(bits int) []gc.Key {
+func (y *vm) Random(bits int) []gc.Key {
 	if bits < 1 {
 		panic("Random: bits < 1")
 	}
-	result := make([]gc.Key, bits)
 	numBytes := bits / 8
 	if bits%8 != 0 {
 		numBytes++
 	}
 	random := make([]byte, numBytes)
 	gc.GenKey(random)
-	for i, _ := range result {
-		selector := ot.Selector(0)
-		if bit.GetBit(random, i) != 0 {
-			selector = 1
-		}
-		result[i] = gc.Key(y.io.Receive(selector))
-	}
-	return result
+	return baseeval.ReceiveKeys(y.io, random, bits)
 }
 
 /* Bit transfer: Generator knows the bits, evaluator gets keys */
-func (y vm) ShareTo1(bits int) []gc.Key {
+func (y *vm) ShareTo1(bits int) []gc.Key {
 	if bits > 64 {
 		panic("BT: bits > 64")
 	}
@@ -8,7 +8,7 @@ import (
 	"github.com/tjim/smpcc/runtime/gc/yaor/gen"
 )
 
-func pairVM(id gc.ConcurrentId) (basegen.VM, baseeval.VM) {
+func pairVM(id gc.ConcurrentId, s *basegen.Session) (basegen.VM, baseeval.VM) {
 	io := gc.NewChanio()
 	gchan := make(chan basegen.IOX, 1)
 	echan := make(chan baseeval.IOX, 1)
@@ -20,14 +20,15 @@ func pairVM(id gc.ConcurrentId) (basegen.VM, baseeval.VM) {
 	}()
 	gio := <-gchan
 	eio := <-echan
-	return gen.NewVM(&gio, id), eval.NewVM(&eio, id)
+	return gen.NewVM(&gio, id, s), eval.NewVM(&eio, id)
 }
 
 func VMs(n int) ([]basegen.VM, []baseeval.VM) {
 	result1 := make([]basegen.VM, n)
 	result2 := make([]baseeval.VM, n)
+	s := basegen.NewSession()
 	for i := 0; i < n; i++ {
-		gio, eio := pairVM(gc.ConcurrentId(i))
+		gio, eio := pairVM(gc.ConcurrentId(i), s)
 		result1[i] = gio
 		result2[i] = eio
 	}
@@ -0,0 +1,268 @@
+package gmw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+/* What a program costs party 0, for a block, an iteration or in total */
+type CostCounts struct {
+	Triples     int `json:"triples"`      /* bits of multiplication triples used */
+	MaskTriples int `json:"mask_triples"` /* MaskTriple32s used */
+	Opens       int `json:"opens"`        /* Open calls, each a round */
+	OpenBits    int `json:"open_bits"`
+	Bytes       int `json:"bytes"` /* sent and received by party 0 */
+}
+
+func (c *CostCounts) add(d CostCounts) {
+	c.Triples += d.Triples
+	c.MaskTriples += d.MaskTriples
+	c.Opens += d.Opens
+	c.OpenBits += d.OpenBits
+	c.Bytes += d.Bytes
+}
+
+type CostBlock struct {
+	Name       string       `json:"name"`
+	Total      CostCounts   `json:"total"`
+	Iterations []CostCounts `json:"iterations"`
+}
+
+type CostReport struct {
+	mu           sync.Mutex
+	newIteration bool
+	Iterations   int          `json:"iterations"`
+	Blocks       []*CostBlock `json:"blocks"`
+	Total        CostCounts   `json:"total"`
+	Rounds       int          `json:"rounds"` /* opens of the main loop, plus the most of any block in each iteration */
+}
+
+/*
+An Io that counts what party 0 does, for cost analysis.  Like the
+garbled circuit cost VMs (see gen.NewCostVMs) the counts are kept for
+the main loop, "main", and each block, and for each iteration of the
+main loop; an iteration begins when a block runs after the main loop
+has opened something.
+
+Every value sent on a channel is a uint32, so a 64-bit value counts
+as 8 bytes and anything smaller as 4.
+*/
+type costIo struct {
+	Io
+	r     *CostReport
+	block int
+}
+
+/* Counting Ios wrapping party 0's io and ios, and their report */
+func NewCostIos(io Io, ios []Io) (Io, []Io, *CostReport) {
+	r := &CostReport{newIteration: true}
+	r.Blocks = append(r.Blocks, &CostBlock{Name: "main"})
+	cios := make([]Io, len(ios))
+	for i := range ios {
+		r.Blocks = append(r.Blocks, &CostBlock{Name: fmt.Sprintf("block%d", i)})
+		cios[i] = &costIo{ios[i], r, i + 1}
+	}
+	return &costIo{io, r, 0}, cios, r
+}
+
+func (x *costIo) count(f func(c *CostCounts)) {
+	r := x.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if x.block > 0 && r.newIteration {
+		r.Iterations++
+		r.newIteration = false
+	}
+	b := r.Blocks[x.block]
+	for len(b.Iterations) <= r.Iterations {
+		b.Iterations = append(b.Iterations, CostCounts{})
+	}
+	f(&b.Iterations[r.Iterations])
+}
+
+func costBytes(bits int) int {
+	if bits > 32 {
+		return 8
+	}
+	return 4
+}
+
+/* An open by the main loop ends the iteration */
+func (x *costIo) open(bits int) {
+	x.count(func(c *CostCounts) {
+		c.Opens++
+		c.OpenBits += bits
+		c.Bytes += 2 * (x.N() - 1) * costBytes(bits)
+	})
+	if x.block == 0 {
+		x.r.mu.Lock()
+		x.r.newIteration = true
+		x.r.mu.Unlock()
+	}
+}
+
+func (x *costIo) Open1(s bool) bool {
+	x.open(1)
+	return x.Io.Open1(s)
+}
+
+func (x *costIo) Open8(s uint8) uint8 {
+	x.open(8)
+	return x.Io.Open8(s)
+}
+
+func (x *costIo) Open32(s uint32) uint32 {
+	x.open(32)
+	return x.Io.Open32(s)
+}
+
+func (x *costIo) Open64(s uint64) uint64 {
+	x.open(64)
+	return x.Io.Open64(s)
+}
+
+func (x *costIo) transfer(bits int) {
+	x.count(func(c *CostCounts) { c.Bytes += costBytes(bits) })
+}
+
+func (x *costIo) Send1(party int, n bool) {
+	x.transfer(1)
+	x.Io.Send1(party, n)
+}
+
+func (x *costIo) Send8(party int, n uint8) {
+	x.transfer(8)
+	x.Io.Send8(party, n)
+}
+
+func (x *costIo) Send32(party int, n uint32) {
+	x.transfer(32)
+	x.Io.Send32(party, n)
+}
+
+func (x *costIo) Send64(party int, n uint64) {
+	x.transfer(64)
+	x.Io.Send64(party, n)
+}
+
+func (x *costIo) Receive1(party int) bool {
+	x.transfer(1)
+	return x.Io.Receive1(party)
+}
+
+func (x *costIo) Receive8(party int) uint8 {
+	x.transfer(8)
+	return x.Io.Receive8(party)
+}
+
+func (x *costIo) Receive32(party int) uint32 {
+	x.transfer(32)
+	return x.Io.Receive32(party)
+}
+
+func (x *costIo) Receive64(party int) uint64 {
+	x.transfer(64)
+	return x.Io.Receive64(party)
+}
+
+func (x *costIo) Triple1() (a, b, c bool) {
+	x.count(func(c *CostCounts) { c.Triples += 1 })
+	return x.Io.Triple1()
+}
+
+func (x *costIo) Triple8() (a, b, c uint8) {
+	x.count(func(c *CostCounts) { c.Triples += 8 })
+	return x.Io.Triple8()
+}
+
+func (x *costIo) Triple32() (a, b, c uint32) {
+	x.count(func(c *CostCounts) { c.Triples += 32 })
+	return x.Io.Triple32()
+}
+
+func (x *costIo) Triple64() (a, b, c uint64) {
+	x.count(func(c *CostCounts) { c.Triples += 64 })
+	return x.Io.Triple64()
+}
+
+func (x *costIo) MaskTriple32() (a byte, b, c uint32) {
+	x.count(func(c *CostCounts) { c.MaskTriples++ })
+	return x.Io.MaskTriple32()
+}
+
+/* Fill in the totals and rounds; the Ios must be finished */
+func (r *CostReport) total() {
+	r.Total = CostCounts{}
+	for _, b := range r.Blocks {
+		b.Total = CostCounts{}
+		for _, c := range b.Iterations {
+			b.Total.add(c)
+		}
+		r.Total.add(b.Total)
+	}
+	r.Rounds = r.Blocks[0].Total.Opens
+	for i := 0; i <= r.Iterations; i++ {
+		most := 0
+		for _, b := range r.Blocks[1:] {
+			if i < len(b.Iterations) && b.Iterations[i].Opens > most {
+				most = b.Iterations[i].Opens
+			}
+		}
+		r.Rounds += most
+	}
+}
+
+func costRow(w io.Writer, name string, c CostCounts) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t\n", name, c.Triples, c.MaskTriples, c.Opens, c.OpenBits, c.Bytes)
+}
+
+func (r *CostReport) Write(w io.Writer) error {
+	r.total()
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\ttriples\tmask triples\topens\topen bits\tbytes\t\n")
+	for _, b := range r.Blocks {
+		costRow(tw, b.Name, b.Total)
+	}
+	costRow(tw, "total", r.Total)
+	fmt.Fprintf(tw, "\t\t\t\t\t\t\n")
+	for i := 0; i <= r.Iterations; i++ {
+		var c CostCounts
+		for _, b := range r.Blocks {
+			if i < len(b.Iterations) {
+				c.add(b.Iterations[i])
+			}
+		}
+		costRow(tw, fmt.Sprintf("iteration %d", i), c)
+	}
+	fmt.Fprintf(tw, "\t\t\t\t\t\t\n")
+	fmt.Fprintf(tw, "rounds\t%d\t\t\t\t\t\n", r.Rounds)
+	return tw.Flush()
+}
+
+func (r *CostReport) WriteJSON(w io.Writer) error {
+	r.total()
+	return json.NewEncoder(w).Encode(r)
+}
+
+/* Write the report as text, or as JSON if name ends in .json */
+func (r *CostReport) WriteFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(name, ".json") {
+		err = r.WriteJSON(f)
+	} else {
+		err = r.Write(f)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
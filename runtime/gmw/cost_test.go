@@ -0,0 +1,62 @@
+package gmw
+
+import (
+	"sync"
+	"testing"
+)
+
+/*
+The counts of party 0 of 3 for a main loop that adds two bytes and
+reveals the sum, after which two blocks run an AND each, and the main
+loop reveals a bit
+*/
+func TestCost(t *testing.T) {
+	var r *CostReport
+	var mu sync.Mutex
+	Simulation([]uint32{0, 0, 0}, 2, func(io Io, ios []Io) {
+		if io.Id() == 0 {
+			var cr *CostReport
+			io, ios, cr = NewCostIos(io, ios)
+			mu.Lock()
+			r = cr
+			mu.Unlock()
+		}
+		if sum := Reveal8(io, Add8(io, Uint8(io, 100), Uint8(io, 200))); sum != 44 {
+			t.Errorf("100 + 200 = %d", sum)
+		}
+		done := make(chan bool)
+		go func() {
+			And32(ios[0], Uint32(ios[0], 3), Uint32(ios[0], 5))
+			done <- true
+		}()
+		And64(ios[1], Uint64(ios[1], 3), Uint64(ios[1], 5))
+		<-done
+		Reveal1(io, false)
+	})
+	r.total()
+	/* an n-bit Add is n ANDs of a bit, the last carry included, of two opens each */
+	want := []struct {
+		block, iteration int
+		c                CostCounts
+	}{
+		{0, 0, CostCounts{Triples: 8, Opens: 17, OpenBits: 24, Bytes: 16*2*2*4 + 2*2*4}},
+		{0, 1, CostCounts{Opens: 1, OpenBits: 1, Bytes: 2 * 2 * 4}},
+		{1, 1, CostCounts{Triples: 32, Opens: 2, OpenBits: 64, Bytes: 2 * 2 * 2 * 4}},
+		{2, 1, CostCounts{Triples: 64, Opens: 2, OpenBits: 128, Bytes: 2 * 2 * 2 * 8}},
+	}
+	if r.Iterations != 1 {
+		t.Fatalf("%d iterations after the first, want 1", r.Iterations)
+	}
+	for _, w := range want {
+		b := r.Blocks[w.block]
+		if w.iteration >= len(b.Iterations) {
+			t.Errorf("%s has no iteration %d", b.Name, w.iteration)
+		} else if c := b.Iterations[w.iteration]; c != w.c {
+			t.Errorf("%s, iteration %d: got %+v, want %+v", b.Name, w.iteration, c, w.c)
+		}
+	}
+	/* the opens of the main loop, and both blocks at once */
+	if r.Rounds != 18+2 {
+		t.Errorf("%d rounds, want 20", r.Rounds)
+	}
+}
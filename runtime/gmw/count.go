@@ -0,0 +1,100 @@
+package gmw
+
+/*
+Bit counting on shares, a word at a time, as in the usual SWAR
+popcount: the counts in adjacent fields are summed in parallel,
+doubling the width of the fields at each step.  Each sum is a ripple of
+one And64 per bit of the counts, so a 64-bit popcount takes 21 rounds,
+where a chain of 64 additions of bits takes about 2000.
+*/
+
+/* The sums of the t-bit values of a and b in the fields whose low bits are set in low, as t+1 bits */
+func addFields64(io Io, a, b uint64, t uint, low uint64) uint64 {
+	sum := uint64(0)
+	c := uint64(0)
+	for j := uint(0); j < t; j++ {
+		aj := (a >> j) & low
+		bj := (b >> j) & low
+		sum |= (aj ^ bj ^ c) << j
+		c ^= And64(io, aj^c, bj^c) & low
+	}
+	return sum | c<<t
+}
+
+/* The number of set bits of the n-bit a */
+func popcount64(io Io, a uint64, n uint) uint64 {
+	a &= low64(n)
+	t := uint(1)
+	for s := uint(1); s < n; s *= 2 {
+		m := ^uint64(0) / (1<<s + 1) /* the low s bits of each field of 2s bits */
+		a = addFields64(io, a&m, (a>>s)&m, t, m&^(m<<1))
+		t++
+	}
+	return a
+}
+
+/* The number of leading zeros of the n-bit a, as the number of zeros in the ORs of a's bits and those above */
+func ctlz64(io Io, a uint64, n uint) uint64 {
+	p := a & low64(n)
+	for s := uint(1); s < n; s *= 2 {
+		p = Or64(io, p, p>>s)
+	}
+	return popcount64(io, Not64(io, p), n)
+}
+
+func cttz64(io Io, a uint64, n uint) uint64 {
+	p := a & low64(n)
+	for s := uint(1); s < n; s *= 2 {
+		p = Or64(io, p, p<<s) & low64(n)
+	}
+	return popcount64(io, Not64(io, p), n)
+}
+
+func Popcount8(io Io, a uint8) uint8 {
+	return uint8(popcount64(io, uint64(a), 8))
+}
+
+func Popcount32(io Io, a uint32) uint32 {
+	return uint32(popcount64(io, uint64(a), 32))
+}
+
+func Popcount64(io Io, a uint64) uint64 {
+	return popcount64(io, a, 64)
+}
+
+func HammingDistance8(io Io, a, b uint8) uint8 {
+	return Popcount8(io, a^b)
+}
+
+func HammingDistance32(io Io, a, b uint32) uint32 {
+	return Popcount32(io, a^b)
+}
+
+func HammingDistance64(io Io, a, b uint64) uint64 {
+	return Popcount64(io, a^b)
+}
+
+/* Ctlz and Cttz of 0 give the width */
+func Ctlz8(io Io, a uint8) uint8 {
+	return uint8(ctlz64(io, uint64(a), 8))
+}
+
+func Ctlz32(io Io, a uint32) uint32 {
+	return uint32(ctlz64(io, uint64(a), 32))
+}
+
+func Ctlz64(io Io, a uint64) uint64 {
+	return ctlz64(io, a, 64)
+}
+
+func Cttz8(io Io, a uint8) uint8 {
+	return uint8(cttz64(io, uint64(a), 8))
+}
+
+func Cttz32(io Io, a uint32) uint32 {
+	return uint32(cttz64(io, uint64(a), 32))
+}
+
+func Cttz64(io Io, a uint64) uint64 {
+	return cttz64(io, a, 64)
+}
@@ -0,0 +1,57 @@
+package gmw
+
+import (
+	"math/bits"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	xs := []uint64{0, 1, 1 << 63, ^uint64(0), 0x8000000080000000, 0x00ff00ff00ff0000}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 8; i++ {
+		xs = append(xs, rnd.Uint64(), rnd.Uint64()>>uint(rnd.Intn(64)))
+	}
+	var mu sync.Mutex
+	Simulation([]uint32{0, 0, 0}, 0, func(io Io, _ []Io) {
+		errorf := func(format string, args ...interface{}) {
+			if io.Id() == 0 {
+				mu.Lock()
+				t.Errorf(format, args...)
+				mu.Unlock()
+			}
+		}
+		for i, x := range xs {
+			y := xs[(i+1)%len(xs)]
+			if r := Reveal64(io, Popcount64(io, Uint64(io, x))); r != uint64(bits.OnesCount64(x)) {
+				errorf("popcount %x: got %d", x, r)
+			}
+			if r := Reveal64(io, HammingDistance64(io, Uint64(io, x), Uint64(io, y))); r != uint64(bits.OnesCount64(x^y)) {
+				errorf("distance %x %x: got %d", x, y, r)
+			}
+			if r := Reveal64(io, Ctlz64(io, Uint64(io, x))); r != uint64(bits.LeadingZeros64(x)) {
+				errorf("ctlz %x: got %d", x, r)
+			}
+			if r := Reveal64(io, Cttz64(io, Uint64(io, x))); r != uint64(bits.TrailingZeros64(x)) {
+				errorf("cttz %x: got %d", x, r)
+			}
+			x32, x8 := uint32(x>>7), uint8(x>>13)
+			if r := Reveal32(io, Popcount32(io, Uint32(io, x32))); r != uint32(bits.OnesCount32(x32)) {
+				errorf("popcount %x: got %d", x32, r)
+			}
+			if r := Reveal32(io, Ctlz32(io, Uint32(io, x32))); r != uint32(bits.LeadingZeros32(x32)) {
+				errorf("ctlz %x: got %d", x32, r)
+			}
+			if r := Reveal32(io, Cttz32(io, Uint32(io, x32))); r != uint32(bits.TrailingZeros32(x32)) {
+				errorf("cttz %x: got %d", x32, r)
+			}
+			if r := Reveal8(io, Ctlz8(io, Uint8(io, x8))); r != uint8(bits.LeadingZeros8(x8)) {
+				errorf("ctlz %x: got %d", x8, r)
+			}
+			if r := Reveal8(io, Cttz8(io, Uint8(io, x8))); r != uint8(bits.TrailingZeros8(x8)) {
+				errorf("cttz %x: got %d", x8, r)
+			}
+		}
+	})
+}
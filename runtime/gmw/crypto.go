@@ -0,0 +1,444 @@
+package gmw
+
+import (
+	"fmt"
+	"github.com/tjim/smpcc/runtime/base"
+	"math/bits"
+)
+
+/*
+AES, SHA-256, SHA-1 and ChaCha20 on shares of bytes, commented in
+gc/gen/crypto.go.  AES is bitsliced, so each AND of the S-box circuit
+is one And32 for all the bytes of the state; the hashes and ChaCha20
+are Add32 and And32 on words.
+*/
+
+/* The AES S-box on up to 32 bytes held bitsliced, bit k of x[i] bit i of byte k */
+func sbox32(io Io, x [8]uint32) [8]uint32 {
+	xor := func(a, b uint32) uint32 { return a ^ b }
+	and := func(a, b uint32) uint32 { return And32(io, a, b) }
+	xnor := func(a, b uint32) uint32 { return Not32(io, a^b) }
+	U0, U1, U2, U3, U4, U5, U6, U7 := x[7], x[6], x[5], x[4], x[3], x[2], x[1], x[0]
+	T1 := xor(U0, U3)
+	T2 := xor(U0, U5)
+	T3 := xor(U0, U6)
+	T4 := xor(U3, U5)
+	T5 := xor(U4, U6)
+	T6 := xor(T1, T5)
+	T7 := xor(U1, U2)
+	T8 := xor(U7, T6)
+	T9 := xor(U7, T7)
+	T10 := xor(T6, T7)
+	T11 := xor(U1, U5)
+	T12 := xor(U2, U5)
+	T13 := xor(T3, T4)
+	T14 := xor(T6, T11)
+	T15 := xor(T5, T11)
+	T16 := xor(T5, T12)
+	T17 := xor(T9, T16)
+	T18 := xor(U3, U7)
+	T19 := xor(T7, T18)
+	T20 := xor(T1, T19)
+	T21 := xor(U6, U7)
+	T22 := xor(T7, T21)
+	T23 := xor(T2, T22)
+	T24 := xor(T2, T10)
+	T25 := xor(T20, T17)
+	T26 := xor(T3, T16)
+	T27 := xor(T1, T12)
+	M1 := and(T13, T6)
+	M2 := and(T23, T8)
+	M3 := xor(T14, M1)
+	M4 := and(T19, U7)
+	M5 := xor(M4, M1)
+	M6 := and(T3, T16)
+	M7 := and(T22, T9)
+	M8 := xor(T26, M6)
+	M9 := and(T20, T17)
+	M10 := xor(M9, M6)
+	M11 := and(T1, T15)
+	M12 := and(T4, T27)
+	M13 := xor(M12, M11)
+	M14 := and(T2, T10)
+	M15 := xor(M14, M11)
+	M16 := xor(M3, M2)
+	M17 := xor(M5, T24)
+	M18 := xor(M8, M7)
+	M19 := xor(M10, M15)
+	M20 := xor(M16, M13)
+	M21 := xor(M17, M15)
+	M22 := xor(M18, M13)
+	M23 := xor(M19, T25)
+	M24 := xor(M22, M23)
+	M25 := and(M22, M20)
+	M26 := xor(M21, M25)
+	M27 := xor(M20, M21)
+	M28 := xor(M23, M25)
+	M29 := and(M28, M27)
+	M30 := and(M26, M24)
+	M31 := and(M20, M23)
+	M32 := and(M27, M31)
+	M33 := xor(M27, M25)
+	M34 := and(M21, M22)
+	M35 := and(M24, M34)
+	M36 := xor(M24, M25)
+	M37 := xor(M21, M29)
+	M38 := xor(M32, M33)
+	M39 := xor(M23, M30)
+	M40 := xor(M35, M36)
+	M41 := xor(M38, M40)
+	M42 := xor(M37, M39)
+	M43 := xor(M37, M38)
+	M44 := xor(M39, M40)
+	M45 := xor(M42, M41)
+	M46 := and(M44, T6)
+	M47 := and(M40, T8)
+	M48 := and(M39, U7)
+	M49 := and(M43, T16)
+	M50 := and(M38, T9)
+	M51 := and(M37, T17)
+	M52 := and(M42, T15)
+	M53 := and(M45, T27)
+	M54 := and(M41, T10)
+	M55 := and(M44, T13)
+	M56 := and(M40, T23)
+	M57 := and(M39, T19)
+	M58 := and(M43, T3)
+	M59 := and(M38, T22)
+	M60 := and(M37, T20)
+	M61 := and(M42, T1)
+	M62 := and(M45, T4)
+	M63 := and(M41, T2)
+	L0 := xor(M61, M62)
+	L1 := xor(M50, M56)
+	L2 := xor(M46, M48)
+	L3 := xor(M47, M55)
+	L4 := xor(M54, M58)
+	L5 := xor(M49, M61)
+	L6 := xor(M62, L5)
+	L7 := xor(M46, L3)
+	L8 := xor(M51, M59)
+	L9 := xor(M52, M53)
+	L10 := xor(M53, L4)
+	L11 := xor(M60, L2)
+	L12 := xor(M48, M51)
+	L13 := xor(M50, L0)
+	L14 := xor(M52, M61)
+	L15 := xor(M55, L1)
+	L16 := xor(M56, L0)
+	L17 := xor(M57, L1)
+	L18 := xor(M58, L8)
+	L19 := xor(M63, L4)
+	L20 := xor(L0, L1)
+	L21 := xor(L1, L7)
+	L22 := xor(L3, L12)
+	L23 := xor(L18, L2)
+	L24 := xor(L15, L9)
+	L25 := xor(L6, L10)
+	L26 := xor(L7, L9)
+	L27 := xor(L8, L10)
+	L28 := xor(L11, L14)
+	L29 := xor(L11, L17)
+	S0 := xor(L6, L24)
+	S1 := xnor(L16, L26)
+	S2 := xnor(L19, L28)
+	S3 := xor(L6, L21)
+	S4 := xor(L20, L22)
+	S5 := xor(L25, L29)
+	S6 := xnor(L13, L27)
+	S7 := xnor(L6, L23)
+	return [8]uint32{S7, S6, S5, S4, S3, S2, S1, S0}
+}
+
+func subBytes(io Io, bs []uint8) []uint8 {
+	var x [8]uint32
+	for k, b := range bs {
+		for i := range x {
+			x[i] |= uint32(b>>uint(i)&1) << uint(k)
+		}
+	}
+	y := sbox32(io, x)
+	result := make([]uint8, len(bs))
+	for k := range result {
+		for i := range y {
+			result[k] |= uint8(y[i]>>uint(k)&1) << uint(i)
+		}
+	}
+	return result
+}
+
+/* Multiplication by x is linear, so each party applies it to its share */
+func xtime(b uint8) uint8 {
+	return b<<1 ^ (b>>7)*0x1b
+}
+
+func mixColumns(s []uint8) []uint8 {
+	result := make([]uint8, 16)
+	for c := 0; c < 16; c += 4 {
+		a := s[c : c+4]
+		all := a[0] ^ a[1] ^ a[2] ^ a[3]
+		for i := range a {
+			result[c+i] = a[i] ^ all ^ xtime(a[i]^a[(i+1)%4])
+		}
+	}
+	return result
+}
+
+func expandKey(io Io, key []uint8) []uint8 {
+	nk := len(key) / 4
+	nr := nk + 6
+	w := append([]uint8{}, key...)
+	rcon := uint8(1)
+	for i := nk; i < 4*(nr+1); i++ {
+		t := w[4*i-4 : 4*i]
+		if i%nk == 0 {
+			t = subBytes(io, []uint8{t[1], t[2], t[3], t[0]})
+			t[0] ^= Uint8(io, rcon)
+			rcon = xtime(rcon)
+		} else if nk > 6 && i%nk == 4 {
+			t = subBytes(io, t)
+		}
+		for j := range t {
+			w = append(w, w[4*(i-nk)+j]^t[j])
+		}
+	}
+	return w
+}
+
+func aesEncrypt(io Io, key, block []uint8, op string) []uint8 {
+	if len(block) != 16 {
+		panic(fmt.Sprintf("%s: block of %d bytes", op, len(block)))
+	}
+	nr := len(key)/4 + 6
+	w := expandKey(io, key)
+	s := make([]uint8, 16)
+	for k := range s {
+		s[k] = block[k] ^ w[k]
+	}
+	for r := 1; r <= nr; r++ {
+		s = subBytes(io, s)
+		t := make([]uint8, 16)
+		for k := range t {
+			t[k] = s[(k+4*(k%4))%16]
+		}
+		if r < nr {
+			t = mixColumns(t)
+		}
+		for k := range t {
+			t[k] ^= w[16*r+k]
+		}
+		s = t
+	}
+	return s
+}
+
+func AES128(io Io, key, block []uint8) []uint8 {
+	if len(key) != 16 {
+		panic(fmt.Sprintf("AES128: key of %d bytes", len(key)))
+	}
+	return aesEncrypt(io, key, block, "AES128")
+}
+
+func AES256(io Io, key, block []uint8) []uint8 {
+	if len(key) != 32 {
+		panic(fmt.Sprintf("AES256: key of %d bytes", len(key)))
+	}
+	return aesEncrypt(io, key, block, "AES256")
+}
+
+func beWord(bs []uint8) uint32 {
+	return uint32(bs[0])<<24 | uint32(bs[1])<<16 | uint32(bs[2])<<8 | uint32(bs[3])
+}
+
+func shaPadded(io Io, msg []uint8) []uint8 {
+	bs := append([]uint8{}, msg...)
+	for _, p := range base.SHAPadding(len(msg)) {
+		bs = append(bs, Uint8(io, p))
+	}
+	return bs
+}
+
+func shaDigest(h []uint32) []uint8 {
+	var result []uint8
+	for _, w := range h {
+		result = append(result, uint8(w>>24), uint8(w>>16), uint8(w>>8), uint8(w))
+	}
+	return result
+}
+
+func sha256Block(io Io, h []uint32, block []uint8) []uint32 {
+	w := make([]uint32, 64)
+	for t := 0; t < 16; t++ {
+		w[t] = beWord(block[4*t : 4*t+4])
+	}
+	for t := 16; t < 64; t++ {
+		s0 := bits.RotateLeft32(w[t-15], -7) ^ bits.RotateLeft32(w[t-15], -18) ^ w[t-15]>>3
+		s1 := bits.RotateLeft32(w[t-2], -17) ^ bits.RotateLeft32(w[t-2], -19) ^ w[t-2]>>10
+		w[t] = Add32(io, Add32(io, w[t-16], s0), Add32(io, w[t-7], s1))
+	}
+	a, b, c, d, e, f, g, hh := h[0], h[1], h[2], h[3], h[4], h[5], h[6], h[7]
+	for t := 0; t < 64; t++ {
+		s1 := bits.RotateLeft32(e, -6) ^ bits.RotateLeft32(e, -11) ^ bits.RotateLeft32(e, -25)
+		ch := g ^ And32(io, e, f^g)
+		t1 := Add32(io, Add32(io, hh, s1), Add32(io, Add32(io, ch, Uint32(io, base.SHA256K[t])), w[t]))
+		s0 := bits.RotateLeft32(a, -2) ^ bits.RotateLeft32(a, -13) ^ bits.RotateLeft32(a, -22)
+		maj := a ^ And32(io, a^b, a^c)
+		t2 := Add32(io, s0, maj)
+		hh, g, f, e, d, c, b, a = g, f, e, Add32(io, d, t1), c, b, a, Add32(io, t1, t2)
+	}
+	result := make([]uint32, 8)
+	for i, x := range []uint32{a, b, c, d, e, f, g, hh} {
+		result[i] = Add32(io, h[i], x)
+	}
+	return result
+}
+
+/* The SHA-256 digest of msg, whose length is public */
+func SHA256(io Io, msg []uint8) []uint8 {
+	bs := shaPadded(io, msg)
+	h := make([]uint32, 8)
+	for i := range h {
+		h[i] = Uint32(io, base.SHA256H[i])
+	}
+	for i := 0; i < len(bs); i += 64 {
+		h = sha256Block(io, h, bs[i:i+64])
+	}
+	return shaDigest(h)
+}
+
+func sha1Block(io Io, h []uint32, block []uint8) []uint32 {
+	w := make([]uint32, 80)
+	for t := 0; t < 16; t++ {
+		w[t] = beWord(block[4*t : 4*t+4])
+	}
+	for t := 16; t < 80; t++ {
+		w[t] = bits.RotateLeft32(w[t-3]^w[t-8]^w[t-14]^w[t-16], 1)
+	}
+	a, b, c, d, e := h[0], h[1], h[2], h[3], h[4]
+	for t := 0; t < 80; t++ {
+		var f uint32
+		switch t / 20 {
+		case 0:
+			f = d ^ And32(io, b, c^d)
+		case 2:
+			f = b ^ And32(io, b^c, b^d)
+		default:
+			f = b ^ c ^ d
+		}
+		k := Uint32(io, base.SHA1K[t/20])
+		x := Add32(io, Add32(io, bits.RotateLeft32(a, 5), f), Add32(io, Add32(io, e, k), w[t]))
+		e, d, c, b, a = d, c, bits.RotateLeft32(b, 30), a, x
+	}
+	result := make([]uint32, 5)
+	for i, x := range []uint32{a, b, c, d, e} {
+		result[i] = Add32(io, h[i], x)
+	}
+	return result
+}
+
+func SHA1(io Io, msg []uint8) []uint8 {
+	bs := shaPadded(io, msg)
+	h := make([]uint32, 5)
+	for i := range h {
+		h[i] = Uint32(io, base.SHA1H[i])
+	}
+	for i := 0; i < len(bs); i += 64 {
+		h = sha1Block(io, h, bs[i:i+64])
+	}
+	return shaDigest(h)
+}
+
+/* The little-endian word of 4 bytes */
+func leWord(bs []uint8) uint32 {
+	return uint32(bs[0]) | uint32(bs[1])<<8 | uint32(bs[2])<<16 | uint32(bs[3])<<24
+}
+
+/* The ChaCha20 block function of RFC 8439 */
+func ChaCha20Block(io Io, key []uint8, counter uint32, nonce []uint8) []uint8 {
+	if len(key) != 32 || len(nonce) != 12 {
+		panic(fmt.Sprintf("ChaCha20Block: key of %d bytes, nonce of %d", len(key), len(nonce)))
+	}
+	var s [16]uint32
+	for i := 0; i < 4; i++ {
+		s[i] = Uint32(io, base.ChaChaSigma[i])
+	}
+	for i := 0; i < 8; i++ {
+		s[4+i] = leWord(key[4*i : 4*i+4])
+	}
+	s[12] = counter
+	for i := 0; i < 3; i++ {
+		s[13+i] = leWord(nonce[4*i : 4*i+4])
+	}
+	x := s
+	qr := func(a, b, c, d int) {
+		x[a] = Add32(io, x[a], x[b])
+		x[d] = bits.RotateLeft32(x[d]^x[a], 16)
+		x[c] = Add32(io, x[c], x[d])
+		x[b] = bits.RotateLeft32(x[b]^x[c], 12)
+		x[a] = Add32(io, x[a], x[b])
+		x[d] = bits.RotateLeft32(x[d]^x[a], 8)
+		x[c] = Add32(io, x[c], x[d])
+		x[b] = bits.RotateLeft32(x[b]^x[c], 7)
+	}
+	for i := 0; i < 10; i++ {
+		qr(0, 4, 8, 12)
+		qr(1, 5, 9, 13)
+		qr(2, 6, 10, 14)
+		qr(3, 7, 11, 15)
+		qr(0, 5, 10, 15)
+		qr(1, 6, 11, 12)
+		qr(2, 7, 8, 13)
+		qr(3, 4, 9, 14)
+	}
+	var result []uint8
+	for i := range x {
+		y := Add32(io, x[i], s[i])
+		result = append(result, uint8(y), uint8(y>>8), uint8(y>>16), uint8(y>>24))
+	}
+	return result
+}
+
+/* The n shares of bytes at loc; the address is public, as for Load */
+func loadBytes(io Io, loc uint64, n int) []uint8 {
+	address := int(Reveal64(io, loc))
+	return append([]uint8{}, io.Ram()[address:address+n]...)
+}
+
+func storeBytes(io Io, loc uint64, bs []uint8) {
+	address := int(Reveal64(io, loc))
+	copy(io.Ram()[address:], bs)
+}
+
+/*
+The forms for C, which do nothing unless mask is true.  Memory is
+shared, so only the addresses are revealed.
+*/
+func AES128Memory(io Io, mask bool, out, key, in uint64) {
+	if io.Open1(mask) {
+		storeBytes(io, out, AES128(io, loadBytes(io, key, 16), loadBytes(io, in, 16)))
+	}
+}
+
+func AES256Memory(io Io, mask bool, out, key, in uint64) {
+	if io.Open1(mask) {
+		storeBytes(io, out, AES256(io, loadBytes(io, key, 32), loadBytes(io, in, 16)))
+	}
+}
+
+func SHA256Memory(io Io, mask bool, out, msg uint64, n int) {
+	if io.Open1(mask) {
+		storeBytes(io, out, SHA256(io, loadBytes(io, msg, n)))
+	}
+}
+
+func SHA1Memory(io Io, mask bool, out, msg uint64, n int) {
+	if io.Open1(mask) {
+		storeBytes(io, out, SHA1(io, loadBytes(io, msg, n)))
+	}
+}
+
+func ChaCha20Memory(io Io, mask bool, out, key uint64, counter uint32, nonce uint64) {
+	if io.Open1(mask) {
+		storeBytes(io, out, ChaCha20Block(io, loadBytes(io, key, 32), counter, loadBytes(io, nonce, 12)))
+	}
+}
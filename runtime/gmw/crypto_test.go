@@ -0,0 +1,74 @@
+package gmw
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestCrypto(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rnd.Read(b)
+		return b
+	}
+	key128, key256, block, msg := random(16), random(32), random(16), random(56)
+	want128 := make([]byte, 16)
+	c, _ := aes.NewCipher(key128)
+	c.Encrypt(want128, block)
+	want256 := make([]byte, 16)
+	c, _ = aes.NewCipher(key256)
+	c.Encrypt(want256, block)
+	wantSHA256 := sha256.Sum256(msg)
+	wantSHA1 := sha1.Sum(msg)
+	/* the test vector of RFC 8439, 2.3.2 */
+	chachaKey, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	nonce, _ := hex.DecodeString("000000090000004a00000000")
+	wantChaCha, _ := hex.DecodeString("10f1e7e4d13b5915500fdd1fa32071c4c7d1f4c733c068030422aa9ac3d46c4e" +
+		"d2826446079faa0914c2d705d98b02a2b5129cd1de164eb9cbd083e8a2503c4e")
+	var mu sync.Mutex
+	Simulation([]uint32{0, 0, 0}, 0, func(io Io, _ []Io) {
+		errorf := func(format string, args ...interface{}) {
+			if io.Id() == 0 {
+				mu.Lock()
+				t.Errorf(format, args...)
+				mu.Unlock()
+			}
+		}
+		share := func(b []byte) []uint8 {
+			result := make([]uint8, len(b))
+			for i := range b {
+				result[i] = Uint8(io, b[i])
+			}
+			return result
+		}
+		reveal := func(s []uint8) []byte {
+			result := make([]byte, len(s))
+			for i := range s {
+				result[i] = Reveal8(io, s[i])
+			}
+			return result
+		}
+		if got := reveal(AES128(io, share(key128), share(block))); !bytes.Equal(got, want128) {
+			errorf("AES-128: got %x, want %x", got, want128)
+		}
+		if got := reveal(AES256(io, share(key256), share(block))); !bytes.Equal(got, want256) {
+			errorf("AES-256: got %x, want %x", got, want256)
+		}
+		if got := reveal(SHA256(io, share(msg))); !bytes.Equal(got, wantSHA256[:]) {
+			errorf("SHA-256: got %x, want %x", got, wantSHA256)
+		}
+		if got := reveal(SHA1(io, share(msg))); !bytes.Equal(got, wantSHA1[:]) {
+			errorf("SHA-1: got %x, want %x", got, wantSHA1)
+		}
+		if got := reveal(ChaCha20Block(io, share(chachaKey), Uint32(io, 1), share(nonce))); !bytes.Equal(got, wantChaCha) {
+			errorf("ChaCha20: got %x, want %x", got, wantChaCha)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package gmw
+
+import (
+	"fmt"
+	"github.com/tjim/smpcc/runtime/base"
+	"math"
+)
+
+/*
+Fixed point on shares, as in gc/gen/fixed.go, and giving the same
+results: a signed n-bit value a stands for a/2^frac, with frac between
+1 and n/2.  The cores below take n-bit values in uint64s, and work on
+magnitudes where the gc versions widen, since a uint64 has no room for
+the wider values.
+*/
+
+func checkFrac(op string, n, frac uint) {
+	if frac < 1 || frac > n/2 {
+		panic(fmt.Sprintf("%s: fractional width %d of a %d-bit value", op, frac, n))
+	}
+}
+
+/* c in fixed point, rounded, sign-extended to 64 bits */
+func fixConst(io Io, c float64, frac uint) uint64 {
+	return Uint64(io, uint64(int64(math.Floor(math.Ldexp(c, int(frac))+0.5))))
+}
+
+/* The n-bit a sign-extended to 64 bits */
+func sext64(io Io, a uint64, n uint) uint64 {
+	if n == 64 {
+		return a
+	}
+	a &= low64(n)
+	return a ^ Mask64(io, (a>>(n-1))&1 > 0, Uint64(io, ^low64(n)))
+}
+
+func neg64(io Io, a uint64) uint64 {
+	return Sub64(io, Uint64(io, 0), a)
+}
+
+/*
+The product of a and b shifted right by frac, the magnitude of the
+product having pos added first if it is positive, or neg if negative.
+*/
+func fixProduct(io Io, a, b uint64, n, frac uint, pos, neg uint64) uint64 {
+	a, b = sext64(io, a, n), sext64(io, b, n)
+	s := xor((a>>63)&1 > 0, (b>>63)&1 > 0)
+	/* magnitudes are at most 2^(n-1), so mulWide64 does not overflow */
+	hi, lo := mulWide64(io, abs64(io, a), abs64(io, b), n)
+	add := Select64(io, s, Uint64(io, neg), Uint64(io, pos))
+	sum := Add64(io, lo, add)
+	var c uint64
+	if n < 64 {
+		c = (sum >> n) & 1
+	} else {
+		c = bit64(Icmp_ult64(io, sum, add), 0)
+	}
+	hi = Add64(io, hi, c)
+	q := (hi<<(n-frac) | (sum&low64(n))>>frac) & low64(n)
+	return Select64(io, s, neg64(io, q), q) & low64(n)
+}
+
+/* truncating toward negative infinity */
+func fixMul(io Io, a, b uint64, n, frac uint) uint64 {
+	return fixProduct(io, a, b, n, frac, 0, 1<<frac-1)
+}
+
+/* rounding to nearest, and halves up */
+func fixMulRound(io Io, a, b uint64, n, frac uint) uint64 {
+	return fixProduct(io, a, b, n, frac, 1<<(frac-1), 1<<(frac-1)-1)
+}
+
+/* a/b, truncated toward zero, by restoring division of the n+frac bits of |a|<<frac */
+func fixDiv(io Io, a, b uint64, n, frac uint) uint64 {
+	a, b = sext64(io, a, n), sext64(io, b, n)
+	s := xor((a>>63)&1 > 0, (b>>63)&1 > 0)
+	x, d := abs64(io, a), abs64(io, b)
+	r := Uint64(io, 0)
+	q := Uint64(io, 0)
+	for i := n + frac; i > 0; i-- {
+		r <<= 1
+		if i-1 >= frac {
+			r |= (x >> (i - 1 - frac)) & 1
+		}
+		ge := Icmp_uge64(io, r, d)
+		r = Select64(io, ge, Sub64(io, r, d), r)
+		if i-1 < n {
+			q |= bit64(ge, i-1)
+		}
+	}
+	return Select64(io, s, neg64(io, q), q) & low64(n)
+}
+
+/* The integer square root of a<<frac, a bit at a time; negative a gives 0 */
+func fixSqrt(io Io, a uint64, n, frac uint) uint64 {
+	a &= low64(n)
+	bit := func(j uint) uint64 {
+		if j < frac {
+			return 0
+		}
+		return (a >> (j - frac)) & 1
+	}
+	h := (n + frac + 1) / 2
+	root := Uint64(io, 0)
+	rem := Uint64(io, 0)
+	for i := h; i > 0; i-- {
+		rem = rem<<2 | bit(2*i-1)<<1 | bit(2*i-2)
+		trial := root<<2 | Uint64(io, 1)
+		ge := Icmp_uge64(io, rem, trial)
+		rem = Select64(io, ge, Sub64(io, rem, trial), rem)
+		root = root<<1 | bit64(ge, 0)
+	}
+	return Select64(io, (a>>(n-1))&1 > 0, Uint64(io, 0), root)
+}
+
+/*
+e^a as in gc, but a is first clamped to [-(frac+2), n-1-frac], which
+leaves the result alone and keeps a log2 e within n bits.
+*/
+func fixExp(io Io, a uint64, n, frac uint) uint64 {
+	a = sext64(io, a, n)
+	hi := fixConst(io, float64(n-1-frac), frac)
+	lo := fixConst(io, -float64(frac+2), frac)
+	a = Select64(io, Icmp_sgt64(io, a, hi), hi, a)
+	a = Select64(io, Icmp_slt64(io, a, lo), lo, a)
+	y := sext64(io, fixProduct(io, a, Uint64(io, base.Log2E(n-2)), n, n-2, 0, 1<<(n-2)-1), n)
+	k := Ashr64(io, y, frac)
+	f := y & low64(frac)
+	terms := base.ExpTerms(frac)
+	p := fixConst(io, math.Pow(math.Ln2, float64(terms-1))/math.Gamma(float64(terms)), frac)
+	for j := terms - 2; j >= 0; j-- {
+		p = Add64(io, fixMul(io, p, f, n, frac), fixConst(io, math.Pow(math.Ln2, float64(j))/math.Gamma(float64(j+1)), frac))
+	}
+	r := Select64(io, (k>>63)&1 > 0, LshrV64(io, p, neg64(io, k)), ShlV64(io, p, k))
+	over := Icmp_sgt64(io, k, Uint64(io, uint64(n-2-frac)))
+	return Select64(io, over, Uint64(io, 1<<(n-1)-1), r) & low64(n)
+}
+
+/* ln a as in gc; a <= 0 gives the smallest value */
+func fixLog(io Io, a uint64, n, frac uint) uint64 {
+	a &= low64(n)
+	m, k := normalize64(io, a, Uint32(io, uint32(n-1-frac)), n)
+	m >>= n - 1 - frac
+	one := fixConst(io, 1, frac)
+	u := fixDiv(io, Sub64(io, m, one), Add64(io, m, one), n, frac)
+	u2 := fixMul(io, u, u, n, frac)
+	s := fixConst(io, 1.0/11, frac)
+	for j := 9; j >= 1; j -= 2 {
+		s = Add64(io, fixMul(io, s, u2, n, frac), fixConst(io, 1/float64(j), frac))
+	}
+	r := Add64(io, fixMul(io, s, u, n, frac)<<1, Mul64(io, sext64(io, uint64(k), 32), fixConst(io, math.Ln2, frac)))
+	positive := Icmp_sgt64(io, sext64(io, a, n), Uint64(io, 0))
+	return Select64(io, positive, r, Uint64(io, 1<<(n-1))) & low64(n)
+}
+
+func fixSigmoid(io Io, a uint64, n, frac uint) uint64 {
+	one := fixConst(io, 1, frac)
+	d := Add64(io, one, fixExp(io, neg64(io, a), n, frac)) & low64(n)
+	/* 1+e^-a overflows only when the result is 0 */
+	over := Icmp_slt64(io, sext64(io, d, n), one)
+	return Select64(io, over, Uint64(io, 0), fixDiv(io, one, d, n, frac))
+}
+
+func FixMul32(io Io, a, b uint32, frac uint) uint32 {
+	checkFrac("FixMul32", 32, frac)
+	return uint32(fixMul(io, uint64(a), uint64(b), 32, frac))
+}
+
+func FixMul64(io Io, a, b uint64, frac uint) uint64 {
+	checkFrac("FixMul64", 64, frac)
+	return fixMul(io, a, b, 64, frac)
+}
+
+func FixMulRound32(io Io, a, b uint32, frac uint) uint32 {
+	checkFrac("FixMulRound32", 32, frac)
+	return uint32(fixMulRound(io, uint64(a), uint64(b), 32, frac))
+}
+
+func FixMulRound64(io Io, a, b uint64, frac uint) uint64 {
+	checkFrac("FixMulRound64", 64, frac)
+	return fixMulRound(io, a, b, 64, frac)
+}
+
+func FixDiv32(io Io, a, b uint32, frac uint) uint32 {
+	checkFrac("FixDiv32", 32, frac)
+	return uint32(fixDiv(io, uint64(a), uint64(b), 32, frac))
+}
+
+func FixDiv64(io Io, a, b uint64, frac uint) uint64 {
+	checkFrac("FixDiv64", 64, frac)
+	return fixDiv(io, a, b, 64, frac)
+}
+
+func FixRecip32(io Io, a uint32, frac uint) uint32 {
+	checkFrac("FixRecip32", 32, frac)
+	return uint32(fixDiv(io, fixConst(io, 1, frac), uint64(a), 32, frac))
+}
+
+func FixRecip64(io Io, a uint64, frac uint) uint64 {
+	checkFrac("FixRecip64", 64, frac)
+	return fixDiv(io, fixConst(io, 1, frac), a, 64, frac)
+}
+
+func FixSqrt32(io Io, a uint32, frac uint) uint32 {
+	checkFrac("FixSqrt32", 32, frac)
+	return uint32(fixSqrt(io, uint64(a), 32, frac))
+}
+
+func FixSqrt64(io Io, a uint64, frac uint) uint64 {
+	checkFrac("FixSqrt64", 64, frac)
+	return fixSqrt(io, a, 64, frac)
+}
+
+func FixExp32(io Io, a uint32, frac uint) uint32 {
+	checkFrac("FixExp32", 32, frac)
+	return uint32(fixExp(io, uint64(a), 32, frac))
+}
+
+func FixExp64(io Io, a uint64, frac uint) uint64 {
+	checkFrac("FixExp64", 64, frac)
+	return fixExp(io, a, 64, frac)
+}
+
+func FixLog32(io Io, a uint32, frac uint) uint32 {
+	checkFrac("FixLog32", 32, frac)
+	return uint32(fixLog(io, uint64(a), 32, frac))
+}
+
+func FixLog64(io Io, a uint64, frac uint) uint64 {
+	checkFrac("FixLog64", 64, frac)
+	return fixLog(io, a, 64, frac)
+}
+
+func FixSigmoid32(io Io, a uint32, frac uint) uint32 {
+	checkFrac("FixSigmoid32", 32, frac)
+	return uint32(fixSigmoid(io, uint64(a), 32, frac))
+}
+
+func FixSigmoid64(io Io, a uint64, frac uint) uint64 {
+	checkFrac("FixSigmoid64", 64, frac)
+	return fixSigmoid(io, a, 64, frac)
+}
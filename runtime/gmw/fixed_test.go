@@ -0,0 +1,78 @@
+package gmw
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+/* The fixed-point operations on shares of 2 parties, 32 bits exactly where Go can say, and 64 within a tolerance */
+func TestFixed(t *testing.T) {
+	const frac = 16
+	const frac64 = 24
+	xs := []int64{0, 1, -1, 1 << frac, -3 << (frac - 1), 5<<frac + 123, -7<<frac - 4567, 655, 100 << frac}
+	var mu sync.Mutex
+	Simulation([]uint32{0, 0}, 0, func(io Io, _ []Io) {
+		errorf := func(format string, args ...interface{}) {
+			if io.Id() == 0 {
+				mu.Lock()
+				t.Errorf(format, args...)
+				mu.Unlock()
+			}
+		}
+		share := func(x int64) uint32 { return Uint32(io, uint32(x)) }
+		share64 := func(x int64) uint64 { return Uint64(io, uint64(x)) }
+		real64 := func(r uint64) float64 { return math.Ldexp(float64(int64(r)), -frac64) }
+		near := func(got, want, tol float64) bool { return math.Abs(got-want) <= tol*math.Ldexp(1, -frac64) }
+		/* the error of exp is relative: a few units of 2^-frac times the result, plus the last place */
+		exp := func(x64 int64) {
+			a := math.Ldexp(float64(x64), -frac64)
+			if r := real64(Reveal64(io, FixExp64(io, share64(x64), frac64))); !near(r, math.Exp(a), 1+6*math.Exp(a)) {
+				errorf("exp %g: got %g, want %g", a, r, math.Exp(a))
+			}
+		}
+		/* up to the largest result, 2^(62-frac64), where the error is largest */
+		for _, d := range []float64{0, 0.3, 1.7} {
+			exp(int64(math.Ldexp(float64(62-frac64)*math.Ln2-d, frac64)))
+		}
+		for i, x := range xs {
+			y := xs[(i*4+3)%len(xs)]/3 + 1
+			if p := x * y >> frac; p == int64(int32(p)) {
+				if r := int32(Reveal32(io, FixMul32(io, share(x), share(y), frac))); int64(r) != p {
+					errorf("%d * %d: got %d, want %d", x, y, r, p)
+				}
+				want := (x*y + 1<<(frac-1)) >> frac
+				if r := int32(Reveal32(io, FixMulRound32(io, share(x), share(y), frac))); int64(r) != want {
+					errorf("%d * %d rounded: got %d, want %d", x, y, r, want)
+				}
+			}
+			if q := (x << frac) / y; q == int64(int32(q)) {
+				if r := int32(Reveal32(io, FixDiv32(io, share(x), share(y), frac))); int64(r) != q {
+					errorf("%d / %d: got %d, want %d", x, y, r, q)
+				}
+			}
+			if x >= 0 {
+				want := int64(math.Sqrt(float64(x << frac)))
+				if r := int32(Reveal32(io, FixSqrt32(io, share(x), frac))); int64(r) != want {
+					errorf("sqrt %d: got %d, want %d", x, r, want)
+				}
+			}
+			a := math.Ldexp(float64(x), -frac)
+			x64 := x << (frac64 - frac)
+			if a < 20 {
+				exp(x64)
+			}
+			if a > 0 {
+				if r := real64(Reveal64(io, FixLog64(io, share64(x64), frac64))); !near(r, math.Log(a), 8) {
+					errorf("log %g: got %g, want %g", a, r, math.Log(a))
+				}
+			}
+			if r := real64(Reveal64(io, FixSigmoid64(io, share64(x64), frac64))); !near(r, 1/(1+math.Exp(-a)), 8) {
+				errorf("sigmoid %g: got %g, want %g", a, r, 1/(1+math.Exp(-a)))
+			}
+			if r := real64(Reveal64(io, FixMul64(io, share64(x64), share64(x64), frac64))); a*a < 1<<30 && !near(r, a*a, 1) {
+				errorf("%g * %g: got %g, want %g", a, a, r, a*a)
+			}
+		}
+	})
+}
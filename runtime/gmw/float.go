@@ -0,0 +1,548 @@
+package gmw
+
+/*
+Soft floating point on shares, as in gc/gen/float.go: IEEE 754
+binary32 and binary64 arithmetic, rounding to nearest, ties to even,
+with subnormals, and the canonical quiet NaN for every NaN result.
+The values of both formats and their working significands fit in a
+uint64, and exponents are signed uint32s.  Arithmetic can leave bits
+above the width of a value, so a value is masked before its top bits
+are tested.
+*/
+
+type floatFormat struct {
+	exp, frac uint /* the widths of the exponent and fraction fields */
+}
+
+var binary32 = floatFormat{8, 23}
+var binary64 = floatFormat{11, 52}
+
+func (f floatFormat) bias() uint32 {
+	return 1<<(f.exp-1) - 1
+}
+
+func (f floatFormat) expMax() uint32 {
+	return 1<<f.exp - 1
+}
+
+/* The low n bits */
+func low64(n uint) uint64 {
+	return ^uint64(0) >> (64 - n)
+}
+
+/* A share of b at bit i */
+func bit64(b bool, i uint) uint64 {
+	if b {
+		return 1 << i
+	}
+	return 0
+}
+
+func nonzero64(io Io, a uint64) bool {
+	return Not1(io, Icmp_eq64(io, a, Uint64(io, 0)))
+}
+
+/* a with sticky ORed into its low bit */
+func jam64(io Io, a uint64, sticky bool) uint64 {
+	return a&^1 | bit64(Or1(io, a&1 > 0, sticky), 0)
+}
+
+type unpacked struct {
+	sign, nan, inf, zero bool
+	exp                  uint32 /* biased, 1 for a subnormal */
+	sig                  uint64 /* f.frac+1 bits, with the leading bit */
+}
+
+func unpack(io Io, f floatFormat, a uint64) unpacked {
+	frac := a & low64(f.frac)
+	e := uint32(a>>f.frac) & f.expMax()
+	eZero := Icmp_eq32(io, e, Uint32(io, 0))
+	eMax := Icmp_eq32(io, e, Uint32(io, f.expMax()))
+	fZero := Icmp_eq64(io, frac, Uint64(io, 0))
+	return unpacked{
+		sign: (a>>(f.exp+f.frac))&1 > 0,
+		nan:  And1(io, eMax, Not1(io, fZero)),
+		inf:  And1(io, eMax, fZero),
+		zero: And1(io, eZero, fZero),
+		exp:  Select32(io, eZero, Uint32(io, 1), e),
+		sig:  frac | bit64(Not1(io, eZero), f.frac),
+	}
+}
+
+func signedZero(f floatFormat, s bool) uint64 {
+	return bit64(s, f.exp+f.frac)
+}
+
+func infinity(io Io, f floatFormat, s bool) uint64 {
+	return Uint64(io, uint64(f.expMax())<<f.frac) | bit64(s, f.exp+f.frac)
+}
+
+func quietNaN(io Io, f floatFormat) uint64 {
+	return Uint64(io, uint64(2*f.expMax()+1)<<(f.frac-1))
+}
+
+/* a shifted right by a variable d, ORing the bits shifted out into the low bit */
+func shiftRightJam64(io Io, a uint64, d uint32) uint64 {
+	sticky := false
+	for k := uint(0); k < 6; k++ {
+		dk := (d>>k)&1 > 0
+		sticky = Or1(io, sticky, And1(io, dk, nonzero64(io, a&low64(1<<k))))
+		a = Select64(io, dk, a>>(1<<k), a)
+	}
+	big := Not1(io, Icmp_eq32(io, d>>6, Uint32(io, 0)))
+	sticky = Or1(io, sticky, And1(io, big, nonzero64(io, a)))
+	a = Select64(io, big, Uint64(io, 0), a)
+	return jam64(io, a, sticky)
+}
+
+/* The top n bits of m, of width bits, jamming, or m padded below to n bits */
+func fit64(io Io, m uint64, width, n uint) uint64 {
+	if width <= n {
+		return m << (n - width)
+	}
+	return jam64(io, m>>(width-n), nonzero64(io, m&low64(width-n)))
+}
+
+/* Shift m, of width bits, left until its top bit is set, taking the shift from e; m must not be 0 */
+func normalize64(io Io, m uint64, e uint32, width uint) (uint64, uint32) {
+	m &= low64(width)
+	s := uint(1)
+	for s*2 < width {
+		s *= 2
+	}
+	for ; s >= 1; s /= 2 {
+		z := Icmp_eq64(io, m>>(width-s), Uint64(io, 0))
+		m = Select64(io, z, m<<s&low64(width), m)
+		e = Select32(io, z, Sub32(io, e, Uint32(io, uint32(s))), e)
+	}
+	return m, e
+}
+
+/* m has a carry bit above its width bits, and e is the exponent of the bit below; shift the carry down */
+func carry64(io Io, m uint64, e uint32, width uint) (uint64, uint32) {
+	c := (m>>width)&1 > 0
+	m = Select64(io, c, jam64(io, m>>1, m&1 > 0), m) & low64(width)
+	return m, Select32(io, c, Add32(io, e, Uint32(io, 1)), e)
+}
+
+/*
+Round m, a significand of f.frac+4 bits whose top bit has the biased
+exponent e, to nearest even, and pack it with the sign s.
+*/
+func roundPack64(io Io, f floatFormat, s bool, e uint32, m uint64) uint64 {
+	m &= low64(f.frac + 4)
+	one := Uint32(io, 1)
+	tiny := Icmp_slt32(io, e, one)
+	m = Select64(io, tiny, shiftRightJam64(io, m, Sub32(io, one, e)), m)
+	e = Select32(io, tiny, one, e)
+	inc := And1(io, (m>>2)&1 > 0, Or1(io, (m>>3)&1 > 0, Or1(io, (m>>1)&1 > 0, m&1 > 0)))
+	q := Add64(io, m>>3, bit64(inc, 0))
+	/* a carry out of the significand moves into the exponent */
+	packed := Add64(io, uint64(Sub32(io, e, one))<<f.frac, q)
+	overflow := Icmp_uge64(io, packed>>f.frac, Uint64(io, uint64(f.expMax())))
+	result := packed&low64(f.exp+f.frac) | bit64(s, f.exp+f.frac)
+	return Select64(io, overflow, infinity(io, f, s), result)
+}
+
+func fadd(io Io, f floatFormat, a, b uint64) uint64 {
+	n := f.exp + f.frac
+	x := unpack(io, f, a)
+	y := unpack(io, f, b)
+	/* operate on the larger magnitude and the smaller */
+	swap := Icmp_ugt64(io, b&low64(n), a&low64(n))
+	sa, sb := Select1(io, swap, y.sign, x.sign), Select1(io, swap, x.sign, y.sign)
+	ea, eb := Select32(io, swap, y.exp, x.exp), Select32(io, swap, x.exp, y.exp)
+	ma, mb := Select64(io, swap, y.sig, x.sig), Select64(io, swap, x.sig, y.sig)
+	sub := xor(sa, sb)
+	wa := ma << 3
+	wb := shiftRightJam64(io, mb<<3, Sub32(io, ea, eb))
+	sum := Select64(io, sub, Sub64(io, wa, wb), Add64(io, wa, wb)) & low64(f.frac+5)
+	m, e := carry64(io, sum, ea, f.frac+4)
+	m, e = normalize64(io, m, e, f.frac+4)
+	result := roundPack64(io, f, sa, e, m)
+	/* an exact zero is -0 only for -0 + -0 */
+	exact := Icmp_eq64(io, sum, Uint64(io, 0))
+	result = Select64(io, exact, signedZero(f, And1(io, sa, Not1(io, sub))), result)
+	result = Select64(io, y.inf, b, result)
+	result = Select64(io, x.inf, a, result)
+	nan := Or1(io, Or1(io, x.nan, y.nan), And1(io, And1(io, x.inf, y.inf), xor(x.sign, y.sign)))
+	return Select64(io, nan, quietNaN(io, f), result)
+}
+
+func fneg(io Io, f floatFormat, a uint64) uint64 {
+	if io.Id() == 0 {
+		return a ^ 1<<(f.exp+f.frac)
+	}
+	return a
+}
+
+/* The product of the width-bit m and n as hi<<width | lo */
+func mulWide64(io Io, m, n uint64, width uint) (uint64, uint64) {
+	hi := Uint64(io, 0)
+	lo := Uint64(io, 0)
+	for i := uint(0); i < width; i++ {
+		t := Add64(io, hi, Mask64(io, (n>>i)&1 > 0, m))
+		lo |= (t & 1) << i
+		hi = t >> 1
+	}
+	return hi, lo
+}
+
+func fmul(io Io, f floatFormat, a, b uint64) uint64 {
+	x := unpack(io, f, a)
+	y := unpack(io, f, b)
+	s := xor(x.sign, y.sign)
+	mx, ex := normalize64(io, x.sig, x.exp, f.frac+1)
+	my, ey := normalize64(io, y.sig, y.exp, f.frac+1)
+	e := Sub32(io, Add32(io, ex, ey), Uint32(io, f.bias()))
+	/* keep the top f.frac+5 bits of the product, jamming */
+	hi, lo := mulWide64(io, mx, my, f.frac+1)
+	m := jam64(io, hi<<4|lo>>(f.frac-3), nonzero64(io, lo&low64(f.frac-3)))
+	m, e = carry64(io, m, e, f.frac+4)
+	result := roundPack64(io, f, s, e, m)
+	zero := Or1(io, x.zero, y.zero)
+	inf := Or1(io, x.inf, y.inf)
+	result = Select64(io, zero, signedZero(f, s), result)
+	result = Select64(io, inf, infinity(io, f, s), result)
+	nan := Or1(io, Or1(io, x.nan, y.nan), And1(io, zero, inf))
+	return Select64(io, nan, quietNaN(io, f), result)
+}
+
+func fdiv(io Io, f floatFormat, a, b uint64) uint64 {
+	x := unpack(io, f, a)
+	y := unpack(io, f, b)
+	s := xor(x.sign, y.sign)
+	mx, ex := normalize64(io, x.sig, x.exp, f.frac+1)
+	my, ey := normalize64(io, y.sig, y.exp, f.frac+1)
+	e := Add32(io, Sub32(io, ex, ey), Uint32(io, f.bias()-1))
+	/* restoring division, of f.frac+5 quotient bits */
+	r := mx
+	q := Uint64(io, 0)
+	for i := int(f.frac + 4); i >= 0; i-- {
+		ge := Icmp_uge64(io, r, my)
+		r = Select64(io, ge, Sub64(io, r, my), r) << 1
+		if ge {
+			q |= 1 << uint(i)
+		}
+	}
+	m, e := carry64(io, jam64(io, q, nonzero64(io, r)), e, f.frac+4)
+	result := roundPack64(io, f, s, e, m)
+	result = Select64(io, Or1(io, x.zero, y.inf), signedZero(f, s), result)
+	result = Select64(io, Or1(io, x.inf, y.zero), infinity(io, f, s), result)
+	nan := Or1(io, Or1(io, x.nan, y.nan), Or1(io, And1(io, x.zero, y.zero), And1(io, x.inf, y.inf)))
+	return Select64(io, nan, quietNaN(io, f), result)
+}
+
+func Fadd32(io Io, a, b uint32) uint32 {
+	return uint32(fadd(io, binary32, uint64(a), uint64(b)))
+}
+
+func Fadd64(io Io, a, b uint64) uint64 {
+	return fadd(io, binary64, a, b)
+}
+
+func Fsub32(io Io, a, b uint32) uint32 {
+	return uint32(fadd(io, binary32, uint64(a), fneg(io, binary32, uint64(b))))
+}
+
+func Fsub64(io Io, a, b uint64) uint64 {
+	return fadd(io, binary64, a, fneg(io, binary64, b))
+}
+
+func Fmul32(io Io, a, b uint32) uint32 {
+	return uint32(fmul(io, binary32, uint64(a), uint64(b)))
+}
+
+func Fmul64(io Io, a, b uint64) uint64 {
+	return fmul(io, binary64, a, b)
+}
+
+func Fdiv32(io Io, a, b uint32) uint32 {
+	return uint32(fdiv(io, binary32, uint64(a), uint64(b)))
+}
+
+func Fdiv64(io Io, a, b uint64) uint64 {
+	return fdiv(io, binary64, a, b)
+}
+
+/* Whether a and b are unordered (either is a NaN), and if not, whether a = b, a < b and a > b */
+func fcmp(io Io, f floatFormat, a, b uint64) (uno, eq, lt, gt bool) {
+	n := f.exp + f.frac
+	x := unpack(io, f, a)
+	y := unpack(io, f, b)
+	uno = Or1(io, x.nan, y.nan)
+	ord := Not1(io, uno)
+	bothZero := And1(io, x.zero, y.zero) /* +0 = -0 */
+	eq = And1(io, ord, Or1(io, bothZero, Icmp_eq64(io, a, b)))
+	ltMag := Icmp_ult64(io, a&low64(n), b&low64(n))
+	gtMag := Icmp_ugt64(io, a&low64(n), b&low64(n))
+	differ := xor(x.sign, y.sign)
+	ord = And1(io, ord, Not1(io, bothZero))
+	lt = And1(io, ord, Select1(io, differ, x.sign, Select1(io, x.sign, gtMag, ltMag)))
+	gt = And1(io, ord, Select1(io, differ, y.sign, Select1(io, x.sign, ltMag, gtMag)))
+	return
+}
+
+func Fcmp_false32(io Io, a, b uint32) bool {
+	return Uint1(io, 0)
+}
+
+func Fcmp_oeq32(io Io, a, b uint32) bool {
+	_, eq, _, _ := fcmp(io, binary32, uint64(a), uint64(b))
+	return eq
+}
+
+func Fcmp_ogt32(io Io, a, b uint32) bool {
+	_, _, _, gt := fcmp(io, binary32, uint64(a), uint64(b))
+	return gt
+}
+
+func Fcmp_oge32(io Io, a, b uint32) bool {
+	_, eq, _, gt := fcmp(io, binary32, uint64(a), uint64(b))
+	return Or1(io, gt, eq)
+}
+
+func Fcmp_olt32(io Io, a, b uint32) bool {
+	_, _, lt, _ := fcmp(io, binary32, uint64(a), uint64(b))
+	return lt
+}
+
+func Fcmp_ole32(io Io, a, b uint32) bool {
+	_, eq, lt, _ := fcmp(io, binary32, uint64(a), uint64(b))
+	return Or1(io, lt, eq)
+}
+
+func Fcmp_one32(io Io, a, b uint32) bool {
+	_, _, lt, gt := fcmp(io, binary32, uint64(a), uint64(b))
+	return Or1(io, lt, gt)
+}
+
+func Fcmp_ord32(io Io, a, b uint32) bool {
+	uno, _, _, _ := fcmp(io, binary32, uint64(a), uint64(b))
+	return Not1(io, uno)
+}
+
+func Fcmp_ueq32(io Io, a, b uint32) bool {
+	uno, eq, _, _ := fcmp(io, binary32, uint64(a), uint64(b))
+	return Or1(io, uno, eq)
+}
+
+func Fcmp_ugt32(io Io, a, b uint32) bool {
+	uno, _, _, gt := fcmp(io, binary32, uint64(a), uint64(b))
+	return Or1(io, uno, gt)
+}
+
+func Fcmp_uge32(io Io, a, b uint32) bool {
+	_, _, lt, _ := fcmp(io, binary32, uint64(a), uint64(b))
+	return Not1(io, lt)
+}
+
+func Fcmp_ult32(io Io, a, b uint32) bool {
+	uno, _, lt, _ := fcmp(io, binary32, uint64(a), uint64(b))
+	return Or1(io, uno, lt)
+}
+
+func Fcmp_ule32(io Io, a, b uint32) bool {
+	_, _, _, gt := fcmp(io, binary32, uint64(a), uint64(b))
+	return Not1(io, gt)
+}
+
+func Fcmp_une32(io Io, a, b uint32) bool {
+	_, eq, _, _ := fcmp(io, binary32, uint64(a), uint64(b))
+	return Not1(io, eq)
+}
+
+func Fcmp_uno32(io Io, a, b uint32) bool {
+	uno, _, _, _ := fcmp(io, binary32, uint64(a), uint64(b))
+	return uno
+}
+
+func Fcmp_true32(io Io, a, b uint32) bool {
+	return Uint1(io, 1)
+}
+
+func Fcmp_false64(io Io, a, b uint64) bool {
+	return Uint1(io, 0)
+}
+
+func Fcmp_oeq64(io Io, a, b uint64) bool {
+	_, eq, _, _ := fcmp(io, binary64, a, b)
+	return eq
+}
+
+func Fcmp_ogt64(io Io, a, b uint64) bool {
+	_, _, _, gt := fcmp(io, binary64, a, b)
+	return gt
+}
+
+func Fcmp_oge64(io Io, a, b uint64) bool {
+	_, eq, _, gt := fcmp(io, binary64, a, b)
+	return Or1(io, gt, eq)
+}
+
+func Fcmp_olt64(io Io, a, b uint64) bool {
+	_, _, lt, _ := fcmp(io, binary64, a, b)
+	return lt
+}
+
+func Fcmp_ole64(io Io, a, b uint64) bool {
+	_, eq, lt, _ := fcmp(io, binary64, a, b)
+	return Or1(io, lt, eq)
+}
+
+func Fcmp_one64(io Io, a, b uint64) bool {
+	_, _, lt, gt := fcmp(io, binary64, a, b)
+	return Or1(io, lt, gt)
+}
+
+func Fcmp_ord64(io Io, a, b uint64) bool {
+	uno, _, _, _ := fcmp(io, binary64, a, b)
+	return Not1(io, uno)
+}
+
+func Fcmp_ueq64(io Io, a, b uint64) bool {
+	uno, eq, _, _ := fcmp(io, binary64, a, b)
+	return Or1(io, uno, eq)
+}
+
+func Fcmp_ugt64(io Io, a, b uint64) bool {
+	uno, _, _, gt := fcmp(io, binary64, a, b)
+	return Or1(io, uno, gt)
+}
+
+func Fcmp_uge64(io Io, a, b uint64) bool {
+	_, _, lt, _ := fcmp(io, binary64, a, b)
+	return Not1(io, lt)
+}
+
+func Fcmp_ult64(io Io, a, b uint64) bool {
+	uno, _, lt, _ := fcmp(io, binary64, a, b)
+	return Or1(io, uno, lt)
+}
+
+func Fcmp_ule64(io Io, a, b uint64) bool {
+	_, _, _, gt := fcmp(io, binary64, a, b)
+	return Not1(io, gt)
+}
+
+func Fcmp_une64(io Io, a, b uint64) bool {
+	_, eq, _, _ := fcmp(io, binary64, a, b)
+	return Not1(io, eq)
+}
+
+func Fcmp_uno64(io Io, a, b uint64) bool {
+	uno, _, _, _ := fcmp(io, binary64, a, b)
+	return uno
+}
+
+func Fcmp_true64(io Io, a, b uint64) bool {
+	return Uint1(io, 1)
+}
+
+/* The integer a, of width bits, as a float; s is its sign and a its magnitude */
+func itofp(io Io, f floatFormat, s bool, a uint64, width uint) uint64 {
+	m, e := normalize64(io, a, Uint32(io, f.bias()+uint32(width)-1), width)
+	result := roundPack64(io, f, s, e, fit64(io, m, width, f.frac+4))
+	return Select64(io, Icmp_eq64(io, a, Uint64(io, 0)), Uint64(io, 0), result)
+}
+
+func sitofp(io Io, f floatFormat, a uint64, width uint) uint64 {
+	s := (a>>(width-1))&1 > 0
+	return itofp(io, f, s, Select64(io, s, Sub64(io, Uint64(io, 0), a), a)&low64(width), width)
+}
+
+/* a truncated toward zero to an integer of width bits; out of range, the result is unspecified, as in C */
+func fptoi(io Io, f floatFormat, a uint64, width uint, signed bool) uint64 {
+	x := unpack(io, f, a)
+	/* the magnitude is x.sig << (x.exp - bias - frac) */
+	sh := Sub32(io, x.exp, Uint32(io, f.bias()+uint32(f.frac)))
+	left := ShlV64(io, x.sig, uint64(sh))
+	right := LshrV64(io, x.sig, uint64(Sub32(io, Uint32(io, 0), sh)))
+	v := Select64(io, (sh>>31)&1 > 0, right, left)
+	if signed {
+		v = Select64(io, x.sign, Sub64(io, Uint64(io, 0), v), v)
+	}
+	return v & low64(width)
+}
+
+func fconvert(io Io, from, to floatFormat, a uint64) uint64 {
+	x := unpack(io, from, a)
+	m, e := normalize64(io, x.sig, x.exp, from.frac+1)
+	e = Add32(io, e, Uint32(io, to.bias()-from.bias()))
+	result := roundPack64(io, to, x.sign, e, fit64(io, m, from.frac+1, to.frac+4))
+	result = Select64(io, x.zero, signedZero(to, x.sign), result)
+	result = Select64(io, x.inf, infinity(io, to, x.sign), result)
+	return Select64(io, x.nan, quietNaN(io, to), result)
+}
+
+func Sitofp32_32(io Io, a uint32) uint32 {
+	return uint32(sitofp(io, binary32, uint64(a), 32))
+}
+
+func Sitofp32_64(io Io, a uint32) uint64 {
+	return sitofp(io, binary64, uint64(a), 32)
+}
+
+func Sitofp64_32(io Io, a uint64) uint32 {
+	return uint32(sitofp(io, binary32, a, 64))
+}
+
+func Sitofp64_64(io Io, a uint64) uint64 {
+	return sitofp(io, binary64, a, 64)
+}
+
+func Uitofp32_32(io Io, a uint32) uint32 {
+	return uint32(itofp(io, binary32, false, uint64(a), 32))
+}
+
+func Uitofp32_64(io Io, a uint32) uint64 {
+	return itofp(io, binary64, false, uint64(a), 32)
+}
+
+func Uitofp64_32(io Io, a uint64) uint32 {
+	return uint32(itofp(io, binary32, false, a, 64))
+}
+
+func Uitofp64_64(io Io, a uint64) uint64 {
+	return itofp(io, binary64, false, a, 64)
+}
+
+func Fptosi32_32(io Io, a uint32) uint32 {
+	return uint32(fptoi(io, binary32, uint64(a), 32, true))
+}
+
+func Fptosi32_64(io Io, a uint32) uint64 {
+	return fptoi(io, binary32, uint64(a), 64, true)
+}
+
+func Fptosi64_32(io Io, a uint64) uint32 {
+	return uint32(fptoi(io, binary64, a, 32, true))
+}
+
+func Fptosi64_64(io Io, a uint64) uint64 {
+	return fptoi(io, binary64, a, 64, true)
+}
+
+func Fptoui32_32(io Io, a uint32) uint32 {
+	return uint32(fptoi(io, binary32, uint64(a), 32, false))
+}
+
+func Fptoui32_64(io Io, a uint32) uint64 {
+	return fptoi(io, binary32, uint64(a), 64, false)
+}
+
+func Fptoui64_32(io Io, a uint64) uint32 {
+	return uint32(fptoi(io, binary64, a, 32, false))
+}
+
+func Fptoui64_64(io Io, a uint64) uint64 {
+	return fptoi(io, binary64, a, 64, false)
+}
+
+func Fpext32_64(io Io, a uint32) uint64 {
+	return fconvert(io, binary32, binary64, uint64(a))
+}
+
+func Fptrunc64_32(io Io, a uint64) uint32 {
+	return uint32(fconvert(io, binary64, binary32, a))
+}
@@ -0,0 +1,87 @@
+package gmw
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func sameFloat64(got uint64, want float64) bool {
+	return got == math.Float64bits(want) || math.IsNaN(want) && got == 0x7ff8000000000000
+}
+
+func sameFloat32(got uint32, want float32) bool {
+	return got == math.Float32bits(want) || want != want && got == 0x7fc00000
+}
+
+/* The soft-float operations on shares of 2 parties against Go's */
+func TestFloat(t *testing.T) {
+	xs := []float64{0, math.Copysign(0, -1), 1, -1.5, 3, 0.1, 1e300, -1e-310, math.MaxFloat64,
+		math.SmallestNonzeroFloat64, math.Inf(1), math.Inf(-1), math.NaN()}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 4; i++ {
+		xs = append(xs, rnd.NormFloat64(), math.Float64frombits(rnd.Uint64()))
+	}
+	var mu sync.Mutex
+	Simulation([]uint32{0, 0}, 0, func(io Io, _ []Io) {
+		errorf := func(format string, args ...interface{}) {
+			if io.Id() == 0 {
+				mu.Lock()
+				t.Errorf(format, args...)
+				mu.Unlock()
+			}
+		}
+		share := func(x float64) uint64 { return Uint64(io, math.Float64bits(x)) }
+		share32 := func(x float32) uint32 { return Uint32(io, math.Float32bits(x)) }
+		for i, x := range xs {
+			y := xs[(i*7+3)%len(xs)]
+			if r := Reveal64(io, Fadd64(io, share(x), share(y))); !sameFloat64(r, x+y) {
+				errorf("%g + %g: got %x, want %g", x, y, r, x+y)
+			}
+			if r := Reveal64(io, Fsub64(io, share(x), share(x))); !sameFloat64(r, x-x) {
+				errorf("%g - %g: got %x, want %g", x, x, r, x-x)
+			}
+			if r := Reveal64(io, Fmul64(io, share(x), share(y))); !sameFloat64(r, x*y) {
+				errorf("%g * %g: got %x, want %g", x, y, r, x*y)
+			}
+			if r := Reveal64(io, Fdiv64(io, share(x), share(y))); !sameFloat64(r, x/y) {
+				errorf("%g / %g: got %x, want %g", x, y, r, x/y)
+			}
+			if r := Reveal1(io, Fcmp_olt64(io, share(x), share(y))); r != (x < y) {
+				errorf("%g < %g: got %v", x, y, r)
+			}
+			if r := Reveal1(io, Fcmp_une64(io, share(x), share(y))); r != (x != y) {
+				errorf("%g != %g: got %v", x, y, r)
+			}
+			x32, y32 := float32(x), float32(y)
+			if r := Reveal32(io, Fadd32(io, share32(x32), share32(y32))); !sameFloat32(r, x32+y32) {
+				errorf("%g + %g: got %x, want %g", x32, y32, r, x32+y32)
+			}
+			if r := Reveal32(io, Fmul32(io, share32(x32), share32(y32))); !sameFloat32(r, x32*y32) {
+				errorf("%g * %g: got %x, want %g", x32, y32, r, x32*y32)
+			}
+			if r := Reveal32(io, Fdiv32(io, share32(x32), share32(y32))); !sameFloat32(r, x32/y32) {
+				errorf("%g / %g: got %x, want %g", x32, y32, r, x32/y32)
+			}
+			if r := Reveal32(io, Fptrunc64_32(io, share(x))); !sameFloat32(r, x32) {
+				errorf("fptrunc %g: got %x, want %g", x, r, x32)
+			}
+			if r := Reveal64(io, Fpext32_64(io, share32(x32))); !sameFloat64(r, float64(x32)) {
+				errorf("fpext %g: got %x, want %g", x32, r, float64(x32))
+			}
+			if !math.IsNaN(x) && math.Abs(x) < 1<<31 {
+				if r := Reveal32(io, Fptosi64_32(io, share(x))); int32(r) != int32(x) {
+					errorf("fptosi %g: got %d", x, int32(r))
+				}
+			}
+			n := int64(math.Float64bits(x)) >> uint(i%64)
+			if r := Reveal64(io, Sitofp64_64(io, Uint64(io, uint64(n)))); !sameFloat64(r, float64(n)) {
+				errorf("sitofp %d: got %x, want %g", n, r, float64(n))
+			}
+			if r := Reveal32(io, Uitofp32_32(io, Uint32(io, uint32(n)))); !sameFloat32(r, float32(uint32(n))) {
+				errorf("uitofp %d: got %x, want %g", uint32(n), r, float32(uint32(n)))
+			}
+		}
+	})
+}
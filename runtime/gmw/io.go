@@ -2,12 +2,12 @@ package gmw
 
 import (
 	"fmt"
-	"github.com/tjim/fatchan"
 	"github.com/tjim/smpcc/runtime/ot"
+	"github.com/tjim/smpcc/runtime/transport"
 	"log"
 	"math/big"
 	"net"
-	"time"
+	"strconv"
 )
 
 var log_mem bool = true
@@ -63,6 +63,8 @@ type Io interface {
 
 	InitRam([]byte)
 	Ram() []byte
+	SetMemory(ORam)
+	Memory() ORam
 }
 
 /* Share of a multiplication triple */
@@ -85,6 +87,7 @@ type GlobalIO struct {
 	id     int      /* id of party, range is 0..n-1 */
 	Inputs []uint32 /* inputs of this party */
 	ram    []byte
+	mem    ORam /* used instead of ram by programs compiled with -oram */
 }
 
 type BlockIO struct {
@@ -101,6 +104,7 @@ type BlockIO struct {
 type PeerIO struct {
 	*GlobalIO // The GlobalIO of the peer and all of its blocks must be the same
 	Blocks    []*BlockIO
+	conns     []*transport.Conn // by party, when connected by SetupPeer
 }
 
 /*
@@ -122,14 +126,14 @@ Peers only listen for leaders and only connect to followers.
 
 // for establishing connections
 type ClientAsSender struct {
-	S2R       chan ot.MessagePair `fatchan:"request"` // One per sender/receiver pair, sender->receiver
-	R2S       chan []byte         `fatchan:"reply"`   // One per sender/receiver pair, receiver->sender
-	Rwchannel chan uint32         `fatchan:"request"`
+	S2R       chan ot.MessagePair // One per sender/receiver pair, sender->receiver
+	R2S       chan []byte         // One per sender/receiver pair, receiver->sender
+	Rwchannel chan uint32         // client->server
 }
 type ServerAsSender struct {
-	S2R       chan ot.MessagePair `fatchan:"reply"`   // One per sender/receiver pair, sender->receiver
-	R2S       chan []byte         `fatchan:"request"` // One per sender/receiver pair, receiver->sender
-	Rwchannel chan uint32         `fatchan:"reply"`
+	S2R       chan ot.MessagePair // One per sender/receiver pair, sender->receiver
+	R2S       chan []byte         // One per sender/receiver pair, receiver->sender
+	Rwchannel chan uint32         // server->client
 }
 type PerBlock struct {
 	CAS ClientAsSender
@@ -140,26 +144,65 @@ type PerNodePair struct {
 	BlockChans []PerBlock
 }
 
+/*
+Carry the channels over conn: the NPChans on streams 1-3, then six
+streams for each block.  The client is the base OT receiver.
+*/
+func (x *PerNodePair) Bind(conn *transport.Conn, client bool) {
+	x.NPChans.Bind(conn, 1, client)
+	for i, b := range x.BlockChans {
+		id := uint32(1 + ot.NPStreams + 6*i)
+		conn.Bind(id, b.CAS.S2R, client)
+		conn.Bind(id+1, b.CAS.R2S, !client)
+		conn.Bind(id+2, b.CAS.Rwchannel, client)
+		conn.Bind(id+3, b.SAS.S2R, !client)
+		conn.Bind(id+4, b.SAS.R2S, client)
+		conn.Bind(id+5, b.SAS.Rwchannel, !client)
+	}
+}
+
+/* The params of a connection, which both parties must agree on */
+func (io *PeerIO) handshakeParams() transport.Params {
+	return transport.Params{
+		"protocol": "gmw",
+		"blocks":   strconv.Itoa(len(io.Blocks) - 1),
+		"parties":  strconv.Itoa(io.n),
+	}
+}
+
 const (
 	base_port int = 3042
 )
 
+/* The security of the connection with party, or nil if there is no Key */
+func (io *PeerIO) security(party int) *transport.Security {
+	if Key == nil {
+		return nil
+	}
+	k, ok := PublicKeys[party]
+	if !ok {
+		log.Fatalf("no public key for party %d in the config file", party)
+	}
+	return &transport.Security{Key: Key, Peer: k}
+}
+
+/* Connect to party, waiting for it to start listening */
 func (io *PeerIO) connect(party int, done chan bool) {
 	if io.id == party {
 		panic("connect0")
 	}
 	addr := fmt.Sprintf("%s:%d", Hosts[io.id], Ports[party]+io.id)
-	server, err := net.Dial("tcp", addr)
+	conn, err := transport.Dial(addr, io.security(party))
 	if err != nil {
 		log.Fatalf("dial(%q): %s", addr, err)
 	}
-
-	xport := fatchan.New(server, nil)
-	nu := make(chan *PerNodePair)
-	xport.FromChan(nu)
+	if err := conn.Handshake(io.handshakeParams()); err != nil {
+		log.Fatalf("handshake with %q: %s", addr, err)
+	}
+	io.conns[party] = conn
 	x := NewPerNodePair(io)
-	nu <- x
-	ClientSideIOSetup(io, party, x, true, done)
+	x.Bind(conn, true)
+	ClientSideIOSetup(io, party, x, done)
 }
 
 func NewPerNodePair(peer *PeerIO) *PerNodePair {
@@ -180,16 +223,13 @@ func NewPerNodePair(peer *PeerIO) *PerNodePair {
 	return &x
 }
 
-func ClientSideIOSetup(peer *PeerIO, party int, x *PerNodePair, wait bool, done chan bool) {
+func ClientSideIOSetup(peer *PeerIO, party int, x *PerNodePair, done chan bool) {
 	blocks := peer.Blocks
 	numBlocks := len(blocks)
 	ParamChan := x.ParamChan
 	NpRecvPk := x.NpRecvPk
 	NpSendEncs := x.NpSendEncs
 
-	if wait {
-		time.Sleep(3 * time.Second) // wait for fatchan channel setup at server to complete
-	}
 	for i := 0; i < numBlocks; i++ {
 		blocks[i].Rchannels[party] = x.BlockChans[i].SAS.Rwchannel
 		blocks[i].Wchannels[party] = x.BlockChans[i].CAS.Rwchannel
@@ -223,14 +263,17 @@ func (io *PeerIO) listen(party int, done chan bool) {
 	if err != nil {
 		log.Fatalf("listen(%q): %s", addr, err)
 	}
-	conn, err := listener.Accept()
+	conn, err := transport.Accept(listener, io.security(party))
 	if err != nil {
 		log.Fatalf("accept(): %s", err)
 	}
-	xport := fatchan.New(conn, nil)
-	nu := make(chan *PerNodePair)
-	xport.ToChan(nu)
-	ServerSideIOSetup(io, party, <-nu, done)
+	if err := conn.Handshake(io.handshakeParams()); err != nil {
+		log.Fatalf("handshake with party %d: %s", party, err)
+	}
+	io.conns[party] = conn
+	x := NewPerNodePair(io)
+	x.Bind(conn, false)
+	ServerSideIOSetup(io, party, x, done)
 }
 
 func ServerSideIOSetup(peer *PeerIO, party int, x *PerNodePair, done chan bool) {
@@ -287,6 +330,7 @@ func NewPeerIO(numBlocks int, numParties int, id int) *PeerIO {
 func SetupPeer(inputs []uint32, numBlocks int, numParties int, id int, runPeer func(Io, []Io)) {
 	io := NewPeerIO(numBlocks, numParties, id)
 	io.Inputs = inputs
+	io.conns = make([]*transport.Conn, numParties)
 	done := make(chan bool)
 	// start listening for clients
 	for i := 0; i < numParties; i++ {
@@ -294,7 +338,6 @@ func SetupPeer(inputs []uint32, numBlocks int, numParties int, id int, runPeer f
 			go io.listen(i, done)
 		}
 	}
-	time.Sleep(2 * time.Second) // wait for servers of other parties to start listening
 	// start connecting to servers of other parties
 	for i := 0; i < numParties; i++ {
 		if io.id != i && io.Leads(i) {
@@ -312,6 +355,11 @@ func SetupPeer(inputs []uint32, numBlocks int, numParties int, id int, runPeer f
 		x[j] = io.Blocks[j+1]
 	}
 	runPeer(io.Blocks[0], x)
+	for _, conn := range io.conns {
+		if conn != nil {
+			conn.Close()
+		}
+	}
 }
 
 func Simulation(inputs []uint32, numBlocks int, runPeer func(Io, []Io)) {
@@ -344,8 +392,8 @@ func Simulation(inputs []uint32, numBlocks int, runPeer func(Io, []Io)) {
 	for i := 0; i < numParties; i++ {
 		for j := 0; j < numParties; j++ {
 			if i != j && ios[i].Leads(j) {
-				x := xs[j*numParties+i]                         // client i talking to server j
-				go ClientSideIOSetup(ios[i], j, x, false, done) // i's setup client for party j
+				x := xs[j*numParties+i]                  // client i talking to server j
+				go ClientSideIOSetup(ios[i], j, x, done) // i's setup client for party j
 			}
 		}
 	}
@@ -654,10 +702,18 @@ func (x *BlockIO) GetInput() uint32 {
 	return result
 }
 
-func (x *BlockIO) InitRam(contents []byte) {
+func (x *GlobalIO) InitRam(contents []byte) {
 	x.ram = contents
 }
 
-func (x *BlockIO) Ram() []byte {
+func (x *GlobalIO) Ram() []byte {
 	return x.ram
 }
+
+func (x *GlobalIO) SetMemory(m ORam) {
+	x.mem = m
+}
+
+func (x *GlobalIO) Memory() ORam {
+	return x.mem
+}
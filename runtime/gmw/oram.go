@@ -0,0 +1,453 @@
+package gmw
+
+import (
+	"fmt"
+)
+
+/*
+Oblivious memory.  Load and Store reveal every address; an ORam keeps
+XOR-shared 64-bit words and an access does not reveal which word it
+touched.
+
+LinearRam touches every word on each access, using Unary-style masks
+computed a level at a time.  FloRam follows Floram (Doerner and
+shelat, "Scaling ORAM for Secure Computation," CCS 2017): the memory
+is published encrypted under a shared key, so that a read is a local
+scan of public ciphertexts plus one encryption in the circuit, and
+writes go to a stash that is folded back in every sqrt(n) accesses.
+Floram uses two-party distributed point functions to fold in writes
+cheaply; without them, folding in the stash costs about a linear scan,
+so FloRam mostly pays off for large memories.
+
+All parties must create and access their ORams in the same order.
+*/
+type ORam interface {
+	// Access returns the word at index and replaces it with
+	// update(word).  update is called exactly once.  index must be
+	// less than the size of the ORam; other indexes touch unspecified
+	// words, but a read, whose update returns its argument, changes
+	// nothing wherever index is.
+	Access(io Io, index uint64, update func(uint64) uint64) uint64
+}
+
+/* memories up to this many words use a linear scan */
+const linearRamMax = 1024
+
+/* An ORam holding the shared words contents */
+func NewORam(io Io, contents []uint64) ORam {
+	if len(contents) <= linearRamMax {
+		return NewLinearRam(io, contents)
+	}
+	return NewFloRam(io, contents)
+}
+
+func ORamRead(io Io, m ORam, index uint64) uint64 {
+	return m.Access(io, index, func(x uint64) uint64 { return x })
+}
+
+func ORamWrite(io Io, m ORam, index, val uint64) {
+	m.Access(io, index, func(x uint64) uint64 { return val })
+}
+
+//--- Batched operations, one round trip per batch
+
+/* Open a batch of values; see Open64 */
+func OpenV64(io Io, xs []uint64) []uint64 {
+	result := make([]uint64, len(xs))
+	if io.Id() == 0 {
+		copy(result, xs)
+		for i := 1; i < io.N(); i++ {
+			for j := range result {
+				result[j] ^= io.Receive64(i)
+			}
+		}
+		for i := 1; i < io.N(); i++ {
+			for _, r := range result {
+				io.Send64(i, r)
+			}
+		}
+	} else {
+		for _, x := range xs {
+			io.Send64(0, x)
+		}
+		for j := range result {
+			result[j] = io.Receive64(0)
+		}
+	}
+	return result
+}
+
+/* xs[i] & ys[i] for every i; see And64 */
+func AndV64(io Io, xs, ys []uint64) []uint64 {
+	n := len(xs)
+	as := make([]uint64, n)
+	bs := make([]uint64, n)
+	cs := make([]uint64, n)
+	de := make([]uint64, 2*n)
+	for i := range xs {
+		as[i], bs[i], cs[i] = io.Triple64()
+		de[i] = xs[i] ^ as[i]
+		de[n+i] = ys[i] ^ bs[i]
+	}
+	de = OpenV64(io, de)
+	result := make([]uint64, n)
+	for i := range result {
+		d, e := de[i], de[n+i]
+		result[i] = cs[i] ^ d&bs[i] ^ e&as[i]
+		if io.Id() == 0 {
+			result[i] ^= d & e
+		}
+	}
+	return result
+}
+
+/* xs[i] & ys[i] for every i, two to a 64-bit triple */
+func andV32(io Io, xs, ys []uint32) []uint32 {
+	x64 := make([]uint64, (len(xs)+1)/2)
+	y64 := make([]uint64, len(x64))
+	for i := range xs {
+		x64[i/2] |= uint64(xs[i]) << uint(32*(i%2))
+		y64[i/2] |= uint64(ys[i]) << uint(32*(i%2))
+	}
+	r64 := AndV64(io, x64, y64)
+	result := make([]uint32, len(xs))
+	for i := range result {
+		result[i] = uint32(r64[i/2] >> uint(32*(i%2)))
+	}
+	return result
+}
+
+/* xs[i] & a for every i */
+func andBitsV(io Io, xs []bool, a bool) []bool {
+	words := make([]uint64, (len(xs)+63)/64)
+	as := make([]uint64, len(words))
+	for i, x := range xs {
+		if x {
+			words[i/64] |= 1 << uint(i%64)
+		}
+	}
+	if a {
+		for i := range as {
+			as[i] = ^uint64(0)
+		}
+	}
+	words = AndV64(io, words, as)
+	result := make([]bool, len(xs))
+	for i := range result {
+		result[i] = (words[i/64]>>uint(i%64))&1 > 0
+	}
+	return result
+}
+
+/* For each x in xs, whether x == y */
+func eqV64(io Io, xs []uint64, y uint64) []bool {
+	zs := make([]uint64, len(xs))
+	for i, x := range xs {
+		zs[i] = Not64(io, x^y)
+	}
+	/* AND all 64 bits of each z into bit 0 */
+	for k := uint(32); k > 0; k /= 2 {
+		shifted := make([]uint64, len(zs))
+		for i, z := range zs {
+			shifted[i] = z >> k
+		}
+		zs = AndV64(io, zs, shifted)
+	}
+	result := make([]bool, len(zs))
+	for i, z := range zs {
+		result[i] = z&1 > 0
+	}
+	return result
+}
+
+/* A mask for a shared bit: all ones or all zeros */
+func bitMask(s bool) uint64 {
+	if s {
+		return ^uint64(0)
+	}
+	return 0
+}
+
+/* Number of bits needed to index n words */
+func bitsFor(n int) int {
+	b := 0
+	for 1<<uint(b) < n {
+		b++
+	}
+	return b
+}
+
+/*
+Unary(io, index, n) as a vector of n shared bits, computed like
+unaryB, but a level of the tree at a time.  A right child is its
+parent AND the next bit of index, and the left child is the parent
+XOR the right child, so each level takes one batched AND.
+*/
+func unaryV(io Io, index uint64, n int) []bool {
+	level := []bool{Uint1(io, 1)}
+	b := bitsFor(n)
+	for i := b - 1; i >= 0; i-- {
+		width := (n + (1 << uint(i)) - 1) >> uint(i) /* nodes at this level with leaves below n */
+		right := andBitsV(io, level, (index>>uint(i))&1 > 0)
+		next := make([]bool, width)
+		for v := range next {
+			if v%2 == 1 {
+				next[v] = right[v/2]
+			} else {
+				next[v] = xor(level[v/2], right[v/2])
+			}
+		}
+		level = next
+	}
+	return level
+}
+
+//--- Linear scan
+
+type LinearRam struct {
+	elts []uint64
+}
+
+func NewLinearRam(io Io, contents []uint64) *LinearRam {
+	if len(contents) < 1 {
+		panic("NewLinearRam: empty memory")
+	}
+	elts := make([]uint64, len(contents))
+	copy(elts, contents)
+	return &LinearRam{elts}
+}
+
+func (m *LinearRam) Access(io Io, index uint64, update func(uint64) uint64) uint64 {
+	sel := unaryV(io, index, len(m.elts))
+	masks := make([]uint64, len(sel))
+	for j, s := range sel {
+		masks[j] = bitMask(s)
+	}
+	old := TreeXor64(io, AndV64(io, masks, m.elts)...)
+	deltas := make([]uint64, len(sel))
+	d := update(old) ^ old
+	for j := range deltas {
+		deltas[j] = d
+	}
+	for j, x := range AndV64(io, masks, deltas) {
+		m.elts[j] ^= x
+	}
+	return old
+}
+
+//--- Floram
+
+/*
+rom[j] is word j encrypted by XOR with prf(key, j), and is known to
+every party.  Each stash entry records a write: the Unary vector of
+its index, which is needed to fold it in, the index, and the XOR of
+the old and new words, so the current word j is rom[j] decrypted XOR
+the deltas of the stash entries for j.
+*/
+type FloRam struct {
+	n        int
+	rom      []uint64
+	key      []uint32 /* shared round keys */
+	stash    []floramWrite
+	stashMax int
+}
+
+type floramWrite struct {
+	sel          []bool
+	index, delta uint64
+}
+
+func NewFloRam(io Io, contents []uint64) *FloRam {
+	if len(contents) < 1 {
+		panic("NewFloRam: empty memory")
+	}
+	stashMax := 1
+	for stashMax*stashMax < len(contents) {
+		stashMax++
+	}
+	m := &FloRam{n: len(contents), stashMax: stashMax}
+	m.encrypt(io, contents)
+	return m
+}
+
+/* Pick a fresh key and publish contents encrypted under it */
+func (m *FloRam) encrypt(io Io, contents []uint64) {
+	var k [4]uint32
+	for i := range k {
+		k[i] = rand32() /* random shares of a random key */
+	}
+	m.key = simonKeys(io, k)
+	pads := simonV(io, m.key, indexes(io, m.n))
+	for j := range pads {
+		pads[j] ^= contents[j]
+	}
+	m.rom = OpenV64(io, pads)
+}
+
+/* Shares of the public indexes 0..n-1 */
+func indexes(io Io, n int) []uint64 {
+	result := make([]uint64, n)
+	for j := range result {
+		result[j] = Uint64(io, uint64(j))
+	}
+	return result
+}
+
+/* Decrypt the rom, fold in the stash, and encrypt it again under a new key */
+func (m *FloRam) refresh(io Io) {
+	elts := simonV(io, m.key, indexes(io, m.n))
+	for j := range elts {
+		elts[j] ^= Uint64(io, m.rom[j])
+	}
+	masks := make([]uint64, 0, len(m.stash)*m.n)
+	deltas := make([]uint64, 0, len(m.stash)*m.n)
+	for _, w := range m.stash {
+		for _, s := range w.sel {
+			masks = append(masks, bitMask(s))
+			deltas = append(deltas, w.delta)
+		}
+	}
+	for i, x := range AndV64(io, masks, deltas) {
+		elts[i%m.n] ^= x
+	}
+	m.stash = nil
+	m.encrypt(io, elts)
+}
+
+func (m *FloRam) Access(io Io, index uint64, update func(uint64) uint64) uint64 {
+	sel := unaryV(io, index, m.n)
+	/* the rom is public, so selecting from it with shared bits is local */
+	old := uint64(0)
+	for j, s := range sel {
+		if s {
+			old ^= m.rom[j]
+		}
+	}
+	old ^= simonV(io, m.key, []uint64{index})[0]
+	if len(m.stash) > 0 {
+		is := make([]uint64, len(m.stash))
+		for i, w := range m.stash {
+			is[i] = w.index
+		}
+		masks := make([]uint64, len(m.stash))
+		deltas := make([]uint64, len(m.stash))
+		for i, eq := range eqV64(io, is, index) {
+			masks[i] = bitMask(eq)
+			deltas[i] = m.stash[i].delta
+		}
+		old ^= TreeXor64(io, AndV64(io, masks, deltas)...)
+	}
+	m.stash = append(m.stash, floramWrite{sel, index, update(old) ^ old})
+	if len(m.stash) == m.stashMax {
+		m.refresh(io)
+	}
+	return old
+}
+
+//--- Memory for compiled programs
+
+/*
+The ORam used by programs compiled with -oram: "linear", "floram", or
+"auto" to choose by size; it can be overridden with the -oram flag.
+*/
+var ORamKind = "auto"
+
+/* contents are shares of the program's initial memory, as for InitRam */
+func InitMemory(io Io, contents []byte) {
+	words := make([]uint64, (len(contents)+7)/8)
+	for i, c := range contents {
+		words[i/8] |= uint64(c) << uint(8*(i%8))
+	}
+	switch ORamKind {
+	case "auto":
+		io.SetMemory(NewORam(io, words))
+	case "linear":
+		io.SetMemory(NewLinearRam(io, words))
+	case "floram":
+		io.SetMemory(NewFloRam(io, words))
+	default:
+		panic(fmt.Sprintf("InitMemory: unknown ORAM %s", ORamKind))
+	}
+}
+
+/*
+A load (act 1) or store (act 2) of val that does not reveal which it
+is, or where; the result is the loaded value.  Memory is 64-bit words,
+so accesses must be naturally aligned, as the C compiler makes them.
+*/
+func MemAccess(io Io, act uint8, loc uint64, eltsize uint32, val uint32) uint64 {
+	m := io.Memory()
+	if m == nil {
+		panic("MemAccess: memory not initialized")
+	}
+	sh := (loc & 7) << 3 /* bit offset within the word */
+	mask := TreeXor64(io,
+		Mask64(io, Icmp_eq32(io, eltsize, Uint32(io, 1)), Uint64(io, 0xff)),
+		Mask64(io, Icmp_eq32(io, eltsize, Uint32(io, 2)), Uint64(io, 0xffff)),
+		Mask64(io, Icmp_eq32(io, eltsize, Uint32(io, 4)), Uint64(io, 0xffffffff)),
+		Mask64(io, Icmp_eq32(io, eltsize, Uint32(io, 8)), Uint64(io, ^uint64(0))))
+	mask = ShlV64(io, mask, sh)
+	v := ShlV64(io, uint64(val), sh)
+	isStore := Icmp_eq8(io, act, Uint8(io, 2))
+	old := m.Access(io, loc>>3, func(w uint64) uint64 {
+		return Select64(io, isStore, w^And64(io, mask, w^v), w)
+	})
+	return LshrV64(io, And64(io, old, mask), sh)
+}
+
+//--- Simon64/128 as the Floram PRF
+
+/*
+Simon (Beaulieu et al., "The SIMON and SPECK Families of Lightweight
+Block Ciphers," 2013) needs only XOR, rotations and one AND per
+round, and its key schedule is linear, so on XOR shares the only
+interaction is one batched AND per round.
+*/
+const simonRounds = 44
+
+const simonZ3 uint64 = 0x3c2ce51207a635db /* the z3 sequence, bit i is z3[i] */
+
+func rol32(x uint32, k uint) uint32 {
+	return x<<k | x>>(32-k)
+}
+
+/* Expand the shared 128-bit key k into shared round keys */
+func simonKeys(io Io, k [4]uint32) []uint32 {
+	ks := make([]uint32, simonRounds)
+	copy(ks, k[:])
+	for i := 4; i < simonRounds; i++ {
+		tmp := rol32(ks[i-1], 29) ^ ks[i-3]
+		tmp ^= rol32(tmp, 31)
+		ks[i] = ks[i-4] ^ tmp ^ Uint32(io, 0xfffffffc^uint32((simonZ3>>uint((i-4)%62))&1))
+	}
+	return ks
+}
+
+/* Encrypt each of the shared blocks xs under the shared round keys ks */
+func simonV(io Io, ks []uint32, xs []uint64) []uint64 {
+	if len(ks) != simonRounds {
+		panic(fmt.Sprintf("simonV: %d round keys", len(ks)))
+	}
+	x := make([]uint32, len(xs))
+	y := make([]uint32, len(xs))
+	for i, b := range xs {
+		x[i], y[i] = uint32(b>>32), uint32(b)
+	}
+	a := make([]uint32, len(xs))
+	b := make([]uint32, len(xs))
+	for r := 0; r < simonRounds; r++ {
+		for i := range x {
+			a[i] = rol32(x[i], 1)
+			b[i] = rol32(x[i], 8)
+		}
+		f := andV32(io, a, b)
+		for i := range x {
+			x[i], y[i] = y[i]^f[i]^rol32(x[i], 2)^ks[r], x[i]
+		}
+	}
+	result := make([]uint64, len(xs))
+	for i := range result {
+		result[i] = uint64(x[i])<<32 | uint64(y[i])
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+package gmw
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+/*
+Accesses to an ORam made by newORam, on shares of 3 parties, against a
+slice: reads after writes, runs of writes to the same word, and reads
+out of range, which must change nothing
+*/
+func testORam(t *testing.T, n int, newORam func(io Io, contents []uint64) ORam) {
+	rnd := rand.New(rand.NewSource(int64(n)))
+	words := make([]uint64, n)
+	for i := range words {
+		words[i] = rnd.Uint64()
+	}
+	type access struct {
+		write      bool
+		index, val uint64
+	}
+	var accesses []access
+	for i := 0; i < 24; i++ {
+		a := access{rnd.Intn(2) == 0, uint64(rnd.Intn(n)), rnd.Uint64()}
+		switch i % 6 {
+		case 0, 1, 2: /* three writes to the same word, then a read of it */
+			a.write, a.index = true, uint64(i/6%n)
+		case 3:
+			a.write, a.index = false, uint64(i/6%n)
+		case 4: /* out of range, up to the next power of 2 and beyond */
+			a.write, a.index = false, uint64(n+rnd.Intn(2*n))
+		}
+		accesses = append(accesses, a)
+	}
+	simulate(t, 3, func(io Io, errorf func(string, ...interface{})) {
+		contents := make([]uint64, n)
+		for i := range contents {
+			contents[i] = Uint64(io, words[i])
+		}
+		m := newORam(io, contents)
+		want := append([]uint64(nil), words...)
+		for i, a := range accesses {
+			var r uint64
+			if a.write {
+				val := Uint64(io, a.val)
+				r = Reveal64(io, m.Access(io, Uint64(io, a.index), func(uint64) uint64 { return val }))
+			} else {
+				r = Reveal64(io, ORamRead(io, m, Uint64(io, a.index)))
+			}
+			if a.index < uint64(n) && r != want[a.index] {
+				errorf("access %d, %v: got %x, want %x", i, a, r, want[a.index])
+			}
+			if a.write {
+				want[a.index] = a.val
+			}
+		}
+		for i := range want {
+			if r := Reveal64(io, ORamRead(io, m, Uint64(io, uint64(i)))); r != want[i] {
+				errorf("word %d at the end: got %x, want %x", i, r, want[i])
+			}
+		}
+	})
+}
+
+func TestLinearRam(t *testing.T) {
+	for _, n := range []int{1, 5, 20} {
+		testORam(t, n, func(io Io, contents []uint64) ORam { return NewLinearRam(io, contents) })
+	}
+}
+
+func TestFloRam(t *testing.T) {
+	/* 9 words fold in the stash every 3 accesses; Simon makes each access slow */
+	for _, n := range []int{1, 9} {
+		testORam(t, n, func(io Io, contents []uint64) ORam { return NewFloRam(io, contents) })
+	}
+}
+
+/* Simon64/128 test vector from the Simon and Speck paper, on shares of 3 parties */
+func TestSimon(t *testing.T) {
+	var mu sync.Mutex
+	got := map[int]uint64{}
+	Simulation([]uint32{0, 0, 0}, 0, func(io Io, _ []Io) {
+		var k [4]uint32
+		if io.Id() == 0 {
+			k = [4]uint32{0x03020100, 0x0b0a0908, 0x13121110, 0x1b1a1918}
+		}
+		ks := simonKeys(io, k)
+		c := simonV(io, ks, []uint64{Uint64(io, 0x656b696c20646e75), Uint64(io, 0x656b696c20646e75)})
+		r := OpenV64(io, c)
+		mu.Lock()
+		got[io.Id()] = r[0]
+		if r[1] != r[0] {
+			t.Errorf("party %d: batch mismatch", io.Id())
+		}
+		mu.Unlock()
+	})
+	for id, r := range got {
+		if r != 0x44c8fc20b9dfa07a {
+			t.Errorf("party %d: got %x, want 44c8fc20b9dfa07a", id, r)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package gmw
+
+import (
+	"sync"
+)
+
+/*
+A PlainIO runs a program in the clear, as party 0 of n parties whose
+shares are all 0: an Open is the identity, every triple is 0, sends
+are dropped and receives are 0.  Input32 takes the input of any party
+directly from the PlainIO, so a program gets the same inputs as in
+Simulation, and party 0 computes the same answer.
+*/
+type PlainIO struct {
+	*GlobalIO
+	inputs *plainInputs
+}
+
+type plainInputs struct {
+	sync.Mutex
+	parties [][]uint32 /* the inputs of each party */
+}
+
+/* PlainIOs for the main loop and numBlocks blocks; party i has input inputs[i] */
+func NewPlainIOs(inputs []uint32, numBlocks int) (Io, []Io) {
+	numParties := len(inputs)
+	if numParties == 0 {
+		numParties = 2
+	}
+	gio := &GlobalIO{n: numParties}
+	in := &plainInputs{parties: make([][]uint32, numParties)}
+	for i := range inputs {
+		in.parties[i] = inputs[i : i+1]
+	}
+	ios := make([]Io, numBlocks)
+	for i := range ios {
+		ios[i] = &PlainIO{gio, in}
+	}
+	return &PlainIO{gio, in}, ios
+}
+
+/* The next input of party */
+func (x *PlainIO) input(party int) uint32 {
+	x.inputs.Lock()
+	defer x.inputs.Unlock()
+	result := x.inputs.parties[party][0]
+	x.inputs.parties[party] = x.inputs.parties[party][1:]
+	return result
+}
+
+func (x *PlainIO) GetInput() uint32 {
+	return x.input(0)
+}
+
+func (x *PlainIO) Open1(s bool) bool {
+	return s
+}
+
+func (x *PlainIO) Open8(s uint8) uint8 {
+	return s
+}
+
+func (x *PlainIO) Open32(s uint32) uint32 {
+	return s
+}
+
+func (x *PlainIO) Open64(s uint64) uint64 {
+	return s
+}
+
+func (x *PlainIO) Send1(party int, n bool) {
+}
+
+func (x *PlainIO) Send8(party int, n uint8) {
+}
+
+func (x *PlainIO) Send32(party int, n uint32) {
+}
+
+func (x *PlainIO) Send64(party int, n uint64) {
+}
+
+func (x *PlainIO) Receive1(party int) bool {
+	return false
+}
+
+func (x *PlainIO) Receive8(party int) uint8 {
+	return 0
+}
+
+func (x *PlainIO) Receive32(party int) uint32 {
+	return 0
+}
+
+func (x *PlainIO) Receive64(party int) uint64 {
+	return 0
+}
+
+func (x *PlainIO) Triple1() (a, b, c bool) {
+	return false, false, false
+}
+
+func (x *PlainIO) Triple8() (a, b, c uint8) {
+	return 0, 0, 0
+}
+
+func (x *PlainIO) Triple32() (a, b, c uint32) {
+	return 0, 0, 0
+}
+
+func (x *PlainIO) Triple64() (a, b, c uint64) {
+	return 0, 0, 0
+}
+
+func (x *PlainIO) MaskTriple32() (a byte, b, c uint32) {
+	return 0, 0, 0
+}
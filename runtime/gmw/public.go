@@ -0,0 +1,83 @@
+package gmw
+
+/*
+Operations with a public operand c, a value known to every party such
+as a constant of the program, in place of its share Uint32(io, c).  A
+share is a bare integer that cannot say it is public, so the compiler
+calls these when an operand is a literal.  An AND or OR with a public
+value is computed locally, with no triple, and a multiplication by
+one adds only the shifts of x for the 1 bits of c.
+*/
+
+func AndPublic8(io Io, x, c uint8) uint8 {
+	return x & c
+}
+
+func AndPublic32(io Io, x, c uint32) uint32 {
+	return x & c
+}
+
+func AndPublic64(io Io, x, c uint64) uint64 {
+	return x & c
+}
+
+/* x | c = (x &^ c) ^ c, where party 0 adds c */
+func OrPublic8(io Io, x, c uint8) uint8 {
+	return x&^c ^ Uint8(io, c)
+}
+
+func OrPublic32(io Io, x, c uint32) uint32 {
+	return x&^c ^ Uint32(io, c)
+}
+
+func OrPublic64(io Io, x, c uint64) uint64 {
+	return x&^c ^ Uint64(io, c)
+}
+
+func MulPublic8(io Io, x, c uint8) uint8 {
+	result := Uint8(io, 0)
+	first := true
+	for ; c != 0; c, x = c>>1, x<<1 {
+		if c&1 == 0 {
+			continue
+		}
+		if first {
+			result, first = x, false
+		} else {
+			result = Add8(io, result, x)
+		}
+	}
+	return result
+}
+
+func MulPublic32(io Io, x, c uint32) uint32 {
+	result := Uint32(io, 0)
+	first := true
+	for ; c != 0; c, x = c>>1, x<<1 {
+		if c&1 == 0 {
+			continue
+		}
+		if first {
+			result, first = x, false
+		} else {
+			result = Add32(io, result, x)
+		}
+	}
+	return result
+}
+
+func MulPublic64(io Io, x, c uint64) uint64 {
+	result := Uint64(io, 0)
+	first := true
+	for ; c != 0; c, x = c>>1, x<<1 {
+		if c&1 == 0 {
+			continue
+		}
+		if first {
+			result, first = x, false
+		} else {
+			result = Add64(io, result, x)
+		}
+	}
+	return result
+}
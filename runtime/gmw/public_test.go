@@ -0,0 +1,51 @@
+package gmw
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestPublic(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	xs := []uint64{0, 1, ^uint64(0), 0x8000000000000001}
+	for i := 0; i < 6; i++ {
+		xs = append(xs, rnd.Uint64())
+	}
+	var mu sync.Mutex
+	Simulation([]uint32{0, 0, 0}, 0, func(io Io, _ []Io) {
+		errorf := func(format string, args ...interface{}) {
+			if io.Id() == 0 {
+				mu.Lock()
+				t.Errorf(format, args...)
+				mu.Unlock()
+			}
+		}
+		for i, x := range xs {
+			c := xs[(i+3)%len(xs)]
+			/* an AND makes shares that every party holds a part of */
+			a := And64(io, Uint64(io, x), Uint64(io, ^uint64(0)))
+			if r := Reveal64(io, AndPublic64(io, a, c)); r != x&c {
+				errorf("%x & %x: got %x", x, c, r)
+			}
+			if r := Reveal64(io, OrPublic64(io, a, c)); r != x|c {
+				errorf("%x | %x: got %x", x, c, r)
+			}
+			if r := Reveal64(io, MulPublic64(io, a, c)); r != x*c {
+				errorf("%x * %x: got %x", x, c, r)
+			}
+			x32, c32 := uint32(x), uint32(c>>5)
+			a32 := And32(io, Uint32(io, x32), Uint32(io, ^uint32(0)))
+			if r := Reveal32(io, OrPublic32(io, a32, c32)); r != x32|c32 {
+				errorf("%x | %x: got %x", x32, c32, r)
+			}
+			if r := Reveal32(io, MulPublic32(io, a32, c32)); r != x32*c32 {
+				errorf("%x * %x: got %x", x32, c32, r)
+			}
+			x8, c8 := uint8(x), uint8(c>>11)
+			if r := Reveal8(io, MulPublic8(io, Uint8(io, x8), c8)); r != x8*c8 {
+				errorf("%x * %x: got %x", x8, c8, r)
+			}
+		}
+	})
+}
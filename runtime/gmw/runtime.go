@@ -2,8 +2,10 @@ package gmw
 
 import (
 	"bufio"
+	"crypto/ed25519"
 	"flag"
 	"fmt"
+	"github.com/tjim/smpcc/runtime/transport"
 	"os"
 	"runtime/pprof"
 	"strings"
@@ -17,21 +19,31 @@ type MPC struct {
 var Hosts map[int]string = make(map[int]string)
 var Ports map[int]int = make(map[int]int)
 
+/* The public key of each party, from the config file, and this party's private key; see PeerIO.security */
+var PublicKeys map[int]ed25519.PublicKey = make(map[int]ed25519.PublicKey)
+var Key ed25519.PrivateKey
+
 var MpcPrintsChan chan string = make(chan string, 100)
 
 // Read a configuration file, which consists a series lines of the form host:port, on per party, in order.
 // Return maps of hosts and ports, so hosts[i] is the host of party i and ports[i] is its base port.
+// A line may give the party's public key, in hex, after its host:port.
 func ReadConfig(filename string) bool {
 	file, err := os.Open(filename)
 	if err != nil {
 		return false
 	}
 	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanWords)
 	numParties := 0
 	for scanner.Scan() {
-		hostport := scanner.Bytes()
-		parts := strings.Split(string(hostport), ":")
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			panic("ReadConfig: input error")
+		}
+		parts := strings.Split(fields[0], ":")
 		if len(parts) != 2 {
 			panic("ReadConfig: input error")
 		}
@@ -40,6 +52,13 @@ func ReadConfig(filename string) bool {
 		fmt.Sscanf(parts[1], "%d", &port)
 		Hosts[numParties] = host
 		Ports[numParties] = port
+		if len(fields) == 2 {
+			k, err := transport.ParsePublicKey(fields[1])
+			if err != nil {
+				panic(fmt.Sprintf("ReadConfig: %s", err))
+			}
+			PublicKeys[numParties] = k
+		}
 		numParties++
 	}
 	return true
@@ -57,10 +76,17 @@ func Run(numBlocks int, runPeer func(Io, []Io)) {
 	var id int
 	var parties int
 	var config string
+	var cost string
+	var plain bool
+	var keyFile string
 	flag.BoolVar(&do_pprof, "pprof", false, "run for profiling")
 	flag.IntVar(&id, "id", 0, "id of this party")
 	flag.IntVar(&parties, "parties", 0, "number of parties")
 	flag.StringVar(&config, "config", "", "config file")
+	flag.StringVar(&ORamKind, "oram", ORamKind, "memory for programs compiled with -oram: linear, floram or auto")
+	flag.StringVar(&cost, "cost", "", "simulate, and write a report of party 0's triples, opens and traffic to this file, as JSON if it ends in .json")
+	flag.BoolVar(&plain, "plain", false, "run in the clear as party 0, with no cryptography, to check a program's answer")
+	flag.StringVar(&keyFile, "key", "", "secure the connections with TLS, authenticated by this party's private key file, as made by keygen, and the public keys in the -config file")
 	flag.Parse()
 	args := flag.Args()
 	inputs := make([]uint32, len(args))
@@ -78,8 +104,35 @@ func Run(numBlocks int, runPeer func(Io, []Io)) {
 		pprof.StartCPUProfile(f)
 		defer pprof.StopCPUProfile()
 	}
-	if ReadConfig(config) {
+	if keyFile != "" && config == "" {
+		fmt.Println("Error: -key needs a -config file with the public keys of the parties")
+		os.Exit(1)
+	}
+	if plain {
+		io, ios := NewPlainIOs(inputs, numBlocks)
+		runPeer(io, ios)
+	} else if cost != "" {
+		Simulation(inputs, numBlocks, func(io Io, ios []Io) {
+			if io.Id() != 0 {
+				runPeer(io, ios)
+				return
+			}
+			cio, cios, r := NewCostIos(io, ios)
+			runPeer(cio, cios)
+			if err := r.WriteFile(cost); err != nil {
+				fmt.Println("Error: ", err)
+			}
+		})
+	} else if ReadConfig(config) {
 		parties = len(Hosts)
+		if keyFile != "" {
+			k, err := transport.LoadKey(keyFile)
+			if err != nil {
+				fmt.Println("Error: ", err)
+				os.Exit(1)
+			}
+			Key = k
+		}
 		SetupPeer(inputs, numBlocks, parties, id, runPeer)
 	} else if parties == 0 {
 		Simulation(inputs, numBlocks, runPeer)
@@ -0,0 +1,174 @@
+package gmw
+
+import (
+	"fmt"
+	"github.com/tjim/smpcc/runtime/base"
+)
+
+/*
+Oblivious sorting and shuffling of shares, by the networks of
+runtime/base.  The switches applied do not depend on the values, so
+unlike a sort in C through the block machinery, nothing leaks through
+Load and Store.  Each comparator is a comparison and two Masks, and
+the comparators are applied one after another.
+*/
+
+/* Exchange xs[i] and xs[j] if s */
+func exchange32(io Io, s bool, xs []uint32, i, j int) {
+	d := Mask32(io, s, xs[i]^xs[j])
+	xs[i] ^= d
+	xs[j] ^= d
+}
+
+func exchange64(io Io, s bool, xs []uint64, i, j int) {
+	d := Mask64(io, s, xs[i]^xs[j])
+	xs[i] ^= d
+	xs[j] ^= d
+}
+
+/* Put the smaller of the unsigned keys[i] and keys[j] at i; payloads, if not nil, move with the keys */
+func CompareSwap32(io Io, keys, payloads []uint32, i, j int) {
+	s := Icmp_ugt32(io, keys[i], keys[j])
+	exchange32(io, s, keys, i, j)
+	if payloads != nil {
+		exchange32(io, s, payloads, i, j)
+	}
+}
+
+func CompareSwap64(io Io, keys, payloads []uint64, i, j int) {
+	s := Icmp_ugt64(io, keys[i], keys[j])
+	exchange64(io, s, keys, i, j)
+	if payloads != nil {
+		exchange64(io, s, payloads, i, j)
+	}
+}
+
+func checkPayloads(op string, keys, payloads int) {
+	if payloads != 0 && payloads != keys {
+		panic(fmt.Sprintf("%s: %d keys vs %d payloads", op, keys, payloads))
+	}
+}
+
+func OddEvenMergeSort32(io Io, keys, payloads []uint32) {
+	checkPayloads("OddEvenMergeSort32", len(keys), len(payloads))
+	for _, sw := range base.OddEvenMergeNetwork(len(keys)) {
+		CompareSwap32(io, keys, payloads, sw.I, sw.J)
+	}
+}
+
+func OddEvenMergeSort64(io Io, keys, payloads []uint64) {
+	checkPayloads("OddEvenMergeSort64", len(keys), len(payloads))
+	for _, sw := range base.OddEvenMergeNetwork(len(keys)) {
+		CompareSwap64(io, keys, payloads, sw.I, sw.J)
+	}
+}
+
+func BitonicSort32(io Io, keys, payloads []uint32) {
+	checkPayloads("BitonicSort32", len(keys), len(payloads))
+	for _, sw := range base.BitonicNetwork(len(keys)) {
+		CompareSwap32(io, keys, payloads, sw.I, sw.J)
+	}
+}
+
+func BitonicSort64(io Io, keys, payloads []uint64) {
+	checkPayloads("BitonicSort64", len(keys), len(payloads))
+	for _, sw := range base.BitonicNetwork(len(keys)) {
+		CompareSwap64(io, keys, payloads, sw.I, sw.J)
+	}
+}
+
+/* Permute xs by base.WaksmanNetwork(len(xs)), one shared bit of control per switch */
+func Waksman32(io Io, xs []uint32, control []bool) {
+	net := base.WaksmanNetwork(len(xs))
+	if len(control) != len(net) {
+		panic(fmt.Sprintf("Waksman32: %d switches vs %d controls", len(net), len(control)))
+	}
+	for k, sw := range net {
+		exchange32(io, control[k], xs, sw.I, sw.J)
+	}
+}
+
+func Waksman64(io Io, xs []uint64, control []bool) {
+	net := base.WaksmanNetwork(len(xs))
+	if len(control) != len(net) {
+		panic(fmt.Sprintf("Waksman64: %d switches vs %d controls", len(net), len(control)))
+	}
+	for k, sw := range net {
+		exchange64(io, control[k], xs, sw.I, sw.J)
+	}
+}
+
+/*
+Shares of the control bits of a random permutation of n elements
+chosen by party: it holds the bits as its share and the others hold
+false, so no messages are needed.
+*/
+func shuffleControl(io Io, party, n int) []bool {
+	if io.Id() == party {
+		return base.WaksmanControl(base.RandomPermutation(n))
+	}
+	return make([]bool, len(base.WaksmanNetwork(n)))
+}
+
+/*
+Shuffle xs by a random permutation that no party knows, the
+composition of a permutation chosen by each party in turn.
+*/
+func Shuffle32(io Io, xs []uint32) {
+	for p := 0; p < io.N(); p++ {
+		Waksman32(io, xs, shuffleControl(io, p, len(xs)))
+	}
+}
+
+func Shuffle64(io Io, xs []uint64) {
+	for p := 0; p < io.N(); p++ {
+		Waksman64(io, xs, shuffleControl(io, p, len(xs)))
+	}
+}
+
+/* The n 32-bit shares at loc; the address is public, as for Load */
+func loadArray32(io Io, loc uint64, n int) []uint32 {
+	address := int(Reveal64(io, loc))
+	ram := io.Ram()
+	xs := make([]uint32, n)
+	for i := range xs {
+		for j := 0; j < 4; j++ {
+			xs[i] |= uint32(ram[address+4*i+j]) << uint(j*8)
+		}
+	}
+	return xs
+}
+
+func storeArray32(io Io, loc uint64, xs []uint32) {
+	address := int(Reveal64(io, loc))
+	ram := io.Ram()
+	for i := range xs {
+		for j := 0; j < 4; j++ {
+			ram[address+4*i+j] = byte(xs[i] >> uint(j*8))
+		}
+	}
+}
+
+/*
+Sort the n unsigned ints at loc in place, for oblivious_sort of C.
+Like Printf, it does nothing unless mask is true.  The contents of
+memory stay shared, so no party learns the order.
+*/
+func SortMemory(io Io, mask bool, loc uint64, n int) {
+	if !io.Open1(mask) {
+		return
+	}
+	xs := loadArray32(io, loc, n)
+	OddEvenMergeSort32(io, xs, nil)
+	storeArray32(io, loc, xs)
+}
+
+/* Shuffle the n unsigned ints at loc in place, for oblivious_shuffle of C */
+func ShuffleMemory(io Io, mask bool, loc uint64, n int) {
+	if !io.Open1(mask) {
+		return
+	}
+	xs := loadArray32(io, loc, n)
+	Shuffle32(io, xs)
+	storeArray32(io, loc, xs)
+}
@@ -0,0 +1,65 @@
+package gmw
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestSort(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	xs := make([]uint32, 11)
+	for i := range xs {
+		xs[i] = rnd.Uint32()
+		if i%3 == 0 {
+			xs[i] = uint32(rnd.Intn(3)) /* repeats */
+		}
+	}
+	want := append([]uint32{}, xs...)
+	sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+	var mu sync.Mutex
+	Simulation([]uint32{0, 0, 0}, 0, func(io Io, _ []Io) {
+		errorf := func(format string, args ...interface{}) {
+			if io.Id() == 0 {
+				mu.Lock()
+				t.Errorf(format, args...)
+				mu.Unlock()
+			}
+		}
+		/* not a map: every party must run the sorters in the same order */
+		for _, s := range []struct {
+			name   string
+			sorter func(Io, []uint32, []uint32)
+		}{{"odd-even merge", OddEvenMergeSort32}, {"bitonic", BitonicSort32}} {
+			name, sorter := s.name, s.sorter
+			keys := make([]uint32, len(xs))
+			payloads := make([]uint32, len(xs))
+			for i := range xs {
+				keys[i], payloads[i] = Uint32(io, xs[i]), Uint32(io, uint32(i))
+			}
+			sorter(io, keys, payloads)
+			for i := range xs {
+				k, p := Reveal32(io, keys[i]), Reveal32(io, payloads[i])
+				if k != want[i] || xs[p] != k {
+					errorf("%s sort of %v: got key %x payload %d at %d", name, xs, k, p, i)
+				}
+			}
+		}
+		ys := make([]uint64, len(xs))
+		for i := range ys {
+			ys[i] = Uint64(io, uint64(i)<<40|uint64(i))
+		}
+		Shuffle64(io, ys)
+		seen := make([]bool, len(ys))
+		for i := range ys {
+			y := Reveal64(io, ys[i])
+			j := int(y & 0xff)
+			if j >= len(ys) || seen[j] || y != uint64(j)<<40|uint64(j) {
+				errorf("shuffle: got %x at %d", y, i)
+				return
+			}
+			seen[j] = true
+		}
+	})
+}
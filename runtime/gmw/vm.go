@@ -247,7 +247,7 @@ func Icmp_slt64(io Io, a, b uint64) bool {
 }
 
 func Icmp_uge8(io Io, a, b uint8) bool {
-	c := true
+	c := Uint1(io, 1) /* a share of true */
 	for i := uint8(1); i > 0; i = i * 2 {
 		ai := (a & i) > 0
 		bi := (b & i) > 0
@@ -257,7 +257,7 @@ func Icmp_uge8(io Io, a, b uint8) bool {
 }
 
 func Icmp_uge32(io Io, a, b uint32) bool {
-	c := true
+	c := Uint1(io, 1)
 	for i := uint32(1); i > 0; i = i * 2 {
 		ai := (a & i) > 0
 		bi := (b & i) > 0
@@ -267,7 +267,7 @@ func Icmp_uge32(io Io, a, b uint32) bool {
 }
 
 func Icmp_uge64(io Io, a, b uint64) bool {
-	c := true
+	c := Uint1(io, 1)
 	for i := uint64(1); i > 0; i = i * 2 {
 		ai := (a & i) > 0
 		bi := (b & i) > 0
@@ -501,7 +501,137 @@ func Mul64(io Io, a, b uint64) uint64 {
 	return result
 }
 
-/* constant shift left; TODO: variable Shl */
+/*
+Restoring division.  Shifting the next bit of a into the partial
+remainder r can carry out of the top; r >= b if it does.  Division by
+zero gives a quotient of all ones and a remainder of a, so a signed
+division by zero gives -1, or 1 if a is negative.  The most negative
+value divided by -1 wraps around to itself, as in Go.
+*/
+func udivrem8(io Io, a, b uint8) (uint8, uint8) {
+	q := Uint8(io, 0)
+	r := Uint8(io, 0)
+	for i := 7; i >= 0; i-- {
+		carry := (r>>7)&1 > 0
+		r = r<<1 | (a>>uint(i))&1
+		ge := Or1(io, carry, Icmp_uge8(io, r, b))
+		r = Select8(io, ge, Sub8(io, r, b), r)
+		if ge {
+			q |= 1 << uint(i)
+		}
+	}
+	return q, r
+}
+
+func Udiv8(io Io, a, b uint8) uint8 {
+	q, _ := udivrem8(io, a, b)
+	return q
+}
+
+func Urem8(io Io, a, b uint8) uint8 {
+	_, r := udivrem8(io, a, b)
+	return r
+}
+
+func abs8(io Io, a uint8) uint8 {
+	return Select8(io, (a>>7)&1 > 0, Sub8(io, Uint8(io, 0), a), a)
+}
+
+/* signed division truncates toward zero, and the remainder has the sign of the dividend, as in C */
+func Sdiv8(io Io, a, b uint8) uint8 {
+	q, _ := udivrem8(io, abs8(io, a), abs8(io, b))
+	s := xor((a>>7)&1 > 0, (b>>7)&1 > 0)
+	return Select8(io, s, Sub8(io, Uint8(io, 0), q), q)
+}
+
+func Srem8(io Io, a, b uint8) uint8 {
+	_, r := udivrem8(io, abs8(io, a), abs8(io, b))
+	return Select8(io, (a>>7)&1 > 0, Sub8(io, Uint8(io, 0), r), r)
+}
+
+func udivrem32(io Io, a, b uint32) (uint32, uint32) {
+	q := Uint32(io, 0)
+	r := Uint32(io, 0)
+	for i := 31; i >= 0; i-- {
+		carry := (r>>31)&1 > 0
+		r = r<<1 | (a>>uint(i))&1
+		ge := Or1(io, carry, Icmp_uge32(io, r, b))
+		r = Select32(io, ge, Sub32(io, r, b), r)
+		if ge {
+			q |= 1 << uint(i)
+		}
+	}
+	return q, r
+}
+
+func Udiv32(io Io, a, b uint32) uint32 {
+	q, _ := udivrem32(io, a, b)
+	return q
+}
+
+func Urem32(io Io, a, b uint32) uint32 {
+	_, r := udivrem32(io, a, b)
+	return r
+}
+
+func abs32(io Io, a uint32) uint32 {
+	return Select32(io, (a>>31)&1 > 0, Sub32(io, Uint32(io, 0), a), a)
+}
+
+/* signed division truncates toward zero, and the remainder has the sign of the dividend, as in C */
+func Sdiv32(io Io, a, b uint32) uint32 {
+	q, _ := udivrem32(io, abs32(io, a), abs32(io, b))
+	s := xor((a>>31)&1 > 0, (b>>31)&1 > 0)
+	return Select32(io, s, Sub32(io, Uint32(io, 0), q), q)
+}
+
+func Srem32(io Io, a, b uint32) uint32 {
+	_, r := udivrem32(io, abs32(io, a), abs32(io, b))
+	return Select32(io, (a>>31)&1 > 0, Sub32(io, Uint32(io, 0), r), r)
+}
+
+func udivrem64(io Io, a, b uint64) (uint64, uint64) {
+	q := Uint64(io, 0)
+	r := Uint64(io, 0)
+	for i := 63; i >= 0; i-- {
+		carry := (r>>63)&1 > 0
+		r = r<<1 | (a>>uint(i))&1
+		ge := Or1(io, carry, Icmp_uge64(io, r, b))
+		r = Select64(io, ge, Sub64(io, r, b), r)
+		if ge {
+			q |= 1 << uint(i)
+		}
+	}
+	return q, r
+}
+
+func Udiv64(io Io, a, b uint64) uint64 {
+	q, _ := udivrem64(io, a, b)
+	return q
+}
+
+func Urem64(io Io, a, b uint64) uint64 {
+	_, r := udivrem64(io, a, b)
+	return r
+}
+
+func abs64(io Io, a uint64) uint64 {
+	return Select64(io, (a>>63)&1 > 0, Sub64(io, Uint64(io, 0), a), a)
+}
+
+/* signed division truncates toward zero, and the remainder has the sign of the dividend, as in C */
+func Sdiv64(io Io, a, b uint64) uint64 {
+	q, _ := udivrem64(io, abs64(io, a), abs64(io, b))
+	s := xor((a>>63)&1 > 0, (b>>63)&1 > 0)
+	return Select64(io, s, Sub64(io, Uint64(io, 0), q), q)
+}
+
+func Srem64(io Io, a, b uint64) uint64 {
+	_, r := udivrem64(io, abs64(io, a), abs64(io, b))
+	return Select64(io, (a>>63)&1 > 0, Sub64(io, Uint64(io, 0), r), r)
+}
+
+/* constant shift left; see ShlV8 etc. for a variable shift */
 func Shl8(io Io, a uint8, b uint) uint8 {
 	return a << b
 }
@@ -514,7 +644,7 @@ func Shl64(io Io, a uint64, b uint) uint64 {
 	return a << b
 }
 
-/* constant logical shift right; TODO: variable Lshr */
+/* constant logical shift right; see LshrV8 etc. for a variable shift */
 func Lshr8(io Io, a uint8, b uint) uint8 {
 	return a >> b
 }
@@ -527,7 +657,7 @@ func Lshr64(io Io, a uint64, b uint) uint64 {
 	return a >> b
 }
 
-/* constant arithmetic shift right; TODO: variable Ashr */
+/* constant arithmetic shift right; see AshrV8 etc. for a variable shift */
 func Ashr8(io Io, a uint8, b uint) uint8 {
 	return uint8(int8(a) >> b)
 }
@@ -540,6 +670,78 @@ func Ashr64(io Io, a uint64, b uint) uint64 {
 	return uint64(int64(a) >> b)
 }
 
+/*
+Variable shifts, as barrel shifters.  The shares of a and b are
+shifted locally since XOR sharing is linear; each stage k picks a
+shifted by 2^k if bit k of b is set.  Shifting by the bit width or more
+gives 0, or the sign bits for an arithmetic shift.
+*/
+func ShlV8(io Io, a, b uint8) uint8 {
+	for k := uint(0); k < 3; k++ {
+		a = Select8(io, (b>>k)&1 > 0, a<<(1<<k), a)
+	}
+	return Select8(io, Icmp_eq8(io, b>>3, Uint8(io, 0)), a, Uint8(io, 0))
+}
+
+func ShlV32(io Io, a, b uint32) uint32 {
+	for k := uint(0); k < 5; k++ {
+		a = Select32(io, (b>>k)&1 > 0, a<<(1<<k), a)
+	}
+	return Select32(io, Icmp_eq32(io, b>>5, Uint32(io, 0)), a, Uint32(io, 0))
+}
+
+func ShlV64(io Io, a, b uint64) uint64 {
+	for k := uint(0); k < 6; k++ {
+		a = Select64(io, (b>>k)&1 > 0, a<<(1<<k), a)
+	}
+	return Select64(io, Icmp_eq64(io, b>>6, Uint64(io, 0)), a, Uint64(io, 0))
+}
+
+func LshrV8(io Io, a, b uint8) uint8 {
+	for k := uint(0); k < 3; k++ {
+		a = Select8(io, (b>>k)&1 > 0, a>>(1<<k), a)
+	}
+	return Select8(io, Icmp_eq8(io, b>>3, Uint8(io, 0)), a, Uint8(io, 0))
+}
+
+func LshrV32(io Io, a, b uint32) uint32 {
+	for k := uint(0); k < 5; k++ {
+		a = Select32(io, (b>>k)&1 > 0, a>>(1<<k), a)
+	}
+	return Select32(io, Icmp_eq32(io, b>>5, Uint32(io, 0)), a, Uint32(io, 0))
+}
+
+func LshrV64(io Io, a, b uint64) uint64 {
+	for k := uint(0); k < 6; k++ {
+		a = Select64(io, (b>>k)&1 > 0, a>>(1<<k), a)
+	}
+	return Select64(io, Icmp_eq64(io, b>>6, Uint64(io, 0)), a, Uint64(io, 0))
+}
+
+func AshrV8(io Io, a, b uint8) uint8 {
+	sign := Ashr8(io, a, 7)
+	for k := uint(0); k < 3; k++ {
+		a = Select8(io, (b>>k)&1 > 0, Ashr8(io, a, 1<<k), a)
+	}
+	return Select8(io, Icmp_eq8(io, b>>3, Uint8(io, 0)), a, sign)
+}
+
+func AshrV32(io Io, a, b uint32) uint32 {
+	sign := Ashr32(io, a, 31)
+	for k := uint(0); k < 5; k++ {
+		a = Select32(io, (b>>k)&1 > 0, Ashr32(io, a, 1<<k), a)
+	}
+	return Select32(io, Icmp_eq32(io, b>>5, Uint32(io, 0)), a, sign)
+}
+
+func AshrV64(io Io, a, b uint64) uint64 {
+	sign := Ashr64(io, a, 63)
+	for k := uint(0); k < 6; k++ {
+		a = Select64(io, (b>>k)&1 > 0, Ashr64(io, a, 1<<k), a)
+	}
+	return Select64(io, Icmp_eq64(io, b>>6, Uint64(io, 0)), a, sign)
+}
+
 func Mask1(io Io, s bool, a bool) bool {
 	a32 := uint32(0)
 	if a {
@@ -634,6 +836,9 @@ func Input32(io Io, mask bool, party uint32) uint32 {
 	}
 	id := io.Id()
 	party = io.Open32(party)
+	if p, ok := io.(*PlainIO); ok {
+		return p.input(int(party))
+	}
 	if id == int(party) {
 		X := io.GetInput()
 		shares := split_uint32(X, io.N())
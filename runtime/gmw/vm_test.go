@@ -0,0 +1,133 @@
+package gmw
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+/* The parties of a simulation, for tests; errorf reports through party 0 only */
+func simulate(t *testing.T, parties int, f func(io Io, errorf func(format string, args ...interface{}))) {
+	var mu sync.Mutex
+	Simulation(make([]uint32, parties), 0, func(io Io, _ []Io) {
+		f(io, func(format string, args ...interface{}) {
+			if io.Id() == 0 {
+				mu.Lock()
+				t.Errorf(format, args...)
+				mu.Unlock()
+			}
+		})
+	})
+}
+
+/* A carry of true on every party is a share of false when the number of parties is even */
+func TestIcmpUge(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	xs := []uint64{0, 1, 2, 1 << 63, ^uint64(0)}
+	for i := 0; i < 6; i++ {
+		xs = append(xs, rnd.Uint64())
+	}
+	for _, parties := range []int{2, 3} {
+		simulate(t, parties, func(io Io, errorf func(string, ...interface{})) {
+			for _, x := range xs {
+				for _, y := range xs {
+					if r := Reveal1(io, Icmp_uge64(io, Uint64(io, x), Uint64(io, y))); r != (x >= y) {
+						errorf("%d parties: %x >= %x: got %v", parties, x, y, r)
+					}
+					x32, y32 := uint32(x), uint32(y>>32)
+					if r := Reveal1(io, Icmp_ule32(io, Uint32(io, x32), Uint32(io, y32))); r != (x32 <= y32) {
+						errorf("%d parties: %x <= %x: got %v", parties, x32, y32, r)
+					}
+					x8, y8 := uint8(x), uint8(y>>8)
+					if r := Reveal1(io, Icmp_uge8(io, Uint8(io, x8), Uint8(io, y8))); r != (x8 >= y8) {
+						errorf("%d parties: %x >= %x: got %v", parties, x8, y8, r)
+					}
+				}
+			}
+		})
+	}
+}
+
+/* The variable shifts against Go's, which also give 0, or the sign bits, for amounts of the width or more */
+func TestShiftV(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	xs := []uint64{^uint64(0), 1 << 63, rnd.Uint64()}
+	simulate(t, 3, func(io Io, errorf func(string, ...interface{})) {
+		for _, x := range xs {
+			for _, n := range []uint64{8, 32, 64} {
+				for _, s := range []uint64{0, 1, 3, n - 1, n, n + 1, 2*n - 1, ^uint64(0)} {
+					x64, s64 := x, s
+					x32, s32 := uint32(x>>32), uint32(s)
+					x8, s8 := uint8(x>>56), uint8(s)
+					var got, want [3]uint64
+					xn := x >> (64 - n) /* the operand of n bits */
+					switch n {
+					case 8:
+						got = [3]uint64{uint64(Reveal8(io, ShlV8(io, Uint8(io, x8), Uint8(io, s8)))), uint64(Reveal8(io, LshrV8(io, Uint8(io, x8), Uint8(io, s8)))), uint64(Reveal8(io, AshrV8(io, Uint8(io, x8), Uint8(io, s8))))}
+						want = [3]uint64{uint64(x8 << s8), uint64(x8 >> s8), uint64(uint8(int8(x8) >> s8))}
+					case 32:
+						got = [3]uint64{uint64(Reveal32(io, ShlV32(io, Uint32(io, x32), Uint32(io, s32)))), uint64(Reveal32(io, LshrV32(io, Uint32(io, x32), Uint32(io, s32)))), uint64(Reveal32(io, AshrV32(io, Uint32(io, x32), Uint32(io, s32))))}
+						want = [3]uint64{uint64(x32 << s32), uint64(x32 >> s32), uint64(uint32(int32(x32) >> s32))}
+					case 64:
+						got = [3]uint64{Reveal64(io, ShlV64(io, Uint64(io, x64), Uint64(io, s64))), Reveal64(io, LshrV64(io, Uint64(io, x64), Uint64(io, s64))), Reveal64(io, AshrV64(io, Uint64(io, x64), Uint64(io, s64)))}
+						want = [3]uint64{x64 << s64, x64 >> s64, uint64(int64(x64) >> s64)}
+					}
+					for i, name := range []string{"<<", ">>", "signed >>"} {
+						if got[i] != want[i] {
+							errorf("%d bits: %x %s %x: got %x, want %x", n, xn, name, s&(^uint64(0)>>(64-n)), got[i], want[i])
+						}
+					}
+				}
+			}
+		}
+	})
+}
+
+/* The quotient and remainder of n-bit a and b, as Go's operators give them, or as the circuits define them for b = 0 */
+func divRem(a, b uint64, n uint) [4]uint64 {
+	mask := ^uint64(0) >> (64 - n)
+	sa, sb := int64(a<<(64-n))>>(64-n), int64(b<<(64-n))>>(64-n)
+	if b == 0 {
+		sq := int64(-1)
+		if sa < 0 {
+			sq = 1
+		}
+		return [4]uint64{mask, a, uint64(sq) & mask, a}
+	}
+	return [4]uint64{a / b, a % b, uint64(sa/sb) & mask, uint64(sa%sb) & mask}
+}
+
+func TestDiv(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	/* division by 0, the most negative value by -1, and operands of every sign */
+	cases := [][2]uint64{{5 << 56, 0}, {1 << 63, 0}, {1 << 63, ^uint64(0)}, {0xf9 << 56, 3 << 56}, {7 << 56, 0xfd << 56}}
+	for i := 0; i < 3; i++ {
+		cases = append(cases, [2]uint64{rnd.Uint64(), rnd.Uint64() >> uint(i)})
+	}
+	simulate(t, 3, func(io Io, errorf func(string, ...interface{})) {
+		for _, c := range cases {
+			for _, n := range []uint{8, 32, 64} {
+				/* the top n bits, so that each case keeps its signs at every width */
+				a, b := c[0]>>(64-n), c[1]>>(64-n)
+				var got [4]uint64
+				switch n {
+				case 8:
+					x, y := Uint8(io, uint8(a)), Uint8(io, uint8(b))
+					got = [4]uint64{uint64(Reveal8(io, Udiv8(io, x, y))), uint64(Reveal8(io, Urem8(io, x, y))), uint64(Reveal8(io, Sdiv8(io, x, y))), uint64(Reveal8(io, Srem8(io, x, y)))}
+				case 32:
+					x, y := Uint32(io, uint32(a)), Uint32(io, uint32(b))
+					got = [4]uint64{uint64(Reveal32(io, Udiv32(io, x, y))), uint64(Reveal32(io, Urem32(io, x, y))), uint64(Reveal32(io, Sdiv32(io, x, y))), uint64(Reveal32(io, Srem32(io, x, y)))}
+				case 64:
+					x, y := Uint64(io, a), Uint64(io, b)
+					got = [4]uint64{Reveal64(io, Udiv64(io, x, y)), Reveal64(io, Urem64(io, x, y)), Reveal64(io, Sdiv64(io, x, y)), Reveal64(io, Srem64(io, x, y))}
+				}
+				want := divRem(a, b, n)
+				for i, name := range []string{"/", "%", "signed /", "signed %"} {
+					if got[i] != want[i] {
+						errorf("%d bits: %x %s %x: got %x, want %x", n, a, name, b, got[i], want[i])
+					}
+				}
+			}
+		}
+	})
+}
@@ -228,7 +228,7 @@ func (R *ExtendReceiver) ReceiveM(r []byte) []Message { // r is a packed vector
 	for i := range r {
 		for bit := 0; bit < 8; bit++ {
 			selector := Selector((r[i] >> uint(7-bit)) & 1)
-			result[i+bit] = R.Receive(selector)
+			result[8*i+bit] = R.Receive(selector)
 		}
 	}
 	return result
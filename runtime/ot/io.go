@@ -1,16 +1,43 @@
 package ot
 
-import "math/big"
+import (
+	"github.com/tjim/smpcc/runtime/transport"
+	"math/big"
+)
 
+/*
+Over a connection, the client is the base OT receiver: it sends
+NpRecvPk and receives the others.
+*/
 type NPChans struct {
-	ParamChan  chan *big.Int          `fatchan:"reply"`
-	NpRecvPk   chan *big.Int          `fatchan:"request"`
-	NpSendEncs chan HashedElGamalCiph `fatchan:"reply"`
+	ParamChan  chan *big.Int
+	NpRecvPk   chan *big.Int
+	NpSendEncs chan HashedElGamalCiph
 }
 
+/* The number of streams used by NPChans.Bind */
+const NPStreams = 3
+
+/* Carry the channels over conn, on streams id, id+1 and id+2 */
+func (c NPChans) Bind(conn *transport.Conn, id uint32, client bool) {
+	conn.Bind(id, c.ParamChan, !client)
+	conn.Bind(id+1, c.NpRecvPk, client)
+	conn.Bind(id+2, c.NpSendEncs, !client)
+}
+
+/* Over a connection, the client is the extension sender: it sends OtExtChan */
 type ExtChans struct {
-	OtExtChan    chan []byte   `fatchan:"request"`
-	OtExtSelChan chan Selector `fatchan:"reply"`
+	OtExtChan    chan []byte
+	OtExtSelChan chan Selector
+}
+
+/* The number of streams used by ExtChans.Bind */
+const ExtStreams = 2
+
+/* Carry the channels over conn, on streams id and id+1 */
+func (c ExtChans) Bind(conn *transport.Conn, id uint32, client bool) {
+	conn.Bind(id, c.OtExtChan, client)
+	conn.Bind(id+1, c.OtExtSelChan, !client)
 }
 
 func NewOTChansSender(npchans NPChans, extchans ExtChans) Sender {
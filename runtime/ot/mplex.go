@@ -17,13 +17,12 @@ type SendRequest struct {
 
 // Channels needed for multiplex OT to function
 // In gc case, generator is client and sender, evaluator is server and receiver
-// We send an MplexChans from client to server, so fatchan notations are relative to generator/client/sender
 type PerNodePairMplexChans struct {
-	RefreshCh chan int `fatchan:"reply"` // One per SET of multiplexed sender/receiver, receiver->sender
+	RefreshCh chan int // One per SET of multiplexed sender/receiver, receiver->sender
 }
 type PerBlockMplexChans struct {
-	RepCh chan []byte      `fatchan:"request"` // One per sender/receiver pair, sender->receiver
-	ReqCh chan SendRequest `fatchan:"reply"`   // One per sender/receiver pair, receiver->sender
+	RepCh chan []byte      // One per sender/receiver pair, sender->receiver
+	ReqCh chan SendRequest // One per sender/receiver pair, receiver->sender
 }
 
 type MplexSender struct {
@@ -213,7 +212,7 @@ func (R *MplexReceiver) ReceiveM(r []byte) []Message { // r is a packed vector o
 	for i := range r {
 		for bit := 0; bit < 8; bit++ {
 			selector := Selector((r[i] >> uint(7-bit)) & 1)
-			result[i+bit] = R.Receive(selector)
+			result[8*i+bit] = R.Receive(selector)
 		}
 	}
 	return result
@@ -160,7 +160,7 @@ func (R *NPReceiver) ReceiveM(r []byte) []Message { // r is a packed vector of s
 	for i := range r {
 		for bit := 0; bit < 8; bit++ {
 			selector := Selector((r[i] >> uint(7-bit)) & 1)
-			result[i+bit] = R.Receive(selector)
+			result[8*i+bit] = R.Receive(selector)
 		}
 	}
 	return result
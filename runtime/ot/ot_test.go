@@ -321,3 +321,34 @@ func BenchmarkRandomBits(b *testing.B) {
 		<-done
 	}
 }
+
+// ReceiveM with more than one byte of selections
+func TestExtendReceiveM(t *testing.T) {
+	baseSender, baseReceiver := NewNP()
+	OtExtChan := make(chan []byte)
+	OtExtSelChan := make(chan Selector)
+	s := NewExtendSender(OtExtChan, OtExtSelChan, baseReceiver, 80, 1024)
+	r := NewExtendReceiver(OtExtChan, OtExtSelChan, baseSender, 80, 1024)
+
+	a := make([]Message, 24)
+	b := make([]Message, 24)
+	for i := range a {
+		a[i] = []byte{byte(2 * i)}
+		b[i] = []byte{byte(2*i + 1)}
+	}
+	go s.SendM(a, b)
+	sel := []byte{0xaa, 0x0f, 0x81}
+	rslt := r.ReceiveM(sel)
+	if len(rslt) != len(a) {
+		t.Fatalf("expected %d messages, received %d", len(a), len(rslt))
+	}
+	for i, v := range rslt {
+		want := a[i]
+		if sel[i/8]&(0x80>>uint(i%8)) != 0 {
+			want = b[i]
+		}
+		if !bytes.Equal(v, want) {
+			t.Errorf("message %d: expected %v, got %v", i, want, v)
+		}
+	}
+}
@@ -0,0 +1,769 @@
+/*
+Package transport carries the channels of a two-party protocol over a
+single net.Conn, such as a TCP connection, a Unix socket or one end of
+a net.Pipe.  An address is a TCP address or, for a Unix socket,
+unix:path.
+
+Each channel is given a stream number, agreed by the two sides
+without any exchange, and every value sent on a channel travels in a
+frame of its stream.  The receiver queues the frames of each stream
+until they are wanted, so a stream whose reader is busy never holds up
+the others, and a side may send before the other side has set up its
+channels.
+
+# Wire format
+
+All integers are big-endian.  A connection is a sequence of frames:
+
+	stream  uint32
+	length  uint32
+	payload [length]byte
+
+Stream 0 is reserved.  The first frame of each side is a hello on
+stream 0:
+
+	magic   "smpc"
+	version uint16, the highest version the side speaks
+	count   uint16
+	params  count pairs of strings, each a uint16 length and the bytes
+
+The version spoken is the lower of the two versions; a side fails if
+it does not speak it.  The params describe the computation, e.g., the
+protocol and the number of blocks, and a side fails unless both sides
+sent the same params.  The two hellos may be sent at the same time.
+
+Every other frame holds one value sent on a channel.  A value is
+encoded according to its Go type:
+
+	uint8, uint32, int  1, 4 and 8 bytes
+	*big.Int            a sign byte, 0 or 1 for negative, then the magnitude
+	[]byte              the bytes
+	other slices        a uint32 count, then the elements
+	structs             the fields, in order
+
+A *big.Int or []byte inside another value is prefixed by its length,
+as a uint32; the length of the outermost value is the frame's.
+
+A side fails the connection on a frame longer than MaxFrame, or when
+more than MaxQueue bytes of a stream received without a window have
+arrived and not been taken.
+
+After the hellos, a frame on stream 0 returns credit to a stream sent
+with a window (see SendWindow):
+
+	stream  uint32
+	count   uint32, the number of its frames taken by the receiver
+
+With a Security, Dial and Accept first run TLS 1.3 over the
+connection, and the frames travel inside it.
+*/
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Version    = 1
+	MinVersion = 1
+	magic      = "smpc"
+)
+
+/*
+The longest frame a side reads.  The length arrives before anything
+checks the frame, and must not make us allocate up to 4 GiB.
+*/
+var MaxFrame = 64 << 20
+
+/*
+The most bytes of a stream received without a window that may wait
+for the receiver; a stream with one is held back by its sender.
+*/
+var MaxQueue = 256 << 20
+
+/*
+How long the TLS handshake and the exchange of hellos may take, so
+that a peer that connects and says nothing cannot hold us up
+*/
+var HandshakeTimeout = 30 * time.Second
+
+/*
+How long Close waits for the values already taken to be sent, so that
+a peer that stops reading, and returns no credit, cannot hold it up
+*/
+var CloseTimeout = 10 * time.Second
+
+/* The params of a hello, e.g., {"protocol": "gc", "blocks": "8"} */
+type Params map[string]string
+
+type Conn struct {
+	conn net.Conn
+
+	wmu sync.Mutex /* held while writing a frame */
+
+	mu      sync.Mutex
+	streams map[uint32]*stream
+	credits map[uint32]chan bool /* of the streams sent with SendWindow, one per frame in flight */
+	eof     bool
+	gone    chan bool /* closed when eof is set */
+	failed  bool
+
+	pumps   sync.WaitGroup /* the goroutines sending channels */
+	closing chan bool
+	done    chan bool /* closed by Cancel, to end the waits of the pumps */
+}
+
+/* The frames of a stream that have arrived and not been read */
+type stream struct {
+	queue  [][]byte
+	bytes  int        /* in queue */
+	window bool       /* received with ReceiveWindow */
+	closed bool       /* no more frames will arrive */
+	ready  *sync.Cond /* on Conn.mu, signalled when queue or closed changes */
+}
+
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{
+		conn:    conn,
+		streams: make(map[uint32]*stream),
+		credits: make(map[uint32]chan bool),
+		gone:    make(chan bool),
+		closing: make(chan bool),
+		done:    make(chan bool),
+	}
+}
+
+/* The network and address of addr, a TCP address or, with a unix: prefix, a Unix socket */
+func split(addr string) (string, string) {
+	if strings.HasPrefix(addr, "unix:") {
+		return "unix", addr[len("unix:"):]
+	}
+	return "tcp", addr
+}
+
+/* Listen on addr, a TCP address or unix:path */
+func Listen(addr string) (net.Listener, error) {
+	return net.Listen(split(addr))
+}
+
+/*
+Connect to addr, waiting up to 10 seconds for it to start listening;
+if sec is not nil, the connection is secured as the client.
+*/
+func Dial(addr string, sec *Security) (*Conn, error) {
+	network, address := split(addr)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		conn, err := net.Dial(network, address)
+		if err == nil {
+			return Secure(conn, sec, true)
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+/* Accept one connection on listener; if sec is not nil, it is secured as the server */
+func Accept(listener net.Listener, sec *Security) (*Conn, error) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return Secure(conn, sec, false)
+}
+
+/*
+Make a Conn of conn, an open connection, secured as the client if
+client when sec is not nil.  Accept is listener.Accept then Secure.
+*/
+func Secure(conn net.Conn, sec *Security, client bool) (*Conn, error) {
+	if sec == nil {
+		return NewConn(conn), nil
+	}
+	conn, err := sec.Wrap(conn, client)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn), nil
+}
+
+func (c *Conn) writeFrame(id uint32, payload []byte) error {
+	if len(payload) > MaxFrame {
+		return fmt.Errorf("a frame of %d bytes, more than MaxFrame", len(payload))
+	}
+	frame := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint32(frame[0:], id)
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(payload)))
+	copy(frame[8:], payload)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func readFrame(r io.Reader) (uint32, []byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(header[4:])
+	if int64(n) > int64(MaxFrame) {
+		return 0, nil, fmt.Errorf("a frame of %d bytes, more than MaxFrame", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return binary.BigEndian.Uint32(header[0:]), payload, nil
+}
+
+func putString(b *bytes.Buffer, s string) {
+	binary.Write(b, binary.BigEndian, uint16(len(s)))
+	b.WriteString(s)
+}
+
+func getString(b *bytes.Reader) (string, error) {
+	var n uint16
+	if err := binary.Read(b, binary.BigEndian, &n); err != nil {
+		return "", err
+	}
+	s := make([]byte, n)
+	if _, err := io.ReadFull(b, s); err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
+
+func hello(params Params) []byte {
+	var b bytes.Buffer
+	b.WriteString(magic)
+	binary.Write(&b, binary.BigEndian, uint16(Version))
+	binary.Write(&b, binary.BigEndian, uint16(len(params)))
+	for k, v := range params {
+		putString(&b, k)
+		putString(&b, v)
+	}
+	return b.Bytes()
+}
+
+func parseHello(payload []byte) (int, Params, error) {
+	b := bytes.NewReader(payload)
+	m := make([]byte, len(magic))
+	if _, err := io.ReadFull(b, m); err != nil || string(m) != magic {
+		return 0, nil, errors.New("transport: not an smpc connection")
+	}
+	var version, count uint16
+	if err := binary.Read(b, binary.BigEndian, &version); err != nil {
+		return 0, nil, errors.New("transport: bad hello")
+	}
+	if err := binary.Read(b, binary.BigEndian, &count); err != nil {
+		return 0, nil, errors.New("transport: bad hello")
+	}
+	params := make(Params)
+	for i := 0; i < int(count); i++ {
+		k, err := getString(b)
+		if err != nil {
+			return 0, nil, errors.New("transport: bad hello")
+		}
+		v, err := getString(b)
+		if err != nil {
+			return 0, nil, errors.New("transport: bad hello")
+		}
+		params[k] = v
+	}
+	return int(version), params, nil
+}
+
+/*
+Exchange hellos with the other side, check that it speaks our version
+and has the same params, then start delivering frames to the
+channels.  Call it once, before sending or receiving.  It fails if the
+hellos take longer than HandshakeTimeout.
+*/
+func (c *Conn) Handshake(params Params) error {
+	c.conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+	sent := make(chan error, 1)
+	go func() { sent <- c.writeFrame(0, hello(params)) }()
+	id, payload, err := readFrame(c.conn)
+	if err == nil && id != 0 {
+		err = errors.New("transport: expected a hello")
+	}
+	if err != nil {
+		return err
+	}
+	if err := <-sent; err != nil {
+		return err
+	}
+	version, theirs, err := parseHello(payload)
+	if err != nil {
+		return err
+	}
+	if version > Version {
+		version = Version
+	}
+	if version < MinVersion {
+		return fmt.Errorf("transport: the other side speaks version %d, we need at least %d", version, MinVersion)
+	}
+	for k, v := range params {
+		if theirs[k] != v {
+			return fmt.Errorf("transport: %s is %q here but %q on the other side", k, v, theirs[k])
+		}
+	}
+	for k, v := range theirs {
+		if _, ok := params[k]; !ok {
+			return fmt.Errorf("transport: the other side has %s %q, which we do not", k, v)
+		}
+	}
+	go c.read()
+	return nil
+}
+
+/* The stream with number id, which is created if necessary; the caller holds c.mu */
+func (c *Conn) stream(id uint32) *stream {
+	s, ok := c.streams[id]
+	if !ok {
+		s = &stream{closed: c.eof, ready: sync.NewCond(&c.mu)}
+		c.streams[id] = s
+	}
+	return s
+}
+
+/* Queue each frame for its stream, until the connection ends */
+func (c *Conn) read() {
+	for {
+		id, payload, err := readFrame(c.conn)
+		if err == nil && id == 0 {
+			c.credit(payload)
+			continue
+		}
+		c.mu.Lock()
+		if err == nil {
+			s := c.stream(id)
+			if s.window || s.bytes+len(payload) <= MaxQueue {
+				s.queue = append(s.queue, payload)
+				s.bytes += len(payload)
+				s.ready.Signal()
+				c.mu.Unlock()
+				continue
+			}
+			err = fmt.Errorf("stream %d: more than MaxQueue bytes waiting", id)
+		}
+		c.eof = true
+		close(c.gone)
+		for _, s := range c.streams {
+			s.closed = true
+			s.ready.Broadcast()
+		}
+		failed := c.failed
+		c.mu.Unlock()
+		if err != io.EOF && !failed && !c.isClosing() {
+			c.fail(err)
+		}
+		return
+	}
+}
+
+/* The next frame of stream id, or false if there are no more */
+func (c *Conn) next(id uint32) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stream(id)
+	for len(s.queue) == 0 && !s.closed {
+		s.ready.Wait()
+	}
+	if len(s.queue) == 0 {
+		return nil, false
+	}
+	payload := s.queue[0]
+	s.bytes -= len(payload)
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+	return payload, true
+}
+
+func (c *Conn) isClosing() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+Send every value sent on ch, a channel, to the other side on stream
+id, until ch is closed or Close is called.  Call it after Handshake.
+*/
+func (c *Conn) Send(id uint32, ch interface{}) {
+	c.sendChan(id, ch, nil)
+}
+
+/*
+Like Send, but with at most window values sent and not yet taken
+from the channel the other side passed to ReceiveWindow, so that a
+fast sender cannot fill the other side's memory.
+*/
+func (c *Conn) SendWindow(id uint32, ch interface{}, window int) {
+	credits := make(chan bool, window)
+	c.mu.Lock()
+	c.credits[id] = credits
+	c.mu.Unlock()
+	c.sendChan(id, ch, credits)
+}
+
+func (c *Conn) sendChan(id uint32, ch interface{}, credits chan bool) {
+	v := reflect.ValueOf(ch)
+	if v.Kind() != reflect.Chan || id == 0 {
+		panic("transport.Send: not a channel, or stream 0")
+	}
+	c.pumps.Add(1)
+	go func() {
+		defer c.pumps.Done()
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: v},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.closing)},
+		}
+		for {
+			chosen, x, ok := reflect.Select(cases)
+			if chosen == 1 {
+				/* Close was called: send what is left in a buffered channel */
+				for {
+					x, ok := v.TryRecv()
+					if !ok {
+						return
+					}
+					c.send(id, x, credits)
+				}
+			}
+			if !ok {
+				return
+			}
+			c.send(id, x, credits)
+		}
+	}()
+}
+
+func (c *Conn) send(id uint32, x reflect.Value, credits chan bool) {
+	if credits != nil {
+		select {
+		case credits <- true:
+		case <-c.gone:
+			return
+		case <-c.done:
+			return
+		}
+	}
+	var b bytes.Buffer
+	encode(&b, x, true)
+	if err := c.writeFrame(id, b.Bytes()); err != nil {
+		c.mu.Lock()
+		eof := c.eof
+		c.mu.Unlock()
+		if !eof {
+			c.fail(fmt.Errorf("write: %s", err))
+		}
+		/* the other side has gone, and does not want x */
+	}
+}
+
+/*
+End the connection after an error, so that the channels being
+received are closed, and leave the rest to whoever reads them; one
+failed connection must not end a process serving others.
+*/
+func (c *Conn) fail(err error) {
+	c.mu.Lock()
+	failed := c.failed
+	c.failed = true
+	c.mu.Unlock()
+	if !failed {
+		log.Printf("transport: %s", err)
+		c.conn.Close()
+	}
+}
+
+/* Return credit for a frame of stream id, taken by a windowed sender; see SendWindow */
+func (c *Conn) credit(payload []byte) {
+	if len(payload) != 8 {
+		log.Printf("transport: bad credit")
+		return
+	}
+	id := binary.BigEndian.Uint32(payload)
+	n := binary.BigEndian.Uint32(payload[4:])
+	c.mu.Lock()
+	credits := c.credits[id]
+	c.mu.Unlock()
+	for i := uint32(0); i < n && credits != nil; i++ {
+		select {
+		case <-credits:
+		default:
+		}
+	}
+}
+
+/*
+Deliver every value the other side sends on stream id to ch, a
+channel; ch is closed when the connection ends.
+*/
+func (c *Conn) Receive(id uint32, ch interface{}) {
+	c.receiveChan(id, ch, false)
+}
+
+/* Like Receive, for a stream sent with SendWindow */
+func (c *Conn) ReceiveWindow(id uint32, ch interface{}) {
+	c.receiveChan(id, ch, true)
+}
+
+func (c *Conn) receiveChan(id uint32, ch interface{}, window bool) {
+	v := reflect.ValueOf(ch)
+	if v.Kind() != reflect.Chan || id == 0 {
+		panic("transport.Receive: not a channel, or stream 0")
+	}
+	if window {
+		c.mu.Lock()
+		c.stream(id).window = true
+		c.mu.Unlock()
+	}
+	go func() {
+		for {
+			payload, ok := c.next(id)
+			if !ok {
+				v.Close()
+				return
+			}
+			x := reflect.New(v.Type().Elem()).Elem()
+			if err := decode(bytes.NewReader(payload), x, true); err != nil {
+				c.fail(fmt.Errorf("stream %d: %s", id, err))
+				continue
+			}
+			cases := []reflect.SelectCase{
+				{Dir: reflect.SelectSend, Chan: v, Send: x},
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.closing)},
+			}
+			if chosen, _, _ := reflect.Select(cases); chosen == 1 {
+				return
+			}
+			if window {
+				credit := make([]byte, 8)
+				binary.BigEndian.PutUint32(credit, id)
+				binary.BigEndian.PutUint32(credit[4:], 1)
+				c.writeFrame(0, credit) /* an error here is the sender's problem */
+			}
+		}
+	}()
+}
+
+/* Send ch on stream id if send, or else receive it */
+func (c *Conn) Bind(id uint32, ch interface{}, send bool) {
+	if send {
+		c.Send(id, ch)
+	} else {
+		c.Receive(id, ch)
+	}
+}
+
+/* Like Bind, with SendWindow and ReceiveWindow */
+func (c *Conn) BindWindow(id uint32, ch interface{}, send bool, window int) {
+	if send {
+		c.SendWindow(id, ch, window)
+	} else {
+		c.ReceiveWindow(id, ch)
+	}
+}
+
+/*
+Write every value already taken from a channel passed to Send, or
+waiting in its buffer, then close the connection.  What is not written
+within CloseTimeout is dropped, as by Cancel.
+*/
+func (c *Conn) Close() error {
+	close(c.closing)
+	sent := make(chan bool)
+	go func() {
+		c.pumps.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(CloseTimeout):
+		c.Cancel()
+		<-sent
+	}
+	return c.conn.Close()
+}
+
+/*
+End the connection at once, as if it had failed, without sending what
+is waiting: the channels being received are closed and whatever is
+sent is dropped, so that nothing waits on the connection any longer.
+Close must still be called.
+*/
+func (c *Conn) Cancel() {
+	c.mu.Lock()
+	c.failed = true
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	c.mu.Unlock()
+	c.conn.Close()
+}
+
+var bigIntType = reflect.TypeOf((*big.Int)(nil))
+
+func encode(b *bytes.Buffer, x reflect.Value, top bool) {
+	if x.Type() == bigIntType {
+		n := x.Interface().(*big.Int)
+		sign := byte(0)
+		if n.Sign() < 0 {
+			sign = 1
+		}
+		mag := n.Bytes()
+		if !top {
+			binary.Write(b, binary.BigEndian, uint32(1+len(mag)))
+		}
+		b.WriteByte(sign)
+		b.Write(mag)
+		return
+	}
+	switch x.Kind() {
+	case reflect.Uint8:
+		b.WriteByte(uint8(x.Uint()))
+	case reflect.Uint32:
+		binary.Write(b, binary.BigEndian, uint32(x.Uint()))
+	case reflect.Int:
+		binary.Write(b, binary.BigEndian, x.Int())
+	case reflect.Slice:
+		if x.Type().Elem().Kind() == reflect.Uint8 {
+			if !top {
+				binary.Write(b, binary.BigEndian, uint32(x.Len()))
+			}
+			b.Write(x.Bytes())
+			return
+		}
+		binary.Write(b, binary.BigEndian, uint32(x.Len()))
+		for i := 0; i < x.Len(); i++ {
+			encode(b, x.Index(i), false)
+		}
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			encode(b, x.Field(i), false)
+		}
+	default:
+		panic(fmt.Sprintf("transport: cannot send a %s", x.Type()))
+	}
+}
+
+/* Read a length and that many bytes */
+func decodeBytes(r *bytes.Reader) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if int64(n) > int64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	result := make([]byte, n)
+	_, err := io.ReadFull(r, result)
+	return result, err
+}
+
+/* Decode into x, which must be settable */
+func decode(r *bytes.Reader, x reflect.Value, top bool) error {
+	if x.Type() == bigIntType {
+		var data []byte
+		if top {
+			data = make([]byte, r.Len())
+			io.ReadFull(r, data)
+		} else {
+			var err error
+			if data, err = decodeBytes(r); err != nil {
+				return err
+			}
+		}
+		if len(data) == 0 {
+			return errors.New("bad big.Int")
+		}
+		n := new(big.Int).SetBytes(data[1:])
+		if data[0] == 1 {
+			n.Neg(n)
+		}
+		x.Set(reflect.ValueOf(n))
+		return nil
+	}
+	switch x.Kind() {
+	case reflect.Uint8:
+		v, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		x.SetUint(uint64(v))
+	case reflect.Uint32:
+		var v uint32
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return err
+		}
+		x.SetUint(uint64(v))
+	case reflect.Int:
+		var v int64
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return err
+		}
+		x.SetInt(v)
+	case reflect.Slice:
+		if x.Type().Elem().Kind() == reflect.Uint8 {
+			var data []byte
+			if top {
+				data = make([]byte, r.Len())
+				io.ReadFull(r, data)
+			} else {
+				var err error
+				if data, err = decodeBytes(r); err != nil {
+					return err
+				}
+			}
+			x.SetBytes(data)
+			return nil
+		}
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return err
+		}
+		if int64(n) > int64(r.Len()) {
+			return io.ErrUnexpectedEOF
+		}
+		x.Set(reflect.MakeSlice(x.Type(), int(n), int(n)))
+		for i := 0; i < int(n); i++ {
+			if err := decode(r, x.Index(i), false); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			if err := decode(r, x.Field(i), false); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot receive a %s", x.Type())
+	}
+	if top && r.Len() != 0 {
+		return errors.New("frame too long")
+	}
+	return nil
+}
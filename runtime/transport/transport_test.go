@@ -0,0 +1,276 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type pair struct {
+	N  *big.Int
+	M  []byte
+	S  uint8
+	Ms [][]byte
+}
+
+func handshake(p0, p1 Params) (*Conn, *Conn, error, error) {
+	a, b := net.Pipe()
+	c0, c1 := NewConn(a), NewConn(b)
+	errs := make(chan error)
+	go func() { errs <- c1.Handshake(p1) }()
+	err0 := c0.Handshake(p0)
+	return c0, c1, err0, <-errs
+}
+
+func TestHandshake(t *testing.T) {
+	_, _, err0, err1 := handshake(Params{"protocol": "gc", "blocks": "3"}, Params{"protocol": "gc", "blocks": "4"})
+	if err0 == nil || err1 == nil {
+		t.Fatalf("mismatched params accepted: %v, %v", err0, err1)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	c0, c1, err0, err1 := handshake(Params{"protocol": "test"}, Params{"protocol": "test"})
+	if err0 != nil || err1 != nil {
+		t.Fatal(err0, err1)
+	}
+	/* Stream 2 is sent first but read last, which must not hold up stream 1 */
+	in1, out1 := make(chan pair), make(chan pair)
+	in2, out2 := make(chan uint32, 10), make(chan uint32)
+	c0.Send(1, in1)
+	c0.Send(2, in2)
+	c1.Receive(1, out1)
+	c1.Receive(2, out2)
+	for i := 0; i < 10; i++ {
+		in2 <- uint32(i)
+	}
+	want := pair{big.NewInt(-12345), []byte{1, 2, 3}, 7, [][]byte{{4}, {}, {5, 6}}}
+	in1 <- want
+	got := <-out1
+	if got.N.Cmp(want.N) != 0 || !bytes.Equal(got.M, want.M) || got.S != want.S || len(got.Ms) != 3 || !bytes.Equal(got.Ms[2], want.Ms[2]) {
+		t.Fatalf("sent %v, received %v", want, got)
+	}
+	for i := 0; i < 10; i++ {
+		if x := <-out2; x != uint32(i) {
+			t.Fatalf("received %d, expected %d", x, i)
+		}
+	}
+	c0.Close()
+	if _, ok := <-out2; ok {
+		t.Fatal("channel not closed at the end of the connection")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	c0, c1, err0, err1 := handshake(Params{"protocol": "test"}, Params{"protocol": "test"})
+	if err0 != nil || err1 != nil {
+		t.Fatal(err0, err1)
+	}
+	in, out := make(chan uint32, 10), make(chan uint32)
+	c0.SendWindow(1, in, 2)
+	c1.ReceiveWindow(1, out)
+	for i := 0; i < 10; i++ {
+		in <- uint32(i)
+	}
+	/* Two values in flight, and one taken by the sender waiting for credit */
+	time.Sleep(100 * time.Millisecond)
+	if len(in) != 7 {
+		t.Fatalf("%d values sent with a window of 2", 10-len(in))
+	}
+	for i := 0; i < 10; i++ {
+		if x := <-out; x != uint32(i) {
+			t.Fatalf("received %d, expected %d", x, i)
+		}
+	}
+	c0.Close()
+}
+
+func TestUnix(t *testing.T) {
+	addr := "unix:" + filepath.Join(t.TempDir(), "sock")
+	listener, err := Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		c, err := Accept(listener, nil)
+		if err != nil || c.Handshake(Params{"protocol": "test"}) != nil {
+			return
+		}
+		in := make(chan []byte, 1)
+		c.Send(1, in)
+		in <- []byte("hello")
+		c.Close()
+	}()
+	c, err := Dial(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Handshake(Params{"protocol": "test"}); err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan []byte)
+	c.Receive(1, out)
+	if got := <-out; string(got) != "hello" {
+		t.Fatalf("received %q", got)
+	}
+}
+
+func TestSecurity(t *testing.T) {
+	pub0, key0, _ := ed25519.GenerateKey(nil)
+	pub1, key1, _ := ed25519.GenerateKey(nil)
+	_, other, _ := ed25519.GenerateKey(nil)
+	listener, err := Listen("unix:" + filepath.Join(t.TempDir(), "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	/* A socket, not a net.Pipe: in TLS 1.3 the client may finish before the server rejects it, and nobody reads the alert */
+	secure := func(s0, s1 *Security) (error, error) {
+		errs := make(chan error)
+		go func() {
+			c, err := Accept(listener, s1)
+			if err == nil {
+				c.conn.Close()
+			}
+			errs <- err
+		}()
+		c, err := Dial(listener.Addr().Network()+":"+listener.Addr().String(), s0)
+		if err == nil {
+			defer c.conn.Close()
+		}
+		return err, <-errs
+	}
+	if err0, err1 := secure(&Security{key0, pub1}, &Security{key1, pub0}); err0 != nil || err1 != nil {
+		t.Fatal(err0, err1)
+	}
+	if err0, err1 := secure(&Security{other, pub1}, &Security{key1, pub0}); err0 == nil && err1 == nil {
+		t.Fatal("accepted a client with the wrong key")
+	}
+	if err0, err1 := secure(&Security{key0, pub1}, &Security{other, pub0}); err0 == nil && err1 == nil {
+		t.Fatal("accepted a server with the wrong key")
+	}
+}
+
+func TestMaxFrame(t *testing.T) {
+	c0, c1, err0, err1 := handshake(Params{"protocol": "test"}, Params{"protocol": "test"})
+	if err0 != nil || err1 != nil {
+		t.Fatal(err0, err1)
+	}
+	out := make(chan []byte)
+	c1.Receive(1, out)
+	/* The header of a frame of 4 GiB - 1, which must fail the connection, not be read */
+	go c0.conn.Write([]byte{0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff})
+	if _, ok := <-out; ok {
+		t.Fatal("received a frame longer than MaxFrame")
+	}
+	if err := c0.writeFrame(1, make([]byte, MaxFrame+1)); err == nil {
+		t.Fatal("sent a frame longer than MaxFrame")
+	}
+	c0.conn.Close()
+}
+
+func TestMaxQueue(t *testing.T) {
+	defer func(n int) { MaxQueue = n }(MaxQueue)
+	MaxQueue = 100
+	c0, c1, err0, err1 := handshake(Params{"protocol": "test"}, Params{"protocol": "test"})
+	if err0 != nil || err1 != nil {
+		t.Fatal(err0, err1)
+	}
+	/* Stream 1 is never read; past 100 bytes waiting the connection fails, and ends stream 2 */
+	in := make(chan []byte, 10)
+	c0.Send(1, in)
+	out := make(chan []byte)
+	c1.Receive(2, out)
+	for i := 0; i < 10; i++ {
+		in <- make([]byte, 20)
+	}
+	if _, ok := <-out; ok {
+		t.Fatal("received a frame on stream 2, which was not sent")
+	}
+	/* A stream received with a window is held back by its sender instead */
+	c0, c1, err0, err1 = handshake(Params{"protocol": "test"}, Params{"protocol": "test"})
+	if err0 != nil || err1 != nil {
+		t.Fatal(err0, err1)
+	}
+	in = make(chan []byte, 10)
+	c0.SendWindow(1, in, 8)
+	w := make(chan []byte)
+	c1.ReceiveWindow(1, w)
+	for i := 0; i < 10; i++ {
+		in <- make([]byte, 20)
+	}
+	for i := 0; i < 10; i++ {
+		if x := <-w; len(x) != 20 {
+			t.Fatalf("received %d bytes, expected 20", len(x))
+		}
+	}
+	c0.Close()
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	defer func(d time.Duration) { HandshakeTimeout = d }(HandshakeTimeout)
+	HandshakeTimeout = 50 * time.Millisecond
+	/* The other ends of the pipes are never read or written */
+	a, _ := net.Pipe()
+	if err := NewConn(a).Handshake(Params{"protocol": "test"}); err == nil {
+		t.Fatal("a handshake with a silent peer succeeded")
+	}
+	_, key, _ := ed25519.GenerateKey(nil)
+	pub, _, _ := ed25519.GenerateKey(nil)
+	a, _ = net.Pipe()
+	if _, err := Secure(a, &Security{key, pub}, false); err == nil {
+		t.Fatal("a TLS handshake with a silent peer succeeded")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	c0, c1, err0, err1 := handshake(Params{"protocol": "test"}, Params{"protocol": "test"})
+	if err0 != nil || err1 != nil {
+		t.Fatal(err0, err1)
+	}
+	/* c1 waits on stream 1, which c0 never sends, until c1 gives up */
+	out := make(chan []byte)
+	c1.Receive(1, out)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		c1.Cancel()
+	}()
+	if _, ok := <-out; ok {
+		t.Fatal("received a frame on stream 1, which was not sent")
+	}
+	c1.Close()
+	c0.Close()
+}
+
+func TestCloseTimeout(t *testing.T) {
+	defer func(d time.Duration) { CloseTimeout = d }(CloseTimeout)
+	CloseTimeout = 50 * time.Millisecond
+	c0, c1, err0, err1 := handshake(Params{"protocol": "test"}, Params{"protocol": "test"})
+	if err0 != nil || err1 != nil {
+		t.Fatal(err0, err1)
+	}
+	/* c1 never takes from out, so no credit comes back once c0 has sent a window's worth */
+	in, out := make(chan uint32, 10), make(chan uint32)
+	c0.SendWindow(1, in, 2)
+	c1.ReceiveWindow(1, out)
+	for i := 0; i < 10; i++ {
+		in <- uint32(i)
+	}
+	closed := make(chan bool)
+	go func() {
+		c0.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for credit from a peer that never reads")
+	}
+	c1.Close()
+}